@@ -0,0 +1,410 @@
+// Package agent provides direct execution of learned action triggers.
+//
+// A learned action ("when I say deploy, run make deploy") is bound to one of:
+//   - a tool call:    tool:file_list path=./src  or  tool:bash {"command": "make"}
+//   - a stored plan:  plan:<id, id prefix or intent>
+//   - a shell snippet: shell:make deploy, $ make deploy or `make deploy`
+//   - a phrase handled by the direct execution patterns ("list ./src")
+//
+// Anything else is left to the model, which still sees the action in its
+// memory context. Shell commands, destructive actions and triggers matched
+// despite a typo wait for the user to confirm.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+	"github.com/flynn-ai/flynn/internal/planlib"
+	"github.com/flynn-ai/flynn/internal/subagent"
+)
+
+// pendingActionTTL is how long an action waits for confirmation.
+const pendingActionTTL = 5 * time.Minute
+
+// Kinds of bound action.
+const (
+	boundStep = "step" // Subagent action
+	boundTool = "tool" // Tool registry call
+	boundPlan = "plan" // Stored plan
+)
+
+// boundAction is a learned action resolved to something runnable.
+type boundAction struct {
+	kind     string
+	trigger  string
+	label    string // Shown to the user
+	subagent string
+	tool     string // Tool name or subagent action
+	input    map[string]any
+	plan     *planlib.Plan
+	caution  string // Why the action waits for confirmation; empty runs it unasked
+	learned  bool   // Bound from a learned trigger, which running it reinforces
+}
+
+// Reasons an action waits for confirmation.
+const (
+	cautionDestructive = "can change or delete things"
+	cautionShell       = "runs in your shell"
+)
+
+// pendingAction is an action waiting for confirmation.
+type pendingAction struct {
+	action  *boundAction
+	expires time.Time
+}
+
+// destructiveSteps lists subagent actions that change or remove state.
+var destructiveSteps = map[string]bool{
+	"file.write": true, "file.delete": true, "file.move": true,
+	"system.close_app": true, "system.net_download": true, "system.schedule_run": true,
+	"task.delete": true, "code.git_op": true, "code.refactor": true, "code.format": true,
+}
+
+// destructiveTools lists registry tools that change or remove state. bash
+// always asks, since no list of commands covers what a shell can do.
+var destructiveTools = map[string]bool{
+	"file_write": true, "file_delete": true, "code_git_op": true, "system_kill": true,
+}
+
+var (
+	toolArgRegex = regexp.MustCompile(`(\w+)=("[^"]*"|'[^']*'|\S+)`)
+	confirmReply = regexp.MustCompile(`^(y|yes|yep|yeah|confirm|confirmed|do it|go ahead|run it|proceed|ok,? (do|run) it)[.!]?$`)
+	cancelReply  = regexp.MustCompile(`^(n|no|nope|cancel|stop|abort|don'?t|never ?mind)[.!]?$`)
+)
+
+// tryLearnedAction runs the learned action whose trigger matches the
+// message. Shell commands, destructive actions and actions whose trigger
+// only roughly matches are held until the user confirms. Returns nil when
+// no trigger matches or the action cannot run without the model.
+func (h *HeadAgent) tryLearnedAction(ctx context.Context, message string) *DirectExecution {
+	if exec := h.resolvePendingAction(ctx, message); exec != nil {
+		return exec
+	}
+	if h.memoryStore == nil {
+		return nil
+	}
+
+	match, err := h.memoryStore.MatchAction(ctx, message)
+	if err != nil || match == nil {
+		return nil
+	}
+	action := h.bindAction(ctx, match)
+	if action == nil {
+		return nil
+	}
+
+	if action.caution != "" || !match.Exact() {
+		lead := ""
+		if !match.Exact() {
+			lead = fmt.Sprintf("Taking that as %q. ", action.trigger)
+		}
+		return &DirectExecution{Message: h.holdAction(action, lead), Tool: "confirm"}
+	}
+	return h.runBoundAction(ctx, action, false)
+}
+
+// holdAction keeps an action until the user confirms it and returns the
+// question to ask, prefixed with lead.
+func (h *HeadAgent) holdAction(a *boundAction, lead string) string {
+	h.actionMu.Lock()
+	h.pendingAction = &pendingAction{action: a, expires: time.Now().Add(pendingActionTTL)}
+	h.actionMu.Unlock()
+	prompt := fmt.Sprintf("%q runs %s.", a.trigger, a.label)
+	if a.caution != "" {
+		prompt = fmt.Sprintf("%q runs %s, which %s.", a.trigger, a.label, a.caution)
+	}
+	return lead + prompt + ` Reply "yes" to run it or "no" to cancel.`
+}
+
+// resolvePendingAction handles the reply to a confirmation prompt. Any
+// other message drops the pending action.
+func (h *HeadAgent) resolvePendingAction(ctx context.Context, message string) *DirectExecution {
+	h.actionMu.Lock()
+	pending := h.pendingAction
+	h.pendingAction = nil
+	h.actionMu.Unlock()
+
+	if pending == nil || time.Now().After(pending.expires) {
+		return nil
+	}
+	reply := strings.ToLower(strings.TrimSpace(message))
+	switch {
+	case confirmReply.MatchString(reply):
+		return h.runBoundAction(ctx, pending.action, true)
+	case cancelReply.MatchString(reply):
+		return &DirectExecution{Message: fmt.Sprintf("Cancelled %s.", pending.action.label), Tool: "confirm"}
+	default:
+		return nil
+	}
+}
+
+// bindAction resolves a learned action's text to a runnable action.
+func (h *HeadAgent) bindAction(ctx context.Context, match *memory.ActionMatch) *boundAction {
+	text := strings.TrimSpace(match.Action)
+	lower := strings.ToLower(text)
+	a := &boundAction{trigger: match.Trigger, learned: true}
+
+	switch {
+	case strings.HasPrefix(lower, "plan:"):
+		if h.planExecutor == nil {
+			return nil
+		}
+		stored := h.findPlan(ctx, strings.TrimSpace(text[len("plan:"):]))
+		if stored == nil {
+			return nil
+		}
+		// A trigger carries no variables; plans that need them go to the model
+		plan, err := planlib.Instantiate(stored, nil)
+		if err != nil {
+			return nil
+		}
+		plan.ID = stored.ID
+		a.kind, a.plan = boundPlan, plan
+		a.label = "the saved plan " + planLabel(plan)
+		if planDestructive(plan) {
+			a.caution = cautionDestructive
+		}
+		return a
+
+	case strings.HasPrefix(lower, "tool:"):
+		name, args, _ := strings.Cut(strings.TrimSpace(text[len("tool:"):]), " ")
+		input, err := parseToolArgs(args)
+		if err != nil || h.tools == nil {
+			return nil
+		}
+		a.kind, a.tool, a.input = boundTool, name, input
+		a.label = "the " + name + " tool"
+		if destructiveTools[name] {
+			a.caution = cautionDestructive
+		}
+		if name == "bash" {
+			if command, ok := input["command"].(string); ok {
+				a.label = fmt.Sprintf("`%s`", command)
+			}
+			a.caution = cautionShell
+		}
+		return a
+	}
+
+	if command, ok := shellSnippet(text); ok {
+		return h.bindShell(a, command)
+	}
+	if step := matchDirectStep(lower, h.tenantID); step != nil && h.subagentReg != nil {
+		a.kind, a.subagent, a.tool, a.input = boundStep, step.Subagent, step.Action, step.Input
+		a.label = fmt.Sprintf("%s %s", step.Subagent, step.Action)
+		if destructiveSteps[step.Subagent+"."+step.Action] {
+			a.caution = cautionDestructive
+		}
+		return a
+	}
+	return nil
+}
+
+func (h *HeadAgent) bindShell(a *boundAction, command string) *boundAction {
+	if h.tools == nil || command == "" {
+		return nil
+	}
+	a.kind, a.tool = boundTool, "bash"
+	a.input = map[string]any{"command": command}
+	a.label = fmt.Sprintf("`%s`", command)
+	a.caution = cautionShell
+	return a
+}
+
+// runBoundAction executes an action without a model call.
+func (h *HeadAgent) runBoundAction(ctx context.Context, a *boundAction, confirmed bool) *DirectExecution {
+	start := time.Now()
+	execution := &ToolExecution{Tool: a.tool, Action: a.kind, Input: a.input}
+
+	var message string
+	switch a.kind {
+	case boundPlan:
+		plan := a.plan
+		if confirmed {
+			plan = confirmPlan(plan)
+		}
+		exec, err := h.planExecutor.Execute(ctx, h.tenantID, plan, nil)
+		if err != nil {
+			return &DirectExecution{Message: fmt.Sprintf("Error running %s: %v", a.label, err), Tool: "plan"}
+		}
+		execution.Tool, execution.Output = plan.ID, exec
+		message = formatPlanRun(plan, exec)
+		if exec.Status != "completed" {
+			message = fmt.Sprintf("%s did not complete (%s).\n\n%s", a.label, exec.Status, message)
+		}
+
+	case boundTool:
+		result, err := h.tools.Execute(ctx, a.tool, a.input)
+		if err != nil {
+			return &DirectExecution{Message: fmt.Sprintf("Error: %v", err), Tool: a.tool}
+		}
+		if !result.Success {
+			return &DirectExecution{Message: fmt.Sprintf("Error: %s", result.Error), Tool: a.tool}
+		}
+		h.trackFiles(a.input)
+		execution.Output = result.Data
+		message = formatToolOutput(result.Data)
+		if out, ok := result.Data.(map[string]any); ok && a.tool == "bash" {
+			// Show the command's own output rather than the result map
+			message, _ = out["output"].(string)
+			if failed, _ := out["error"].(string); failed != "" {
+				message = fmt.Sprintf("Command failed: %s\n%s", failed, message)
+			}
+		}
+
+	case boundStep:
+		sub, ok := h.subagentReg.Get(a.subagent)
+		if !ok {
+			return &DirectExecution{Message: fmt.Sprintf("%s agent not available.", a.subagent)}
+		}
+		input := a.input
+		if confirmed {
+			input = withConfirm(input)
+		}
+		result, err := sub.Execute(ctx, &subagent.PlanStep{ID: 1, Subagent: a.subagent, Action: a.tool, Input: input, Timeout: 30})
+		if err != nil {
+			return &DirectExecution{Message: fmt.Sprintf("Error: %v", err), Tool: a.subagent}
+		}
+		if !result.Success {
+			return &DirectExecution{Message: fmt.Sprintf("Error: %s", result.Error), Tool: a.subagent}
+		}
+		h.trackFiles(input)
+		execution.Tool, execution.Action, execution.Output = a.subagent, a.tool, result.Data
+		message = formatToolResult(result)
+	}
+
+	execution.DurationMs = time.Since(start).Milliseconds()
+	if strings.TrimSpace(message) == "" {
+		message = "Done."
+	}
+	// Reinforced on the next turn unless the user corrects it
+	if a.learned {
+		h.noteRecalled([]memory.MemoryEntry{{Type: "action", Trigger: a.trigger}})
+	}
+	return &DirectExecution{
+		Message:   fmt.Sprintf("Ran %s for %q.\n\n%s", a.label, a.trigger, message),
+		Execution: execution,
+		Tool:      execution.Tool,
+	}
+}
+
+// findPlan looks a plan up by ID, unique ID prefix or intent.
+func (h *HeadAgent) findPlan(ctx context.Context, ref string) *planlib.Plan {
+	if ref == "" {
+		return nil
+	}
+	if plan, err := h.planLibrary.GetByID(ctx, h.tenantID, ref); err == nil {
+		return plan
+	}
+	if plan, err := h.planLibrary.GetByIntent(ctx, h.tenantID, ref); err == nil {
+		return plan
+	}
+	plans, err := h.planLibrary.List(ctx, h.tenantID)
+	if err != nil {
+		return nil
+	}
+	var found *planlib.Plan
+	for _, p := range plans {
+		if strings.HasPrefix(p.ID, ref) || strings.EqualFold(p.Description, ref) {
+			if found != nil {
+				return nil // Ambiguous
+			}
+			found = p
+		}
+	}
+	return found
+}
+
+// planDestructive reports whether any step of a plan changes or removes
+// state. Steps are checked by subagent action and by the registry tool of
+// the same name, "<subagent>_<action>".
+func planDestructive(plan *planlib.Plan) bool {
+	for _, step := range plan.Steps {
+		if destructiveSteps[step.Subagent+"."+step.Action] || destructiveTools[step.Subagent+"_"+step.Action] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDirectStep resolves a phrase with the direct execution patterns.
+func matchDirectStep(msg, tenantID string) *subagent.PlanStep {
+	if m := matchFileOperation(msg); m != nil {
+		return &subagent.PlanStep{Subagent: "file", Action: m.Action, Input: buildFileInput(m)}
+	}
+	if m := matchSystemOperation(msg); m != nil {
+		return &subagent.PlanStep{Subagent: "system", Action: m.Action, Input: buildSystemInput(m)}
+	}
+	if m := matchTaskOperation(msg); m != nil {
+		return &subagent.PlanStep{Subagent: "task", Action: m.Action, Input: buildTaskInput(m)}
+	}
+	if m := matchGraphOperation(msg); m != nil {
+		return &subagent.PlanStep{Subagent: "graph", Action: m.Action, Input: buildGraphInput(m, tenantID)}
+	}
+	return nil
+}
+
+// shellSnippet returns the command of an explicitly marked shell snippet.
+// Unmarked text is never run as a command, even when it starts with a
+// program on PATH.
+func shellSnippet(text string) (string, bool) {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(lower, "shell:"):
+		return strings.TrimSpace(text[len("shell:"):]), true
+	case strings.HasPrefix(text, "$ "):
+		return strings.TrimSpace(text[2:]), true
+	case len(text) > 2 && strings.HasPrefix(text, "`") && strings.HasSuffix(text, "`"):
+		return strings.Trim(text, "`"), true
+	}
+	return "", false
+}
+
+// parseToolArgs parses a JSON object or key=value pairs.
+func parseToolArgs(args string) (map[string]any, error) {
+	args = strings.TrimSpace(args)
+	input := make(map[string]any)
+	if strings.HasPrefix(args, "{") {
+		if err := json.Unmarshal([]byte(args), &input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	}
+	for _, m := range toolArgRegex.FindAllStringSubmatch(args, -1) {
+		input[m[1]] = strings.Trim(m[2], `"'`)
+	}
+	return input, nil
+}
+
+func planLabel(plan *planlib.Plan) string {
+	if plan.Description != "" {
+		return fmt.Sprintf("%q", plan.Description)
+	}
+	return fmt.Sprintf("%q", plan.Intent)
+}
+
+// confirmPlan returns a copy of the plan whose steps carry confirm=true.
+func confirmPlan(plan *planlib.Plan) *planlib.Plan {
+	confirmed := *plan
+	confirmed.Steps = make([]planlib.PlanStep, len(plan.Steps))
+	for i, step := range plan.Steps {
+		step.Input = withConfirm(step.Input)
+		confirmed.Steps[i] = step
+	}
+	return &confirmed
+}
+
+func withConfirm(input map[string]any) map[string]any {
+	out := make(map[string]any, len(input)+1)
+	for k, v := range input {
+		out[k] = v
+	}
+	out["confirm"] = true
+	return out
+}
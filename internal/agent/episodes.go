@@ -0,0 +1,129 @@
+// Package agent provides conversation sessions and their episodic memory.
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// DefaultEpisodeIdle is how long a conversation may sit idle before the
+// next message starts a new one.
+const DefaultEpisodeIdle = 30 * time.Minute
+
+// episodeTimeout bounds summarizing a conversation in the background.
+const episodeTimeout = 30 * time.Second
+
+// fileInputKeys are tool input keys that name files.
+var fileInputKeys = []string{"path", "file", "file_path", "dest", "source"}
+
+// conversation is the session in progress, summarized into an episode
+// when it ends.
+type conversation struct {
+	id        string
+	startedAt time.Time
+	lastAt    time.Time
+	turns     []memory.EpisodeTurn
+	files     []string
+}
+
+// currentConversation returns the conversation in progress, starting a
+// new one if there is none or the last has been idle too long. The idle
+// conversation is summarized in the background. Callers hold sessionMu.
+func (h *HeadAgent) currentConversation(now time.Time) *conversation {
+	if h.session != nil && now.Sub(h.session.lastAt) > h.episodeIdle {
+		finished := h.session
+		h.session = nil
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), episodeTimeout)
+			defer cancel()
+			_, _ = h.recordEpisode(ctx, finished)
+		}()
+	}
+	if h.session == nil {
+		h.session = &conversation{id: generateID(), startedAt: now}
+	}
+	h.session.lastAt = now
+	return h.session
+}
+
+// conversationID returns the ID messages of the current conversation are
+// stored under.
+func (h *HeadAgent) conversationID() string {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	return h.currentConversation(time.Now()).id
+}
+
+// trackTurn adds an exchange to the current conversation.
+func (h *HeadAgent) trackTurn(userMsg, assistantMsg string) {
+	if h.episodes == nil {
+		return
+	}
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	c := h.currentConversation(time.Now())
+	c.turns = append(c.turns, memory.EpisodeTurn{User: userMsg, Assistant: assistantMsg})
+}
+
+// trackFiles records file paths named in a tool input.
+func (h *HeadAgent) trackFiles(input map[string]any) {
+	if h.episodes == nil {
+		return
+	}
+	var paths []string
+	for _, key := range fileInputKeys {
+		if p, ok := input[key].(string); ok && strings.TrimSpace(p) != "" {
+			paths = append(paths, cleanPath(p))
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	c := h.currentConversation(time.Now())
+	for _, p := range paths {
+		seen := false
+		for _, existing := range c.files {
+			if existing == p {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			c.files = append(c.files, p)
+		}
+	}
+}
+
+// EndConversation summarizes the current conversation into an episodic
+// memory and starts a fresh one. Call it when the user exits or clears
+// the session. It returns nil when there was nothing worth remembering.
+func (h *HeadAgent) EndConversation(ctx context.Context) (*memory.Episode, error) {
+	h.sessionMu.Lock()
+	finished := h.session
+	h.session = nil
+	h.sessionMu.Unlock()
+
+	if finished == nil {
+		return nil, nil
+	}
+	return h.recordEpisode(ctx, finished)
+}
+
+func (h *HeadAgent) recordEpisode(ctx context.Context, c *conversation) (*memory.Episode, error) {
+	if h.episodes == nil {
+		return nil, nil
+	}
+	return h.episodes.Record(ctx, &memory.Transcript{
+		ConversationID: c.id,
+		Turns:          c.turns,
+		Files:          c.files,
+		StartedAt:      c.startedAt,
+		EndedAt:        c.lastAt,
+	})
+}
@@ -1,9 +1,8 @@
 // Package agent provides the Head Agent - Flynn's main orchestrator.
 //
 // This is a simplified single-agent architecture:
-// - No intent classification
-// - No plan library
 // - Direct subagent execution via pattern matching
+// - Intent classification to replay learned plans (no cloud call)
 // - Strong system prompt with capabilities
 // - Streaming responses
 package agent
@@ -22,10 +21,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/flynn-ai/flynn/internal/classifier"
 	apperrors "github.com/flynn-ai/flynn/internal/errors"
 	"github.com/flynn-ai/flynn/internal/graph"
 	"github.com/flynn-ai/flynn/internal/memory"
 	"github.com/flynn-ai/flynn/internal/model"
+	"github.com/flynn-ai/flynn/internal/planlib"
 	"github.com/flynn-ai/flynn/internal/prompt"
 	"github.com/flynn-ai/flynn/internal/stats"
 	"github.com/flynn-ai/flynn/internal/subagent"
@@ -46,11 +47,32 @@ type HeadAgent struct {
 	memoryRouter    *memory.MemoryRouter
 	memoryExtractor *memory.LLMExtractor
 	memoryRetrieval *memory.EnhancedMemoryStore // Enhanced retrieval
+	memoryTokens    int                         // Prompt budget for recalled memories
+	episodes        *memory.EpisodeStore        // Conversation summaries
+	episodeIdle     time.Duration
 	promptBuilder   *prompt.Builder
+	planLibrary     *planlib.PlanLibrary
+	planExecutor    *planlib.Executor
+	planLearner     *planlib.Learner
+	planThreshold   float64
+	classifier      *classifier.Classifier
 	teamDB          *sql.DB
 	personalDB      *sql.DB
 	stats           *stats.Collector // Statistics tracking
 
+	// Conversation in progress, summarized into an episode when it ends
+	session   *conversation
+	sessionMu sync.Mutex
+
+	// Destructive learned action waiting for the user to confirm
+	pendingAction *pendingAction
+	actionMu      sync.Mutex
+
+	// Memories used for this turn and the last, reinforced unless corrected
+	recalled             []recalledMemory
+	awaitingConfirmation []recalledMemory
+	recallMu             sync.Mutex
+
 	// Streaming support
 	streamWriter io.Writer
 	streamMux    sync.Mutex
@@ -73,7 +95,13 @@ type Config struct {
 	MemoryStore     *memory.MemoryStore
 	MemoryRouter    *memory.MemoryRouter
 	MemoryExtractor *memory.LLMExtractor
+	MemoryTokens    int           // Prompt budget for recalled memories (default memory.DefaultContextTokens)
+	EpisodeIdle     time.Duration // Idle time that ends a conversation (default DefaultEpisodeIdle)
 	PromptBuilder   *prompt.Builder
+	PlanLibrary     *planlib.PlanLibrary   // Optional: replay learned plans
+	PlanLearner     *planlib.Learner       // Optional: learn plans from tool calls
+	PlanThreshold   float64                // Min plan match confidence (default planlib.DefaultMinConfidence)
+	Classifier      *classifier.Classifier // Defaults to rule-based only
 	TeamDB          *sql.DB
 	PersonalDB      *sql.DB
 }
@@ -91,7 +119,13 @@ func NewHeadAgent(cfg *Config) *HeadAgent {
 		memoryStore:     cfg.MemoryStore,
 		memoryRouter:    cfg.MemoryRouter,
 		memoryExtractor: cfg.MemoryExtractor,
+		memoryTokens:    cfg.MemoryTokens,
+		episodeIdle:     cfg.EpisodeIdle,
 		promptBuilder:   cfg.PromptBuilder,
+		planLibrary:     cfg.PlanLibrary,
+		planLearner:     cfg.PlanLearner,
+		planThreshold:   cfg.PlanThreshold,
+		classifier:      cfg.Classifier,
 		teamDB:          cfg.TeamDB,
 		personalDB:      cfg.PersonalDB,
 		stats:           stats.NewCollector(),
@@ -100,6 +134,24 @@ func NewHeadAgent(cfg *Config) *HeadAgent {
 	// Initialize enhanced memory retrieval
 	if cfg.MemoryStore != nil && cfg.PersonalDB != nil {
 		agent.memoryRetrieval = memory.NewEnhancedMemoryStore(cfg.MemoryStore, cfg.PersonalDB)
+		if cfg.TeamDB != nil {
+			agent.memoryRetrieval.SetTeamDB(cfg.TeamDB, cfg.TenantID)
+		}
+		agent.episodes = memory.NewEpisodeStore(cfg.PersonalDB, cfg.Model)
+	}
+	if agent.memoryTokens <= 0 {
+		agent.memoryTokens = memory.DefaultContextTokens
+	}
+	if agent.episodeIdle <= 0 {
+		agent.episodeIdle = DefaultEpisodeIdle
+	}
+
+	// Plan reuse needs a classifier; rule-based patterns are free and instant
+	if cfg.PlanLibrary != nil && cfg.Subagents != nil {
+		if agent.classifier == nil {
+			agent.classifier = classifier.NewClassifier(nil)
+		}
+		agent.planExecutor = planlib.NewExecutor(cfg.PlanLibrary, cfg.Subagents, nil)
 	}
 
 	return agent
@@ -116,7 +168,20 @@ func (h *HeadAgent) SetStreamWriter(w io.Writer) {
 func (h *HeadAgent) Process(ctx context.Context, message string, threadMode ThreadMode) (*Response, error) {
 	startTime := time.Now()
 
-	// Step 1: Check for direct subagent execution patterns
+	// Step 1: Run a learned "when I say X, do Y" action (no model call)
+	if exec := h.tryLearnedAction(ctx, message); exec != nil {
+		resp := &Response{
+			Message:    exec.Message,
+			Execution:  exec.Execution,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			Tier:       int(model.TierRules),
+			ToolUsed:   exec.Tool,
+		}
+		h.recordConversation(ctx, message, resp.Message, threadMode)
+		return resp, nil
+	}
+
+	// Step 1a: Check for direct subagent execution patterns
 	directStart := time.Now()
 	if exec := h.tryDirectExecution(ctx, message); exec != nil {
 		resp := &Response{
@@ -130,6 +195,20 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 	}
 	directDuration := time.Since(directStart)
 
+	// Step 1b: Reuse a learned plan for this intent (no model call)
+	intent := h.classifyIntent(ctx, message)
+	if run := h.tryPlanExecution(ctx, message, intent); run != nil {
+		resp := &Response{
+			Message:    run.Message,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			Tier:       int(model.TierRules),
+			UsedPlan:   true,
+			PlanID:     run.PlanID,
+		}
+		h.recordConversation(ctx, message, resp.Message, threadMode)
+		return resp, nil
+	}
+
 	// Step 2: Build context for the LLM (with short timeout for DB operations)
 	// Create a separate context with short timeout just for context building
 	contextStart := time.Now()
@@ -160,7 +239,7 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 	})
 
 	systemPrompt := h.cachedSystemPrompt
-	userPrompt := h.buildUserPromptWithTimeout(contextCtx, message)
+	userPrompt := h.buildUserPromptWithTimeout(contextCtx, message, threadMode)
 	contextCancel()
 
 	// Debug: Log prompts (only on first request or if file doesn't exist)
@@ -241,7 +320,7 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 
 	if len(toolCalls) > 0 {
 		// Execute tool calls
-		toolResults := h.executeToolCalls(ctx, toolCalls)
+		toolResults, trace := h.executeToolCallsWithTrace(ctx, toolCalls)
 
 		// Feed results back to LLM for final response
 		// IMPORTANT: Don't pass tools here - we want a text response, not more tool calls
@@ -264,6 +343,13 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 			}, nil
 		}
 
+		// Learn a reusable plan from the session (non-blocking)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			h.learnPlan(ctx, message, intent, trace)
+		}()
+
 		response := &Response{
 			Message:    finalResp.Text,
 			DurationMs: time.Since(startTime).Milliseconds(),
@@ -272,14 +358,6 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 		return response, nil
 	}
 
-	// Step 5: Extract memory facts from conversation (non-blocking)
-	// We don't want memory errors to affect the response
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		h.ingestMemory(ctx, message, resp.Text)
-	}()
-
 	response := &Response{
 		Message:    resp.Text,
 		DurationMs: time.Since(startTime).Milliseconds(),
@@ -287,6 +365,7 @@ func (h *HeadAgent) Process(ctx context.Context, message string, threadMode Thre
 		TokensUsed: resp.TokensUsed,
 	}
 
+	// Step 5: Store the conversation and extract memory facts linked to it
 	h.recordConversation(ctx, message, resp.Text, threadMode)
 	return response, nil
 }
@@ -563,6 +642,7 @@ func (h *HeadAgent) executeFileOperation(ctx context.Context, op *FileOp) *Direc
 	if !result.Success {
 		return &DirectExecution{Message: fmt.Sprintf("Error: %s", result.Error)}
 	}
+	h.trackFiles(input)
 
 	return &DirectExecution{
 		Message: formatToolResult(result),
@@ -753,11 +833,11 @@ Everything else requires tool usage.`
 	})
 }
 
-func (h *HeadAgent) buildUserPrompt(message string, ctx context.Context) string {
+func (h *HeadAgent) buildUserPrompt(message string, ctx context.Context, mode ThreadMode) string {
 	var parts []string
 
 	// Add memory context if relevant
-	if memCtx := h.buildMemoryContext(ctx, message); memCtx != "" && memCtx != "None." {
+	if memCtx := h.buildMemoryContext(ctx, message, mode); memCtx != "" && memCtx != "None." {
 		parts = append(parts, fmt.Sprintf("## Memory Context\n%s", memCtx))
 	}
 
@@ -774,14 +854,14 @@ func (h *HeadAgent) buildUserPrompt(message string, ctx context.Context) string
 
 // buildUserPromptWithTimeout builds the user prompt with context timeouts to prevent hanging.
 // If context building takes too long, it skips that context and continues.
-func (h *HeadAgent) buildUserPromptWithTimeout(ctx context.Context, message string) string {
+func (h *HeadAgent) buildUserPromptWithTimeout(ctx context.Context, message string, mode ThreadMode) string {
 	var parts []string
 	var memCtx, graphCtx string
 
 	// Get memory context with timeout
 	doneCh := make(chan string, 1)
 	go func() {
-		doneCh <- h.buildMemoryContext(ctx, message)
+		doneCh <- h.buildMemoryContext(ctx, message, mode)
 	}()
 	select {
 	case memCtx = <-doneCh:
@@ -917,20 +997,27 @@ func (h *HeadAgent) buildWorkspaceContext() string {
 	return ""
 }
 
-func (h *HeadAgent) buildMemoryContext(ctx context.Context, message string) string {
+// buildMemoryContext renders memories relevant to message. Team threads
+// also draw on the tenant's team memory.
+func (h *HeadAgent) buildMemoryContext(ctx context.Context, message string, mode ThreadMode) string {
 	if h.memoryStore == nil {
 		return "None."
 	}
 
 	// Try enhanced retrieval first (keyword-based relevance)
 	if h.memoryRetrieval != nil {
-		memories, err := h.memoryRetrieval.RetrieveRelevant(ctx, message, 8)
+		retrieve, render := h.memoryRetrieval.RetrieveRelevant, h.memoryRetrieval.RetrieveContext
+		if mode == ThreadModeTeam {
+			retrieve, render = h.memoryRetrieval.RetrieveTeamRelevant, h.memoryRetrieval.RetrieveTeamContext
+		}
+		memories, err := retrieve(ctx, message, 8)
 		if err == nil && len(memories) > 0 {
 			// Check if any memory has meaningful relevance
 			for _, m := range memories {
 				if m.Score >= 0.3 { // Minimum threshold for relevance
-					ctx, _ := h.memoryRetrieval.RetrieveSemantic(ctx, message, 8)
+					ctx, _ := render(ctx, message, 8, h.memoryTokens)
 					if ctx != "" {
+						h.noteRecalled(memories)
 						return ctx
 					}
 					break
@@ -1011,44 +1098,16 @@ func (h *HeadAgent) extractMemoryFromResponse(userMsg, assistantResp string) []m
 	return facts
 }
 
-// ingestMemory processes and stores memory facts.
-func (h *HeadAgent) ingestMemory(ctx context.Context, userMsg, assistantResp string) {
+// ingestMemory processes and stores memory facts. messageID identifies the
+// stored user message so each fact can be traced back to it. Facts already
+// known are reinforced; conflicting ones lower the stored confidence.
+// Memories used for the previous answer are reinforced unless this message
+// corrected them.
+func (h *HeadAgent) ingestMemory(ctx context.Context, userMsg, assistantResp, messageID string) {
 	facts := h.extractMemoryFromResponse(userMsg, assistantResp)
-
-	if len(facts) == 0 {
-		return
-	}
-
-	// Store each fact
-	stored := 0
-	for _, fact := range facts {
-		switch fact.Type {
-		case "profile":
-			if fact.Field != "" && fact.Value != "" {
-				// Check if we should skip (no overwrite and existing value)
-				if !fact.Overwrite {
-					if existing, _ := h.memoryStore.GetProfileField(ctx, fact.Field); existing != "" {
-						continue
-					}
-				}
-				if err := h.memoryStore.UpsertProfileField(ctx, fact.Field, fact.Value, fact.Confidence); err == nil {
-					stored++
-				}
-			}
-		case "action":
-			if fact.Trigger != "" && fact.Action != "" {
-				// Check if we should skip
-				if !fact.Overwrite {
-					if existing, _ := h.memoryStore.GetAction(ctx, fact.Trigger); existing != "" {
-						continue
-					}
-				}
-				if err := h.memoryStore.UpsertAction(ctx, fact.Trigger, fact.Action, fact.Confidence); err == nil {
-					stored++
-				}
-			}
-		}
-	}
+	prov := memory.Provenance{MessageID: messageID, Snippet: userMsg}
+	stored, corrected := h.observeFacts(ctx, facts, prov)
+	h.settleRecalled(ctx, corrected)
 
 	if stored > 0 {
 		fmt.Fprintf(os.Stderr, "[MEMORY] Stored %d new facts\n", stored)
@@ -1056,28 +1115,36 @@ func (h *HeadAgent) ingestMemory(ctx context.Context, userMsg, assistantResp str
 }
 
 func (h *HeadAgent) ingestMemoryFacts(ctx context.Context, facts []memory.MemoryFact) {
+	h.observeFacts(ctx, facts, memory.Provenance{})
+}
+
+// observeFacts records facts with the memory lifecycle. It returns how many
+// were stored or changed and which memories they contradicted.
+func (h *HeadAgent) observeFacts(ctx context.Context, facts []memory.MemoryFact, prov memory.Provenance) (int, map[string]bool) {
+	stored := 0
+	corrected := map[string]bool{}
 	for _, fact := range facts {
-		switch fact.Type {
-		case "profile":
-			if fact.Field != "" && fact.Value != "" {
-				if !fact.Overwrite {
-					if existing, _ := h.memoryStore.GetProfileField(ctx, fact.Field); existing != "" {
-						continue
-					}
-				}
-				_ = h.memoryStore.UpsertProfileField(ctx, fact.Field, fact.Value, fact.Confidence)
-			}
-		case "action":
-			if fact.Trigger != "" && fact.Action != "" {
-				if !fact.Overwrite {
-					if existing, _ := h.memoryStore.GetAction(ctx, fact.Trigger); existing != "" {
-						continue
-					}
-				}
-				_ = h.memoryStore.UpsertAction(ctx, fact.Trigger, fact.Action, fact.Confidence)
-			}
+		key := recalledMemory{kind: fact.Type, key: fact.Field}
+		if fact.Type == "action" {
+			key.key = fact.Trigger
+		}
+		if fact.Type != "profile" && fact.Type != "action" || key.key == "" {
+			continue
+		}
+		prov.Source = fact.Source
+		outcome, err := h.memoryStore.Observe(ctx, fact, prov)
+		if err != nil {
+			continue
+		}
+		switch outcome {
+		case memory.FactAdded, memory.FactReplaced:
+			stored++
+		}
+		if outcome == memory.FactReplaced || outcome == memory.FactContradicted {
+			corrected[key.id()] = true
 		}
 	}
+	return stored, corrected
 }
 
 // ============================================================
@@ -1085,7 +1152,8 @@ func (h *HeadAgent) ingestMemoryFacts(ctx context.Context, facts []memory.Memory
 // ============================================================
 
 func (h *HeadAgent) recordConversation(ctx context.Context, userMsg, assistantMsg string, mode ThreadMode) {
-	if err := h.storeConversation(ctx, userMsg, nil, mode); err != nil {
+	messageID, err := h.storeConversation(ctx, userMsg, nil, mode)
+	if err != nil {
 		// Log but don't fail
 	}
 	if h.graphIngestor != nil {
@@ -1093,8 +1161,9 @@ func (h *HeadAgent) recordConversation(ctx context.Context, userMsg, assistantMs
 		h.ingestConversation(ctx, assistantMsg, "assistant", mode)
 	}
 	if h.memoryStore != nil {
-		h.ingestMemory(ctx, userMsg, assistantMsg)
+		h.ingestMemory(ctx, userMsg, assistantMsg, messageID)
 	}
+	h.trackTurn(userMsg, assistantMsg)
 }
 
 func (h *HeadAgent) ingestConversation(ctx context.Context, content string, role string, mode ThreadMode) {
@@ -1109,7 +1178,8 @@ func (h *HeadAgent) ingestConversation(ctx context.Context, content string, role
 	_, _ = h.graphIngestor.IngestText(ctx, h.tenantID, source, title, content)
 }
 
-func (h *HeadAgent) storeConversation(ctx context.Context, message string, execution any, mode ThreadMode) error {
+// storeConversation records the user message and returns its ID.
+func (h *HeadAgent) storeConversation(ctx context.Context, message string, execution any, mode ThreadMode) (string, error) {
 	db := h.personalDB
 	msgTable := "messages"
 	convTable := "conversations"
@@ -1120,7 +1190,7 @@ func (h *HeadAgent) storeConversation(ctx context.Context, message string, execu
 		convTable = "team_conversations"
 	}
 
-	conversationID := generateID()
+	conversationID := h.conversationID()
 	messageID := generateID()
 	now := time.Now().Unix()
 
@@ -1130,14 +1200,14 @@ func (h *HeadAgent) storeConversation(ctx context.Context, message string, execu
 			VALUES (?, ?, ?, ?)
 		`, conversationID, h.tenantID, now, now)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		_, err = db.ExecContext(ctx, `
 			INSERT INTO `+msgTable+` (id, tenant_id, conversation_id, user_id, role, content, tokens_used, cost, tier, created_at)
 			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`, messageID, h.tenantID, conversationID, h.userID, "user", message, 0, 0, 0, now)
-		return err
+		return messageID, err
 	}
 
 	_, err := db.ExecContext(ctx, `
@@ -1145,14 +1215,14 @@ func (h *HeadAgent) storeConversation(ctx context.Context, message string, execu
 		VALUES (?, ?, ?, ?)
 	`, conversationID, h.userID, now, now)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	_, err = db.ExecContext(ctx, `
 		INSERT INTO `+msgTable+` (id, conversation_id, role, content, tier, tokens_used, cost, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`, messageID, conversationID, "user", message, 0, 0, 0, now)
-	return err
+	return messageID, err
 }
 
 // ============================================================
@@ -1216,23 +1286,18 @@ func (h *HeadAgent) ConsolidateMemory(ctx context.Context, daysThreshold int) (i
 	return h.memoryRetrieval.ConsolidateOldMemories(ctx, daysThreshold)
 }
 
-// ForgetMemory removes a specific memory by field or trigger.
+// ForgetMemory removes a specific memory by field or trigger, including its
+// version history.
 func (h *HeadAgent) ForgetMemory(ctx context.Context, memType, key string) error {
 	if h.memoryStore == nil {
 		return fmt.Errorf("memory store not available")
 	}
-
-	if memType == "profile" {
-		// Delete profile field
-		_, err := h.personalDB.ExecContext(ctx, `DELETE FROM memory_profile WHERE field = ?`, key)
-		return err
-	} else if memType == "action" {
-		// Delete action trigger
-		_, err := h.personalDB.ExecContext(ctx, `DELETE FROM memory_actions WHERE trigger = ?`, key)
-		return err
+	if memType != memory.KindProfile && memType != memory.KindAction {
+		return fmt.Errorf("unknown memory type: %s", memType)
 	}
 
-	return fmt.Errorf("unknown memory type: %s", memType)
+	_, err := memory.NewMemoryManager(h.personalDB, nil, h.tenantID).ForgetKey(ctx, memType, key)
+	return err
 }
 
 // ============================================================
@@ -1248,6 +1313,8 @@ type Response struct {
 	TokensUsed    int            `json:"tokens_used"`
 	ToolUsed      string         `json:"tool_used,omitempty"`
 	ToolsExecuted []ToolCallInfo `json:"tools_executed,omitempty"`
+	UsedPlan      bool           `json:"used_plan"`
+	PlanID        string         `json:"plan_id,omitempty"`
 }
 
 // ToolCallInfo represents info about an executed tool.
@@ -1554,7 +1621,11 @@ func (h *HeadAgent) executeToolCall(ctx context.Context, tc *ToolCall) (*subagen
 		Timeout:  30,
 	}
 
-	return sub.Execute(ctx, step)
+	result, err := sub.Execute(ctx, step)
+	if err == nil && result != nil && result.Success {
+		h.trackFiles(input)
+	}
+	return result, err
 }
 
 // executeToolCallsParallel executes multiple tool calls in parallel and aggregates results.
@@ -1642,6 +1713,12 @@ func (h *HeadAgent) executeToolCallsParallelWithInfo(ctx context.Context, toolCa
 
 // executeToolCalls executes tool calls using the tool registry.
 func (h *HeadAgent) executeToolCalls(ctx context.Context, toolCalls []model.ToolCall) string {
+	result, _ := h.executeToolCallsWithTrace(ctx, toolCalls)
+	return result
+}
+
+// executeToolCallsWithTrace executes tools and returns both formatted string and a trace for plan learning.
+func (h *HeadAgent) executeToolCallsWithTrace(ctx context.Context, toolCalls []model.ToolCall) (string, []planlib.TraceStep) {
 	type toolResult struct {
 		index   int
 		call    model.ToolCall
@@ -1693,7 +1770,17 @@ func (h *HeadAgent) executeToolCalls(ctx context.Context, toolCalls []model.Tool
 	var output strings.Builder
 	output.WriteString(fmt.Sprintf("Executed %d tools in parallel:\n\n", len(toolCalls)))
 
+	trace := make([]planlib.TraceStep, 0, len(results))
 	for _, r := range results {
+		trace = append(trace, planlib.TraceStep{
+			Tool:    r.call.Name,
+			Input:   r.call.Input,
+			Success: r.err == nil && r.result != nil && r.result.Success,
+		})
+		if trace[len(trace)-1].Success {
+			h.trackFiles(r.call.Input)
+		}
+
 		output.WriteString(fmt.Sprintf("### Tool: %s\n", r.call.Name))
 		if r.err != nil {
 			output.WriteString(fmt.Sprintf("**Error**: %v\n\n", r.err))
@@ -1707,7 +1794,7 @@ func (h *HeadAgent) executeToolCalls(ctx context.Context, toolCalls []model.Tool
 		}
 	}
 
-	return output.String()
+	return output.String(), trace
 }
 
 // formatToolOutput formats tool output as a string.
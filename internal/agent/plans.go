@@ -0,0 +1,179 @@
+// Package agent provides plan library reuse for the Head Agent.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/classifier"
+	"github.com/flynn-ai/flynn/internal/planlib"
+)
+
+// PlanRun is the outcome of replaying a stored plan.
+type PlanRun struct {
+	Message   string
+	PlanID    string
+	Intent    string
+	Execution *planlib.PlanExecution // Nil while the plan waits for confirmation
+}
+
+// planVariableAliases maps plan variable names to classifier variable names
+// that can fill them when the exact name was not extracted.
+var planVariableAliases = map[string][]string{
+	"repo_path":    {"dir", "path"},
+	"dir":          {"path"},
+	"path":         {"dir"},
+	"file_path":    {"path"},
+	"test_pattern": {"test", "pattern"},
+	"search":       {"pattern", "query"},
+	"pattern":      {"query"},
+	"query":        {"pattern"},
+	"url":          {"path"},
+	"title":        {"task", "name"},
+}
+
+// classifyIntent classifies the message for plan reuse and learning.
+// Returns nil when plans are not configured.
+func (h *HeadAgent) classifyIntent(ctx context.Context, message string) *classifier.Intent {
+	if h.planLibrary == nil || h.classifier == nil {
+		return nil
+	}
+	intent, err := h.classifier.Classify(ctx, message)
+	if err != nil {
+		return nil
+	}
+	return intent
+}
+
+// tryPlanExecution replays the stored plan that best matches the message.
+// A plan with destructive steps is held until the user confirms it, and the
+// run carries the question instead of an execution. Returns nil when no
+// plan is confident enough or the plan fails, so the caller can fall back
+// to the model.
+func (h *HeadAgent) tryPlanExecution(ctx context.Context, message string, intent *classifier.Intent) *PlanRun {
+	if intent == nil || h.planExecutor == nil {
+		return nil
+	}
+
+	// A chat label carries no signal; match on phrasing alone
+	label := intent.String()
+	if intent.Category == "chat" {
+		label = ""
+	}
+
+	match, err := h.planLibrary.BestMatch(ctx, h.tenantID, label, message, h.planThreshold)
+	if err != nil {
+		return nil
+	}
+	plan, pattern := match.Plan, match.Pattern
+
+	// Extract with the plan's category too, in case the classifier mislabeled the message
+	extracted := h.classifier.ExtractVariables(message, intent)
+	planCategory, _, _ := strings.Cut(plan.Intent, ".")
+	for k, v := range h.classifier.ExtractVariables(message, &classifier.Intent{Category: planCategory}) {
+		if _, ok := extracted[k]; !ok {
+			extracted[k] = v
+		}
+	}
+
+	vars := bindPlanVariables(plan, extracted)
+	instance, err := planlib.Instantiate(plan, vars)
+	if err != nil {
+		// Missing variables - let the model handle it
+		return nil
+	}
+	instance.ID = plan.ID
+
+	// Steps that change or delete things wait for the user to confirm
+	if planDestructive(instance) {
+		held := &boundAction{
+			kind:    boundPlan,
+			trigger: message,
+			label:   "the saved plan " + planLabel(instance),
+			plan:    instance,
+			caution: cautionDestructive,
+		}
+		return &PlanRun{Message: h.holdAction(held, ""), PlanID: plan.ID, Intent: plan.Intent}
+	}
+
+	exec, err := h.planExecutor.Execute(ctx, h.tenantID, instance, vars)
+	if err != nil {
+		_ = h.planLibrary.RecordFailure(ctx, h.tenantID, pattern.ID)
+		return nil
+	}
+	exec.PatternID = pattern.ID
+
+	if exec.Status != "completed" {
+		_ = h.planLibrary.RecordFailure(ctx, h.tenantID, pattern.ID)
+		return nil
+	}
+	_ = h.planLibrary.RecordSuccess(ctx, h.tenantID, pattern.ID)
+	_ = h.planLibrary.AddExample(ctx, h.tenantID, plan.ID, plan.Intent, message)
+
+	return &PlanRun{
+		Message:   formatPlanRun(plan, exec),
+		PlanID:    plan.ID,
+		Intent:    plan.Intent,
+		Execution: exec,
+	}
+}
+
+// learnPlan records a successful tool-call session as a plan candidate.
+func (h *HeadAgent) learnPlan(ctx context.Context, message string, intent *classifier.Intent, trace []planlib.TraceStep) {
+	if h.planLearner == nil || intent == nil || intent.Category == "chat" || len(trace) == 0 {
+		return
+	}
+	for _, step := range trace {
+		if !step.Success {
+			return // Only learn from clean sessions
+		}
+	}
+	_, _ = h.planLearner.Observe(ctx, h.tenantID, &planlib.Trace{
+		Intent:    intent.String(),
+		Message:   message,
+		Variables: h.classifier.ExtractVariables(message, intent),
+		Steps:     trace,
+	})
+}
+
+// bindPlanVariables builds the variable map for a plan from extracted values.
+func bindPlanVariables(plan *planlib.Plan, extracted map[string]string) map[string]string {
+	vars := make(map[string]string, len(extracted))
+	for k, v := range extracted {
+		vars[k] = v
+	}
+	for _, v := range plan.Variables {
+		if _, ok := vars[v.Name]; ok {
+			continue
+		}
+		for _, alias := range planVariableAliases[v.Name] {
+			if val, ok := extracted[alias]; ok && val != "" {
+				vars[v.Name] = val
+				break
+			}
+		}
+	}
+	return vars
+}
+
+// formatPlanRun renders a plan execution as a user-facing message.
+func formatPlanRun(plan *planlib.Plan, exec *planlib.PlanExecution) string {
+	var b strings.Builder
+	desc := plan.Description
+	if desc == "" {
+		desc = plan.Intent
+	}
+	fmt.Fprintf(&b, "Ran saved plan: %s (%d/%d steps, %dms)\n", desc, exec.StepsCompleted, exec.StepCount, exec.DurationMs)
+
+	// Show the output of the final step; earlier steps usually feed into it.
+	for i := len(exec.Results) - 1; i >= 0; i-- {
+		r := exec.Results[i]
+		if r.Success && r.Data != nil {
+			b.WriteString("\n")
+			b.WriteString(formatToolOutput(r.Data))
+			break
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
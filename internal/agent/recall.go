@@ -0,0 +1,49 @@
+// Package agent provides reinforcement of memories the user went along with.
+package agent
+
+import (
+	"context"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// recalledMemory is a profile fact or learned action used to answer a turn.
+type recalledMemory struct {
+	kind string // profile or action
+	key  string // field or trigger
+}
+
+func (r recalledMemory) id() string { return r.kind + ":" + r.key }
+
+// noteRecalled records the profile facts and actions used for the current
+// turn. They are reinforced if the user's next message does not correct them.
+func (h *HeadAgent) noteRecalled(memories []memory.MemoryEntry) {
+	h.recallMu.Lock()
+	defer h.recallMu.Unlock()
+	for _, m := range memories {
+		switch m.Type {
+		case "profile":
+			h.recalled = append(h.recalled, recalledMemory{kind: m.Type, key: m.Field})
+		case "action":
+			h.recalled = append(h.recalled, recalledMemory{kind: m.Type, key: m.Trigger})
+		}
+	}
+}
+
+// settleRecalled reinforces the memories used for the previous turn unless
+// this turn corrected them, then holds this turn's memories for the next.
+func (h *HeadAgent) settleRecalled(ctx context.Context, corrected map[string]bool) {
+	h.recallMu.Lock()
+	previous := h.awaitingConfirmation
+	h.awaitingConfirmation, h.recalled = h.recalled, nil
+	h.recallMu.Unlock()
+
+	seen := map[string]bool{}
+	for _, r := range previous {
+		if corrected[r.id()] || seen[r.id()] {
+			continue
+		}
+		seen[r.id()] = true
+		_ = h.memoryStore.Reinforce(ctx, r.kind, r.key)
+	}
+}
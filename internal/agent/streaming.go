@@ -10,7 +10,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/flynn-ai/flynn/internal/classifier"
 	"github.com/flynn-ai/flynn/internal/model"
+	"github.com/flynn-ai/flynn/internal/planlib"
 )
 
 // StreamCallback is called for each chunk of streamed content.
@@ -131,7 +133,19 @@ func (s *StreamingProcessor) detectToolCalls(chunk string) []ToolCall {
 func (h *HeadAgent) ProcessStream(ctx context.Context, message string, threadMode ThreadMode, callback StreamCallback) (*Response, error) {
 	startTime := time.Now()
 
-	// Step 1: Check for direct execution first
+	// Step 1: Run a learned action, then check for direct execution
+	if exec := h.tryLearnedAction(ctx, message); exec != nil {
+		callback(StreamChunk{Text: exec.Message, Done: true})
+		resp := &Response{
+			Message:    exec.Message,
+			Execution:  exec.Execution,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			Tier:       int(model.TierRules),
+			ToolUsed:   exec.Tool,
+		}
+		h.recordConversation(ctx, message, resp.Message, threadMode)
+		return resp, nil
+	}
 	if exec := h.tryDirectExecution(ctx, message); exec != nil {
 		callback(StreamChunk{Text: exec.Message, Done: true})
 		return &Response{
@@ -142,16 +156,32 @@ func (h *HeadAgent) ProcessStream(ctx context.Context, message string, threadMod
 		}, nil
 	}
 
+	// Step 1b: Reuse a learned plan for this intent
+	intent := h.classifyIntent(ctx, message)
+	if run := h.tryPlanExecution(ctx, message, intent); run != nil {
+		callback(StreamChunk{Text: run.Message, Done: true})
+		resp := &Response{
+			Message:    run.Message,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			Tier:       int(model.TierRules),
+			UsedPlan:   true,
+			PlanID:     run.PlanID,
+		}
+		h.recordConversation(ctx, message, resp.Message, threadMode)
+		return resp, nil
+	}
+
 	// Step 2: Build context
 	systemPrompt := h.buildSystemPrompt()
-	userPrompt := h.buildUserPrompt(message, ctx)
+	userPrompt := h.buildUserPrompt(message, ctx, threadMode)
 
 	// Step 3: Stream from model
-	return h.streamWithTools(ctx, systemPrompt, userPrompt, message, threadMode, startTime, callback)
+	return h.streamWithTools(ctx, systemPrompt, userPrompt, message, intent, threadMode, startTime, callback)
 }
 
-// streamWithTools streams from model and handles tool calls.
-func (h *HeadAgent) streamWithTools(ctx context.Context, systemPrompt, userPrompt, originalMsg string, threadMode ThreadMode, startTime time.Time, callback StreamCallback) (*Response, error) {
+// streamWithTools streams from model and handles tool calls. A session whose
+// tools all succeed is learned as a plan for intent.
+func (h *HeadAgent) streamWithTools(ctx context.Context, systemPrompt, userPrompt, originalMsg string, intent *classifier.Intent, threadMode ThreadMode, startTime time.Time, callback StreamCallback) (*Response, error) {
 	var fullText strings.Builder
 
 	// Create stream writer that accumulates and calls back
@@ -183,7 +213,7 @@ func (h *HeadAgent) streamWithTools(ctx context.Context, systemPrompt, userPromp
 		}
 
 		// Execute tools in parallel
-		toolResults := h.executeToolCallsParallel(ctx, toolCalls)
+		toolResults, infos := h.executeToolCallsParallelWithInfo(ctx, toolCalls)
 
 		// Stream final response with tool results
 		followUpPrompt := fmt.Sprintf("%s\n\nOriginal user request: %s\n\nTool execution results:\n%s\n\nPlease provide a helpful response based on these results.",
@@ -210,11 +240,18 @@ func (h *HeadAgent) streamWithTools(ctx context.Context, systemPrompt, userPromp
 		// Accumulate final response text
 		fullText.WriteString(finalResp.Text)
 
-		// Extract memory from the conversation
-		h.ingestMemory(ctx, originalMsg, finalResp.Text)
+		// Learn a reusable plan from the session (non-blocking)
+		trace := streamTrace(toolCalls, infos)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			h.learnPlan(ctx, originalMsg, intent, trace)
+		}()
+
+		// Store the conversation and extract memory facts linked to it
+		h.recordConversation(ctx, originalMsg, finalResp.Text, threadMode)
 	} else {
-		// No tool calls - extract memory from initial response
-		h.ingestMemory(ctx, originalMsg, resp.Text)
+		h.recordConversation(ctx, originalMsg, resp.Text, threadMode)
 	}
 
 	return &Response{
@@ -223,6 +260,25 @@ func (h *HeadAgent) streamWithTools(ctx context.Context, systemPrompt, userPromp
 	}, nil
 }
 
+// streamTrace converts streamed tool calls and their outcomes into a trace
+// for plan learning. Tools are named "<subagent>_<action>", as the model's
+// native tool calls are.
+func streamTrace(calls []ToolCall, infos []ToolCallInfo) []planlib.TraceStep {
+	trace := make([]planlib.TraceStep, 0, len(calls))
+	for i, call := range calls {
+		input := make(map[string]any, len(call.Params))
+		for k, v := range call.Params {
+			input[k] = v
+		}
+		trace = append(trace, planlib.TraceStep{
+			Tool:    call.Tool + "_" + call.Action,
+			Input:   input,
+			Success: i < len(infos) && infos[i].Success,
+		})
+	}
+	return trace
+}
+
 // streamWriter implements io.Writer for streaming callbacks.
 type streamWriter struct {
 	callback StreamCallback
@@ -0,0 +1,719 @@
+// Package backup provides consistent, compressed archives of Flynn's data
+// directory.
+//
+// Databases are snapshotted with VACUUM INTO, so a backup taken while Flynn
+// runs never sees a half-written page or an unmerged WAL. Each archive is a
+// gzipped tar whose first entry is a manifest listing every file with its
+// checksum and the schema version of each database.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// Archive file names and layout.
+const (
+	archivePrefix   = "flynn-"
+	archiveExt      = ".tar.gz"
+	encryptedExt    = ".tar.gz.enc"
+	manifestName    = "manifest.json"
+	manifestFormat  = 1
+	archiveTimeForm = "20060102-150405"
+)
+
+// File kinds recorded in the manifest.
+const (
+	KindDatabase = "database" // personal.db or team.db snapshot
+	KindData     = "data"     // Any other file from the data directory
+)
+
+// Options locates the data being backed up or restored.
+type Options struct {
+	DataDir    string   // Data directory; its files are archived under data/
+	PersonalDB string   // personal.db path
+	TeamDB     string   // team.db path
+	Dir        string   // Where archives are written and listed
+	Exclude    []string // Directories under DataDir left out, e.g. logs and cache
+	Passphrase string   // Encrypts new archives and opens encrypted ones
+}
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	Format    int            `json:"format"`
+	CreatedAt int64          `json:"created_at"`
+	Schema    map[string]int `json:"schema"` // personal/team -> schema version
+	Files     []File         `json:"files"`
+}
+
+// File is one archived file.
+type File struct {
+	Path   string `json:"path"` // Slash-separated path inside the archive
+	Kind   string `json:"kind"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a backup on disk.
+type Archive struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt int64     `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+	Manifest  *Manifest `json:"manifest,omitempty"` // Nil when it could not be read
+	Error     string    `json:"error,omitempty"`    // Why the manifest could not be read
+}
+
+// Report is the outcome of verifying or restoring an archive.
+type Report struct {
+	Archive  string    `json:"archive"`
+	Manifest *Manifest `json:"manifest"`
+	Problems []string  `json:"problems,omitempty"`
+	Restored []string  `json:"restored,omitempty"` // Files written by Restore
+}
+
+// OK reports whether verification found no problems.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// ============================================================
+// Create
+// ============================================================
+
+// Create snapshots both databases and the data directory into a new
+// archive in opts.Dir. The store stays usable while the snapshot runs.
+func Create(ctx context.Context, store *memory.Store, opts Options) (*Archive, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("no backup directory configured")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(opts.Dir, ".snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	statuses, err := store.SchemaStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	manifest := &Manifest{Format: manifestFormat, CreatedAt: now.Unix(), Schema: map[string]int{}}
+	for _, s := range statuses {
+		manifest.Schema[s.Database] = s.Current
+	}
+
+	// Snapshot into the staging directory first so every file is hashed
+	// and archived from a copy that cannot change underneath us.
+	for _, db := range []struct {
+		name string
+		db   *sql.DB
+	}{{"personal", store.Personal()}, {"team", store.Team()}} {
+		dest := filepath.Join(staging, "db", db.name+".db")
+		if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+			return nil, err
+		}
+		if _, err := db.db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+			return nil, fmt.Errorf("snapshot %s.db: %w", db.name, err)
+		}
+		if err := manifest.add(staging, "db/"+db.name+".db", KindDatabase); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := dataFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		name := path.Join("data", rel)
+		if err := copyFile(filepath.Join(opts.DataDir, filepath.FromSlash(rel)), filepath.Join(staging, filepath.FromSlash(name))); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", rel, err)
+		}
+		if err := manifest.add(staging, name, KindData); err != nil {
+			return nil, err
+		}
+	}
+
+	dest, err := archiveName(opts.Dir, now, opts.Passphrase != "")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeArchive(dest, staging, manifest, opts.Passphrase); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{
+		Path:      dest,
+		Size:      info.Size(),
+		CreatedAt: manifest.CreatedAt,
+		Encrypted: opts.Passphrase != "",
+		Manifest:  manifest,
+	}, nil
+}
+
+// add hashes a staged file into the manifest.
+func (m *Manifest) add(staging, name, kind string) error {
+	f, err := os.Open(filepath.Join(staging, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	m.Files = append(m.Files, File{Path: name, Kind: kind, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))})
+	return nil
+}
+
+// dataFiles lists the regular files under opts.DataDir to archive, as
+// slash-separated relative paths. The live databases, their WAL files,
+// migration backups and excluded directories are skipped.
+func dataFiles(opts Options) ([]string, error) {
+	if opts.DataDir == "" {
+		return nil, nil
+	}
+	skipDirs := map[string]bool{filepath.Clean(opts.Dir): true}
+	for _, dir := range opts.Exclude {
+		if dir != "" {
+			skipDirs[filepath.Clean(dir)] = true
+		}
+	}
+	skipFiles := map[string]bool{}
+	for _, db := range []string{opts.PersonalDB, opts.TeamDB} {
+		if db == "" {
+			continue
+		}
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			skipFiles[filepath.Clean(db+suffix)] = true
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(opts.DataDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == opts.DataDir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if skipDirs[filepath.Clean(p)] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || skipFiles[filepath.Clean(p)] || strings.HasSuffix(p, ".bak") {
+			return nil
+		}
+		rel, err := filepath.Rel(opts.DataDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// archiveName picks an unused archive path for a backup taken at t,
+// numbering archives taken in the same second after the newest of them.
+func archiveName(dir string, t time.Time, encrypted bool) (string, error) {
+	ext := archiveExt
+	if encrypted {
+		ext = encryptedExt
+	}
+	stamp := t.Format(archiveTimeForm)
+	paths, err := archivePaths(dir)
+	if err != nil {
+		return "", err
+	}
+	seq := 0
+	for _, p := range paths {
+		if s, n := archiveStamp(p); s == stamp {
+			seq = max(seq, n)
+		}
+	}
+	if seq == 0 {
+		return filepath.Join(dir, archivePrefix+stamp+ext), nil
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s%s-%d%s", archivePrefix, stamp, seq+1, ext)), nil
+}
+
+// writeArchive writes the manifest and staged files to dest, going through
+// a temporary file so a failed backup never leaves a partial archive.
+func writeArchive(dest, staging string, manifest *Manifest, passphrase string) (err error) {
+	out, err := os.CreateTemp(filepath.Dir(dest), ".partial-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+
+	var w io.Writer = out
+	var enc *encryptWriter
+	if passphrase != "" {
+		if enc, err = newEncryptWriter(out, passphrase); err != nil {
+			return err
+		}
+		w = enc
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	modTime := time.Unix(manifest.CreatedAt, 0)
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o600, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, f := range manifest.Files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.Path, Mode: 0o600, Size: f.Size, ModTime: modTime}); err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(staging, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", f.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dest)
+}
+
+// ============================================================
+// List and Rotate
+// ============================================================
+
+// List returns the archives in dir, newest first. Manifests of encrypted
+// archives are only read when passphrase is set.
+func List(dir, passphrase string) ([]Archive, error) {
+	paths, err := archivePaths(dir)
+	if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		a := Archive{
+			Path:      p,
+			Size:      info.Size(),
+			CreatedAt: info.ModTime().Unix(),
+			Encrypted: strings.HasSuffix(p, encryptedExt),
+		}
+		if a.Encrypted && passphrase == "" {
+			a.Error = "encrypted; passphrase needed to read the manifest"
+		} else if m, err := ReadManifest(p, passphrase); err != nil {
+			a.Error = err.Error()
+		} else {
+			a.Manifest, a.CreatedAt = m, m.CreatedAt
+		}
+		archives = append(archives, a)
+	}
+	return archives, nil
+}
+
+// Rotate deletes all but the newest keep archives in dir and returns the
+// deleted paths. keep <= 0 keeps everything.
+func Rotate(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	paths, err := archivePaths(dir)
+	if err != nil || len(paths) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, p := range paths[keep:] {
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
+
+// archivePaths returns the archives in dir, newest first.
+func archivePaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, archivePrefix) &&
+			(strings.HasSuffix(name, archiveExt) || strings.HasSuffix(name, encryptedExt)) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		si, ni := archiveStamp(paths[i])
+		sj, nj := archiveStamp(paths[j])
+		if si != sj {
+			return si > sj
+		}
+		return ni > nj
+	})
+	return paths, nil
+}
+
+// archiveStamp splits an archive name into its creation time and the
+// counter of archives taken in the same second, which starts at 1.
+func archiveStamp(p string) (string, int) {
+	stem := strings.TrimPrefix(filepath.Base(p), archivePrefix)
+	stem = strings.TrimSuffix(strings.TrimSuffix(stem, encryptedExt), archiveExt)
+	seq := 1
+	if len(stem) > len(archiveTimeForm) {
+		fmt.Sscanf(stem[len(archiveTimeForm):], "-%d", &seq)
+		stem = stem[:len(archiveTimeForm)]
+	}
+	return stem, seq
+}
+
+// ============================================================
+// Reading
+// ============================================================
+
+// ReadManifest returns an archive's manifest without extracting it.
+func ReadManifest(archive, passphrase string) (*Manifest, error) {
+	var manifest *Manifest
+	err := readArchive(archive, passphrase, func(m *Manifest, _ *tar.Header, _ io.Reader) error {
+		manifest = m
+		return errStop
+	})
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return manifest, err
+}
+
+// errStop ends readArchive early.
+var errStop = errors.New("stop")
+
+// readArchive calls fn for every file after the manifest.
+func readArchive(archive, passphrase string, fn func(m *Manifest, hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if isEncrypted(br) {
+		if passphrase == "" {
+			return fmt.Errorf("%s is encrypted; a passphrase is required", filepath.Base(archive))
+		}
+		if r, err = newDecryptReader(br, passphrase); err != nil {
+			return err
+		}
+	}
+	gz, err := gzip.NewReader(r)
+	if errors.Is(err, ErrPassphrase) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("not a flynn backup: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	if hdr.Name != manifestName {
+		return fmt.Errorf("not a flynn backup: first entry is %q", hdr.Name)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	if manifest.Format > manifestFormat {
+		return fmt.Errorf("backup format %d is newer than this build supports (%d)", manifest.Format, manifestFormat)
+	}
+	if err := fn(&manifest, nil, nil); err != nil {
+		return err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("corrupted archive: %w", err)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("archive entry %q escapes the data directory", hdr.Name)
+		}
+		if err := fn(&manifest, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extract unpacks an archive into dir and checks every file against the
+// manifest. Mismatches are reported as problems, not errors.
+func extract(archive, passphrase, dir string) (*Report, error) {
+	report := &Report{Archive: archive}
+	seen := map[string]bool{}
+	err := readArchive(archive, passphrase, func(m *Manifest, hdr *tar.Header, r io.Reader) error {
+		report.Manifest = m
+		if hdr == nil {
+			return nil
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		size, err := io.Copy(io.MultiWriter(out, h), r)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+		seen[hdr.Name] = true
+		sum := hex.EncodeToString(h.Sum(nil))
+		for _, f := range m.Files {
+			if f.Path != hdr.Name {
+				continue
+			}
+			if f.Size != size || f.SHA256 != sum {
+				report.Problems = append(report.Problems, fmt.Sprintf("%s: checksum mismatch", hdr.Name))
+			}
+			return nil
+		}
+		report.Problems = append(report.Problems, fmt.Sprintf("%s: not listed in the manifest", hdr.Name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range report.Manifest.Files {
+		if !seen[f.Path] {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: missing from the archive", f.Path))
+		}
+	}
+	return report, nil
+}
+
+// ============================================================
+// Verify and Restore
+// ============================================================
+
+// Verify extracts an archive to a temporary directory, checks every file
+// against the manifest, runs an integrity check on both databases and
+// confirms this build can read their schema versions.
+func Verify(ctx context.Context, archive, passphrase string) (*Report, error) {
+	staging, err := os.MkdirTemp("", "flynn-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	return verifyInto(ctx, archive, passphrase, staging)
+}
+
+func verifyInto(ctx context.Context, archive, passphrase, staging string) (*Report, error) {
+	report, err := extract(archive, passphrase, staging)
+	if err != nil {
+		return nil, err
+	}
+	personal := filepath.Join(staging, "db", "personal.db")
+	team := filepath.Join(staging, "db", "team.db")
+	for _, p := range []string{personal, team} {
+		if _, err := os.Stat(p); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: database missing", filepath.Base(p)))
+			return report, nil
+		}
+	}
+
+	store, err := memory.OpenUnmigrated(personal, team)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("open databases: %v", err))
+		return report, nil
+	}
+	defer store.Close()
+	for _, db := range []struct {
+		name string
+		db   *sql.DB
+	}{{"personal", store.Personal()}, {"team", store.Team()}} {
+		var result string
+		if err := db.db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+			result = err.Error()
+		}
+		if result != "ok" {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s.db: integrity check failed: %s", db.name, result))
+		}
+	}
+
+	statuses, err := store.SchemaStatus(ctx)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("read schema versions: %v", err))
+		return report, nil
+	}
+	for _, s := range statuses {
+		if recorded, ok := report.Manifest.Schema[s.Database]; ok && recorded != s.Current {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s.db: manifest says schema version %d, database has %d", s.Database, recorded, s.Current))
+		}
+		if s.Current > s.Latest {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s.db: schema version %d is newer than this build supports (%d)", s.Database, s.Current, s.Latest))
+		}
+	}
+	return report, nil
+}
+
+// Restore verifies an archive and writes its databases to opts.PersonalDB
+// and opts.TeamDB and its data files under opts.DataDir. Existing files
+// are only replaced when force is set. Flynn must not be running against
+// the target directory. Databases older than this build are migrated the
+// next time they are opened.
+func Restore(ctx context.Context, archive string, opts Options, force bool) (*Report, error) {
+	staging, err := os.MkdirTemp("", "flynn-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	report, err := verifyInto(ctx, archive, opts.Passphrase, staging)
+	if err != nil {
+		return nil, err
+	}
+	if !report.OK() {
+		return report, fmt.Errorf("archive failed verification: %s", strings.Join(report.Problems, "; "))
+	}
+
+	targets := map[string]string{}
+	for _, f := range report.Manifest.Files {
+		switch {
+		case f.Path == "db/personal.db":
+			targets[f.Path] = opts.PersonalDB
+		case f.Path == "db/team.db":
+			targets[f.Path] = opts.TeamDB
+		case strings.HasPrefix(f.Path, "data/"):
+			targets[f.Path] = filepath.Join(opts.DataDir, filepath.FromSlash(strings.TrimPrefix(f.Path, "data/")))
+		}
+	}
+	if !force {
+		for _, dest := range targets {
+			if _, err := os.Stat(dest); err == nil {
+				return report, fmt.Errorf("%s already exists; restore into an empty data directory or pass --force", dest)
+			}
+		}
+	}
+
+	for _, f := range report.Manifest.Files {
+		dest, ok := targets[f.Path]
+		if !ok || dest == "" {
+			continue
+		}
+		if f.Kind == KindDatabase {
+			// A stale WAL would be replayed over the restored database
+			for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+				if err := os.Remove(dest + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return report, err
+				}
+			}
+		}
+		if err := copyFile(filepath.Join(staging, filepath.FromSlash(f.Path)), dest); err != nil {
+			return report, fmt.Errorf("restore %s: %w", dest, err)
+		}
+		report.Restored = append(report.Restored, dest)
+	}
+	return report, nil
+}
+
+// copyFile copies src to dst through a temporary file in dst's directory.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), ".copy-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
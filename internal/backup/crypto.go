@@ -0,0 +1,195 @@
+// Package backup provides passphrase encryption of backup archives.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted archives start with encMagic, a random salt and a base nonce,
+// followed by AES-256-GCM sealed chunks. Each chunk is prefixed with its
+// sealed length; the high bit marks the last chunk so a truncated archive
+// fails to decrypt instead of restoring partially.
+const (
+	encMagic      = "FLYNNBK1"
+	encSaltSize   = 16
+	encIterations = 600_000
+	encChunkSize  = 64 << 10
+	encFinalFlag  = 1 << 31
+)
+
+// ErrPassphrase is returned when an archive cannot be decrypted with the
+// given passphrase.
+var ErrPassphrase = errors.New("wrong passphrase or corrupted archive")
+
+// deriveKey stretches a passphrase into an AES-256 key.
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, encIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives a unique nonce for chunk n from the base nonce.
+func chunkNonce(base []byte, n uint64) []byte {
+	nonce := append([]byte(nil), base...)
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], n)
+	for i := range ctr {
+		nonce[len(nonce)-8+i] ^= ctr[i]
+	}
+	return nonce
+}
+
+// encryptWriter seals everything written to it in fixed-size chunks.
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	n     uint64
+	buf   []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(encMagic), salt...), nonce...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, nonce: nonce, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), encChunkSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p, written = p[n:], written+n
+		if len(e.buf) == encChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the last chunk. It does not close the underlying writer.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	var header [4]byte
+	size := uint32(len(e.buf) + e.aead.Overhead())
+	if final {
+		size |= encFinalFlag
+	}
+	binary.BigEndian.PutUint32(header[:], size)
+	sealed := e.aead.Seal(nil, chunkNonce(e.nonce, e.n), e.buf, header[:])
+	e.n++
+	e.buf = e.buf[:0]
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader opens chunks written by encryptWriter.
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	n     uint64
+	buf   []byte
+	done  bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, len(encMagic)+encSaltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if string(header[:len(encMagic)]) != encMagic {
+		return nil, fmt.Errorf("not an encrypted flynn backup")
+	}
+	aead, err := deriveKey(passphrase, header[len(encMagic):])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	return &decryptReader{r: r, aead: aead, nonce: nonce}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return fmt.Errorf("archive truncated: %w", ErrPassphrase)
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	final := size&encFinalFlag != 0
+	size &^= encFinalFlag
+	if size < uint32(d.aead.Overhead()) || size > encChunkSize+uint32(d.aead.Overhead()) {
+		return ErrPassphrase
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("archive truncated: %w", ErrPassphrase)
+	}
+	plain, err := d.aead.Open(nil, chunkNonce(d.nonce, d.n), sealed, header[:])
+	if err != nil {
+		return ErrPassphrase
+	}
+	d.n++
+	d.buf, d.done = plain, final
+	return nil
+}
+
+// isEncrypted reports whether the stream starts with the encryption header.
+func isEncrypted(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(encMagic))
+	return err == nil && bytes.Equal(magic, []byte(encMagic))
+}
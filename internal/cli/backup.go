@@ -0,0 +1,306 @@
+// Package cli provides the "flynn backup" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/backup"
+)
+
+// backupPassphraseEnv holds the backup passphrase when --passphrase-file is
+// not given.
+const backupPassphraseEnv = "FLYNN_BACKUP_PASSPHRASE"
+
+var backupCommand = &Command{
+	Name:    "backup",
+	Summary: "Create, verify and restore backups of the data directory",
+	Usage: `Usage: flynn backup <subcommand> [arguments]
+
+Subcommands:
+  create [--encrypt] [--keep n] [--dir path] [--json]
+                                    Snapshot both databases and the data
+                                    directory into a compressed archive
+  list [--dir path] [--json]        List archives, newest first
+  verify <archive> [--json]         Check checksums, database integrity and
+                                    schema versions
+  restore <archive> [--to dir] [--force]
+                                    Restore an archive into the configured data
+                                    directory, or into dir
+
+Options:
+  --passphrase-file path            Read the passphrase from a file instead of
+                                    $FLYNN_BACKUP_PASSPHRASE
+
+Databases are snapshotted with VACUUM INTO, so create is safe while Flynn is
+running. Archives are written to [backup] dir; after each create all but the
+newest [backup] keep archives are deleted. Logs, cache and models are not
+backed up. An <archive> that is not a path is looked up in the backup dir.
+
+Stop Flynn before restoring. Restore refuses to overwrite existing files
+unless --force is given, and refuses archives whose schema is newer than
+this build. Older databases are migrated the next time Flynn opens them.`,
+	Run: runBackup,
+}
+
+func runBackup(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	switch args[0] {
+	case "create":
+		return backupCreate(ctx, env, args[1:])
+	case "list":
+		return backupList(env, args[1:])
+	case "verify":
+		return backupVerify(ctx, env, args[1:])
+	case "restore":
+		return backupRestore(ctx, env, args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+// backupOptions locates the configured data directory and backups.
+func backupOptions(env *Env) backup.Options {
+	cfg := env.Config
+	return backup.Options{
+		DataDir:    cfg.Paths.DataDir,
+		PersonalDB: cfg.Paths.PersonalDB,
+		TeamDB:     cfg.Paths.TeamDB,
+		Dir:        cfg.Backup.Dir,
+		Exclude:    []string{cfg.Paths.LogsDir, cfg.Paths.CacheDir, cfg.Models.Local.ModelsDir},
+	}
+}
+
+// readPassphrase returns the passphrase from file, or from the environment
+// variable envVar when file is empty.
+func readPassphrase(file, envVar string) (string, error) {
+	if file == "" {
+		return os.Getenv(envVar), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveArchive accepts an archive path or a name in the backup dir.
+func resolveArchive(env *Env, name string) string {
+	if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) && !strings.ContainsRune(name, filepath.Separator) {
+		return filepath.Join(env.Config.Backup.Dir, name)
+	}
+	return name
+}
+
+func backupCreate(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "backup create")
+	encrypt := fs.Bool("encrypt", false, "encrypt the archive with the passphrase")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	keep := fs.Int("keep", env.Config.Backup.Keep, "newest archives to keep; 0 keeps all")
+	dir := fs.String("dir", env.Config.Backup.Dir, "directory to write the archive to")
+	asJSON := fs.Bool("json", false, "print the archive as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	opts := backupOptions(env)
+	opts.Dir = *dir
+	if *encrypt {
+		pass, err := readPassphrase(*passFile, backupPassphraseEnv)
+		if err != nil {
+			return err
+		}
+		if pass == "" {
+			return fmt.Errorf("--encrypt needs a passphrase in $%s or --passphrase-file", backupPassphraseEnv)
+		}
+		opts.Passphrase = pass
+	}
+
+	// Snapshots copy encrypted fields as stored, so no key is needed
+	store, err := env.lockedStore()
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Create(ctx, store, opts)
+	if err != nil {
+		return fmt.Errorf("create backup: %w", err)
+	}
+	rotated, err := backup.Rotate(opts.Dir, *keep)
+	if err != nil {
+		return fmt.Errorf("rotate backups: %w", err)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(struct {
+			*backup.Archive
+			Rotated []string `json:"rotated,omitempty"`
+		}{archive, rotated}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	fmt.Fprintf(env.Out, "Created %s (%s, %d files)\n", archive.Path, formatSize(archive.Size), len(archive.Manifest.Files))
+	fmt.Fprintf(env.Out, "  schema: %s\n", formatSchema(archive.Manifest.Schema))
+	for _, p := range rotated {
+		fmt.Fprintf(env.Out, "  rotated out %s\n", filepath.Base(p))
+	}
+	return nil
+}
+
+func backupList(env *Env, args []string) error {
+	fs := newFlagSet(env, "backup list")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	dir := fs.String("dir", env.Config.Backup.Dir, "directory to list")
+	asJSON := fs.Bool("json", false, "print archives as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	pass, err := readPassphrase(*passFile, backupPassphraseEnv)
+	if err != nil {
+		return err
+	}
+
+	archives, err := backup.List(*dir, pass)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(archives, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+	if len(archives) == 0 {
+		fmt.Fprintf(env.Out, "No backups in %s\n", *dir)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARCHIVE\tCREATED\tSIZE\tFILES\tSCHEMA")
+	for _, a := range archives {
+		name := filepath.Base(a.Path)
+		created := time.Unix(a.CreatedAt, 0).Format("2006-01-02 15:04")
+		files, schema := "-", a.Error
+		if a.Manifest != nil {
+			files, schema = fmt.Sprint(len(a.Manifest.Files)), formatSchema(a.Manifest.Schema)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, created, formatSize(a.Size), files, schema)
+	}
+	return tw.Flush()
+}
+
+func backupVerify(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "backup verify")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return ErrUsage
+	}
+	pass, err := readPassphrase(*passFile, backupPassphraseEnv)
+	if err != nil {
+		return err
+	}
+
+	report, err := backup.Verify(ctx, resolveArchive(env, rest[0]), pass)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+	} else {
+		for _, p := range report.Problems {
+			fmt.Fprintf(env.Out, "  %s\n", p)
+		}
+	}
+	if !report.OK() {
+		return fmt.Errorf("%s failed verification", filepath.Base(report.Archive))
+	}
+	if !*asJSON {
+		fmt.Fprintf(env.Out, "%s: OK (%d files, schema %s)\n", filepath.Base(report.Archive), len(report.Manifest.Files), formatSchema(report.Manifest.Schema))
+	}
+	return nil
+}
+
+func backupRestore(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "backup restore")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	to := fs.String("to", "", "restore into this data directory instead of the configured one")
+	force := fs.Bool("force", false, "overwrite existing files")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return ErrUsage
+	}
+	pass, err := readPassphrase(*passFile, backupPassphraseEnv)
+	if err != nil {
+		return err
+	}
+
+	opts := backupOptions(env)
+	opts.Passphrase = pass
+	if *to != "" {
+		opts.DataDir = *to
+		opts.PersonalDB = filepath.Join(*to, "personal.db")
+		opts.TeamDB = filepath.Join(*to, "team.db")
+	}
+
+	report, err := backup.Restore(ctx, resolveArchive(env, rest[0]), opts, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Restored %d files from %s (schema %s)\n", len(report.Restored), filepath.Base(report.Archive), formatSchema(report.Manifest.Schema))
+	for _, p := range report.Restored {
+		fmt.Fprintf(env.Out, "  %s\n", p)
+	}
+	return nil
+}
+
+// formatSchema renders schema versions as "personal v2, team v2".
+func formatSchema(schema map[string]int) string {
+	var parts []string
+	for _, name := range []string{"personal", "team"} {
+		if v, ok := schema[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s v%d", name, v))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatSize renders a byte count for humans.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
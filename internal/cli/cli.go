@@ -0,0 +1,327 @@
+// Package cli implements Flynn's management subcommands.
+//
+// The flynn binary hands "flynn <command> [args]" to Run. Each command
+// lives in its own file and opens only the stores it needs.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/config"
+	"github.com/flynn-ai/flynn/internal/graph"
+	"github.com/flynn-ai/flynn/internal/memory"
+	"github.com/flynn-ai/flynn/internal/model"
+	"github.com/flynn-ai/flynn/internal/subagent"
+	"github.com/flynn-ai/flynn/internal/tools"
+)
+
+// ErrUsage is returned when a command is invoked with bad arguments.
+var ErrUsage = errors.New("invalid usage")
+
+// Command is a top-level flynn subcommand.
+type Command struct {
+	Name    string
+	Summary string
+	Usage   string
+	Run     func(ctx context.Context, env *Env, args []string) error
+}
+
+// commands lists every subcommand handled by Run.
+var commands = []*Command{
+	daemonCommand,
+	backupCommand,
+	dbCommand,
+	encryptionCommand,
+	graphCommand,
+	indexCommand,
+	lockCommand,
+	memoryCommand,
+	plansCommand,
+	retentionCommand,
+	unlockCommand,
+}
+
+// Commands returns all subcommands sorted by name.
+func Commands() []*Command {
+	out := append([]*Command(nil), commands...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Lookup returns the subcommand with the given name.
+func Lookup(name string) (*Command, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// Run dispatches args[0] to its subcommand.
+func Run(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		if len(args) > 1 {
+			if cmd, ok := Lookup(args[1]); ok {
+				fmt.Fprintln(env.Out, cmd.Usage)
+				return nil
+			}
+		}
+		printHelp(env.Out)
+		return nil
+	}
+
+	cmd, ok := Lookup(args[0])
+	if !ok {
+		printHelp(env.Err)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	err := cmd.Run(ctx, env, args[1:])
+	if errors.Is(err, ErrUsage) {
+		fmt.Fprintln(env.Err, cmd.Usage)
+	}
+	return err
+}
+
+func printHelp(w io.Writer) {
+	fmt.Fprintln(w, "Usage: flynn <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range Commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "flynn help <command>" for details.`)
+}
+
+// ============================================================
+// Environment
+// ============================================================
+
+// Env carries configuration, output streams and lazily opened stores.
+type Env struct {
+	Config *config.Config
+	Out    io.Writer
+	Err    io.Writer
+
+	store *memory.Store
+}
+
+// NewEnv creates a command environment. Stores are opened on first use.
+func NewEnv(cfg *config.Config, out, errOut io.Writer) *Env {
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	return &Env{Config: cfg, Out: out, Err: errOut}
+}
+
+// TenantID returns the configured tenant.
+func (e *Env) TenantID() string {
+	if e.Config.Tenant.ID == "" {
+		return "default"
+	}
+	return e.Config.Tenant.ID
+}
+
+// UserID returns the local user, [tenant] member_id.
+func (e *Env) UserID() string {
+	return e.Config.Tenant.MemberID
+}
+
+// TeamActor returns the local user and the role [tenant] members gives
+// them. The role is empty, which team memory refuses every change from,
+// when member_id is unset or names no member.
+func (e *Env) TeamActor() memory.TeamActor {
+	actor := memory.TeamActor{ID: e.UserID()}
+	if actor.ID == "" {
+		return actor
+	}
+	for _, m := range e.Config.Tenant.Members {
+		if m.ID == actor.ID {
+			actor.Role = m.Role
+			break
+		}
+	}
+	return actor
+}
+
+// Store opens the personal and team databases. When field encryption is
+// enabled it unlocks them, or fails if no key is available.
+func (e *Env) Store() (*memory.Store, error) {
+	store, err := e.lockedStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.unlock(context.Background(), store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// lockedStore opens the databases without unlocking encrypted fields, for
+// commands that never read them.
+func (e *Env) lockedStore() (*memory.Store, error) {
+	if e.store != nil {
+		return e.store, nil
+	}
+	store, err := memory.Open(e.Config.Paths.PersonalDB, e.Config.Paths.TeamDB)
+	if err != nil {
+		return nil, fmt.Errorf("open stores: %w", err)
+	}
+	if err := store.EnsureTenant(e.TenantID(), e.Config.Tenant.Name); err != nil {
+		store.Close()
+		return nil, err
+	}
+	e.store = store
+	return store, nil
+}
+
+// Subagents builds a registry with the subagents that run without a model.
+func (e *Env) Subagents() (*subagent.Registry, error) {
+	store, err := e.Store()
+	if err != nil {
+		return nil, err
+	}
+	reg := subagent.NewRegistry()
+	reg.Register(subagent.NewFileAgent())
+	reg.Register(subagent.NewCodeAgent(nil))
+	reg.Register(subagent.NewTaskAgent())
+	reg.Register(subagent.NewResearchAgent(nil))
+	reg.Register(subagent.NewSystemAgent())
+	reg.Register(subagent.NewGraphAgent(memory.NewGraphStore(store.Team())))
+	return reg, nil
+}
+
+// Graph returns the knowledge graph service for the current tenant. It
+// extracts with the configured model only when [graph] use_llm is set, and
+// answers document questions with it whenever one is configured.
+func (e *Env) Graph() (*graph.Service, error) {
+	store, err := e.Store()
+	if err != nil {
+		return nil, err
+	}
+	var m model.Model
+	if e.Config.Graph.UseLLM {
+		m = e.Model()
+	}
+	svc := graph.NewService(memory.NewGraphStore(store.Team()), graph.NewExtractor(m), e.TenantID())
+	cfg := e.Config.Graph
+	if cfg.MaxEntities > 0 {
+		svc.Ingestor.MaxEntities = cfg.MaxEntities
+	}
+	if cfg.MaxRelations > 0 {
+		svc.Ingestor.MaxRelations = cfg.MaxRelations
+	}
+	if cfg.MaxChunkBytes > 0 {
+		svc.Ingestor.MaxChunkBytes = cfg.MaxChunkBytes
+	}
+	if kb := e.Config.Index.MaxFileKB; kb > 0 {
+		svc.Indexer.MaxFileBytes = int64(kb) << 10
+	}
+	svc.Indexer.MaxFiles = e.Config.Index.BatchFiles
+	svc.Docs = graph.NewDocsQA(svc.Store, e.Model())
+	svc.Docs.TopK = cfg.AskTopK
+	svc.Docs.MaxContextChars = cfg.AskContextChars
+	return svc, nil
+}
+
+// Tools builds the model-facing tool registry with its services injected.
+func (e *Env) Tools() (*tools.Registry, error) {
+	svc, err := e.Graph()
+	if err != nil {
+		return nil, err
+	}
+	reg := tools.NewRegistry()
+	reg.Initialize(tools.Dependencies{Graph: svc})
+	return reg, nil
+}
+
+// Model returns the configured cloud model, or nil when none is set up.
+// Commands that can use a model fall back to rule-based behavior without one.
+func (e *Env) Model() model.Model {
+	cloud := e.Config.Models.Cloud
+	if !cloud.Enabled || cloud.Mode == string(config.CloudModeNever) {
+		return nil
+	}
+	if cloud.Provider == "glm" && cloud.GLMAPIKey != "" {
+		cfg := model.DefaultGLMConfig(cloud.GLMAPIKey)
+		if cloud.GLMModel != "" {
+			cfg.Model = cloud.GLMModel
+		}
+		return model.NewGLMClient(cfg)
+	}
+	if cloud.APIKey != "" {
+		cfg := model.DefaultOpenRouterConfig(cloud.APIKey)
+		if cloud.DefaultModel != "" {
+			cfg.Model = cloud.DefaultModel
+		}
+		return model.NewOpenRouterClient(cfg)
+	}
+	return nil
+}
+
+// Close releases any opened stores.
+func (e *Env) Close() error {
+	if e.store == nil {
+		return nil
+	}
+	err := e.store.Close()
+	e.store = nil
+	return err
+}
+
+// ============================================================
+// Flag Helpers
+// ============================================================
+
+// newFlagSet creates a flag set that reports errors instead of exiting.
+func newFlagSet(env *Env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Err)
+	return fs
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, ErrUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// keyValueFlag collects repeated key=value flags.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	parts := make([]string, 0, len(f))
+	for k, v := range f {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[k] = v
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package cli provides the "flynn daemon" command.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+	"github.com/flynn-ai/flynn/internal/scheduler"
+)
+
+var daemonCommand = &Command{
+	Name:    "daemon",
+	Summary: "Run background maintenance jobs until interrupted",
+	Usage: `Usage: flynn daemon [--list]
+
+Runs periodic jobs (memory consolidation, retention purges, directory
+indexing, ...) on the intervals set in the config file. Stop with Ctrl-C or SIGTERM.
+
+  --list    print the jobs that would run and exit`,
+	Run: runDaemon,
+}
+
+// daemonJobs builds the periodic jobs. A builder returns nil when its job
+// is disabled in the config.
+var daemonJobs = []func(env *Env) (*scheduler.Job, error){
+	consolidationJob,
+	retentionJob,
+	indexJob,
+}
+
+func runDaemon(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "daemon")
+	list := fs.Bool("list", false, "list jobs and exit")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+
+	sched := scheduler.New(func(r scheduler.Result) {
+		if r.Err != nil {
+			fmt.Fprintf(env.Err, "%s %s failed after %s: %v\n", r.Started.Format(time.RFC3339), r.Job, r.Duration.Round(time.Millisecond), r.Err)
+			return
+		}
+		fmt.Fprintf(env.Out, "%s %s done in %s\n", r.Started.Format(time.RFC3339), r.Job, r.Duration.Round(time.Millisecond))
+	})
+	for _, build := range daemonJobs {
+		job, err := build(env)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			continue
+		}
+		if err := sched.Add(job); err != nil {
+			return err
+		}
+	}
+
+	jobs := sched.Jobs()
+	if *list || len(jobs) == 0 {
+		if len(jobs) == 0 {
+			fmt.Fprintln(env.Out, "No jobs enabled.")
+		}
+		for _, job := range jobs {
+			fmt.Fprintf(env.Out, "%-20s every %s\n", job.Name, job.Interval)
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(env.Out, "Running %d job(s); press Ctrl-C to stop.\n", len(jobs))
+	sched.Run(ctx)
+	return nil
+}
+
+// consolidationJob periodically consolidates personal memory.
+func consolidationJob(env *Env) (*scheduler.Job, error) {
+	cfg := env.Config.Memory
+	if cfg.ConsolidateIntervalHours <= 0 {
+		return nil, nil
+	}
+	store, err := env.Store()
+	if err != nil {
+		return nil, err
+	}
+	memStore := memory.NewMemoryStore(store.Personal())
+	memStore.SetConfidencePolicy(confidencePolicy(cfg))
+	retrieval := memory.NewEnhancedMemoryStore(memStore, store.Personal())
+
+	return &scheduler.Job{
+		Name:     "memory-consolidate",
+		Interval: time.Duration(cfg.ConsolidateIntervalHours) * time.Hour,
+		Run: func(ctx context.Context) error {
+			report, err := retrieval.Consolidate(ctx, memory.ConsolidationOptions{
+				OlderThanDays: cfg.ConsolidateAfterDays,
+				Model:         env.Model(),
+			})
+			if err != nil {
+				return err
+			}
+			if report.Archived > 0 {
+				fmt.Fprintf(env.Out, "memory-consolidate: %d merged, %d superseded, %d summarized, %d decayed\n",
+					len(report.Merged), len(report.Superseded), len(report.Summarized), len(report.Decayed))
+			}
+			return nil
+		},
+	}, nil
+}
+
+// retentionJob periodically purges data past its retention policy.
+func retentionJob(env *Env) (*scheduler.Job, error) {
+	cfg := env.Config.Retention
+	if cfg.PurgeIntervalHours <= 0 {
+		return nil, nil
+	}
+	store, err := env.Store()
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Job{
+		Name:     "retention-purge",
+		Interval: time.Duration(cfg.PurgeIntervalHours) * time.Hour,
+		Run: func(ctx context.Context) error {
+			report, err := store.Purge(ctx, retentionOptions(cfg))
+			if err != nil {
+				return err
+			}
+			if report.Rows() > 0 || report.Reclaimed > 0 {
+				fmt.Fprintf(env.Out, "retention-purge: %d rows purged, %s reclaimed\n", report.Rows(), formatSize(report.Reclaimed))
+			}
+			return nil
+		},
+	}, nil
+}
+
+// indexJob periodically indexes the configured directories. Each run ingests
+// at most [index] batch_files changed files per directory; the rest are
+// picked up by the next run.
+func indexJob(env *Env) (*scheduler.Job, error) {
+	cfg := env.Config.Index
+	if cfg.IntervalMinutes <= 0 || len(cfg.Paths) == 0 {
+		return nil, nil
+	}
+	svc, err := env.Graph()
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Job{
+		Name:     "graph-index",
+		Interval: time.Duration(cfg.IntervalMinutes) * time.Minute,
+		Run: func(ctx context.Context) error {
+			var errs []error
+			for _, dir := range cfg.Paths {
+				result, err := svc.Indexer.Index(ctx, svc.TenantID, dir)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", dir, err))
+					continue
+				}
+				if result.Added+result.Updated+result.Removed+result.Failed+result.Pending > 0 {
+					fmt.Fprintf(env.Out, "graph-index: %s: %d added, %d updated, %d removed, %d failed, %d pending\n",
+						result.Root, result.Added, result.Updated, result.Removed, result.Failed, result.Pending)
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}, nil
+}
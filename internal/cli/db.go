@@ -0,0 +1,140 @@
+// Package cli provides the "flynn db" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+var dbCommand = &Command{
+	Name:    "db",
+	Summary: "Show and apply database schema migrations",
+	Usage: `Usage: flynn db <subcommand> [arguments]
+
+Subcommands:
+  status [--json]                   Show applied and pending migrations
+  migrate [--dry-run] [--no-backup] [--json]
+                                    Apply pending migrations
+
+Flynn migrates personal.db and team.db when it opens them; these commands
+let you inspect and run migrations explicitly. Before upgrading an existing
+database, migrate copies it to <db>.v<version>-<timestamp>.bak.`,
+	Run: runDB,
+}
+
+func runDB(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	// Open without migrating so status shows what is pending
+	store, err := memory.OpenUnmigrated(env.Config.Paths.PersonalDB, env.Config.Paths.TeamDB)
+	if err != nil {
+		return fmt.Errorf("open stores: %w", err)
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "status":
+		return dbStatus(ctx, env, store, args[1:])
+	case "migrate":
+		return dbMigrate(ctx, env, store, args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+func dbStatus(ctx context.Context, env *Env, store *memory.Store, args []string) error {
+	fs := newFlagSet(env, "db status")
+	asJSON := fs.Bool("json", false, "print status as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	statuses, err := store.SchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	for i, s := range statuses {
+		if i > 0 {
+			fmt.Fprintln(env.Out)
+		}
+		state := "up to date"
+		if n := len(s.Pending()); n > 0 {
+			state = fmt.Sprintf("%d pending", n)
+		} else if s.Current > s.Latest {
+			state = "newer than this build"
+		}
+		fmt.Fprintf(env.Out, "%s (%s): version %d of %d, %s\n", s.Database, s.Path, s.Current, s.Latest, state)
+
+		tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  VERSION\tAPPLIED\tDESCRIPTION")
+		for _, m := range s.Migrations {
+			applied := "pending"
+			if m.AppliedAt > 0 {
+				applied = time.Unix(m.AppliedAt, 0).Format("2006-01-02 15:04")
+			} else if m.Version <= s.Current {
+				applied = "skipped"
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\n", m.Version, applied, m.Description)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+func dbMigrate(ctx context.Context, env *Env, store *memory.Store, args []string) error {
+	fs := newFlagSet(env, "db migrate")
+	dryRun := fs.Bool("dry-run", false, "list pending migrations without applying them")
+	noBackup := fs.Bool("no-backup", false, "skip the backup taken before migrating")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	results, err := store.Migrate(ctx, memory.MigrateOptions{DryRun: *dryRun, NoBackup: *noBackup})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	for _, r := range results {
+		if len(r.Applied) == 0 {
+			fmt.Fprintf(env.Out, "%s: up to date at version %d\n", r.Database, r.From)
+			continue
+		}
+		verb := "migrated"
+		if *dryRun {
+			verb = "would migrate"
+		}
+		fmt.Fprintf(env.Out, "%s: %s from version %d to %d\n", r.Database, verb, r.From, r.To)
+		if r.Backup != "" {
+			fmt.Fprintf(env.Out, "  backup: %s\n", r.Backup)
+		}
+		for _, m := range r.Applied {
+			fmt.Fprintf(env.Out, "  %d  %s\n", m.Version, m.Description)
+		}
+	}
+	return nil
+}
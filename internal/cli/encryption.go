@@ -0,0 +1,404 @@
+// Package cli provides the "flynn encryption", "flynn unlock" and
+// "flynn lock" commands.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// encryptionPassphraseEnv holds the encryption passphrase when no
+// passphrase or key file is given.
+const encryptionPassphraseEnv = "FLYNN_PASSPHRASE"
+
+var encryptionCommand = &Command{
+	Name:    "encryption",
+	Summary: "Encrypt sensitive fields at rest and rotate their keys",
+	Usage: `Usage: flynn encryption <subcommand> [arguments]
+
+Subcommands:
+  status [--json]                   Show whether encryption is enabled and
+                                    unlocked
+  enable [--key-file path | --passphrase-file path] [--no-index]
+                                    Encrypt message content, memory values and
+                                    document chunks in both databases
+  rotate [--new-key-file path | --new-passphrase-file path] [--data-key]
+                                    Replace the passphrase or key file, and
+                                    with --data-key re-encrypt every field
+                                    under a new data key
+
+The passphrase is read from --passphrase-file or $FLYNN_PASSPHRASE and
+stretched with argon2id; a key file must hold at least 32 random bytes.
+Encrypted fields stay searchable through a blind index of keyed word
+hashes, which matches whole words only. --no-index leaves encrypted fields
+out of full-text search instead. An enable that was interrupted is
+finished by running it again with the same passphrase or key file.
+
+Once enabled, Flynn needs the key to open the databases: set [encryption]
+key_file, export $FLYNN_PASSPHRASE, or run "flynn unlock". Backups taken
+before enabling still hold plaintext.`,
+	Run: runEncryption,
+}
+
+var unlockCommand = &Command{
+	Name:    "unlock",
+	Summary: "Unlock encrypted data for later commands and the daemon",
+	Usage: `Usage: flynn unlock [--key-file path] [--passphrase-file path] [--for duration]
+
+Checks the passphrase or key file and caches the derived key, readable
+only by you, in $XDG_RUNTIME_DIR or the cache directory until it expires
+([encryption] unlock_minutes by default). Commands and a daemon started
+while unlocked use it; a running daemon keeps its keys until it stops.
+Run "flynn lock" to forget the key early.`,
+	Run: runUnlock,
+}
+
+var lockCommand = &Command{
+	Name:    "lock",
+	Summary: "Forget the key cached by flynn unlock",
+	Usage: `Usage: flynn lock
+
+Deletes the key cached by "flynn unlock". A running daemon keeps its keys
+until it stops.`,
+	Run: runLock,
+}
+
+func runEncryption(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	switch args[0] {
+	case "status":
+		return encryptionStatus(ctx, env, args[1:])
+	case "enable":
+		return encryptionEnable(ctx, env, args[1:])
+	case "rotate":
+		return encryptionRotate(ctx, env, args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+func encryptionStatus(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "encryption status")
+	asJSON := fs.Bool("json", false, "print status as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	store, err := env.lockedStore()
+	if err != nil {
+		return err
+	}
+	if err := env.unlock(ctx, store); err != nil && !errors.Is(err, memory.ErrLocked) {
+		return err
+	}
+
+	status, err := store.EncryptionStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if !status.Enabled {
+		fmt.Fprintln(env.Out, "Encryption: disabled")
+		return nil
+	}
+	secret := "passphrase (argon2id)"
+	if status.KDF == memory.KDFKeyFile {
+		secret = "key file"
+	}
+	search := "blind index, whole words"
+	if !status.BlindIndex {
+		search = "encrypted fields not indexed"
+	}
+	state := "locked"
+	if status.Unlocked {
+		state = "unlocked"
+	}
+	fmt.Fprintf(env.Out, "Encryption: enabled with a %s\n", secret)
+	fmt.Fprintf(env.Out, "State:      %s\n", state)
+	fmt.Fprintf(env.Out, "Search:     %s\n", search)
+	for _, k := range status.Keys {
+		fmt.Fprintf(env.Out, "Data key:   %s (%s, created %s)\n", k.ID, k.Status, time.Unix(k.CreatedAt, 0).Format("2006-01-02 15:04"))
+	}
+	if status.Plaintext > 0 {
+		fmt.Fprintf(env.Out, "Warning:    %d encrypted fields still hold plaintext; run \"flynn encryption rotate --data-key\"\n", status.Plaintext)
+	}
+	return nil
+}
+
+func encryptionEnable(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "encryption enable")
+	keyFile := fs.String("key-file", "", "encrypt with this key file")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	noIndex := fs.Bool("no-index", false, "leave encrypted fields out of full-text search")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	sec, ok, err := readSecret(*keyFile, *passFile, encryptionPassphraseEnv)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("enable needs --key-file, --passphrase-file or $%s", encryptionPassphraseEnv)
+	}
+
+	store, err := env.lockedStore()
+	if err != nil {
+		return err
+	}
+	if err := store.EnableEncryption(ctx, sec, !*noIndex); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Out, "Encryption enabled; sensitive fields are now sealed at rest.")
+	if *noIndex {
+		fmt.Fprintln(env.Out, "Encrypted fields are left out of full-text search.")
+	}
+	if sec.KDF() == memory.KDFKeyFile && env.Config.Encryption.KeyFile == "" {
+		fmt.Fprintln(env.Out, `Set [encryption] key_file to unlock automatically, or run "flynn unlock".`)
+	}
+	fmt.Fprintln(env.Out, "Keep the passphrase or key file safe: encrypted data cannot be recovered without it.")
+	return nil
+}
+
+func encryptionRotate(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "encryption rotate")
+	newKeyFile := fs.String("new-key-file", "", "protect the data keys with this key file")
+	newPassFile := fs.String("new-passphrase-file", "", "protect the data keys with the passphrase in this file")
+	dataKey := fs.Bool("data-key", false, "re-encrypt every field under a new data key")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	sec, newSecret, err := readSecret(*newKeyFile, *newPassFile, "")
+	if err != nil {
+		return err
+	}
+	if !newSecret && !*dataKey {
+		return ErrUsage
+	}
+
+	store, err := env.Store()
+	if err != nil {
+		return err
+	}
+	opts := memory.RotateOptions{DataKey: *dataKey}
+	if newSecret {
+		opts.Secret = &sec
+	}
+	if err := store.RotateEncryption(ctx, opts); err != nil {
+		return err
+	}
+
+	if newSecret {
+		fmt.Fprintln(env.Out, "Data keys rewrapped with the new secret.")
+		// Keep a cached unlock working under the new secret
+		if session, ok := loadSession(env); ok {
+			kek, err := store.DeriveKey(ctx, sec)
+			if err != nil {
+				return err
+			}
+			session.Key = kek
+			if err := saveSession(env, session); err != nil {
+				return err
+			}
+		}
+		if env.Config.Encryption.KeyFile != "" {
+			fmt.Fprintln(env.Out, "Update [encryption] key_file to match.")
+		}
+	}
+	if *dataKey {
+		fmt.Fprintln(env.Out, "All encrypted fields resealed under a new data key; old keys deleted.")
+	}
+	return nil
+}
+
+func runUnlock(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "unlock")
+	keyFile := fs.String("key-file", env.Config.Encryption.KeyFile, "unlock with this key file")
+	passFile := fs.String("passphrase-file", "", "file containing the passphrase")
+	duration := fs.Duration("for", time.Duration(env.Config.Encryption.UnlockMinutes)*time.Minute, "how long to stay unlocked")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	store, err := env.lockedStore()
+	if err != nil {
+		return err
+	}
+	if locked, err := store.Locked(ctx); err != nil {
+		return err
+	} else if !locked {
+		if status, err := store.EncryptionStatus(ctx); err == nil && !status.Enabled {
+			fmt.Fprintln(env.Out, "Encryption is not enabled; nothing to unlock.")
+			return nil
+		}
+	}
+
+	if *passFile != "" {
+		*keyFile = ""
+	}
+	sec, ok, err := readSecret(*keyFile, *passFile, encryptionPassphraseEnv)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unlock needs --key-file, --passphrase-file or $%s", encryptionPassphraseEnv)
+	}
+	kek, err := store.DeriveKey(ctx, sec)
+	if err != nil {
+		return err
+	}
+	if err := store.UnlockKey(ctx, kek); err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(*duration)
+	if err := saveSession(env, &unlockSession{Database: env.Config.Paths.PersonalDB, Key: kek, Expires: expires.Unix()}); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Unlocked until %s\n", expires.Format("2006-01-02 15:04"))
+	return nil
+}
+
+func runLock(ctx context.Context, env *Env, args []string) error {
+	if len(args) > 0 {
+		return ErrUsage
+	}
+	err := os.Remove(sessionPath(env))
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(env.Out, "Not unlocked.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Out, "Locked; cached key deleted.")
+	return nil
+}
+
+// readSecret returns the secret from a key file, a passphrase file or the
+// environment variable envVar, in that order. ok is false when none is set.
+func readSecret(keyFile, passFile, envVar string) (sec memory.EncryptionSecret, ok bool, err error) {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return sec, false, fmt.Errorf("read key file: %w", err)
+		}
+		return memory.EncryptionSecret{KeyFile: data}, true, nil
+	}
+	if passFile == "" && envVar == "" {
+		return sec, false, nil
+	}
+	pass, err := readPassphrase(passFile, envVar)
+	if err != nil || pass == "" {
+		return sec, false, err
+	}
+	return memory.EncryptionSecret{Passphrase: pass}, true, nil
+}
+
+// unlock unlocks an encrypted store with the configured key file,
+// $FLYNN_PASSPHRASE or the key cached by "flynn unlock".
+func (e *Env) unlock(ctx context.Context, store *memory.Store) error {
+	locked, err := store.Locked(ctx)
+	if err != nil || !locked {
+		return err
+	}
+
+	if path := e.Config.Encryption.KeyFile; path != "" {
+		sec, _, err := readSecret(path, "", "")
+		if err != nil {
+			return err
+		}
+		if err := store.Unlock(ctx, sec); err == nil {
+			return nil
+		} else if !errors.Is(err, memory.ErrWrongKey) {
+			return err
+		}
+	}
+	if pass := os.Getenv(encryptionPassphraseEnv); pass != "" {
+		err := store.Unlock(ctx, memory.EncryptionSecret{Passphrase: pass})
+		if err == nil || !errors.Is(err, memory.ErrWrongKey) {
+			return err
+		}
+		return fmt.Errorf("$%s: %w", encryptionPassphraseEnv, err)
+	}
+	if session, ok := loadSession(e); ok {
+		if err := store.UnlockKey(ctx, session.Key); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w; run \"flynn unlock\" or set $%s", memory.ErrLocked, encryptionPassphraseEnv)
+}
+
+// ============================================================
+// Unlock sessions
+// ============================================================
+
+// unlockSession is the key cached by "flynn unlock".
+type unlockSession struct {
+	Database string `json:"database"` // personal.db the key unlocks
+	Key      []byte `json:"key"`
+	Expires  int64  `json:"expires"`
+}
+
+// sessionPath prefers the per-user runtime directory, which is private and
+// cleared on logout.
+func sessionPath(env *Env) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "flynn", "unlock.json")
+	}
+	return filepath.Join(env.Config.Paths.CacheDir, "unlock.json")
+}
+
+// loadSession returns the cached key for the configured database unless it
+// is missing or expired. Expired sessions are deleted.
+func loadSession(env *Env) (*unlockSession, bool) {
+	path := sessionPath(env)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var session unlockSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, false
+	}
+	if time.Now().Unix() >= session.Expires {
+		os.Remove(path)
+		return nil, false
+	}
+	if session.Database != env.Config.Paths.PersonalDB {
+		return nil, false
+	}
+	return &session, true
+}
+
+func saveSession(env *Env, session *unlockSession) error {
+	path := sessionPath(env)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,722 @@
+// Package cli provides the "flynn graph" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/graph"
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+var graphCommand = &Command{
+	Name:    "graph",
+	Summary: "Query and explore the team knowledge graph",
+	Usage: `Usage: flynn graph <subcommand> [arguments]
+
+Subcommands:
+  query <query> [--limit n] [--json] [--sql]
+                                    Run a pattern query and print the rows
+  path <from> <to> [traversal flags] [--max-hops n] [--json]
+                                    Show the shortest path between two entities
+  neighbors <entity> [traversal flags] [--hops n] [--limit n] [--json]
+                                    List entities within n hops (default 2)
+  dedupe [--min-score n] [--limit n] [--apply] [--json]
+                                    List likely duplicate entities; --apply
+                                    merges every listed pair
+  merge <keep> <drop>               Fold one entity into another
+  distinct <a> <b>                  Record that two entities are different
+  alias <entity> <name>             Record another name for an entity
+  ingest-go <dir|file.go> [--watch interval] [--json]
+                                    Record the packages, files, types, functions
+                                    and methods of Go code and how they relate
+  ask <question> [--top-k n] [--json]
+                                    Answer a question from ingested documents,
+                                    citing the file and lines of each source
+  export [--format f] [--type a,b] [--around entity] [--hops n] [-o file]
+                                    Write the graph, or part of it, as json,
+                                    graphml, dot, csv or jsonld
+  import <file> [--format json|csv] [--json]
+                                    Merge a json or csv export into the graph
+
+Traversal flags:
+  --relations a,b                   Only follow these relation types
+  --min-confidence n                Ignore relations below this confidence
+  --directed                        Only follow relations from source to target
+
+Go code becomes package, file, type, interface, function and method
+entities linked by contains, imports, defines, implements, calls and embeds.
+Symbols are named "pkg.Name" and "pkg.Type.Method", so
+
+  MATCH (t)-[:implements]->(i:interface {name: "subagent.Subagent"}) RETURN t
+
+lists the implementations of an interface. Packages whose code did not change
+are skipped; --watch ingests again whenever a Go file changes.
+
+ask ranks document chunks by full-text relevance (and vector similarity when
+the model can embed text), gives the best [graph] ask_top_k of them to the
+configured model within ask_context_chars, and prints its answer with
+[doc:path#chunk] citations followed by the file and lines each one refers
+to. Without a model it prints the most relevant passages.
+
+export writes to stdout without -o and otherwise picks the format from the
+file extension. json keeps everything, including aliases, and is what import
+reads back. graphml and dot open in graph tools such as Gephi, yEd and
+Graphviz; jsonld uses schema.org names for the standard properties. csv
+writes a node list and an edge list, so -o graph.csv writes
+graph.nodes.csv and graph.edges.csv. --type keeps entities of those types and
+--around keeps the entities within --hops (default 2) of one entity; only
+relations between kept entities are written.
+
+import resolves entities by name and alias as ingestion does, so an entity
+the graph already knows under another spelling is merged, not duplicated. A
+csv import reads the node and edge lists beside the given file; nodes need a
+name column and edges source and target columns, which refer to node ids or
+else to entity names.
+
+Entities are given by ID or by a name or alias that matches only one.
+dedupe keeps the entity with more relations, then the more important one.
+
+Queries match patterns of entities and relations:
+
+  MATCH (p:Person)-[:works_on]->(proj:Project)-[:uses]->(t)
+  WHERE t.name = "Postgres"
+  RETURN p, proj LIMIT 10
+
+  (n:Type {name: "x"})   an entity; the label is its type
+  -[r:uses|needs]->      a relation of either type; <-[]- and -[]- also match
+  -[*1..3]->             a path of 1 to 3 relations (at most 6)
+
+WHERE compares properties (name, type, description, importance on entities;
+type, confidence on relations) with =, <>, <, >, CONTAINS, STARTS WITH and
+ENDS WITH, combined with AND, OR and NOT. Names and types ignore case.
+Queries only see the current tenant. Without LIMIT, --limit rows are
+returned (default 50).`,
+	Run: runGraph,
+}
+
+func runGraph(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	switch args[0] {
+	case "query":
+		return graphQuery(ctx, env, args[1:])
+	case "path":
+		return graphPath(ctx, env, args[1:])
+	case "neighbors":
+		return graphNeighbors(ctx, env, args[1:])
+	case "dedupe":
+		return graphDedupe(ctx, env, args[1:])
+	case "merge":
+		return graphMerge(ctx, env, args[1:])
+	case "distinct":
+		return graphDistinct(ctx, env, args[1:])
+	case "alias":
+		return graphAlias(ctx, env, args[1:])
+	case "ingest-go":
+		return graphIngestGo(ctx, env, args[1:])
+	case "ask":
+		return graphAsk(ctx, env, args[1:])
+	case "export":
+		return graphExport(ctx, env, args[1:])
+	case "import":
+		return graphImport(ctx, env, args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+func graphQuery(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph query")
+	limit := fs.Int("limit", graph.DefaultQueryLimit, "maximum rows when the query has no LIMIT")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	showSQL := fs.Bool("sql", false, "print the compiled SQL instead of running it")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return ErrUsage
+	}
+	text := strings.Join(pos, " ")
+
+	if *showSQL {
+		q, err := graph.ParseQuery(text)
+		if err != nil {
+			return err
+		}
+		query, _, err := q.Compile(env.TenantID())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, query)
+		return nil
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	result, err := svc.Query(ctx, text, *limit)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if len(result.Rows) == 0 {
+		fmt.Fprintln(env.Out, "No matches.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(result.Columns, "\t")))
+	for _, row := range result.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = formatGraphValue(v)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+	fmt.Fprintf(env.Out, "%d rows\n", len(result.Rows))
+	return nil
+}
+
+// traversalFlags registers the flags shared by path and neighbors.
+func traversalFlags(fs *flag.FlagSet) func() memory.TraversalOptions {
+	relations := fs.String("relations", "", "comma-separated relation types to follow")
+	minConfidence := fs.Float64("min-confidence", 0, "ignore relations below this confidence")
+	directed := fs.Bool("directed", false, "only follow relations from source to target")
+	return func() memory.TraversalOptions {
+		opts := memory.TraversalOptions{MinConfidence: *minConfidence, Directed: *directed}
+		for _, r := range strings.Split(*relations, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				opts.RelationTypes = append(opts.RelationTypes, r)
+			}
+		}
+		return opts
+	}
+}
+
+func graphPath(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph path")
+	traversal := traversalFlags(fs)
+	maxHops := fs.Int("max-hops", memory.DefaultTraversalDepth, "longest path to look for")
+	asJSON := fs.Bool("json", false, "print the path as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	opts := traversal()
+	opts.MaxDepth = *maxHops
+	path, err := svc.FindPath(ctx, pos[0], pos[1], opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		out := map[string]any{"from": pos[0], "to": pos[1], "found": path != nil}
+		if path != nil {
+			out["hops"] = path.Hops()
+			out["path"] = graph.FormatPath(path)
+			out["triples"] = graph.PathTriples(path)
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if path == nil {
+		fmt.Fprintf(env.Out, "No path between %q and %q within %d hops.\n", pos[0], pos[1], *maxHops)
+		return nil
+	}
+	fmt.Fprintln(env.Out, graph.FormatPath(path))
+	fmt.Fprintf(env.Out, "%d hops\n", path.Hops())
+	return nil
+}
+
+func graphNeighbors(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph neighbors")
+	traversal := traversalFlags(fs)
+	hops := fs.Int("hops", 2, "how many relations away to look")
+	limit := fs.Int("limit", 100, "maximum entities to list")
+	asJSON := fs.Bool("json", false, "print the neighborhood as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	opts := traversal()
+	opts.Limit = *limit
+	sub, err := svc.Neighbors(ctx, pos[0], *hops, opts)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+	for _, e := range sub.Entities {
+		names[e.ID] = e.Name
+	}
+	if *asJSON {
+		type neighbor struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Hops int    `json:"hops"`
+		}
+		out := struct {
+			Entities  []neighbor `json:"entities"`
+			Relations []string   `json:"relations"`
+		}{Entities: []neighbor{}, Relations: []string{}}
+		for _, e := range sub.Entities {
+			out.Entities = append(out.Entities, neighbor{e.Name, e.EntityType, sub.Depth[e.ID]})
+		}
+		for _, r := range sub.Relations {
+			out.Relations = append(out.Relations, fmt.Sprintf("%s --%s--> %s", names[r.SourceID], r.RelationType, names[r.TargetID]))
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOPS\tENTITY\tTYPE")
+	for _, e := range sub.Entities {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", sub.Depth[e.ID], e.Name, e.EntityType)
+	}
+	tw.Flush()
+	if len(sub.Relations) > 0 {
+		fmt.Fprintln(env.Out, "\nRelations:")
+		for _, r := range sub.Relations {
+			fmt.Fprintf(env.Out, "  %s --%s--> %s\n", names[r.SourceID], r.RelationType, names[r.TargetID])
+		}
+	}
+	return nil
+}
+
+func graphDedupe(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph dedupe")
+	minScore := fs.Float64("min-score", graph.DefaultDedupeScore, "lowest name similarity to list")
+	limit := fs.Int("limit", 50, "maximum pairs to list")
+	apply := fs.Bool("apply", false, "merge every listed pair")
+	asJSON := fs.Bool("json", false, "print the pairs as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	pairs, err := svc.DuplicateCandidates(ctx, *minScore, *limit)
+	if err != nil {
+		return err
+	}
+
+	merged := 0
+	if *apply {
+		// An entity merged away earlier in the run cannot be merged again
+		gone := map[string]bool{}
+		for _, p := range pairs {
+			if gone[p.Keep.ID] || gone[p.Drop.ID] {
+				continue
+			}
+			if _, err := svc.Merge(ctx, p.Keep, p.Drop); err != nil {
+				return fmt.Errorf("merge %q into %q: %w", p.Drop.Name, p.Keep.Name, err)
+			}
+			gone[p.Drop.ID] = true
+			merged++
+		}
+	}
+
+	if *asJSON {
+		type side struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			Type      string `json:"type"`
+			Relations int    `json:"relations"`
+		}
+		type pair struct {
+			Keep   side    `json:"keep"`
+			Drop   side    `json:"drop"`
+			Score  float64 `json:"score"`
+			Reason string  `json:"reason"`
+		}
+		out := struct {
+			Pairs  []pair `json:"pairs"`
+			Merged int    `json:"merged"`
+		}{Pairs: []pair{}, Merged: merged}
+		for _, p := range pairs {
+			out.Pairs = append(out.Pairs, pair{
+				Keep:   side{p.Keep.ID, p.Keep.Name, p.Keep.EntityType, p.KeepRelations},
+				Drop:   side{p.Drop.ID, p.Drop.Name, p.Drop.EntityType, p.DropRelations},
+				Score:  p.Score,
+				Reason: p.Reason,
+			})
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if len(pairs) == 0 {
+		fmt.Fprintln(env.Out, "No likely duplicates.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCORE\tKEEP\tDROP\tREASON")
+	for _, p := range pairs {
+		fmt.Fprintf(tw, "%.2f\t%s\t%s\t%s\n", p.Score,
+			formatDedupeSide(p.Keep, p.KeepRelations), formatDedupeSide(p.Drop, p.DropRelations), p.Reason)
+	}
+	tw.Flush()
+	if *apply {
+		fmt.Fprintf(env.Out, "Merged %d of %d pairs.\n", merged, len(pairs))
+	} else {
+		fmt.Fprintf(env.Out, "%d pairs. Merge one with \"flynn graph merge <keep> <drop>\", keep one apart with\n\"flynn graph distinct <a> <b>\", or merge them all with --apply.\n", len(pairs))
+	}
+	return nil
+}
+
+func formatDedupeSide(e *memory.Entity, relations int) string {
+	return fmt.Sprintf("%s (%s, %d rel) %s", e.Name, e.EntityType, relations, e.ID)
+}
+
+// graphEntities resolves the entity references of merge, distinct and alias.
+func graphEntities(ctx context.Context, svc *graph.Service, refs ...string) ([]*memory.Entity, error) {
+	out := make([]*memory.Entity, 0, len(refs))
+	for _, ref := range refs {
+		e, err := svc.Entity(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func graphMerge(ctx context.Context, env *Env, args []string) error {
+	if len(args) != 2 {
+		return ErrUsage
+	}
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	entities, err := graphEntities(ctx, svc, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	keep, drop := entities[0], entities[1]
+	if keep.ID == drop.ID {
+		return fmt.Errorf("%q and %q are the same entity", args[0], args[1])
+	}
+	merged, err := svc.Merge(ctx, keep, drop)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Merged %s (%s) into %s (%s).\n", drop.Name, drop.EntityType, merged.Name, merged.EntityType)
+	return nil
+}
+
+func graphDistinct(ctx context.Context, env *Env, args []string) error {
+	if len(args) != 2 {
+		return ErrUsage
+	}
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	entities, err := graphEntities(ctx, svc, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if entities[0].ID == entities[1].ID {
+		return fmt.Errorf("%q and %q are the same entity", args[0], args[1])
+	}
+	if err := svc.Store.MarkDistinct(ctx, svc.TenantID, entities[0].ID, entities[1].ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "%s and %s will no longer be offered as duplicates.\n", entities[0].Name, entities[1].Name)
+	return nil
+}
+
+func graphAlias(ctx context.Context, env *Env, args []string) error {
+	if len(args) != 2 {
+		return ErrUsage
+	}
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	entities, err := graphEntities(ctx, svc, args[0])
+	if err != nil {
+		return err
+	}
+	if err := svc.Store.AddAlias(ctx, svc.TenantID, entities[0].ID, args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "%s is now also known as %s.\n", entities[0].Name, args[1])
+	return nil
+}
+
+func graphIngestGo(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph ingest-go")
+	watch := fs.Duration("watch", 0, "poll for changes at this interval and ingest again")
+	asJSON := fs.Bool("json", false, "print each result as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	ingest := func() error {
+		result, err := svc.IngestGo(ctx, pos[0])
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			data, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(env.Out, string(data))
+			return nil
+		}
+		fmt.Fprintf(env.Out, "%s: %d packages, %d updated, %d unchanged, %d removed\n",
+			result.Module, result.Packages, result.Updated, result.Unchanged, result.Removed)
+		if result.Updated > 0 || result.Pruned > 0 {
+			fmt.Fprintf(env.Out, "  wrote %d entities and %d relations, pruned %d entities\n", result.Entities, result.Relations, result.Pruned)
+		}
+		return nil
+	}
+	if err := ingest(); err != nil || *watch <= 0 {
+		return err
+	}
+
+	stamp, err := graph.GoTreeStamp(pos[0])
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(*watch)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		next, err := graph.GoTreeStamp(pos[0])
+		if err != nil {
+			return err
+		}
+		if next == stamp {
+			continue
+		}
+		stamp = next
+		if err := ingest(); err != nil {
+			fmt.Fprintf(env.Err, "ingest: %v\n", err)
+		}
+	}
+}
+
+func graphAsk(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph ask")
+	topK := fs.Int("top-k", 0, "most document chunks to answer from (default [graph] ask_top_k)")
+	asJSON := fs.Bool("json", false, "print the answer and its sources as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	answer, err := svc.Ask(ctx, strings.Join(pos, " "), *topK)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(answer, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if len(answer.Sources) == 0 {
+		fmt.Fprintln(env.Out, "No ingested document matches the question.")
+		return nil
+	}
+	sources := answer.Cited()
+	switch {
+	case answer.Answer == "":
+		fmt.Fprintln(env.Out, "No model is configured to answer; the most relevant passages are:")
+		sources = answer.Sources
+	case len(sources) == 0:
+		fmt.Fprintln(env.Out, answer.Answer)
+		fmt.Fprintln(env.Out, "\nThe answer cites no source. It was given:")
+		sources = answer.Sources
+	default:
+		fmt.Fprintln(env.Out, answer.Answer)
+		fmt.Fprintln(env.Out, "\nSources:")
+	}
+	for _, src := range sources {
+		fmt.Fprintf(env.Out, "  [%s] %s\n", src.Ref, src.Location())
+		if answer.Answer == "" {
+			fmt.Fprintf(env.Out, "    %s\n", src.Excerpt)
+		}
+	}
+	return nil
+}
+
+func graphExport(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph export")
+	format := fs.String("format", "", strings.Join(graph.ExportFormats, ", ")+" (default from file extension, else json)")
+	types := fs.String("type", "", "comma-separated entity types to keep")
+	around := fs.String("around", "", "only export the neighborhood of this entity")
+	hops := fs.Int("hops", 2, "size of the --around neighborhood")
+	output := fs.String("o", "", "write to file instead of stdout")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	opts := graph.ExportOptions{
+		SelectOptions: graph.SelectOptions{Around: *around, Hops: *hops},
+		Format:        *format,
+	}
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.Types = append(opts.Types, t)
+		}
+	}
+
+	if *output == "" {
+		if opts.Format == "" {
+			opts.Format = "json"
+		}
+		snap, err := svc.Select(ctx, opts.SelectOptions)
+		if err != nil {
+			return err
+		}
+		return snap.Encode(env.Out, opts.Format)
+	}
+	result, err := svc.ExportGraph(ctx, *output, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Exported %d entities and %d relations as %s to %s\n",
+		result.Entities, result.Relations, result.Format, strings.Join(result.Files, " and "))
+	return nil
+}
+
+func graphImport(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "graph import")
+	format := fs.String("format", "", "json or csv (default from file extension, else json)")
+	asJSON := fs.Bool("json", false, "print the counts as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	result, err := svc.ImportGraph(ctx, pos[0], *format)
+	if result == nil {
+		return err
+	}
+	if *asJSON {
+		data, jerr := json.MarshalIndent(result, "", "  ")
+		if jerr != nil {
+			return jerr
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return err
+	}
+	fmt.Fprintf(env.Out, "Imported: %d entities created, %d merged into existing ones, %d relations added",
+		result.Entities, result.Merged, result.Relations)
+	if result.Skipped > 0 {
+		fmt.Fprintf(env.Out, ", %d skipped", result.Skipped)
+	}
+	fmt.Fprintln(env.Out, ".")
+	return err
+}
+
+// formatGraphValue renders an entity as "name (type)", a relation as
+// "source -type-> target" and anything else as is.
+func formatGraphValue(v any) string {
+	m, ok := v.(map[string]any)
+	if !ok {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprint(v)
+	}
+	if _, isRel := m["source"]; isRel {
+		return fmt.Sprintf("%v -%v-> %v", m["source"], m["type"], m["target"])
+	}
+	return fmt.Sprintf("%v (%v)", m["name"], m["type"])
+}
@@ -0,0 +1,157 @@
+// Package cli provides the "flynn index" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/graph"
+)
+
+var indexCommand = &Command{
+	Name:    "index",
+	Summary: "Keep directory trees ingested into the team knowledge graph",
+	Usage: `Usage: flynn index <dir>... [--max-files n] [--quiet] [--json]
+       flynn index --status [--json]
+
+Ingests the files of each directory into the knowledge graph. Files ignored
+by .gitignore or .git/info/exclude, larger than [index] max_file_kb, or
+binary are skipped. Each file's size, modification time and content hash are
+recorded, so running again only reads files that changed and only ingests
+those whose content did. Files that were deleted are removed along with
+their chunks and the entities no other document mentions. Go code is
+ingested by structure, as with "flynn graph ingest-go".
+
+A run ingests at most --max-files changed files (default [index]
+batch_files; 0 is no limit) and leaves the rest pending. A run that was
+interrupted or left files pending is resumed by the next one.
+
+  --status    list indexed directories and how their last run ended
+
+The daemon indexes the [index] paths every interval_minutes.`,
+	Run: runIndex,
+}
+
+// indexProgressEvery is how many changed files pass between progress lines.
+const indexProgressEvery = 25
+
+func runIndex(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "index")
+	maxFiles := fs.Int("max-files", env.Config.Index.BatchFiles, "most changed files to ingest per directory; 0 is no limit")
+	status := fs.Bool("status", false, "list indexed directories")
+	quiet := fs.Bool("quiet", false, "do not report progress")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	dirs, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *status {
+		if len(dirs) != 0 {
+			return ErrUsage
+		}
+		return indexStatus(ctx, env, *asJSON)
+	}
+	if len(dirs) == 0 {
+		return ErrUsage
+	}
+
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	indexer := *svc.Indexer
+	indexer.MaxFiles = *maxFiles
+	if !*quiet && !*asJSON {
+		indexer.Progress = func(p graph.IndexProgress) {
+			if p.Done%indexProgressEvery == 0 || p.Done == p.Total {
+				fmt.Fprintf(env.Err, "  %d/%d %s\n", p.Done, p.Total, p.Path)
+			}
+		}
+	}
+
+	var results []*graph.IndexResult
+	for _, dir := range dirs {
+		result, err := indexer.Index(ctx, svc.TenantID, dir)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", dir, err)
+		}
+		results = append(results, result)
+		if !*asJSON {
+			printIndexResult(env, result)
+		}
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+	}
+	return nil
+}
+
+func printIndexResult(env *Env, r *graph.IndexResult) {
+	if r.Resumed {
+		fmt.Fprintf(env.Out, "%s (resumed an interrupted run)\n", r.Root)
+	} else {
+		fmt.Fprintln(env.Out, r.Root)
+	}
+	fmt.Fprintf(env.Out, "  %d files: %d added, %d updated, %d unchanged; %d removed, %d skipped\n",
+		r.Files, r.Added, r.Updated, r.Unchanged, r.Removed, r.Skipped)
+	for _, code := range r.Code {
+		fmt.Fprintf(env.Out, "  Go module %s: %d packages, %d updated, %d removed\n", code.Module, code.Packages, code.Updated, code.Removed)
+	}
+	if r.Failed > 0 {
+		fmt.Fprintf(env.Out, "  %d files failed:\n", r.Failed)
+		for _, e := range r.Errors {
+			fmt.Fprintf(env.Out, "    %s\n", e)
+		}
+	}
+	if !r.Complete() {
+		fmt.Fprintf(env.Out, "  %d changed files pending; run again to continue\n", r.Pending)
+	}
+}
+
+func indexStatus(ctx context.Context, env *Env, asJSON bool) error {
+	svc, err := env.Graph()
+	if err != nil {
+		return err
+	}
+	roots, err := svc.Store.ListIndexRoots(ctx, svc.TenantID)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(roots, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+	if len(roots) == 0 {
+		fmt.Fprintln(env.Out, "No directories indexed.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOT\tFILES\tPENDING\tLAST RUN\tSTATUS")
+	for _, r := range roots {
+		state := "complete"
+		switch {
+		case r.Interrupted():
+			state = "interrupted"
+		case r.Pending > 0:
+			state = "pending"
+		}
+		if r.LastError != "" {
+			state += ": " + r.LastError
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", r.Root, r.Files, r.Pending,
+			time.Unix(r.StartedAt, 0).Format("2006-01-02 15:04"), state)
+	}
+	return tw.Flush()
+}
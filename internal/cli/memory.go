@@ -0,0 +1,551 @@
+// Package cli provides the "flynn memory" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/config"
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+var memoryCommand = &Command{
+	Name:    "memory",
+	Summary: "Inspect and maintain personal memory",
+	Usage: `Usage: flynn memory <subcommand> [arguments]
+
+Subcommands:
+  list [filters] [--json]           List remembered facts, newest first
+  search <query> [filters] [--json] Full-text search across memories
+  edit <key> <value> [--type profile|action|episode|entity|team] [--confidence n]
+                                    Set a fact (creates profile fields, actions
+                                    and team facts)
+  forget <key> | --match <glob> [filters] [--dry-run]
+                                    Delete facts and their history
+  export [filters] [--format json|markdown] [-o file]
+                                    Export memories
+  import <file>                     Import a JSON export
+  why <field|trigger> [--json]      Show where a fact came from and its earlier versions
+  restore <version-id>              Make an earlier version the current value
+  consolidate [--dry-run] [--older-than days] [--json]
+                                    Archive facts whose confidence has decayed,
+                                    merge duplicates, archive superseded facts
+                                    and summarize clusters of old facts
+  promote <field|trigger> [--type profile|action] [--as key] [--overwrite]
+                                    Share a personal fact or action with the team
+
+Filters:
+  --type profile,action,episode,entity,team
+                                    Memory kinds (default all)
+  --min-confidence n, --max-confidence n
+  --older-than age, --newer-than age
+                                    Age such as 12h, 30d or 2w
+  --match glob                      Key or value pattern, e.g. "*editor*"
+  --limit n
+
+Confidence rises when a fact is re-stated or used without correction,
+halves every [memory] decay_half_life_days without confirmation, and drops
+when contradicted. Facts below min_confidence are no longer recalled.
+
+Team memory is shared by everyone in the tenant and recalled in team threads.
+Team members with the "admin" role may change any team memory, "member" only
+those they added, and "viewer" none. Your role is that of the [[tenant.members]]
+entry named by [tenant] member_id; without one, team memory is read only.
+
+Version IDs may be abbreviated to any unique prefix.`,
+	Run: runMemory,
+}
+
+func runMemory(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	store, err := env.Store()
+	if err != nil {
+		return err
+	}
+	policy := confidencePolicy(env.Config.Memory)
+	memStore := memory.NewMemoryStore(store.Personal())
+	memStore.SetConfidencePolicy(policy)
+	retrieval := memory.NewEnhancedMemoryStore(memStore, store.Personal())
+	manager := memory.NewMemoryManager(store.Personal(), store.Team(), env.TenantID())
+	manager.SetConfidencePolicy(policy)
+	manager.SetTeamActor(env.TeamActor())
+
+	switch args[0] {
+	case "list", "ls":
+		return memoryList(ctx, env, manager, args[1:], false)
+	case "search":
+		return memoryList(ctx, env, manager, args[1:], true)
+	case "edit", "set":
+		return memoryEdit(ctx, env, manager, args[1:])
+	case "forget", "rm":
+		return memoryForget(ctx, env, manager, args[1:])
+	case "export":
+		return memoryExport(ctx, env, manager, args[1:])
+	case "import":
+		return memoryImport(ctx, env, manager, args[1:])
+	case "why":
+		return memoryWhy(ctx, env, memStore, args[1:])
+	case "restore":
+		return memoryRestore(ctx, env, memStore, args[1:])
+	case "consolidate":
+		return memoryConsolidate(ctx, env, retrieval, args[1:])
+	case "promote":
+		return memoryPromote(ctx, env, manager, args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+func memoryConsolidate(ctx context.Context, env *Env, retrieval *memory.EnhancedMemoryStore, args []string) error {
+	fs := newFlagSet(env, "memory consolidate")
+	dryRun := fs.Bool("dry-run", false, "report changes without writing them")
+	olderThan := fs.Int("older-than", env.Config.Memory.ConsolidateAfterDays, "summarize facts older than this many days")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+
+	report, err := retrieval.Consolidate(ctx, memory.ConsolidationOptions{
+		OlderThanDays: *olderThan,
+		DryRun:        *dryRun,
+		Model:         env.Model(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+	fmt.Fprint(env.Out, report.String())
+	return nil
+}
+
+func memoryWhy(ctx context.Context, env *Env, memStore *memory.MemoryStore, args []string) error {
+	fs := newFlagSet(env, "memory why")
+	asJSON := fs.Bool("json", false, "print versions as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return ErrUsage
+	}
+	subject := strings.Join(pos, " ")
+
+	// Profile fields first, then action triggers
+	kind := "profile"
+	versions, err := memStore.History(ctx, kind, subject)
+	if err == nil && len(versions) == 0 {
+		kind = "action"
+		versions, err = memStore.History(ctx, kind, subject)
+	}
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		// Facts written before version history was kept have no provenance
+		if value, _ := memStore.GetProfileField(ctx, subject); value != "" {
+			fmt.Fprintf(env.Out, "profile %q = %s\n(no recorded source)\n", subject, value)
+			return nil
+		}
+		if action, _ := memStore.GetAction(ctx, subject); action != "" {
+			fmt.Fprintf(env.Out, "action %q = %s\n(no recorded source)\n", subject, action)
+			return nil
+		}
+		return fmt.Errorf("no memory history for %q", subject)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(versions, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	var current string
+	if kind == "profile" {
+		current, err = memStore.GetProfileField(ctx, subject)
+	} else {
+		current, err = memStore.GetAction(ctx, subject)
+	}
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		fmt.Fprintf(env.Out, "%s %q is not currently remembered.\n", kind, subject)
+	} else {
+		fmt.Fprintf(env.Out, "%s %q = %s\n", kind, subject, current)
+	}
+
+	for i, v := range versions {
+		label := "earlier"
+		if i == 0 && v.Content == current {
+			label = "current"
+		}
+		fmt.Fprintf(env.Out, "\n[%s] %s  %s  (%s)\n", shortID(v.ID), label, time.Unix(v.CreatedAt, 0).Format("2006-01-02 15:04"), v.Source)
+		fmt.Fprintf(env.Out, "  value:      %s\n", v.Content)
+		fmt.Fprintf(env.Out, "  confidence: %.2f\n", v.Confidence)
+		if v.SourceMessageID != "" {
+			fmt.Fprintf(env.Out, "  message:    %s\n", v.SourceMessageID)
+		}
+		if v.Snippet != "" {
+			fmt.Fprintf(env.Out, "  said:       %q\n", v.Snippet)
+		}
+	}
+	return nil
+}
+
+func memoryRestore(ctx context.Context, env *Env, memStore *memory.MemoryStore, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+	v, err := memStore.Restore(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Restored %s %q = %s\n", v.Kind, v.Subject, v.Content)
+	return nil
+}
+
+// confidencePolicy maps the [memory] config onto the memory lifecycle.
+func confidencePolicy(cfg config.MemoryConfig) memory.ConfidencePolicy {
+	return memory.ConfidencePolicy{
+		Restate:      cfg.RestateRate,
+		Use:          cfg.UseRate,
+		Contradict:   cfg.ContradictFactor,
+		HalfLifeDays: cfg.DecayHalfLifeDays,
+		Min:          cfg.MinConfidence,
+	}
+}
+
+// memoryFilterFlags registers the shared filter flags.
+func memoryFilterFlags(fs *flag.FlagSet) func() (memory.MemoryFilter, error) {
+	kinds := fs.String("type", "", "memory kinds: profile, action, episode, entity, team (comma-separated)")
+	minConf := fs.Float64("min-confidence", 0, "minimum confidence")
+	maxConf := fs.Float64("max-confidence", 0, "maximum confidence")
+	olderThan := fs.String("older-than", "", "only memories last updated before this age (e.g. 30d)")
+	newerThan := fs.String("newer-than", "", "only memories updated within this age (e.g. 7d)")
+	match := fs.String("match", "", "glob matched against key or value")
+	limit := fs.Int("limit", 0, "maximum results")
+
+	return func() (memory.MemoryFilter, error) {
+		filter := memory.MemoryFilter{
+			MinConfidence: *minConf,
+			MaxConfidence: *maxConf,
+			Pattern:       *match,
+			Limit:         *limit,
+		}
+		for _, k := range strings.Split(*kinds, ",") {
+			switch k = strings.TrimSpace(k); k {
+			case "":
+			case memory.KindProfile, memory.KindAction, memory.KindEpisode, memory.KindEntity, memory.KindTeam:
+				filter.Kinds = append(filter.Kinds, k)
+			default:
+				return filter, fmt.Errorf("unknown memory type %q", k)
+			}
+		}
+		var err error
+		if filter.OlderThan, err = parseAge(*olderThan); err != nil {
+			return filter, err
+		}
+		if filter.NewerThan, err = parseAge(*newerThan); err != nil {
+			return filter, err
+		}
+		return filter, nil
+	}
+}
+
+func memoryList(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string, search bool) error {
+	name := "memory list"
+	if search {
+		name = "memory search"
+	}
+	fs := newFlagSet(env, name)
+	buildFilter := memoryFilterFlags(fs)
+	asJSON := fs.Bool("json", false, "print as JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if search == (len(pos) == 0) {
+		return ErrUsage
+	}
+	filter, err := buildFilter()
+	if err != nil {
+		return err
+	}
+	if search {
+		filter.Query = strings.Join(pos, " ")
+		if filter.Limit == 0 {
+			filter.Limit = 20
+		}
+	}
+
+	items, err := manager.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if items == nil {
+			items = []memory.MemoryItem{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+	if len(items) == 0 {
+		fmt.Fprintln(env.Out, "No memories found.")
+		return nil
+	}
+	printMemoryItems(env, items)
+	return nil
+}
+
+func printMemoryItems(env *Env, items []memory.MemoryItem) {
+	tw := tabwriter.NewWriter(env.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tKEY\tVALUE\tCONF\tUPDATED")
+	for _, item := range items {
+		kind := item.Kind
+		if item.Type != "" {
+			kind += "/" + item.Type
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%s\n", kind, clip(item.Key, 40), clip(item.Value, 60),
+			item.Confidence, time.Unix(item.UpdatedAt, 0).Format("2006-01-02"))
+	}
+	tw.Flush()
+}
+
+func memoryEdit(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string) error {
+	fs := newFlagSet(env, "memory edit")
+	kind := fs.String("type", memory.KindProfile, "memory kind: profile, action, episode, entity or team")
+	confidence := fs.Float64("confidence", 0, "confidence (default 1.0 for facts you set)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) < 2 {
+		return ErrUsage
+	}
+	key, value := pos[0], strings.Join(pos[1:], " ")
+
+	if err := manager.Edit(ctx, *kind, key, value, *confidence); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Set %s %q = %s\n", *kind, key, value)
+	return nil
+}
+
+func memoryPromote(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string) error {
+	fs := newFlagSet(env, "memory promote")
+	kind := fs.String("type", "", "personal memory kind: profile or action (default: whichever has the key)")
+	as := fs.String("as", "", "team key (default: the personal key)")
+	overwrite := fs.Bool("overwrite", false, "replace a different team value")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	fact, err := manager.Promote(ctx, pos[0], memory.PromoteOptions{Kind: *kind, As: *as, Overwrite: *overwrite})
+	if err != nil {
+		if errors.Is(err, memory.ErrPermission) {
+			if actor := env.TeamActor(); actor.Role != "" {
+				if strings.Contains(err.Error(), fmt.Sprintf("%q", actor.Role)) {
+					return err
+				}
+				return fmt.Errorf("%w (your role is %q)", err, actor.Role)
+			}
+			return fmt.Errorf("%w; set [tenant] member_id to your [[tenant.members]] id", err)
+		}
+		return err
+	}
+	fmt.Fprintf(env.Out, "Shared team %s %q = %s\n", fact.Kind, fact.Key, fact.Value)
+	return nil
+}
+
+func memoryForget(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string) error {
+	fs := newFlagSet(env, "memory forget")
+	buildFilter := memoryFilterFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "show what would be forgotten")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	filter, err := buildFilter()
+	if err != nil {
+		return err
+	}
+
+	var items []memory.MemoryItem
+	switch {
+	case len(pos) > 0 && filter.Pattern == "":
+		key := strings.Join(pos, " ")
+		kind := ""
+		if len(filter.Kinds) == 1 {
+			kind = filter.Kinds[0]
+		}
+		if items, err = manager.Lookup(ctx, kind, key); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return fmt.Errorf("nothing remembered as %q", key)
+		}
+	case len(pos) == 0 && filter.Pattern != "":
+		if items, err = manager.List(ctx, filter); err != nil {
+			return err
+		}
+	default:
+		// Bulk forgetting needs an explicit pattern
+		return ErrUsage
+	}
+
+	if len(items) == 0 {
+		fmt.Fprintln(env.Out, "No memories matched.")
+		return nil
+	}
+	printMemoryItems(env, items)
+	if *dryRun {
+		fmt.Fprintf(env.Out, "\nDry run: %d memories would be forgotten.\n", len(items))
+		return nil
+	}
+	n, err := manager.Forget(ctx, items)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "\nForgot %d memories.\n", n)
+	return nil
+}
+
+func memoryExport(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string) error {
+	fs := newFlagSet(env, "memory export")
+	buildFilter := memoryFilterFlags(fs)
+	format := fs.String("format", "", "json or markdown (default from file extension, else json)")
+	output := fs.String("o", "", "write to file instead of stdout")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+	filter, err := buildFilter()
+	if err != nil {
+		return err
+	}
+
+	doc, err := manager.Export(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = "json"
+		if strings.HasSuffix(strings.ToLower(*output), ".md") {
+			*format = "markdown"
+		}
+	}
+	var data []byte
+	switch *format {
+	case "json":
+		if data, err = json.MarshalIndent(doc, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case "markdown", "md":
+		data = []byte(memory.FormatMarkdown(doc.Items))
+	default:
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	if *output == "" {
+		_, err = env.Out.Write(data)
+		return err
+	}
+	// Memories are personal; keep the file private
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Exported %d memories to %s\n", len(doc.Items), *output)
+	return nil
+}
+
+func memoryImport(ctx context.Context, env *Env, manager *memory.MemoryManager, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	doc, err := memory.DecodeMemoryExport(data)
+	if err != nil {
+		return err
+	}
+	n, err := manager.Import(ctx, doc)
+	fmt.Fprintf(env.Out, "Imported %d of %d memories.\n", n, len(doc.Items))
+	return err
+}
+
+// parseAge parses durations with day and week units ("30d", "2w") as well
+// as anything time.ParseDuration accepts.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// clip shortens text for table cells.
+func clip(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
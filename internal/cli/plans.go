@@ -0,0 +1,430 @@
+// Package cli provides the "flynn plans" command.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/planlib"
+)
+
+var plansCommand = &Command{
+	Name:    "plans",
+	Summary: "List, share and run stored plans",
+	Usage: `Usage: flynn plans <subcommand> [arguments]
+
+Subcommands:
+  list                              List active plans with usage stats
+  show <id> [--format yaml|json]    Show a plan (human-readable by default)
+  export [<id>...] [-o file] [--format yaml|json]
+                                    Export plans (all when no IDs are given)
+  import <file> [--format yaml|json] [--replace]
+                                    Import plans; --replace updates plans for existing intents
+  delete <id>                       Deactivate a plan
+  run <id> [--var key=value]... [--dry-run]
+                                    Run a plan, or print it and its cost estimate
+  candidates [--status pending|promoted|rejected]
+                                    List plans learned from chat sessions
+  approve <candidate-id>            Store a learned plan now, replacing any plan
+                                    for its intent
+  reject <candidate-id>             Never store a learned plan
+
+Learned plans are stored once they have succeeded [plans] promote_after
+times, unless the intent already has a plan; approve replaces it. Plan and
+candidate IDs may be abbreviated to any unique prefix.`,
+	Run: runPlans,
+}
+
+func runPlans(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	store, err := env.Store()
+	if err != nil {
+		return err
+	}
+	lib := planlib.NewPlanLibrary(store.Team())
+
+	switch args[0] {
+	case "list", "ls":
+		return plansList(ctx, env, lib)
+	case "show":
+		return plansShow(ctx, env, lib, args[1:])
+	case "export":
+		return plansExport(ctx, env, lib, args[1:])
+	case "import":
+		return plansImport(ctx, env, lib, args[1:])
+	case "delete", "rm":
+		return plansDelete(ctx, env, lib, args[1:])
+	case "run":
+		return plansRun(ctx, env, lib, args[1:])
+	case "candidates":
+		return plansCandidates(ctx, env, lib, args[1:])
+	case "approve", "reject":
+		return plansReview(ctx, env, lib, args[0], args[1:])
+	default:
+		return ErrUsage
+	}
+}
+
+func plansList(ctx context.Context, env *Env, lib *planlib.PlanLibrary) error {
+	plans, err := lib.List(ctx, env.TenantID())
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		fmt.Fprintln(env.Out, "No plans stored.")
+		return nil
+	}
+
+	doc, err := lib.Export(ctx, env.TenantID())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(env.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tINTENT\tSTEPS\tUSES\tSUCCESS\tDESCRIPTION")
+	for _, p := range doc.Plans {
+		uses, rate := 0, "-"
+		if p.Stats != nil {
+			uses = p.Stats.UsageCount
+			if uses > 0 {
+				rate = fmt.Sprintf("%.0f%%", p.Stats.SuccessRate*100)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", shortID(p.ID), p.Intent, len(p.Steps), uses, rate, p.Description)
+	}
+	return tw.Flush()
+}
+
+func plansShow(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	fs := newFlagSet(env, "plans show")
+	format := fs.String("format", "", "output format: yaml or json")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	plan, err := resolvePlan(ctx, env, lib, pos[0])
+	if err != nil {
+		return err
+	}
+
+	if *format != "" {
+		doc, err := lib.Export(ctx, env.TenantID(), plan.ID)
+		if err != nil {
+			return err
+		}
+		data, err := planlib.EncodePlans(doc, *format)
+		if err != nil {
+			return err
+		}
+		_, err = env.Out.Write(data)
+		return err
+	}
+
+	fmt.Fprintf(env.Out, "ID: %s\n", plan.ID)
+	fmt.Fprintln(env.Out, planlib.FormatPlan(plan))
+
+	doc, err := lib.Export(ctx, env.TenantID(), plan.ID)
+	if err != nil {
+		return err
+	}
+	if shared := doc.Plans[0]; shared.Stats != nil {
+		s := shared.Stats
+		fmt.Fprintf(env.Out, "\nUsage: %d runs, %d succeeded, %d failed (%.0f%%)\n",
+			s.UsageCount, s.SuccessCount, s.FailureCount, s.SuccessRate*100)
+		if s.LastUsed > 0 {
+			fmt.Fprintf(env.Out, "Last used: %s\n", time.Unix(s.LastUsed, 0).Format(time.RFC3339))
+		}
+		if len(shared.Examples) > 0 {
+			fmt.Fprintln(env.Out, "\nExample requests:")
+			for _, ex := range shared.Examples {
+				fmt.Fprintf(env.Out, "  - %s\n", ex)
+			}
+		}
+	}
+	return nil
+}
+
+func plansExport(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	fs := newFlagSet(env, "plans export")
+	format := fs.String("format", "", "output format: yaml or json (default from file extension, else yaml)")
+	output := fs.String("o", "", "write to file instead of stdout")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(pos))
+	for _, ref := range pos {
+		plan, err := resolvePlan(ctx, env, lib, ref)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, plan.ID)
+	}
+
+	doc, err := lib.Export(ctx, env.TenantID(), ids...)
+	if err != nil {
+		return err
+	}
+	if len(doc.Plans) == 0 {
+		return fmt.Errorf("no plans to export")
+	}
+
+	if *format == "" {
+		*format = planlib.FormatFromPath(*output)
+	}
+	data, err := planlib.EncodePlans(doc, *format)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = env.Out.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Exported %d plan(s) to %s\n", len(doc.Plans), *output)
+	return nil
+}
+
+func plansImport(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	fs := newFlagSet(env, "plans import")
+	format := fs.String("format", "", "input format: yaml or json (default from file extension or content)")
+	replace := fs.Bool("replace", false, "replace plans for intents that already have one")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	data, err := os.ReadFile(pos[0])
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = planlib.FormatFromPath(pos[0])
+	}
+	doc, err := planlib.DecodePlans(data, *format)
+	if err != nil {
+		return err
+	}
+
+	plans, err := lib.Import(ctx, env.TenantID(), doc, *replace)
+	for _, plan := range plans {
+		fmt.Fprintf(env.Out, "Imported %s (%s)\n", shortID(plan.ID), plan.Intent)
+	}
+	return err
+}
+
+func plansDelete(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+	plan, err := resolvePlan(ctx, env, lib, args[0])
+	if err != nil {
+		return err
+	}
+	if err := lib.Delete(ctx, env.TenantID(), plan.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Deleted %s (%s)\n", shortID(plan.ID), plan.Intent)
+	return nil
+}
+
+func plansRun(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	fs := newFlagSet(env, "plans run")
+	vars := keyValueFlag{}
+	fs.Var(vars, "var", "set a plan variable (key=value, repeatable)")
+	dryRun := fs.Bool("dry-run", false, "print the plan and cost estimate without executing")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return ErrUsage
+	}
+
+	plan, err := resolvePlan(ctx, env, lib, pos[0])
+	if err != nil {
+		return err
+	}
+	instance, err := planlib.Instantiate(plan, vars)
+	if err != nil {
+		return err
+	}
+	instance.ID = plan.ID
+
+	if *dryRun {
+		fmt.Fprintln(env.Out, planlib.FormatPlan(instance))
+		est := planlib.EstimateCost(instance)
+		fmt.Fprintf(env.Out, "\nDry run: %d steps, ~%d tokens, ~$%.4f. Nothing was executed.\n",
+			est.TotalSteps, est.EstimatedTokens, est.EstimatedCost)
+		return nil
+	}
+
+	reg, err := env.Subagents()
+	if err != nil {
+		return err
+	}
+	executor := planlib.NewExecutor(lib, reg, &planlib.ExecutorConfig{
+		OnStep: func(r planlib.StepResult) {
+			status := "ok"
+			if r.Skipped {
+				status = "skipped"
+			} else if !r.Success {
+				status = "failed: " + r.Error
+			}
+			fmt.Fprintf(env.Out, "  step %d: %s (%dms)\n", r.StepID, status, r.DurationMs)
+		},
+	})
+
+	fmt.Fprintf(env.Out, "Running %s (%s)\n", shortID(plan.ID), plan.Intent)
+	exec, err := executor.Execute(ctx, env.TenantID(), instance, vars)
+	if err != nil {
+		return err
+	}
+
+	if pattern, err := lib.GetPattern(ctx, env.TenantID(), plan.Intent); err == nil && pattern.PlanID == plan.ID {
+		if exec.Status == "completed" {
+			_ = lib.RecordSuccess(ctx, env.TenantID(), pattern.ID)
+		} else {
+			_ = lib.RecordFailure(ctx, env.TenantID(), pattern.ID)
+		}
+	}
+
+	fmt.Fprintf(env.Out, "%s: %d/%d steps in %dms\n", exec.Status, exec.StepsCompleted, exec.StepCount, exec.DurationMs)
+	if exec.Status != "completed" {
+		return fmt.Errorf("plan failed: %s", exec.Error)
+	}
+	return nil
+}
+
+func plansCandidates(ctx context.Context, env *Env, lib *planlib.PlanLibrary, args []string) error {
+	fs := newFlagSet(env, "plans candidates")
+	status := fs.String("status", "", "only show candidates with this status: pending, promoted or rejected")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return ErrUsage
+	}
+
+	candidates, err := planlib.NewLearner(lib, nil, nil).ListCandidates(ctx, env.TenantID(), *status)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(env.Out, "No learned plans.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(env.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tINTENT\tSTEPS\tSUCCESSES\tSTATUS\tEXAMPLE")
+	for _, c := range candidates {
+		steps := 0
+		if c.Plan != nil {
+			steps = len(c.Plan.Steps)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", shortID(c.ID), c.Intent, steps, c.SuccessCount, c.Status, c.Example)
+	}
+	return tw.Flush()
+}
+
+// plansReview approves or rejects a learned plan.
+func plansReview(ctx context.Context, env *Env, lib *planlib.PlanLibrary, action string, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+	learner := planlib.NewLearner(lib, nil, nil)
+	candidate, err := resolveCandidate(ctx, env, learner, args[0])
+	if err != nil {
+		return err
+	}
+
+	if action == "reject" {
+		if err := learner.Reject(ctx, env.TenantID(), candidate.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Out, "Rejected %s (%s)\n", shortID(candidate.ID), candidate.Intent)
+		return nil
+	}
+	plan, err := learner.Approve(ctx, env.TenantID(), candidate.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Approved %s; stored as plan %s (%s)\n", shortID(candidate.ID), shortID(plan.ID), plan.Intent)
+	return nil
+}
+
+// resolveCandidate finds a learned plan by full ID or unique ID prefix.
+func resolveCandidate(ctx context.Context, env *Env, learner *planlib.Learner, ref string) (*planlib.PlanCandidate, error) {
+	candidates, err := learner.ListCandidates(ctx, env.TenantID(), "")
+	if err != nil {
+		return nil, err
+	}
+	var found *planlib.PlanCandidate
+	for _, c := range candidates {
+		if c.ID == ref {
+			return c, nil
+		}
+		if strings.HasPrefix(c.ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("candidate ID prefix %q is ambiguous", ref)
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: %w", ref, planlib.ErrCandidateNotFound)
+	}
+	return found, nil
+}
+
+// resolvePlan finds a plan by full ID or unique ID prefix.
+func resolvePlan(ctx context.Context, env *Env, lib *planlib.PlanLibrary, ref string) (*planlib.Plan, error) {
+	if plan, err := lib.GetByID(ctx, env.TenantID(), ref); err == nil {
+		return plan, nil
+	}
+
+	plans, err := lib.List(ctx, env.TenantID())
+	if err != nil {
+		return nil, err
+	}
+	var found *planlib.Plan
+	for _, plan := range plans {
+		if strings.HasPrefix(plan.ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("plan ID prefix %q is ambiguous", ref)
+			}
+			found = plan
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: %w", ref, planlib.ErrPlanNotFound)
+	}
+	return found, nil
+}
+
+// shortID abbreviates a UUID for tables.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,162 @@
+// Package cli provides the "flynn retention" command.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flynn-ai/flynn/internal/config"
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+var retentionCommand = &Command{
+	Name:    "retention",
+	Summary: "Purge data past its retention policy and pin items to keep",
+	Usage: `Usage: flynn retention <subcommand> [arguments]
+
+Subcommands:
+  purge [--dry-run] [--compact] [--json]
+                                    Delete data older or larger than its policy
+                                    and release the freed space
+  pin <class> <id>                  Keep an item forever
+  unpin <class> <id>                Make a pinned item subject to retention again
+
+Classes:
+  messages    Conversation messages; pin a message or a whole conversation
+  documents   Chat turns ingested into the graph; pin by ID or path
+  audit       Plan execution records, one per plan run
+  archive     Memories archived by consolidation
+
+Each class has a max_age_days and a max_mb cap under [retention.<class>];
+0 disables a cap. Team data can be overridden per tenant under
+[retention.tenants.<tenant-id>.<class>]. The daemon purges every
+[retention] purge_interval_hours and releases up to vacuum_pages free pages
+per run with an incremental VACUUM.
+
+Databases created before incremental VACUUM was enabled keep freed space for
+reuse instead of releasing it. purge --compact converts them with one full
+VACUUM, which rewrites the whole file and blocks writes while it runs; it is
+never done by the daemon.`,
+	Run: runRetention,
+}
+
+func runRetention(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	store, err := env.Store()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "purge":
+		return retentionPurge(ctx, env, store, args[1:])
+	case "pin", "unpin":
+		fs := newFlagSet(env, "retention "+args[0])
+		rest, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(rest) != 2 {
+			return ErrUsage
+		}
+		pin := args[0] == "pin"
+		if err := store.Pin(ctx, rest[0], rest[1], pin); err != nil {
+			return err
+		}
+		if pin {
+			fmt.Fprintf(env.Out, "Pinned %s %s; it will be kept forever\n", rest[0], rest[1])
+		} else {
+			fmt.Fprintf(env.Out, "Unpinned %s %s\n", rest[0], rest[1])
+		}
+		return nil
+	default:
+		return ErrUsage
+	}
+}
+
+func retentionPurge(ctx context.Context, env *Env, store *memory.Store, args []string) error {
+	fs := newFlagSet(env, "retention purge")
+	dryRun := fs.Bool("dry-run", false, "report what would be purged")
+	compact := fs.Bool("compact", false, "fully VACUUM databases not yet in incremental mode")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	opts := retentionOptions(env.Config.Retention)
+	opts.DryRun = *dryRun
+	opts.Compact = *compact
+	report, err := store.Purge(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Out, string(data))
+		return nil
+	}
+
+	if len(report.Purged) == 0 {
+		fmt.Fprintln(env.Out, "Nothing past its retention policy.")
+	} else {
+		tw := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLASS\tDATABASE\tTENANT\tROWS\tSIZE")
+		for _, p := range report.Purged {
+			tenant := p.Tenant
+			if tenant == "" {
+				tenant = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", p.Class, p.Database, tenant, p.Rows, formatSize(p.Bytes))
+		}
+		tw.Flush()
+	}
+	if *dryRun {
+		fmt.Fprintf(env.Out, "Dry run: %d rows would be purged.\n", report.Rows())
+		return nil
+	}
+	fmt.Fprintf(env.Out, "Purged %d rows; reclaimed %s.\n", report.Rows(), formatSize(report.Reclaimed))
+	if len(report.Uncompacted) > 0 {
+		fmt.Fprintf(env.Out, "The %s database keeps freed space for reuse; run \"flynn retention purge --compact\" once to release it.\n",
+			strings.Join(report.Uncompacted, " and "))
+	}
+	return nil
+}
+
+// retentionOptions converts the config into purge options.
+func retentionOptions(cfg config.RetentionConfig) memory.RetentionOptions {
+	policy := func(p config.RetentionPolicy) memory.RetentionPolicy {
+		return memory.RetentionPolicy{MaxAgeDays: p.MaxAgeDays, MaxBytes: int64(p.MaxMB * (1 << 20))}
+	}
+	opts := memory.RetentionOptions{
+		Policies: map[string]memory.RetentionPolicy{
+			memory.RetainMessages:  policy(cfg.Messages),
+			memory.RetainDocuments: policy(cfg.Documents),
+			memory.RetainAudit:     policy(cfg.Audit),
+			memory.RetainArchive:   policy(cfg.Archive),
+		},
+		Tenants:     map[string]map[string]memory.RetentionPolicy{},
+		VacuumPages: cfg.VacuumPages,
+	}
+	for tenant, t := range cfg.Tenants {
+		overrides := map[string]memory.RetentionPolicy{}
+		for class, p := range map[string]*config.RetentionPolicy{
+			memory.RetainMessages:  t.Messages,
+			memory.RetainDocuments: t.Documents,
+			memory.RetainAudit:     t.Audit,
+		} {
+			if p != nil {
+				overrides[class] = policy(*p)
+			}
+		}
+		opts.Tenants[tenant] = overrides
+	}
+	return opts
+}
@@ -19,8 +19,9 @@ func Default() *Config {
 			MaxAgents: 3,
 		},
 		Tenant: TenantConfig{
-			ID:   "default",
-			Name: "Default Tenant",
+			ID:       "default",
+			Name:     "Default Tenant",
+			MemberID: "user-local",
 			Members: []TeamMember{
 				{ID: "user-local", Name: "Local User", Role: "admin"},
 			},
@@ -70,11 +71,47 @@ func Default() *Config {
 			Anonymize:       true,
 		},
 		Graph: GraphConfig{
-			Enabled:       true,
-			UseLLM:        false,
-			MaxEntities:   20,
-			MaxRelations:  20,
-			MaxChunkBytes: 2000,
+			Enabled:         true,
+			UseLLM:          false,
+			MaxEntities:     20,
+			MaxRelations:    20,
+			MaxChunkBytes:   2000,
+			AskTopK:         6,
+			AskContextChars: 6000,
+		},
+		Index: IndexConfig{
+			IntervalMinutes: 60,
+			MaxFileKB:       512,
+			BatchFiles:      500,
+		},
+		Plans: PlansConfig{
+			Learn:         true,
+			PromoteAfter:  3,
+			MinConfidence: 0.6,
+		},
+		Memory: MemoryConfig{
+			ConsolidateIntervalHours: 24,
+			ConsolidateAfterDays:     30,
+			RestateRate:              0.3,
+			UseRate:                  0.05,
+			ContradictFactor:         0.4,
+			DecayHalfLifeDays:        90,
+			MinConfidence:            0.3,
+		},
+		Backup: BackupConfig{
+			Dir:  filepath.Join(dataDir, "backups"),
+			Keep: 7,
+		},
+		Retention: RetentionConfig{
+			PurgeIntervalHours: 24,
+			VacuumPages:        2000,
+			Messages:           RetentionPolicy{MaxAgeDays: 365, MaxMB: 20},
+			Documents:          RetentionPolicy{MaxAgeDays: 90, MaxMB: 15},
+			Audit:              RetentionPolicy{MaxAgeDays: 90, MaxMB: 5},
+			Archive:            RetentionPolicy{MaxAgeDays: 180, MaxMB: 2},
+		},
+		Encryption: EncryptionConfig{
+			UnlockMinutes: 480,
 		},
 	}
 }
@@ -153,6 +190,12 @@ func expandPaths(cfg *Config) *Config {
 	if cfg.Paths.TeamDB == "" || cfg.Paths.TeamDB[0] == '~' {
 		cfg.Paths.TeamDB = filepath.Join(homeDir, cfg.Paths.TeamDB[1:])
 	}
+	if cfg.Backup.Dir != "" && cfg.Backup.Dir[0] == '~' {
+		cfg.Backup.Dir = filepath.Join(homeDir, cfg.Backup.Dir[1:])
+	}
+	if cfg.Encryption.KeyFile != "" && cfg.Encryption.KeyFile[0] == '~' {
+		cfg.Encryption.KeyFile = filepath.Join(homeDir, cfg.Encryption.KeyFile[1:])
+	}
 	if cfg.Models.Local.ModelsDir == "" || cfg.Models.Local.ModelsDir[0] == '~' {
 		cfg.Models.Local.ModelsDir = filepath.Join(homeDir, cfg.Models.Local.ModelsDir[1:])
 	}
@@ -3,14 +3,20 @@ package config
 
 // Config represents the main Flynn configuration.
 type Config struct {
-	Instance InstanceConfig `toml:"instance"`
-	Tenant   TenantConfig   `toml:"tenant"`
-	User     UserConfig     `toml:"user"`
-	Models   ModelConfig    `toml:"models"`
-	Features Features       `toml:"features"`
-	Paths    PathsConfig    `toml:"paths"`
-	Privacy  PrivacyConfig  `toml:"privacy"`
-	Graph    GraphConfig    `toml:"graph"`
+	Instance   InstanceConfig   `toml:"instance"`
+	Tenant     TenantConfig     `toml:"tenant"`
+	User       UserConfig       `toml:"user"`
+	Models     ModelConfig      `toml:"models"`
+	Features   Features         `toml:"features"`
+	Paths      PathsConfig      `toml:"paths"`
+	Privacy    PrivacyConfig    `toml:"privacy"`
+	Graph      GraphConfig      `toml:"graph"`
+	Index      IndexConfig      `toml:"index"`
+	Plans      PlansConfig      `toml:"plans"`
+	Memory     MemoryConfig     `toml:"memory"`
+	Backup     BackupConfig     `toml:"backup"`
+	Retention  RetentionConfig  `toml:"retention"`
+	Encryption EncryptionConfig `toml:"encryption"`
 }
 
 // InstanceConfig contains instance-level settings.
@@ -21,9 +27,10 @@ type InstanceConfig struct {
 
 // TenantConfig contains team/tenant settings.
 type TenantConfig struct {
-	ID      string       `toml:"id"`
-	Name    string       `toml:"name"`
-	Members []TeamMember `toml:"members"`
+	ID       string       `toml:"id"`
+	Name     string       `toml:"name"`
+	MemberID string       `toml:"member_id"` // Which of Members is the local user
+	Members  []TeamMember `toml:"members"`
 }
 
 // TeamMember represents a team member.
@@ -98,11 +105,82 @@ type PrivacyConfig struct {
 
 // GraphConfig contains knowledge graph settings.
 type GraphConfig struct {
-	Enabled       bool `toml:"enabled"`
-	UseLLM        bool `toml:"use_llm"`
-	MaxEntities   int  `toml:"max_entities"`
-	MaxRelations  int  `toml:"max_relations"`
-	MaxChunkBytes int  `toml:"max_chunk_bytes"`
+	Enabled         bool `toml:"enabled"`
+	UseLLM          bool `toml:"use_llm"`
+	MaxEntities     int  `toml:"max_entities"`
+	MaxRelations    int  `toml:"max_relations"`
+	MaxChunkBytes   int  `toml:"max_chunk_bytes"`
+	AskTopK         int  `toml:"ask_top_k"`         // Document chunks given to the model per question
+	AskContextChars int  `toml:"ask_context_chars"` // Budget for chunk text in a question's prompt
+}
+
+// IndexConfig contains directory indexing settings.
+type IndexConfig struct {
+	Paths           []string `toml:"paths"`            // Directories the daemon keeps indexed
+	IntervalMinutes int      `toml:"interval_minutes"` // How often the daemon indexes them; 0 disables
+	MaxFileKB       int      `toml:"max_file_kb"`      // Larger files are not indexed
+	BatchFiles      int      `toml:"batch_files"`      // Most changed files one run ingests; 0 is no limit
+}
+
+// PlansConfig contains plan library settings.
+type PlansConfig struct {
+	Learn         bool    `toml:"learn"`          // Learn plans from successful tool-call sessions
+	PromoteAfter  int     `toml:"promote_after"`  // Similar successes before a learned plan is promoted
+	MinConfidence float64 `toml:"min_confidence"` // Plan match confidence needed to skip the model
+}
+
+// MemoryConfig contains personal memory maintenance settings.
+type MemoryConfig struct {
+	ConsolidateIntervalHours int `toml:"consolidate_interval_hours"` // How often the daemon consolidates; 0 disables
+	ConsolidateAfterDays     int `toml:"consolidate_after_days"`     // Facts older than this may be summarized
+
+	// Confidence lifecycle
+	RestateRate       float64 `toml:"restate_rate"`         // Share of the gap to 1.0 gained when a fact is re-stated
+	UseRate           float64 `toml:"use_rate"`             // Share gained when a recalled fact goes uncorrected
+	ContradictFactor  float64 `toml:"contradict_factor"`    // Multiplier applied when a fact is contradicted
+	DecayHalfLifeDays float64 `toml:"decay_half_life_days"` // Days without confirmation to halve confidence; negative disables
+	MinConfidence     float64 `toml:"min_confidence"`       // Facts below this are not recalled and get archived
+}
+
+// BackupConfig contains backup settings.
+type BackupConfig struct {
+	Dir  string `toml:"dir"`  // Where archives are written
+	Keep int    `toml:"keep"` // Newest archives kept after each backup; 0 keeps all
+}
+
+// EncryptionConfig contains field encryption settings. Encryption itself is
+// enabled with "flynn encryption enable" and recorded in personal.db.
+type EncryptionConfig struct {
+	KeyFile       string `toml:"key_file"`       // Unlocks automatically when encryption uses a key file
+	UnlockMinutes int    `toml:"unlock_minutes"` // How long "flynn unlock" lasts by default
+}
+
+// RetentionConfig contains data retention settings. Team data follows a
+// tenant's overrides where set; personal data always uses the defaults.
+type RetentionConfig struct {
+	PurgeIntervalHours int `toml:"purge_interval_hours"` // How often the daemon purges; 0 disables
+	VacuumPages        int `toml:"vacuum_pages"`         // Free pages released per purge; 0 releases all
+
+	Messages  RetentionPolicy `toml:"messages"`  // Conversation messages
+	Documents RetentionPolicy `toml:"documents"` // Chat turns ingested into the graph
+	Audit     RetentionPolicy `toml:"audit"`     // Plan execution records
+	Archive   RetentionPolicy `toml:"archive"`   // Memories archived by consolidation
+
+	Tenants map[string]TenantRetention `toml:"tenants"` // Overrides by tenant ID
+}
+
+// RetentionPolicy limits how much of one data class is kept.
+type RetentionPolicy struct {
+	MaxAgeDays int     `toml:"max_age_days"` // Older items are purged; 0 keeps them regardless of age
+	MaxMB      float64 `toml:"max_mb"`       // Oldest items beyond this size are purged; 0 means no cap
+}
+
+// TenantRetention overrides retention for one tenant's team data. Unset
+// classes use the defaults.
+type TenantRetention struct {
+	Messages  *RetentionPolicy `toml:"messages"`
+	Documents *RetentionPolicy `toml:"documents"`
+	Audit     *RetentionPolicy `toml:"audit"`
 }
 
 // ThreadMode represents the visibility of a conversation.
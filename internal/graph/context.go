@@ -16,6 +16,13 @@ type ContextBuilder struct {
 	MaxEntities  int
 	MaxRelations int
 	MaxChars     int
+	// Hops is how far to follow relations around matched entities; 0 or 1
+	// includes only their direct relations.
+	Hops int
+	// Docs adds the document chunks most relevant to the text, tagged for
+	// citation as [doc:path#chunk], as far as MaxChars allows; nil leaves
+	// documents out.
+	Docs *DocsQA
 }
 
 // FromText builds a context string by searching entities related to the text.
@@ -29,20 +36,37 @@ func (c *ContextBuilder) FromText(ctx context.Context, tenantID, text string) (s
 		return "", nil
 	}
 
-	entities, err := c.Store.SearchEntities(ctx, tenantID, query, c.maxEntities())
+	entities, err := c.matchEntities(ctx, tenantID, query)
 	if err != nil {
 		return "", err
 	}
 	if len(entities) == 0 {
-		return "", nil
+		return c.documents(ctx, tenantID, text, c.maxChars())
+	}
+
+	nameCache := map[string]string{}
+	for _, e := range entities {
+		nameCache[e.ID] = e.Name
 	}
 
 	relations := make([]*memory.Relation, 0)
 	relSeen := make(map[string]bool)
 	for _, e := range entities {
-		rels, err := c.Store.GetRelations(ctx, tenantID, e.ID, c.maxRelations())
-		if err != nil {
-			continue
+		var rels []*memory.Relation
+		if c.Hops > 1 {
+			sub, err := c.Store.Neighborhood(ctx, tenantID, e.ID, c.Hops, memory.TraversalOptions{Limit: c.maxRelations() + 1})
+			if err != nil {
+				continue
+			}
+			for _, n := range sub.Entities {
+				nameCache[n.ID] = n.Name
+			}
+			rels = sub.Relations
+		} else {
+			rels, err = c.Store.GetRelations(ctx, tenantID, e.ID, c.maxRelations())
+			if err != nil {
+				continue
+			}
 		}
 		for _, r := range rels {
 			key := r.ID
@@ -54,12 +78,60 @@ func (c *ContextBuilder) FromText(ctx context.Context, tenantID, text string) (s
 		}
 	}
 
-	nameCache := map[string]string{}
-	for _, e := range entities {
-		nameCache[e.ID] = e.Name
-	}
 	textOut := formatContext(ctx, c.Store, tenantID, entities, relations, nameCache, c.maxChars())
-	return textOut, nil
+	docs, err := c.documents(ctx, tenantID, text, c.maxChars()-len(textOut))
+	if err != nil {
+		return "", err
+	}
+	return textOut + docs, nil
+}
+
+// documents renders the chunks relevant to text within maxChars, each under
+// the tag an answer cites it by.
+func (c *ContextBuilder) documents(ctx context.Context, tenantID, text string, maxChars int) (string, error) {
+	const heading = "Documents (cite as [doc:path#chunk]):\n"
+	if c.Docs == nil || maxChars <= len(heading) {
+		return "", nil
+	}
+	sources, err := c.Docs.Retrieve(ctx, tenantID, text, 0)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, s := range sources {
+		entry := fmt.Sprintf("[%s] %s\n%s\n", s.Ref, s.Location(), strings.TrimSpace(s.content))
+		if len(heading)+b.Len()+len(entry) > maxChars {
+			continue
+		}
+		b.WriteString(entry)
+	}
+	if b.Len() == 0 {
+		return "", nil
+	}
+	return heading + b.String(), nil
+}
+
+// matchEntities finds entities named by any keyword of the query.
+func (c *ContextBuilder) matchEntities(ctx context.Context, tenantID, query string) ([]*memory.Entity, error) {
+	var entities []*memory.Entity
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(query) {
+		found, err := c.Store.SearchEntities(ctx, tenantID, word, c.maxEntities())
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range found {
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			entities = append(entities, e)
+			if len(entities) == c.maxEntities() {
+				return entities, nil
+			}
+		}
+	}
+	return entities, nil
 }
 
 func (c *ContextBuilder) maxEntities() int {
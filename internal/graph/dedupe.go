@@ -0,0 +1,97 @@
+// Package graph provides duplicate entity review and merging.
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// DefaultDedupeScore is the lowest similarity offered for review by default.
+const DefaultDedupeScore = 0.8
+
+// DedupeCandidate is a pair of entities that may be the same thing, ordered
+// so that Keep is the one a merge would keep.
+type DedupeCandidate struct {
+	Keep          *memory.Entity
+	Drop          *memory.Entity
+	KeepRelations int
+	DropRelations int
+	Score         float64
+	Reason        string
+}
+
+// DuplicateCandidates returns likely duplicates, best first.
+func (s *Service) DuplicateCandidates(ctx context.Context, minScore float64, limit int) ([]DedupeCandidate, error) {
+	pairs, err := s.Store.DuplicateCandidates(ctx, s.TenantID, minScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	count := func(e *memory.Entity) (int, error) {
+		if n, ok := counts[e.ID]; ok {
+			return n, nil
+		}
+		n, err := s.Store.CountRelations(ctx, s.TenantID, e.ID)
+		counts[e.ID] = n
+		return n, err
+	}
+
+	out := make([]DedupeCandidate, 0, len(pairs))
+	for _, p := range pairs {
+		a, err := count(p.A)
+		if err != nil {
+			return nil, err
+		}
+		b, err := count(p.B)
+		if err != nil {
+			return nil, err
+		}
+		c := DedupeCandidate{Keep: p.A, Drop: p.B, KeepRelations: a, DropRelations: b, Score: p.Score, Reason: p.Reason}
+		if survivorRank(p.B, b) > survivorRank(p.A, a) {
+			c.Keep, c.Drop, c.KeepRelations, c.DropRelations = p.B, p.A, b, a
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// survivorRank orders the entities of a pair: the better connected, more
+// important, specifically typed and older one is kept.
+func survivorRank(e *memory.Entity, relations int) float64 {
+	rank := float64(relations)*1000 + e.Importance*100
+	if !memory.IsGenericType(e.EntityType) {
+		rank += 10
+	}
+	// Older entities win ties; creation time only breaks them
+	return rank - float64(e.CreatedAt)/1e12
+}
+
+// Merge folds drop into keep and returns the merged entity.
+func (s *Service) Merge(ctx context.Context, keep, drop *memory.Entity) (*memory.Entity, error) {
+	return s.Store.MergeEntities(ctx, s.TenantID, keep.ID, drop.ID)
+}
+
+// Entity returns the entity an ID or unambiguous name refers to.
+func (s *Service) Entity(ctx context.Context, ref string) (*memory.Entity, error) {
+	if e, err := s.Store.GetEntityByID(ctx, s.TenantID, ref); err != nil || e != nil {
+		return e, err
+	}
+	found, err := s.Store.LookupEntities(ctx, s.TenantID, ref)
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("entity %q not found", ref)
+	case 1:
+		return found[0], nil
+	}
+	ids := make([]string, len(found))
+	for i, e := range found {
+		ids[i] = fmt.Sprintf("%s (%s)", e.ID, e.EntityType)
+	}
+	return nil, fmt.Errorf("%q matches %d entities; use an ID: %s", ref, len(found), strings.Join(ids, ", "))
+}
@@ -0,0 +1,279 @@
+// Package graph provides question answering over ingested documents.
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+	"github.com/flynn-ai/flynn/internal/model"
+)
+
+// DocsQA answers questions from the chunks of ingested documents. Chunks are
+// ranked by full-text relevance, blended with vector similarity when the
+// model can embed text, and the best are put in the prompt. The answer cites
+// them as [doc:path#chunk].
+type DocsQA struct {
+	Store           *memory.GraphStore
+	Model           model.Model    // nil retrieves sources without answering
+	Embedder        model.Embedder // nil ranks by full-text relevance alone
+	TopK            int            // Most chunks in the prompt; 0 uses 6
+	MaxContextChars int            // Budget for chunk text in the prompt; 0 uses 6000
+}
+
+// NewDocsQA creates a question answerer. The model also embeds when it
+// implements model.Embedder.
+func NewDocsQA(store *memory.GraphStore, m model.Model) *DocsQA {
+	q := &DocsQA{Store: store, Model: m}
+	if e, ok := m.(model.Embedder); ok {
+		q.Embedder = e
+	}
+	return q
+}
+
+// DocSource is a chunk given to the model, and where it came from.
+type DocSource struct {
+	Ref       string  `json:"ref"`      // Citation tag, "doc:path#chunk"
+	Document  string  `json:"document"` // Document path
+	File      string  `json:"file,omitempty"`
+	Chunk     int     `json:"chunk"`
+	StartLine int     `json:"start_line,omitempty"`
+	EndLine   int     `json:"end_line,omitempty"`
+	Score     float64 `json:"score"`
+	Cited     bool    `json:"cited"` // The answer cites this chunk
+	Excerpt   string  `json:"excerpt"`
+
+	content string
+}
+
+// Location renders the source as "file:start-end", or its document path
+// when the file is not known.
+func (s *DocSource) Location() string {
+	loc := s.File
+	if loc == "" {
+		loc = s.Document
+	}
+	switch {
+	case s.StartLine > 0 && s.EndLine > s.StartLine:
+		return fmt.Sprintf("%s:%d-%d", loc, s.StartLine, s.EndLine)
+	case s.StartLine > 0:
+		return fmt.Sprintf("%s:%d", loc, s.StartLine)
+	}
+	return loc
+}
+
+// DocAnswer is an answer and the sources it was given.
+type DocAnswer struct {
+	Question string       `json:"question"`
+	Answer   string       `json:"answer"` // Empty without a model or sources
+	Sources  []*DocSource `json:"sources"`
+}
+
+// Cited returns the sources the answer cites.
+func (a *DocAnswer) Cited() []*DocSource {
+	var out []*DocSource
+	for _, s := range a.Sources {
+		if s.Cited {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// citationPattern matches a [doc:path#chunk] citation.
+var citationPattern = regexp.MustCompile(`\[doc:([^\]#]+)#(\d+)\]`)
+
+// Ask answers a question from at most k chunks; k <= 0 uses TopK. Without a
+// model, or when no chunk matches, the answer is empty and Sources holds
+// whatever was found.
+func (q *DocsQA) Ask(ctx context.Context, tenantID, question string, k int) (*DocAnswer, error) {
+	sources, err := q.Retrieve(ctx, tenantID, question, k)
+	if err != nil {
+		return nil, err
+	}
+	answer := &DocAnswer{Question: question, Sources: sources}
+	if len(sources) == 0 || q.Model == nil || !q.Model.IsAvailable() {
+		return answer, nil
+	}
+
+	resp, err := q.Model.Generate(ctx, &model.Request{
+		System:      docsSystemPrompt,
+		Prompt:      docsPrompt(question, sources),
+		Temperature: 0.1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	answer.Answer = strings.TrimSpace(resp.Text)
+
+	byRef := make(map[string]*DocSource, len(sources))
+	for _, s := range sources {
+		byRef[s.Ref] = s
+	}
+	for _, m := range citationPattern.FindAllStringSubmatch(answer.Answer, -1) {
+		if s := byRef["doc:"+m[1]+"#"+m[2]]; s != nil {
+			s.Cited = true
+		}
+	}
+	return answer, nil
+}
+
+const docsSystemPrompt = `You answer questions using only the document excerpts you are given.
+Cite the excerpt behind every statement with its tag, exactly as written, e.g. [doc:notes/setup.md#2].
+If the excerpts do not answer the question, say so instead of guessing.`
+
+// docsPrompt lists the sources under their citation tags, then the question.
+func docsPrompt(question string, sources []*DocSource) string {
+	var b strings.Builder
+	b.WriteString("Excerpts:\n\n")
+	for _, s := range sources {
+		fmt.Fprintf(&b, "[%s] %s\n%s\n\n", s.Ref, s.Location(), strings.TrimSpace(s.content))
+	}
+	fmt.Fprintf(&b, "Question: %s\n", question)
+	return b.String()
+}
+
+// Retrieve ranks the chunks relevant to a question and returns the best k
+// that fit in MaxContextChars; k <= 0 uses TopK.
+func (q *DocsQA) Retrieve(ctx context.Context, tenantID, question string, k int) ([]*DocSource, error) {
+	if q == nil || q.Store == nil {
+		return nil, fmt.Errorf("docs QA not initialized")
+	}
+	if k <= 0 {
+		k = q.topK()
+	}
+	hits, err := q.Store.SearchChunks(ctx, tenantID, question, max(4*k, 20))
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	// bm25 is unbounded; normalize against the best hit
+	best := 0.0
+	for _, h := range hits {
+		best = math.Max(best, h.Rank)
+	}
+	scores := make([]float64, len(hits))
+	for i, h := range hits {
+		if best > 0 {
+			scores[i] = h.Rank / best
+		}
+	}
+	if similarity := q.similarity(ctx, question, hits); similarity != nil {
+		for i := range scores {
+			scores[i] = 0.5*scores[i] + 0.5*math.Max(similarity[i], 0)
+		}
+	}
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	budget := q.maxContextChars()
+	var out []*DocSource
+	for _, i := range order {
+		if len(out) == k {
+			break
+		}
+		content := hits[i].Content
+		if len(content) > budget {
+			if len(out) > 0 {
+				continue // A shorter, lower-ranked chunk may still fit
+			}
+			content = preview(content, budget)
+		}
+		budget -= len(content)
+		s := newDocSource(hits[i], scores[i])
+		s.content = content
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// similarity returns the cosine similarity of the question to each hit, or
+// nil when there is no embedder or embedding fails.
+func (q *DocsQA) similarity(ctx context.Context, question string, hits []*memory.ChunkHit) []float64 {
+	if q.Embedder == nil {
+		return nil
+	}
+	texts := make([]string, 0, len(hits)+1)
+	texts = append(texts, question)
+	for _, h := range hits {
+		texts = append(texts, h.Content)
+	}
+	vectors, err := q.Embedder.Embed(ctx, texts)
+	if err != nil || len(vectors) != len(texts) {
+		return nil
+	}
+	out := make([]float64, len(hits))
+	for i := range hits {
+		out[i] = cosine(vectors[0], vectors[i+1])
+	}
+	return out
+}
+
+func (q *DocsQA) topK() int {
+	if q.TopK <= 0 {
+		return 6
+	}
+	return q.TopK
+}
+
+func (q *DocsQA) maxContextChars() int {
+	if q.MaxContextChars <= 0 {
+		return 6000
+	}
+	return q.MaxContextChars
+}
+
+// newDocSource maps a chunk back to its file and lines.
+func newDocSource(h *memory.ChunkHit, score float64) *DocSource {
+	display := strings.TrimPrefix(h.Path, "file://")
+	s := &DocSource{
+		Ref:      "doc:" + display + "#" + strconv.Itoa(h.Index),
+		Document: h.Path,
+		Chunk:    h.Index,
+		Score:    math.Round(score*1000) / 1000,
+		Excerpt:  preview(strings.Join(strings.Fields(h.Content), " "), 240),
+	}
+	if display != h.Path {
+		s.File = display
+	}
+	var meta struct {
+		File      string `json:"file"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if json.Unmarshal([]byte(h.MetadataJSON), &meta) == nil {
+		if meta.File != "" {
+			s.File = meta.File
+		}
+		s.StartLine, s.EndLine = meta.StartLine, meta.EndLine
+	}
+	return s
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
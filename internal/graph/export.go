@@ -0,0 +1,496 @@
+// Package graph provides graph export and import in standard formats.
+package graph
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExportFormats lists the formats Export writes. Only json is lossless;
+// Import reads json and csv.
+var ExportFormats = []string{"json", "graphml", "dot", "csv", "jsonld"}
+
+// ExportOptions selects what Export writes and how.
+type ExportOptions struct {
+	SelectOptions
+	Format string // One of ExportFormats; "" picks it from the file extension
+}
+
+// ExportResult summarizes an export.
+type ExportResult struct {
+	Format    string   `json:"format"`
+	Files     []string `json:"files"`
+	Entities  int      `json:"entities"`
+	Relations int      `json:"relations"`
+}
+
+// Export writes the tenant's whole graph to path in format, or in the format
+// the file extension names when format is empty.
+func (s *Service) Export(ctx context.Context, path, format string) error {
+	_, err := s.ExportGraph(ctx, path, ExportOptions{Format: format})
+	return err
+}
+
+// ExportGraph writes the part of the tenant's graph opts select to path. The
+// csv format writes a node list and an edge list next to each other; see
+// csvPaths.
+func (s *Service) ExportGraph(ctx context.Context, path string, opts ExportOptions) (*ExportResult, error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatFromPath(path)
+	}
+	if !isExportFormat(format) {
+		return nil, fmt.Errorf("unsupported export format %q (want %s)", format, strings.Join(ExportFormats, ", "))
+	}
+	snap, err := s.Select(ctx, opts.SelectOptions)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExportResult{Format: format, Entities: len(snap.Entities), Relations: len(snap.Relations)}
+
+	if format == "csv" {
+		nodes, edges := csvPaths(path)
+		if err := writeFile(nodes, snap.writeCSVNodes); err != nil {
+			return nil, err
+		}
+		if err := writeFile(edges, snap.writeCSVEdges); err != nil {
+			return nil, err
+		}
+		result.Files = []string{nodes, edges}
+		return result, nil
+	}
+	if err := writeFile(path, func(w io.Writer) error { return snap.Encode(w, format) }); err != nil {
+		return nil, err
+	}
+	result.Files = []string{path}
+	return result, nil
+}
+
+// Import merges a json or csv export into the tenant's graph and returns the
+// number of entities and relations read.
+func (s *Service) Import(ctx context.Context, path string) (int, error) {
+	result, err := s.ImportGraph(ctx, path, "")
+	if result == nil {
+		return 0, err
+	}
+	return result.Entities + result.Merged + result.Relations, err
+}
+
+// ImportGraph merges an export into the tenant's graph; see Restore. format
+// is json or csv, or empty to pick it from the file extension. A csv import
+// reads the node list and the edge list beside path when they exist.
+func (s *Service) ImportGraph(ctx context.Context, path, format string) (*ImportResult, error) {
+	if format == "" {
+		format = FormatFromPath(path)
+	}
+	var snap *Snapshot
+	var err error
+	switch format {
+	case "json":
+		snap, err = readJSONSnapshot(path)
+	case "csv":
+		snap, err = readCSVSnapshot(path)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q (want json or csv)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Restore(ctx, snap)
+}
+
+// FormatFromPath returns the export format a file extension names, json
+// when it names none.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".graphml", ".xml":
+		return "graphml"
+	case ".dot", ".gv":
+		return "dot"
+	case ".csv":
+		return "csv"
+	case ".jsonld":
+		return "jsonld"
+	}
+	return "json"
+}
+
+func isExportFormat(format string) bool {
+	for _, f := range ExportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// csvPaths returns the node and edge lists of a csv export: "graph.csv",
+// "graph.nodes.csv" and "graph.edges.csv" all name graph.nodes.csv and
+// graph.edges.csv.
+func csvPaths(path string) (string, string) {
+	base := path
+	for _, suffix := range []string{".nodes.csv", ".edges.csv", ".csv"} {
+		if strings.HasSuffix(strings.ToLower(base), suffix) {
+			base = base[:len(base)-len(suffix)]
+			break
+		}
+	}
+	return base + ".nodes.csv", base + ".edges.csv"
+}
+
+// writeFile writes a file privately; graphs are team data.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ============================================================
+// Encoding
+// ============================================================
+
+// Encode writes the snapshot in a single-stream format: json, graphml, dot
+// or jsonld. The csv format has two lists; see ExportGraph.
+func (snap *Snapshot) Encode(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "graphml":
+		return snap.writeGraphML(w)
+	case "dot":
+		return snap.writeDOT(w)
+	case "jsonld":
+		return snap.writeJSONLD(w)
+	case "csv":
+		return fmt.Errorf("csv export writes a node and an edge list; export to a file")
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+// nodeIDs numbers the entities n0, n1, ... and returns a lookup of the ID by
+// name and type.
+func (snap *Snapshot) nodeIDs() func(name, entityType string) string {
+	ids := make(map[string]string, len(snap.Entities))
+	for i, e := range snap.Entities {
+		ids[e.Name+"|"+e.Type] = "n" + strconv.Itoa(i)
+	}
+	return func(name, entityType string) string { return ids[name+"|"+entityType] }
+}
+
+// graphMLKeys are the attributes of GraphML nodes and edges.
+var graphMLKeys = []struct{ id, target, typ string }{
+	{"name", "node", "string"},
+	{"type", "node", "string"},
+	{"description", "node", "string"},
+	{"importance", "node", "double"},
+	{"aliases", "node", "string"},
+	{"relation", "edge", "string"},
+	{"confidence", "edge", "double"},
+}
+
+func (snap *Snapshot) writeGraphML(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range graphMLKeys {
+		fmt.Fprintf(b, "  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", k.id, k.target, k.id, k.typ)
+	}
+	b.WriteString(`  <graph id="flynn" edgedefault="directed">` + "\n")
+	data := func(key, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(b, `      <data key="%s">`, key)
+		xml.EscapeText(b, []byte(value))
+		b.WriteString("</data>\n")
+	}
+	for i, e := range snap.Entities {
+		fmt.Fprintf(b, "    <node id=\"n%d\">\n", i)
+		data("name", e.Name)
+		data("type", e.Type)
+		data("description", e.Description)
+		data("importance", formatFloat(e.Importance))
+		data("aliases", strings.Join(e.Aliases, "; "))
+		b.WriteString("    </node>\n")
+	}
+	id := snap.nodeIDs()
+	for i, r := range snap.Relations {
+		fmt.Fprintf(b, "    <edge id=\"e%d\" source=%q target=%q>\n", i, id(r.Source, r.SourceType), id(r.Target, r.TargetType))
+		data("relation", r.Relation)
+		data("confidence", formatFloat(r.Confidence))
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	return b.Flush()
+}
+
+func (snap *Snapshot) writeDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph flynn {\n  node [shape=box];\n")
+	for i, e := range snap.Entities {
+		fmt.Fprintf(b, "  n%d [label=%s];\n", i, dotQuote(e.Name+"\n("+e.Type+")"))
+	}
+	id := snap.nodeIDs()
+	for _, r := range snap.Relations {
+		fmt.Fprintf(b, "  %s -> %s [label=%s];\n", id(r.Source, r.SourceType), id(r.Target, r.TargetType), dotQuote(r.Relation))
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// dotQuote quotes a DOT string, keeping line breaks as \n.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// jsonLDContext maps the standard properties to schema.org and everything
+// else, entity types and relation types, into a flynn vocabulary.
+var jsonLDContext = map[string]any{
+	"@vocab":        "urn:flynn:graph:",
+	"name":          "http://schema.org/name",
+	"description":   "http://schema.org/description",
+	"alternateName": "http://schema.org/alternateName",
+}
+
+func (snap *Snapshot) writeJSONLD(w io.Writer) error {
+	iri := func(name, entityType string) string {
+		return "urn:flynn:entity:" + url.PathEscape(strings.ToLower(entityType)) + ":" + url.PathEscape(name)
+	}
+	nodes := make([]map[string]any, 0, len(snap.Entities))
+	byIRI := make(map[string]map[string]any, len(snap.Entities))
+	for _, e := range snap.Entities {
+		node := map[string]any{"@id": iri(e.Name, e.Type), "@type": e.Type, "name": e.Name}
+		if e.Description != "" {
+			node["description"] = e.Description
+		}
+		if len(e.Aliases) > 0 {
+			node["alternateName"] = e.Aliases
+		}
+		nodes = append(nodes, node)
+		byIRI[node["@id"].(string)] = node
+	}
+	for _, r := range snap.Relations {
+		node := byIRI[iri(r.Source, r.SourceType)]
+		if node == nil {
+			continue
+		}
+		// Relations are properties of their source; keep them off the
+		// properties the context maps elsewhere
+		key := r.Relation
+		if _, reserved := jsonLDContext[key]; reserved || strings.HasPrefix(key, "@") {
+			key = "rel_" + key
+		}
+		targets, _ := node[key].([]map[string]string)
+		node[key] = append(targets, map[string]string{"@id": iri(r.Target, r.TargetType)})
+	}
+	data, err := json.MarshalIndent(map[string]any{"@context": jsonLDContext, "@graph": nodes}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// csvNodeHeader and csvEdgeHeader are the columns of a csv export. Edges
+// refer to nodes by the id column.
+var (
+	csvNodeHeader = []string{"id", "name", "type", "description", "importance", "aliases"}
+	csvEdgeHeader = []string{"source", "target", "relation", "confidence"}
+)
+
+func (snap *Snapshot) writeCSVNodes(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvNodeHeader); err != nil {
+		return err
+	}
+	for i, e := range snap.Entities {
+		if err := cw.Write([]string{"n" + strconv.Itoa(i), e.Name, e.Type, e.Description, formatFloat(e.Importance), strings.Join(e.Aliases, "; ")}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (snap *Snapshot) writeCSVEdges(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvEdgeHeader); err != nil {
+		return err
+	}
+	id := snap.nodeIDs()
+	for _, r := range snap.Relations {
+		if err := cw.Write([]string{id(r.Source, r.SourceType), id(r.Target, r.TargetType), r.Relation, formatFloat(r.Confidence)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// ============================================================
+// Decoding
+// ============================================================
+
+func readJSONSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// readCSVSnapshot reads the node and edge lists of a csv export. Either may
+// be missing, and columns are found by header name, so lists written by
+// other tools import as long as nodes have a name column and edges source
+// and target columns. Edge endpoints that are not node IDs are entity names.
+func readCSVSnapshot(path string) (*Snapshot, error) {
+	nodesPath, edgesPath := csvPaths(path)
+	snap := &Snapshot{}
+	byID := map[string]SnapshotEntity{}
+
+	nodes, err := readCSV(nodesPath)
+	if err != nil {
+		return nil, err
+	}
+	if nodes != nil {
+		col := nodes.columns("name")
+		if col == nil {
+			return nil, fmt.Errorf("%s: no name column", nodesPath)
+		}
+		for _, row := range nodes.rows {
+			e := SnapshotEntity{Name: col(row, "name"), Type: col(row, "type"), Description: col(row, "description")}
+			e.Importance, _ = strconv.ParseFloat(col(row, "importance"), 64)
+			for _, alias := range strings.Split(col(row, "aliases"), ";") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					e.Aliases = append(e.Aliases, alias)
+				}
+			}
+			snap.Entities = append(snap.Entities, e)
+			if id := col(row, "id"); id != "" {
+				byID[id] = e
+			}
+		}
+	}
+
+	edges, err := readCSV(edgesPath)
+	if err != nil {
+		return nil, err
+	}
+	if edges != nil {
+		col := edges.columns("source", "target")
+		if col == nil {
+			return nil, fmt.Errorf("%s: no source and target columns", edgesPath)
+		}
+		endpoint := func(ref, typeColumn string, row []string) (string, string) {
+			if e, ok := byID[ref]; ok {
+				return e.Name, e.Type
+			}
+			return ref, col(row, typeColumn)
+		}
+		for _, row := range edges.rows {
+			r := SnapshotRelation{Relation: col(row, "relation")}
+			if r.Relation == "" {
+				r.Relation = col(row, "type")
+			}
+			r.Source, r.SourceType = endpoint(col(row, "source"), "source_type", row)
+			r.Target, r.TargetType = endpoint(col(row, "target"), "target_type", row)
+			r.Confidence, _ = strconv.ParseFloat(col(row, "confidence"), 64)
+			snap.Relations = append(snap.Relations, r)
+		}
+	}
+	if nodes == nil && edges == nil {
+		return nil, fmt.Errorf("neither %s nor %s exists", nodesPath, edgesPath)
+	}
+	return snap, nil
+}
+
+// csvTable is a csv file with a header row.
+type csvTable struct {
+	header map[string]int
+	rows   [][]string
+}
+
+// readCSV reads a csv file, or returns nil when it does not exist.
+func readCSV(path string) (*csvTable, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	t := &csvTable{header: map[string]int{}}
+	if len(records) == 0 {
+		return t, nil
+	}
+	for i, name := range records[0] {
+		t.header[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	t.rows = records[1:]
+	return t, nil
+}
+
+// columns returns a lookup of a row's value by column name, or nil when a
+// required column is missing. Missing optional columns read as "".
+func (t *csvTable) columns(required ...string) func(row []string, name string) string {
+	for _, name := range required {
+		if _, ok := t.header[name]; !ok {
+			return nil
+		}
+	}
+	return func(row []string, name string) string {
+		i, ok := t.header[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+}
@@ -52,6 +52,16 @@ func (f *FallbackExtractor) Extract(ctx context.Context, text string) ([]Extract
 	return nil, nil, nil
 }
 
+// NewExtractor returns the extractor to use with an optional model: the model
+// first, falling back to rules when it fails, or rules alone without one.
+func NewExtractor(m model.Model) Extractor {
+	rules := &RuleBasedExtractor{}
+	if m == nil {
+		return rules
+	}
+	return &FallbackExtractor{Primary: &LLMExtractor{Model: m}, Fallback: rules}
+}
+
 // RuleBasedExtractor extracts basic entities/relations using regex patterns.
 type RuleBasedExtractor struct {
 	MaxEntities  int
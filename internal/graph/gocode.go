@@ -0,0 +1,961 @@
+// Package graph provides structural ingestion of Go source code.
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// Entity types created from Go code. The graph store resolves them by
+// exact name only and never offers them as duplicates.
+const (
+	CodePackage   = "package"
+	CodeFile      = "file"
+	CodeType      = "type"
+	CodeInterface = "interface"
+	CodeFunction  = "function"
+	CodeMethod    = "method"
+)
+
+// Relation types created from Go code.
+const (
+	RelContains   = "contains"   // package -> file
+	RelImports    = "imports"    // package -> package
+	RelDefines    = "defines"    // file -> symbol, type -> method
+	RelImplements = "implements" // type -> interface
+	RelCalls      = "calls"      // function or method -> function or method
+	RelEmbeds     = "embeds"     // type or interface -> type or interface
+)
+
+// codeFactsVersion is part of every package fingerprint; bumping it makes
+// the next ingestion rewrite every package.
+const codeFactsVersion = "1"
+
+// maxCodeDescription caps how much of a doc comment becomes a description.
+const maxCodeDescription = 2000
+
+// CodeIngestor records the structure of Go packages in the graph. Each
+// package is a document at "go://<import path>" whose entities and relations
+// are replaced as a whole when the package changes.
+type CodeIngestor struct {
+	Store *memory.GraphStore
+}
+
+// NewCodeIngestor creates a Go code ingestor.
+func NewCodeIngestor(store *memory.GraphStore) *CodeIngestor {
+	return &CodeIngestor{Store: store}
+}
+
+// CodeResult summarizes a Go code ingestion.
+type CodeResult struct {
+	Module     string `json:"module"`
+	Packages   int    `json:"packages"`
+	Updated    int    `json:"updated"`
+	Unchanged  int    `json:"unchanged"`
+	Removed    int    `json:"removed"`
+	Entities   int    `json:"entities"`
+	Relations  int    `json:"relations"`
+	Pruned     int    `json:"pruned"`
+	TypeErrors int    `json:"type_errors"`
+}
+
+// IngestGo ingests Go code. A directory ingests every package under it and
+// removes packages that no longer exist there; a .go file ingests its
+// package. The whole enclosing module is type-checked so references across
+// packages resolve, but only packages whose facts changed are rewritten.
+func (c *CodeIngestor) IngestGo(ctx context.Context, tenantID, target string) (*CodeResult, error) {
+	if c == nil || c.Store == nil {
+		return nil, fmt.Errorf("code ingestor not initialized")
+	}
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	dir, recursive := abs, info.IsDir()
+	if !recursive {
+		if filepath.Ext(abs) != ".go" {
+			return nil, fmt.Errorf("%s is not a Go file", target)
+		}
+		dir = filepath.Dir(abs)
+	}
+
+	root, module := findGoModule(dir)
+	tree, err := loadGoTree(root, module)
+	if err != nil {
+		return nil, err
+	}
+	scope := tree.importPath(dir)
+	inScope := func(p string) bool {
+		return p == scope || (recursive && strings.HasPrefix(p, scope+"/"))
+	}
+
+	result := &CodeResult{Module: module, TypeErrors: tree.typeErrors}
+	seen := map[string]bool{}
+	for _, pkg := range tree.ordered {
+		if !inScope(pkg.path) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		seen[pkg.path] = true
+		result.Packages++
+		if err := c.writePackage(ctx, tenantID, tree, pkg, result); err != nil {
+			return result, fmt.Errorf("ingest %s: %w", pkg.path, err)
+		}
+	}
+	if result.Packages == 0 && !recursive {
+		return result, fmt.Errorf("no buildable Go package in %s", dir)
+	}
+
+	if recursive {
+		docs, err := c.Store.ListDocuments(ctx, tenantID, goDocumentPath(scope))
+		if err != nil {
+			return result, err
+		}
+		for _, doc := range docs {
+			p := strings.TrimPrefix(doc.Path, "go://")
+			if seen[p] || !inScope(p) {
+				continue
+			}
+			if err := c.Store.DeleteDocument(ctx, tenantID, doc.ID); err != nil {
+				return result, fmt.Errorf("remove %s: %w", p, err)
+			}
+			result.Removed++
+		}
+	}
+	return result, nil
+}
+
+// writePackage stores a package's facts unless they match the last ingestion.
+func (c *CodeIngestor) writePackage(ctx context.Context, tenantID string, tree *goTree, pkg *goPackage, result *CodeResult) error {
+	facts := tree.facts(pkg)
+	fingerprint := facts.fingerprint()
+
+	docPath := goDocumentPath(pkg.path)
+	existing, err := c.Store.GetDocumentByPath(ctx, tenantID, docPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		var meta struct {
+			Fingerprint string `json:"fingerprint"`
+		}
+		if json.Unmarshal([]byte(existing.MetadataJSON), &meta) == nil && meta.Fingerprint == fingerprint {
+			result.Unchanged++
+			return nil
+		}
+	}
+
+	meta, err := json.Marshal(map[string]any{
+		"fingerprint": fingerprint,
+		"module":      tree.module,
+		"root":        tree.root,
+		"dir":         tree.relDir(pkg.dir),
+		"files":       len(pkg.names),
+	})
+	if err != nil {
+		return err
+	}
+	doc, err := c.Store.UpsertDocument(ctx, tenantID, &memory.Document{
+		Path:           docPath,
+		Title:          pkg.path,
+		ContentPreview: preview(pkg.doc, 500),
+		FileType:       "go",
+		SizeBytes:      pkg.size,
+		Language:       "go",
+		ChunkCount:     len(pkg.files),
+		MetadataJSON:   string(meta),
+	})
+	if err != nil {
+		return err
+	}
+	chunks := make([]memory.DocumentChunk, 0, len(pkg.files))
+	for i := range pkg.files {
+		// Citations of a chunk point at its file
+		fileMeta, err := json.Marshal(map[string]string{"file": filepath.Join(pkg.dir, pkg.names[i])})
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, memory.DocumentChunk{
+			DocumentID:   doc.ID,
+			Index:        i,
+			Content:      tree.fileSummary(pkg, i),
+			MetadataJSON: string(fileMeta),
+		})
+	}
+	if err := c.Store.ReplaceDocumentChunks(ctx, tenantID, doc.ID, chunks); err != nil {
+		return err
+	}
+
+	ids := make(map[codeKey]string, len(facts.entities))
+	entityIDs := make([]string, 0, len(facts.entities))
+	for _, e := range facts.entities {
+		saved, err := c.Store.UpsertEntity(ctx, tenantID, &memory.Entity{
+			Name:         e.key.name,
+			EntityType:   e.key.typ,
+			Description:  e.description,
+			MetadataJSON: e.metadata,
+		})
+		if err != nil {
+			return err
+		}
+		ids[e.key] = saved.ID
+		entityIDs = append(entityIDs, saved.ID)
+	}
+
+	relationIDs := make([]string, 0, len(facts.relations))
+	for _, r := range facts.relations {
+		saved, err := c.Store.CreateRelation(ctx, tenantID, &memory.Relation{
+			SourceID:     ids[r.source],
+			TargetID:     ids[r.target],
+			RelationType: r.relation,
+		})
+		if err != nil {
+			return err
+		}
+		relationIDs = append(relationIDs, saved.ID)
+	}
+
+	pruned, _, err := c.Store.ReplaceDocumentFacts(ctx, tenantID, doc.ID, entityIDs, relationIDs)
+	if err != nil {
+		return err
+	}
+	result.Updated++
+	result.Entities += len(entityIDs)
+	result.Relations += len(relationIDs)
+	result.Pruned += pruned
+	return nil
+}
+
+func goDocumentPath(importPath string) string {
+	return "go://" + importPath
+}
+
+// GoTreeStamp summarizes the names, sizes and modification times of the Go
+// files under path, so callers can poll for changes cheaply.
+func GoTreeStamp(target string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(target, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != target && skipGoDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) != ".go" && d.Name() != "go.mod" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ============================================================
+// Loading
+// ============================================================
+
+// goTree is a type-checked module.
+type goTree struct {
+	root       string
+	module     string
+	fset       *gotoken.FileSet
+	packages   map[string]*goPackage     // by import path
+	ordered    []*goPackage              // sorted by import path
+	labels     map[string]string         // symbol name prefix, by import path
+	external   map[string]*types.Package // packages from outside the module, by import path
+	importer   types.ImporterFrom        // loads them from source
+	typeErrors int
+}
+
+// goPackage is one parsed and type-checked package.
+type goPackage struct {
+	path  string
+	name  string
+	dir   string
+	doc   string
+	size  int
+	names []string // file names, parallel to files
+	files []*ast.File
+	types *types.Package
+	info  *types.Info
+	state int // 0 unchecked, 1 checking, 2 checked
+}
+
+// findGoModule returns the directory holding the go.mod that encloses dir
+// and its module path. Outside a module, dir is its own root and its base
+// name stands in for the module path.
+func findGoModule(dir string) (string, string) {
+	for d := dir; ; {
+		if data, err := os.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok {
+					if m := strings.Trim(strings.TrimSpace(rest), `"`); m != "" {
+						return d, m
+					}
+				}
+			}
+			return d, filepath.Base(d)
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir, filepath.Base(dir)
+		}
+		d = parent
+	}
+}
+
+func skipGoDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// loadGoTree parses every package of the module at root, leaving out tests,
+// and type-checks them. Imports from outside the module, the standard
+// library and module dependencies, are type-checked from source; one that
+// cannot be loaded resolves to an empty package and the resulting type
+// errors are only counted.
+func loadGoTree(root, module string) (*goTree, error) {
+	tree := &goTree{
+		root:     root,
+		module:   module,
+		fset:     gotoken.NewFileSet(),
+		packages: map[string]*goPackage{},
+		external: map[string]*types.Package{},
+	}
+	tree.importer, _ = importer.ForCompiler(tree.fset, "source", nil).(types.ImporterFrom)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root {
+			if skipGoDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir // a nested module
+			}
+		}
+		return tree.parseDir(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkg := range tree.packages {
+		tree.ordered = append(tree.ordered, pkg)
+	}
+	sort.Slice(tree.ordered, func(i, j int) bool { return tree.ordered[i].path < tree.ordered[j].path })
+	for _, pkg := range tree.ordered {
+		tree.check(pkg)
+	}
+	tree.labels = packageLabels(tree.ordered)
+	return tree, nil
+}
+
+func (t *goTree) parseDir(dir string) error {
+	bp, err := build.Default.ImportDir(dir, build.ImportComment)
+	if err != nil {
+		var noGo *build.NoGoError
+		var multi *build.MultiplePackageError
+		if errors.As(err, &noGo) || errors.As(err, &multi) {
+			return nil
+		}
+		return fmt.Errorf("load %s: %w", dir, err)
+	}
+
+	pkg := &goPackage{path: t.importPath(dir), name: bp.Name, dir: dir, doc: strings.TrimSpace(bp.Doc)}
+	for _, name := range append(append([]string{}, bp.GoFiles...), bp.CgoFiles...) {
+		file := filepath.Join(dir, name)
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		f, err := goparser.ParseFile(t.fset, file, src, goparser.ParseComments)
+		if f == nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+		pkg.size += len(src)
+		pkg.names = append(pkg.names, name)
+		pkg.files = append(pkg.files, f)
+	}
+	if len(pkg.files) > 0 {
+		t.packages[pkg.path] = pkg
+	}
+	return nil
+}
+
+// importPath returns the import path of a directory inside the module.
+func (t *goTree) importPath(dir string) string {
+	rel := t.relDir(dir)
+	if rel == "." {
+		return t.module
+	}
+	return path.Join(t.module, rel)
+}
+
+func (t *goTree) relDir(dir string) string {
+	rel, err := filepath.Rel(t.root, dir)
+	if err != nil {
+		return dir
+	}
+	return filepath.ToSlash(rel)
+}
+
+// check type-checks a package after the packages it imports.
+func (t *goTree) check(pkg *goPackage) {
+	if pkg.state != 0 {
+		return
+	}
+	pkg.state = 1
+	conf := types.Config{
+		Importer: importerFunc(func(p string) (*types.Package, error) {
+			if dep := t.packages[p]; dep != nil && dep.state != 1 {
+				t.check(dep)
+				return dep.types, nil
+			}
+			return t.importExternal(p, pkg.dir), nil
+		}),
+		Error:       func(error) { t.typeErrors++ },
+		FakeImportC: true,
+	}
+	pkg.info = &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	pkg.types, _ = conf.Check(pkg.path, t.fset, pkg.files, pkg.info)
+	pkg.state = 2
+}
+
+// importExternal returns a package from outside the module as imported from
+// dir, or an empty stand-in when it cannot be loaded.
+func (t *goTree) importExternal(importPath, dir string) *types.Package {
+	if ext := t.external[importPath]; ext != nil {
+		return ext
+	}
+	var ext *types.Package
+	if t.importer != nil {
+		ext, _ = t.importer.ImportFrom(importPath, dir, 0)
+	}
+	if ext == nil {
+		ext = types.NewPackage(importPath, guessPackageName(importPath))
+		ext.MarkComplete()
+	}
+	t.external[importPath] = ext
+	return ext
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// guessPackageName returns the conventional name of a package that is not
+// loaded: the last path element without a major version suffix.
+func guessPackageName(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = parts[len(parts)-2]
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.TrimPrefix(name, "go-"))
+}
+
+// packageLabels names each package for use in symbol names: its package name
+// when no other package in the module shares it, otherwise the shortest
+// suffix of its import path that is unique, as in "cmd/flynn.main".
+func packageLabels(pkgs []*goPackage) map[string]string {
+	byName := map[string]int{}
+	for _, pkg := range pkgs {
+		byName[pkg.name]++
+	}
+	labels := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		if byName[pkg.name] == 1 && pkg.name != "main" {
+			labels[pkg.path] = pkg.name
+			continue
+		}
+		parts := strings.Split(pkg.path, "/")
+		label := pkg.path
+		for n := 1; n <= len(parts); n++ {
+			suffix := strings.Join(parts[len(parts)-n:], "/")
+			unique := true
+			for _, other := range pkgs {
+				if other != pkg && (other.path == suffix || strings.HasSuffix(other.path, "/"+suffix)) {
+					unique = false
+					break
+				}
+			}
+			if unique {
+				label = suffix
+				break
+			}
+		}
+		labels[pkg.path] = label
+	}
+	return labels
+}
+
+// ============================================================
+// Facts
+// ============================================================
+
+type codeKey struct {
+	name string
+	typ  string
+}
+
+type codeEntity struct {
+	key         codeKey
+	description string
+	metadata    string
+}
+
+type codeRelation struct {
+	source   codeKey
+	target   codeKey
+	relation string
+}
+
+// codeFacts are the entities and relations one package contributes. Its
+// entities include those its relations point at in other packages.
+type codeFacts struct {
+	entities  []*codeEntity
+	relations []codeRelation
+	index     map[codeKey]*codeEntity
+	related   map[codeRelation]bool
+}
+
+func (f *codeFacts) entity(key codeKey, description string, metadata map[string]any) codeKey {
+	if e := f.index[key]; e != nil {
+		if description != "" {
+			e.description = description
+		}
+		if metadata != nil {
+			e.metadata = encodeMetadata(metadata)
+		}
+		return key
+	}
+	e := &codeEntity{key: key, description: description}
+	if metadata != nil {
+		e.metadata = encodeMetadata(metadata)
+	}
+	f.index[key] = e
+	f.entities = append(f.entities, e)
+	return key
+}
+
+func (f *codeFacts) relate(source, target codeKey, relation string) {
+	r := codeRelation{source: source, target: target, relation: relation}
+	if source == target || f.related[r] {
+		return
+	}
+	f.related[r] = true
+	f.relations = append(f.relations, r)
+}
+
+// fingerprint hashes the facts, so unchanged packages can be skipped.
+func (f *codeFacts) fingerprint() string {
+	lines := make([]string, 0, len(f.entities)+len(f.relations)+1)
+	lines = append(lines, "v"+codeFactsVersion)
+	for _, e := range f.entities {
+		lines = append(lines, strings.Join([]string{"e", e.key.name, e.key.typ, e.description, e.metadata}, "\x00"))
+	}
+	for _, r := range f.relations {
+		lines = append(lines, strings.Join([]string{"r", r.source.name, r.source.typ, r.relation, r.target.name, r.target.typ}, "\x00"))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeMetadata(m map[string]any) string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// facts extracts what a package defines and how it relates to the rest of
+// the module.
+func (t *goTree) facts(pkg *goPackage) *codeFacts {
+	f := &codeFacts{index: map[codeKey]*codeEntity{}, related: map[codeRelation]bool{}}
+	self := f.entity(codeKey{pkg.path, CodePackage}, clip(pkg.doc), map[string]any{
+		"module": t.module,
+		"name":   pkg.name,
+		"dir":    t.relDir(pkg.dir),
+	})
+
+	imports := map[string]bool{}
+	for i, file := range pkg.files {
+		fileKey := f.entity(codeKey{pkg.path + "/" + pkg.names[i], CodeFile}, "", map[string]any{
+			"package": pkg.path,
+			"path":    path.Join(t.relDir(pkg.dir), pkg.names[i]),
+		})
+		f.relate(self, fileKey, RelContains)
+		for _, imp := range file.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil && p != "C" {
+				imports[p] = true
+			}
+		}
+		t.declFacts(f, pkg, file, fileKey)
+	}
+	for _, p := range sortedKeys(imports) {
+		f.relate(self, f.entity(codeKey{p, CodePackage}, "", nil), RelImports)
+	}
+	if pkg.types != nil {
+		t.typeFacts(f, pkg)
+	}
+	return f
+}
+
+// declFacts records the types, functions and methods a file declares and
+// the calls they make.
+func (t *goTree) declFacts(f *codeFacts, pkg *goPackage, file *ast.File, fileKey codeKey) {
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != gotoken.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				obj, ok := pkg.info.Defs[ts.Name].(*types.TypeName)
+				if !ok || obj.IsAlias() {
+					continue
+				}
+				doc := ts.Doc
+				if doc == nil && len(d.Specs) == 1 {
+					doc = d.Doc
+				}
+				key, ok := t.symbolKey(obj)
+				if !ok {
+					continue
+				}
+				f.entity(key, clip(doc.Text()), t.position(pkg, obj, typeKind(obj)))
+				f.relate(fileKey, key, RelDefines)
+			}
+		case *ast.FuncDecl:
+			obj, ok := pkg.info.Defs[d.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			key, ok := t.symbolKey(obj)
+			if !ok {
+				continue
+			}
+			f.entity(key, clip(d.Doc.Text()), t.position(pkg, obj, types.ObjectString(obj, types.RelativeTo(pkg.types))))
+			f.relate(fileKey, key, RelDefines)
+			if recv := receiverName(obj); recv != nil {
+				if typeKey, ok := t.symbolKey(recv); ok {
+					f.relate(f.entity(typeKey, "", nil), key, RelDefines)
+				}
+			}
+			if d.Body != nil {
+				t.callFacts(f, pkg, d.Body, key)
+			}
+		}
+	}
+}
+
+// callFacts records the module's functions and methods a body calls.
+// Calls through interfaces and function values are not resolved.
+func (t *goTree) callFacts(f *codeFacts, pkg *goPackage, body *ast.BlockStmt, caller codeKey) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fun := ast.Unparen(call.Fun)
+		switch x := fun.(type) {
+		case *ast.IndexExpr:
+			fun = x.X
+		case *ast.IndexListExpr:
+			fun = x.X
+		}
+		var id *ast.Ident
+		switch x := fun.(type) {
+		case *ast.Ident:
+			id = x
+		case *ast.SelectorExpr:
+			id = x.Sel
+		default:
+			return true
+		}
+		callee, ok := pkg.info.Uses[id].(*types.Func)
+		if !ok {
+			return true
+		}
+		if key, ok := t.symbolKey(callee.Origin()); ok {
+			f.relate(caller, f.entity(key, "", nil), RelCalls)
+		}
+		return true
+	})
+}
+
+// typeFacts records embedding and which interfaces of the module the
+// package's types implement.
+func (t *goTree) typeFacts(f *codeFacts, pkg *goPackage) {
+	var interfaces []*types.Named
+	for _, other := range t.ordered {
+		if other.types == nil {
+			continue
+		}
+		for _, named := range namedTypes(other.types) {
+			if iface, ok := named.Underlying().(*types.Interface); ok && iface.NumMethods() > 0 && named.TypeParams().Len() == 0 {
+				interfaces = append(interfaces, named)
+			}
+		}
+	}
+
+	for _, named := range namedTypes(pkg.types) {
+		key, ok := t.symbolKey(named.Obj())
+		if !ok {
+			continue
+		}
+		switch u := named.Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				if field := u.Field(i); field.Embedded() {
+					t.embeds(f, key, field.Type())
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumEmbeddeds(); i++ {
+				t.embeds(f, key, u.EmbeddedType(i))
+			}
+			continue
+		}
+		if named.TypeParams().Len() > 0 {
+			continue
+		}
+		for _, iface := range interfaces {
+			if implements(named, iface.Underlying().(*types.Interface)) {
+				if ifaceKey, ok := t.symbolKey(iface.Obj()); ok {
+					f.relate(key, f.entity(ifaceKey, "", nil), RelImplements)
+				}
+			}
+		}
+	}
+}
+
+// implements reports whether a type or its pointer implements an interface.
+// go/types lets a type that embeds an unresolved type satisfy any method
+// lookup, so each method must also be found on the type itself.
+func implements(named *types.Named, iface *types.Interface) bool {
+	ptr := types.NewPointer(named)
+	if !types.Implements(named, iface) && !types.Implements(ptr, iface) {
+		return false
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if obj, _, _ := types.LookupFieldOrMethod(ptr, false, m.Pkg(), m.Name()); obj == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *goTree) embeds(f *codeFacts, key codeKey, typ types.Type) {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	if named, ok := typ.(*types.Named); ok {
+		if target, ok := t.symbolKey(named.Origin().Obj()); ok {
+			f.relate(key, f.entity(target, "", nil), RelEmbeds)
+		}
+	}
+}
+
+// symbolKey names a type, function or method of the module: "label.Name"
+// or "label.Type.Method". Objects outside the module have no key.
+func (t *goTree) symbolKey(obj types.Object) (codeKey, bool) {
+	if obj == nil || obj.Pkg() == nil {
+		return codeKey{}, false
+	}
+	label, ok := t.labels[obj.Pkg().Path()]
+	if !ok {
+		return codeKey{}, false
+	}
+	switch o := obj.(type) {
+	case *types.TypeName:
+		if _, ok := o.Type().Underlying().(*types.Interface); ok {
+			return codeKey{label + "." + o.Name(), CodeInterface}, true
+		}
+		return codeKey{label + "." + o.Name(), CodeType}, true
+	case *types.Func:
+		sig, _ := o.Type().(*types.Signature)
+		if sig == nil || sig.Recv() == nil {
+			return codeKey{label + "." + o.Name(), CodeFunction}, true
+		}
+		recv := receiverName(o)
+		if recv == nil {
+			return codeKey{}, false // an interface method
+		}
+		return codeKey{label + "." + recv.Name() + "." + o.Name(), CodeMethod}, true
+	}
+	return codeKey{}, false
+}
+
+// receiverName returns the named type a method is declared on, or nil for
+// functions and interface methods.
+func receiverName(fn *types.Func) *types.TypeName {
+	sig, _ := fn.Type().(*types.Signature)
+	if sig == nil || sig.Recv() == nil {
+		return nil
+	}
+	typ := sig.Recv().Type()
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return nil
+	}
+	if _, isIface := named.Underlying().(*types.Interface); isIface {
+		return nil
+	}
+	return named.Origin().Obj()
+}
+
+func (t *goTree) position(pkg *goPackage, obj types.Object, signature string) map[string]any {
+	pos := t.fset.Position(obj.Pos())
+	rel, err := filepath.Rel(t.root, pos.Filename)
+	if err != nil {
+		rel = pos.Filename
+	}
+	return map[string]any{
+		"package":   pkg.path,
+		"file":      filepath.ToSlash(rel),
+		"line":      pos.Line,
+		"signature": signature,
+		"exported":  obj.Exported(),
+	}
+}
+
+// typeKind describes a type declaration as "type Name struct" and the like.
+func typeKind(obj *types.TypeName) string {
+	kind := "type " + obj.Name()
+	switch u := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		return kind + " struct"
+	case *types.Interface:
+		return kind + " interface"
+	default:
+		return kind + " " + types.TypeString(u, types.RelativeTo(obj.Pkg()))
+	}
+}
+
+func namedTypes(pkg *types.Package) []*types.Named {
+	var out []*types.Named
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			continue
+		}
+		if named, ok := obj.Type().(*types.Named); ok {
+			out = append(out, named)
+		}
+	}
+	return out
+}
+
+// fileSummary renders a file's declarations with their doc comments; it is
+// the file's chunk in the package document.
+func (t *goTree) fileSummary(pkg *goPackage, i int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\npackage %s\n", path.Join(t.relDir(pkg.dir), pkg.names[i]), pkg.name)
+	qualifier := types.RelativeTo(pkg.types)
+	for _, decl := range pkg.files[i].Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != gotoken.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				obj, ok := pkg.info.Defs[ts.Name].(*types.TypeName)
+				if !ok {
+					continue
+				}
+				doc := ts.Doc
+				if doc == nil && len(d.Specs) == 1 {
+					doc = d.Doc
+				}
+				fmt.Fprintf(&b, "\n%s\n", typeKind(obj))
+				writeDoc(&b, doc)
+			}
+		case *ast.FuncDecl:
+			if obj, ok := pkg.info.Defs[d.Name].(*types.Func); ok {
+				fmt.Fprintf(&b, "\n%s\n", types.ObjectString(obj, qualifier))
+				writeDoc(&b, d.Doc)
+			}
+		}
+	}
+	return b.String()
+}
+
+func writeDoc(b *strings.Builder, doc *ast.CommentGroup) {
+	for _, line := range strings.Split(strings.TrimSpace(doc.Text()), "\n") {
+		if line != "" {
+			fmt.Fprintf(b, "  %s\n", line)
+		}
+	}
+}
+
+func clip(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxCodeDescription {
+		s = s[:maxCodeDescription]
+	}
+	return s
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,428 @@
+// Package graph provides incremental indexing of directory trees.
+package graph
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// DefaultIndexMaxFileBytes is the largest file indexed by default.
+const DefaultIndexMaxFileBytes = 512 << 10
+
+// maxIndexErrors is how many file errors an index result keeps.
+const maxIndexErrors = 10
+
+// binaryExtensions are skipped without reading the file.
+var binaryExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".ico": true, ".webp": true, ".bmp": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".bz2": true, ".xz": true, ".7z": true,
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true, ".wasm": true,
+	".class": true, ".jar": true, ".pyc": true, ".bin": true, ".db": true, ".sqlite": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".mp3": true, ".mp4": true, ".mov": true,
+}
+
+// Indexer keeps the files of a directory tree ingested. Each file is a
+// document at "file://<absolute path>" that remembers the file's size,
+// modification time and content hash, so a run only reads files whose size
+// or time changed and only ingests those whose content did. Files that
+// disappear, become ignored or grow too large are removed with their
+// chunks and the entities only they mentioned. Go files are ingested by
+// structure instead, one package per document.
+type Indexer struct {
+	Ingestor     *Ingestor
+	Code         *CodeIngestor // nil indexes Go files as text
+	MaxFileBytes int64         // 0 uses DefaultIndexMaxFileBytes
+	MaxFiles     int           // Most changed files one run ingests; 0 is no limit
+	Progress     func(IndexProgress)
+}
+
+// IndexProgress reports a run after each changed file.
+type IndexProgress struct {
+	Root  string
+	Path  string // File just handled, relative to Root
+	Done  int    // Changed files handled so far
+	Total int    // Changed files this run will handle
+}
+
+// IndexResult summarizes an indexing run.
+type IndexResult struct {
+	Root      string        `json:"root"`
+	Files     int           `json:"files"`
+	Added     int           `json:"added"`
+	Updated   int           `json:"updated"`
+	Unchanged int           `json:"unchanged"`
+	Removed   int           `json:"removed"`
+	Skipped   int           `json:"skipped"`
+	Failed    int           `json:"failed"`
+	Pending   int           `json:"pending"`
+	Resumed   bool          `json:"resumed"`
+	Code      []*CodeResult `json:"code,omitempty"`
+	Errors    []string      `json:"errors,omitempty"`
+}
+
+// Complete reports whether every changed file was handled.
+func (r *IndexResult) Complete() bool {
+	return r.Pending == 0
+}
+
+// indexMeta is the document metadata that detects changes.
+type indexMeta struct {
+	Root  string `json:"root"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Hash  string `json:"hash"`
+}
+
+type indexFile struct {
+	abs   string
+	rel   string
+	size  int64
+	mtime int64
+}
+
+// Index brings the documents of the tree at dir up to date. A run cut short
+// by the context or MaxFiles leaves the remaining files for the next run,
+// which picks up where it stopped.
+func (x *Indexer) Index(ctx context.Context, tenantID, dir string) (*IndexResult, error) {
+	if x == nil || x.Ingestor == nil || x.Ingestor.Store == nil {
+		return nil, fmt.Errorf("indexer not initialized")
+	}
+	store := x.Ingestor.Store
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	state, err := store.GetIndexRoot(ctx, tenantID, root)
+	if err != nil {
+		return nil, err
+	}
+	result := &IndexResult{Root: root}
+	if state == nil {
+		state = &memory.IndexRoot{TenantID: tenantID, Root: root}
+	}
+	result.Resumed = state.Interrupted()
+	state.StartedAt = time.Now().Unix()
+	if err := store.SaveIndexRoot(ctx, state); err != nil {
+		return nil, err
+	}
+
+	files, goFiles, modules, err := x.walk(root, result)
+	if err != nil {
+		return x.finish(ctx, state, result, err)
+	}
+
+	prefix := fileDocumentPath(root) + "/"
+	docs, err := store.ListDocuments(ctx, tenantID, prefix)
+	if err != nil {
+		return x.finish(ctx, state, result, err)
+	}
+	existing := make(map[string]*memory.Document, len(docs))
+	for _, doc := range docs {
+		existing[doc.Path] = doc
+	}
+
+	var changed []indexFile
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		p := fileDocumentPath(f.abs)
+		present[p] = true
+		if doc := existing[p]; doc != nil {
+			if meta := parseIndexMeta(doc); meta.Size == f.size && meta.MTime == f.mtime {
+				result.Unchanged++
+				continue
+			}
+		}
+		changed = append(changed, f)
+	}
+	for _, doc := range docs {
+		if present[doc.Path] {
+			continue
+		}
+		if err := store.DeleteDocument(ctx, tenantID, doc.ID); err != nil {
+			return x.finish(ctx, state, result, err)
+		}
+		result.Removed++
+	}
+
+	todo := changed
+	if x.MaxFiles > 0 && len(todo) > x.MaxFiles {
+		todo = todo[:x.MaxFiles]
+	}
+	result.Pending = len(changed)
+	for i, f := range todo {
+		if err := ctx.Err(); err != nil {
+			return x.finish(ctx, state, result, err)
+		}
+		if err := x.indexFile(ctx, tenantID, root, f, existing[fileDocumentPath(f.abs)], result); err != nil {
+			result.Failed++
+			if len(result.Errors) < maxIndexErrors {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.rel, err))
+			}
+		}
+		result.Pending--
+		if x.Progress != nil {
+			x.Progress(IndexProgress{Root: root, Path: f.rel, Done: i + 1, Total: len(todo)})
+		}
+	}
+
+	if x.Code != nil {
+		stamp := codeStamp(goFiles)
+		if stamp != state.CodeStamp {
+			for _, dir := range modules {
+				code, err := x.Code.IngestGo(ctx, tenantID, dir)
+				if err != nil {
+					return x.finish(ctx, state, result, fmt.Errorf("ingest Go code in %s: %w", dir, err))
+				}
+				result.Code = append(result.Code, code)
+			}
+			removed, err := x.pruneCode(ctx, tenantID, root, result.Code)
+			if err != nil {
+				return x.finish(ctx, state, result, err)
+			}
+			result.Removed += removed
+			state.CodeStamp = stamp
+		}
+	}
+	return x.finish(ctx, state, result, nil)
+}
+
+// finish records how the run ended and returns its result.
+func (x *Indexer) finish(ctx context.Context, state *memory.IndexRoot, result *IndexResult, runErr error) (*IndexResult, error) {
+	result.Files = result.Added + result.Updated + result.Unchanged
+	state.Files = result.Files
+	state.Pending = result.Pending
+	state.LastError = ""
+	if runErr != nil {
+		state.LastError = runErr.Error()
+	} else {
+		state.FinishedAt = time.Now().Unix()
+	}
+	// Record the state even when the run's context was cancelled
+	if err := x.Ingestor.Store.SaveIndexRoot(context.WithoutCancel(ctx), state); err != nil && runErr == nil {
+		runErr = err
+	}
+	return result, runErr
+}
+
+// walk lists the files to index, leaving out ignored, oversized and binary
+// ones. Go files are listed separately along with the module directories
+// to ingest them from.
+func (x *Indexer) walk(root string, result *IndexResult) ([]indexFile, []indexFile, []string, error) {
+	maxBytes := x.MaxFileBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultIndexMaxFileBytes
+	}
+	ignore := &ignoreMatcher{}
+	if err := ignore.load(filepath.Join(root, ".git", "info", "exclude"), ""); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var files, goFiles []indexFile
+	var modules []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == "." {
+				return ignore.load(filepath.Join(p, ".gitignore"), "")
+			}
+			if d.Name() == ".git" || ignore.ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			if x.Code != nil {
+				if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+					modules = append(modules, p)
+				}
+			}
+			return ignore.load(filepath.Join(p, ".gitignore"), rel)
+		}
+		if !d.Type().IsRegular() || ignore.ignored(rel, false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := indexFile{abs: p, rel: rel, size: info.Size(), mtime: info.ModTime().UnixNano()}
+		switch {
+		case x.Code != nil && filepath.Ext(p) == ".go":
+			goFiles = append(goFiles, f)
+		case info.Size() > maxBytes || binaryExtensions[strings.ToLower(filepath.Ext(p))]:
+			result.Skipped++
+		default:
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rel < files[j].rel })
+	if hasLooseGoFiles(root, goFiles, modules) {
+		modules = append([]string{root}, modules...)
+	}
+	return files, goFiles, modules, nil
+}
+
+// pruneCode removes the Go packages of modules under root that were not just
+// ingested, which are modules that no longer exist.
+func (x *Indexer) pruneCode(ctx context.Context, tenantID, root string, ingested []*CodeResult) (int, error) {
+	store := x.Ingestor.Store
+	current := make(map[string]bool, len(ingested))
+	for _, code := range ingested {
+		current[code.Module] = true
+	}
+	docs, err := store.ListDocuments(ctx, tenantID, "go://")
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, doc := range docs {
+		var meta struct {
+			Module string `json:"module"`
+			Root   string `json:"root"`
+		}
+		if json.Unmarshal([]byte(doc.MetadataJSON), &meta) != nil || meta.Root == "" || current[meta.Module] {
+			continue
+		}
+		if meta.Root != root && !strings.HasPrefix(meta.Root, root+string(filepath.Separator)) {
+			continue
+		}
+		if err := store.DeleteDocument(ctx, tenantID, doc.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// indexFile ingests one changed file. A file whose content is unchanged only
+// has its recorded size and time refreshed.
+func (x *Indexer) indexFile(ctx context.Context, tenantID, root string, f indexFile, existing *memory.Document, result *IndexResult) error {
+	store := x.Ingestor.Store
+	content, err := os.ReadFile(f.abs)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	meta := indexMeta{Root: root, Size: f.size, MTime: f.mtime, Hash: hex.EncodeToString(sum[:])}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if isBinary(content) || len(bytes.TrimSpace(content)) == 0 {
+		result.Skipped++
+		if existing != nil {
+			result.Removed++
+			return store.DeleteDocument(ctx, tenantID, existing.ID)
+		}
+		return nil
+	}
+	if existing != nil && parseIndexMeta(existing).Hash == meta.Hash {
+		existing.MetadataJSON = string(data)
+		_, err := store.UpsertDocument(ctx, tenantID, existing)
+		result.Unchanged++
+		return err
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(f.abs), ".")
+	if _, err := x.Ingestor.IngestDocument(ctx, tenantID, &memory.Document{
+		Path:         fileDocumentPath(f.abs),
+		Title:        f.rel,
+		FileType:     ext,
+		Language:     fileLanguage(ext),
+		MetadataJSON: string(data),
+	}, string(content)); err != nil {
+		return err
+	}
+	if existing != nil {
+		result.Updated++
+	} else {
+		result.Added++
+	}
+	return nil
+}
+
+// hasLooseGoFiles reports whether some Go files lie outside every nested
+// module, so the root itself must be ingested.
+func hasLooseGoFiles(root string, goFiles []indexFile, modules []string) bool {
+	if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+		return true
+	}
+next:
+	for _, f := range goFiles {
+		for _, dir := range modules {
+			if strings.HasPrefix(f.abs, dir+string(filepath.Separator)) {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func fileDocumentPath(abs string) string {
+	return "file://" + filepath.ToSlash(abs)
+}
+
+func parseIndexMeta(doc *memory.Document) indexMeta {
+	var meta indexMeta
+	_ = json.Unmarshal([]byte(doc.MetadataJSON), &meta)
+	return meta
+}
+
+// isBinary applies git's heuristic: a NUL byte near the start.
+func isBinary(content []byte) bool {
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+func fileLanguage(ext string) string {
+	switch ext {
+	case "", "txt", "md", "rst":
+		return "text"
+	}
+	return ext
+}
+
+// codeStamp summarizes Go files so code ingestion only runs when one changed.
+func codeStamp(files []indexFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rel < files[j].rel })
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", f.rel, f.size, f.mtime)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
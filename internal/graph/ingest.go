@@ -38,13 +38,6 @@ func NewIngestor(store *memory.GraphStore, extractor Extractor) *Ingestor {
 
 // IngestText ingests raw text into document storage and extracts graph facts.
 func (i *Ingestor) IngestText(ctx context.Context, tenantID string, source Source, title string, content string) (*IngestResult, error) {
-	if i == nil || i.Store == nil {
-		return nil, fmt.Errorf("ingestor not initialized")
-	}
-	if strings.TrimSpace(content) == "" {
-		return nil, fmt.Errorf("content is empty")
-	}
-
 	path := source.Ref
 	if path == "" {
 		path = fmt.Sprintf("text-%d", time.Now().UnixNano())
@@ -53,16 +46,28 @@ func (i *Ingestor) IngestText(ctx context.Context, tenantID string, source Sourc
 		path = fmt.Sprintf("%s://%s", source.Type, path)
 	}
 
-	doc := &memory.Document{
-		Path:           path,
-		Title:          title,
-		ContentPreview: preview(content, 500),
-		FileType:       "text",
-		SizeBytes:      len(content),
-		Language:       "text",
-		ChunkCount:     0,
+	return i.IngestDocument(ctx, tenantID, &memory.Document{
+		Path:     path,
+		Title:    title,
+		FileType: "text",
+		Language: "text",
+	}, content)
+}
+
+// IngestDocument stores a document with its content and extracts graph
+// facts. Ingesting a document again replaces its chunks, and entities and
+// relations it no longer yields are removed unless another document has them.
+func (i *Ingestor) IngestDocument(ctx context.Context, tenantID string, doc *memory.Document, content string) (*IngestResult, error) {
+	if i == nil || i.Store == nil {
+		return nil, fmt.Errorf("ingestor not initialized")
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("content is empty")
 	}
 
+	doc.ContentPreview = preview(content, 500)
+	doc.SizeBytes = len(content)
+
 	chunkSize := i.MaxChunkBytes
 	if chunkSize <= 0 {
 		chunkSize = 2000
@@ -78,9 +83,10 @@ func (i *Ingestor) IngestText(ctx context.Context, tenantID string, source Sourc
 	var chunkRows []memory.DocumentChunk
 	for idx, chunk := range chunks {
 		chunkRows = append(chunkRows, memory.DocumentChunk{
-			DocumentID: saved.ID,
-			Index:      idx,
-			Content:    chunk,
+			DocumentID:   saved.ID,
+			Index:        idx,
+			Content:      chunk.Text,
+			MetadataJSON: chunk.metadata(),
 		})
 	}
 
@@ -93,16 +99,19 @@ func (i *Ingestor) IngestText(ctx context.Context, tenantID string, source Sourc
 		return nil, err
 	}
 
-	entityCount, relationCount, err := i.persistFacts(ctx, tenantID, entities, relations)
+	entityIDs, relationIDs, err := i.persistFacts(ctx, tenantID, entities, relations)
 	if err != nil {
 		return nil, err
 	}
+	if _, _, err := i.Store.ReplaceDocumentFacts(ctx, tenantID, saved.ID, entityIDs, relationIDs); err != nil {
+		return nil, err
+	}
 
 	return &IngestResult{
 		DocumentID: saved.ID,
 		Chunks:     len(chunkRows),
-		Entities:   entityCount,
-		Relations:  relationCount,
+		Entities:   len(entityIDs),
+		Relations:  len(relationIDs),
 	}, nil
 }
 
@@ -133,26 +142,35 @@ func (i *Ingestor) extract(ctx context.Context, content string) ([]ExtractedEnti
 	return entities, relations, nil
 }
 
-func (i *Ingestor) persistFacts(ctx context.Context, tenantID string, entities []ExtractedEntity, relations []ExtractedRelation) (int, int, error) {
+// persistFacts stores extracted facts, resolving each entity against the
+// existing ones by name and alias before creating it. It returns the IDs of
+// the entities and relations the facts refer to.
+func (i *Ingestor) persistFacts(ctx context.Context, tenantID string, entities []ExtractedEntity, relations []ExtractedRelation) ([]string, []string, error) {
 	entityMap := make(map[string]*memory.Entity)
+	var entityIDs []string
+	seen := make(map[string]bool)
 
 	for _, e := range entities {
 		if strings.TrimSpace(e.Name) == "" {
 			continue
 		}
-		entity, err := i.Store.UpsertEntity(ctx, tenantID, &memory.Entity{
+		entity, err := i.Store.ResolveOrCreateEntity(ctx, tenantID, &memory.Entity{
 			Name:        e.Name,
 			EntityType:  e.Type,
 			Description: e.Description,
 		})
 		if err != nil {
-			return 0, 0, err
+			return nil, nil, err
 		}
-		key := fmt.Sprintf("%s|%s", strings.ToLower(entity.Name), entity.EntityType)
+		key := fmt.Sprintf("%s|%s", strings.ToLower(e.Name), e.Type)
 		entityMap[key] = entity
+		if !seen[entity.ID] {
+			seen[entity.ID] = true
+			entityIDs = append(entityIDs, entity.ID)
+		}
 	}
 
-	relationCount := 0
+	var relationIDs []string
 	for _, r := range relations {
 		sourceKey := fmt.Sprintf("%s|%s", strings.ToLower(r.SourceName), r.SourceType)
 		targetKey := fmt.Sprintf("%s|%s", strings.ToLower(r.TargetName), r.TargetType)
@@ -163,17 +181,18 @@ func (i *Ingestor) persistFacts(ctx context.Context, tenantID string, entities [
 			continue
 		}
 
-		if _, err := i.Store.CreateRelation(ctx, tenantID, &memory.Relation{
+		saved, err := i.Store.CreateRelation(ctx, tenantID, &memory.Relation{
 			SourceID:     source.ID,
 			TargetID:     target.ID,
 			RelationType: r.Relation,
-		}); err != nil {
-			return 0, relationCount, err
+		})
+		if err != nil {
+			return nil, nil, err
 		}
-		relationCount++
+		relationIDs = append(relationIDs, saved.ID)
 	}
 
-	return len(entityMap), relationCount, nil
+	return entityIDs, relationIDs, nil
 }
 
 func preview(text string, max int) string {
@@ -183,21 +202,58 @@ func preview(text string, max int) string {
 	return text[:max]
 }
 
-func chunkText(text string, maxLen int) []string {
+// textChunk is a piece of a document and the lines it spans.
+type textChunk struct {
+	Text      string
+	StartLine int // 1-based
+	EndLine   int
+}
+
+// metadata records the chunk's line range so citations can point at it.
+func (c textChunk) metadata() string {
+	return fmt.Sprintf(`{"start_line":%d,"end_line":%d}`, c.StartLine, c.EndLine)
+}
+
+// chunkText splits text into chunks of at most maxLen runes. Chunks break
+// between lines, so each maps back to a range of lines; only a line longer
+// than maxLen is split within itself.
+func chunkText(text string, maxLen int) []textChunk {
 	if maxLen <= 0 {
-		return []string{text}
-	}
-	var chunks []string
-	runes := []rune(text)
-	for i := 0; i < len(runes); i += maxLen {
-		end := i + maxLen
-		if end > len(runes) {
-			end = len(runes)
+		return []textChunk{{Text: text, StartLine: 1, EndLine: strings.Count(text, "\n") + 1}}
+	}
+	var chunks []textChunk
+	var cur strings.Builder
+	curLen, start, last := 0, 1, 1
+	flush := func() {
+		if curLen > 0 {
+			chunks = append(chunks, textChunk{Text: cur.String(), StartLine: start, EndLine: last})
+		}
+		cur.Reset()
+		curLen = 0
+	}
+	for n, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		lineNo := n + 1
+		runes := []rune(line)
+		if curLen > 0 && curLen+len(runes) > maxLen {
+			flush()
+		}
+		if curLen == 0 {
+			start = lineNo
+		}
+		for len(runes) > maxLen {
+			chunks = append(chunks, textChunk{Text: string(runes[:maxLen]), StartLine: lineNo, EndLine: lineNo})
+			runes = runes[maxLen:]
 		}
-		chunks = append(chunks, string(runes[i:end]))
+		cur.WriteString(string(runes))
+		curLen += len(runes)
+		last = lineNo
 	}
+	flush()
 	if len(chunks) == 0 {
-		chunks = []string{""}
+		chunks = []textChunk{{StartLine: 1, EndLine: 1}}
 	}
 	return chunks
 }
@@ -0,0 +1,132 @@
+// Package graph provides path finding between named entities.
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// maxCandidates is how many entities a name may resolve to when finding paths.
+const maxCandidates = 3
+
+// FindPath returns the shortest path between two entities given by name. A
+// name matches entities by name or alias, or failing that entities whose
+// name contains it. It returns nil when they are not connected within
+// opts.MaxDepth hops.
+func (s *Service) FindPath(ctx context.Context, from, to string, opts memory.TraversalOptions) (*memory.GraphPath, error) {
+	sources, err := s.candidates(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.candidates(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *memory.GraphPath
+	for _, src := range sources {
+		for _, dst := range targets {
+			if best != nil {
+				// Only a shorter path than the best so far is of interest
+				if best.Hops() <= 1 {
+					return best, nil
+				}
+				opts.MaxDepth = best.Hops() - 1
+			}
+			path, err := s.Store.ShortestPath(ctx, s.TenantID, src.ID, dst.ID, opts)
+			if err != nil {
+				return nil, err
+			}
+			if path != nil && (best == nil || path.Hops() < best.Hops()) {
+				best = path
+			}
+		}
+	}
+	return best, nil
+}
+
+// Neighbors returns the entities within hops of the named entity.
+func (s *Service) Neighbors(ctx context.Context, name string, hops int, opts memory.TraversalOptions) (*memory.Subgraph, error) {
+	found, err := s.candidates(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Neighborhood(ctx, s.TenantID, found[0].ID, hops, opts)
+}
+
+// Path finds how two entities are connected for the graph_path tool.
+func (s *Service) Path(ctx context.Context, from, to string, relationTypes []string, minConfidence float64, maxHops int) (map[string]any, error) {
+	path, err := s.FindPath(ctx, from, to, memory.TraversalOptions{
+		RelationTypes: relationTypes,
+		MinConfidence: minConfidence,
+		MaxDepth:      maxHops,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if path == nil {
+		return map[string]any{"found": false, "triples": []string{}}, nil
+	}
+	return map[string]any{
+		"found":   true,
+		"hops":    path.Hops(),
+		"path":    FormatPath(path),
+		"triples": PathTriples(path),
+	}, nil
+}
+
+// candidates resolves a name to the entities a path may start or end at.
+func (s *Service) candidates(ctx context.Context, name string) ([]*memory.Entity, error) {
+	found, err := s.Store.LookupEntities(ctx, s.TenantID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		found, err = s.Store.SearchEntities(ctx, s.TenantID, name, maxCandidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("entity %q not found", name)
+	}
+	if len(found) > maxCandidates {
+		found = found[:maxCandidates]
+	}
+	return found, nil
+}
+
+// FormatPath renders a path in walking order, with each arrow pointing the
+// way its relation does: "Billing <--owns-- Payments --includes--> Alice".
+func FormatPath(p *memory.GraphPath) string {
+	if p == nil || len(p.Entities) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(p.Entities[0].Name)
+	for i, r := range p.Relations {
+		if r.SourceID == p.Entities[i].ID {
+			fmt.Fprintf(&b, " --%s--> ", r.RelationType)
+		} else {
+			fmt.Fprintf(&b, " <--%s-- ", r.RelationType)
+		}
+		b.WriteString(p.Entities[i+1].Name)
+	}
+	return b.String()
+}
+
+// PathTriples returns each relation on a path as "source --type--> target".
+func PathTriples(p *memory.GraphPath) []string {
+	triples := make([]string, 0, len(p.Relations))
+	for i, r := range p.Relations {
+		src, dst := p.Entities[i], p.Entities[i+1]
+		if r.SourceID != src.ID {
+			src, dst = dst, src
+		}
+		triples = append(triples, fmt.Sprintf("%s --%s--> %s", src.Name, r.RelationType, dst.Name))
+	}
+	return triples
+}
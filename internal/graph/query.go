@@ -0,0 +1,1121 @@
+// Package graph provides a pattern query language over the knowledge graph.
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// Query limits. Variable-length relationships without an upper bound use
+// DefaultMaxHops; no pattern may ask for more than MaxHops.
+const (
+	DefaultQueryLimit = 50
+	MaxQueryLimit     = 1000
+	DefaultMaxHops    = 3
+	MaxHops           = 6
+)
+
+// Query is a parsed graph pattern query:
+//
+//	MATCH (p:Person)-[:works_on]->(proj:Project)-[:uses]->(t)
+//	WHERE t.name = "Postgres"
+//	RETURN p, proj LIMIT 10
+//
+// Node labels match entity types and relationship types match relation
+// types, both case-insensitively. Relationships may be directed (-[]->,
+// <-[]-) or not (-[]-), list alternatives (:uses|depends_on) and span a
+// variable number of hops (-[*1..3]->). WHERE combines comparisons
+// (=, <>, <, <=, >, >=, CONTAINS, STARTS WITH, ENDS WITH) with AND, OR and
+// NOT; text comparisons ignore case.
+type Query struct {
+	Patterns []Pattern
+	Where    Expr
+	Distinct bool
+	Return   []ReturnItem
+	Limit    int
+}
+
+// Pattern is a chain of nodes joined by relationships; Rels[i] joins
+// Nodes[i] and Nodes[i+1].
+type Pattern struct {
+	Nodes []NodePattern
+	Rels  []RelPattern
+}
+
+// NodePattern matches an entity.
+type NodePattern struct {
+	Var   string
+	Label string
+	Props map[string]Literal
+}
+
+// Relationship directions.
+const (
+	DirBoth  = 0
+	DirRight = 1
+	DirLeft  = -1
+)
+
+// RelPattern matches a relation, or a path of relations when VarLength is set.
+type RelPattern struct {
+	Var       string
+	Types     []string
+	Dir       int
+	VarLength bool
+	MinHops   int
+	MaxHops   int
+}
+
+// ReturnItem is a returned variable or property.
+type ReturnItem struct {
+	Var   string
+	Prop  string
+	Alias string
+}
+
+// Name returns the column name of the item.
+func (r ReturnItem) Name() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	if r.Prop != "" {
+		return r.Var + "." + r.Prop
+	}
+	return r.Var
+}
+
+// Literal is a string or number constant.
+type Literal struct {
+	Value any
+}
+
+// Expr is a WHERE condition.
+type Expr interface {
+	compile(c *compiler) (string, error)
+}
+
+// Comparison compares a property with a literal or another property.
+type Comparison struct {
+	Var   string
+	Prop  string
+	Op    string
+	Value any // Literal or PropRef
+}
+
+// PropRef is a property on the right-hand side of a comparison.
+type PropRef struct {
+	Var  string
+	Prop string
+}
+
+// Logical combines conditions with AND or OR.
+type Logical struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Not negates a condition.
+type Not struct {
+	Expr Expr
+}
+
+// QueryResult holds the returned rows. Node values are maps with id, name
+// and type; relationship values have type, confidence, source and target.
+type QueryResult struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// Query parses and runs a pattern query in the service's tenant. limit caps
+// the rows when the query has no LIMIT of its own.
+func (s *Service) Query(ctx context.Context, text string, limit int) (*QueryResult, error) {
+	q, err := ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit == 0 {
+		q.Limit = limit
+	}
+	return q.Run(ctx, s.Store, s.TenantID)
+}
+
+// Match runs a pattern query for the graph_match tool.
+func (s *Service) Match(ctx context.Context, query string, limit int) (map[string]any, error) {
+	result, err := s.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"columns": result.Columns,
+		"rows":    result.Rows,
+		"count":   len(result.Rows),
+	}, nil
+}
+
+// Run executes the query against a tenant's graph.
+func (q *Query) Run(ctx context.Context, store *memory.GraphStore, tenantID string) (*QueryResult, error) {
+	query, args, cols, err := q.compile(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := store.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("run query: %w", err)
+	}
+	defer rows.Close()
+
+	width := 0
+	for _, col := range cols {
+		width += col.width()
+	}
+	result := &QueryResult{Rows: [][]any{}}
+	for _, item := range q.Return {
+		result.Columns = append(result.Columns, item.Name())
+	}
+	for rows.Next() {
+		values := make([]any, width)
+		ptrs := make([]any, width)
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make([]any, 0, len(cols))
+		for _, col := range cols {
+			row = append(row, col.value(values[:col.width()]))
+			values = values[col.width():]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// ============================================================
+// Parsing
+// ============================================================
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexQuery(text string) ([]token, error) {
+	var toks []token
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, string(runes[start:i]), start})
+		case r == '`':
+			start := i
+			end := i + 1
+			for end < len(runes) && runes[end] != '`' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated identifier at %d", start)
+			}
+			toks = append(toks, token{tokIdent, string(runes[start+1 : end]), start})
+			i = end + 1
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			if i+1 < len(runes) && runes[i] == '.' && unicode.IsDigit(runes[i+1]) {
+				i++
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		default:
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "<=", ">=", "<>", "!=", "..":
+				toks = append(toks, token{tokPunct, two, i})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("()[]{}:,.-<>*=|", r) {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			toks = append(toks, token{tokPunct, string(r), i})
+			i++
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// ParseQuery parses a pattern query.
+func ParseQuery(text string) (*Query, error) {
+	toks, err := lexQuery(text)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	p := &parser{toks: toks}
+	q, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return q, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) isKeyword(s string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, s)
+}
+
+func (p *parser) acceptPunct(s string) bool {
+	if p.isPunct(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(s string) bool {
+	if p.isKeyword(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("%s at %d (found %q)", fmt.Sprintf(format, args...), t.pos, found)
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return p.errorf("expected %q", s)
+	}
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.errorf("expected a name")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) query() (*Query, error) {
+	if !p.acceptKeyword("MATCH") {
+		return nil, p.errorf("expected MATCH")
+	}
+	q := &Query{}
+	for {
+		pat, err := p.pattern()
+		if err != nil {
+			return nil, err
+		}
+		q.Patterns = append(q.Patterns, pat)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("WHERE") {
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		q.Where = expr
+	}
+
+	if !p.acceptKeyword("RETURN") {
+		return nil, p.errorf("expected RETURN")
+	}
+	q.Distinct = p.acceptKeyword("DISTINCT")
+	for {
+		item, err := p.returnItem()
+		if err != nil {
+			return nil, err
+		}
+		q.Return = append(q.Return, item)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil || n <= 0 {
+			p.pos--
+			return nil, p.errorf("expected a positive LIMIT")
+		}
+		q.Limit = n
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected input")
+	}
+	return q, nil
+}
+
+func (p *parser) pattern() (Pattern, error) {
+	var pat Pattern
+	node, err := p.node()
+	if err != nil {
+		return pat, err
+	}
+	pat.Nodes = append(pat.Nodes, node)
+	for p.isPunct("-") || p.isPunct("<") {
+		rel, err := p.rel()
+		if err != nil {
+			return pat, err
+		}
+		node, err := p.node()
+		if err != nil {
+			return pat, err
+		}
+		pat.Rels = append(pat.Rels, rel)
+		pat.Nodes = append(pat.Nodes, node)
+	}
+	return pat, nil
+}
+
+func (p *parser) node() (NodePattern, error) {
+	var n NodePattern
+	if err := p.expectPunct("("); err != nil {
+		return n, err
+	}
+	if p.peek().kind == tokIdent {
+		n.Var = p.next().text
+	}
+	if p.acceptPunct(":") {
+		label, err := p.ident()
+		if err != nil {
+			return n, err
+		}
+		n.Label = label
+	}
+	if p.acceptPunct("{") {
+		n.Props = map[string]Literal{}
+		for !p.acceptPunct("}") {
+			if len(n.Props) > 0 {
+				if err := p.expectPunct(","); err != nil {
+					return n, err
+				}
+			}
+			key, err := p.ident()
+			if err != nil {
+				return n, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return n, err
+			}
+			lit, err := p.literal()
+			if err != nil {
+				return n, err
+			}
+			n.Props[strings.ToLower(key)] = lit
+		}
+	}
+	return n, p.expectPunct(")")
+}
+
+// rel parses -[...]->, <-[...]-, -[...]- and the bare forms -->, <-- and --.
+func (p *parser) rel() (RelPattern, error) {
+	r := RelPattern{MinHops: 1, MaxHops: 1}
+	left := p.acceptPunct("<")
+	if err := p.expectPunct("-"); err != nil {
+		return r, err
+	}
+	if p.acceptPunct("[") {
+		if p.peek().kind == tokIdent {
+			r.Var = p.next().text
+		}
+		if p.acceptPunct(":") {
+			for {
+				typ, err := p.ident()
+				if err != nil {
+					return r, err
+				}
+				r.Types = append(r.Types, typ)
+				if !p.acceptPunct("|") {
+					break
+				}
+			}
+		}
+		if p.acceptPunct("*") {
+			if err := p.hops(&r); err != nil {
+				return r, err
+			}
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return r, err
+		}
+	}
+	if err := p.expectPunct("-"); err != nil {
+		return r, err
+	}
+	right := p.acceptPunct(">")
+	switch {
+	case left && right:
+		return r, p.errorf("a relationship cannot point both ways")
+	case left:
+		r.Dir = DirLeft
+	case right:
+		r.Dir = DirRight
+	}
+	return r, nil
+}
+
+// hops parses the range after "*": *, *n, *n.., *..m or *n..m.
+func (p *parser) hops(r *RelPattern) error {
+	r.VarLength = true
+	r.MinHops, r.MaxHops = 1, DefaultMaxHops
+	number := func() (int, bool, error) {
+		if p.peek().kind != tokNumber {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(p.next().text)
+		if err != nil {
+			p.pos--
+			return 0, false, p.errorf("expected a whole number of hops")
+		}
+		return n, true, nil
+	}
+	min, hasMin, err := number()
+	if err != nil {
+		return err
+	}
+	if hasMin {
+		r.MinHops = min
+		r.MaxHops = min
+	}
+	if p.acceptPunct("..") {
+		r.MaxHops = DefaultMaxHops
+		if r.MinHops > r.MaxHops {
+			r.MaxHops = r.MinHops
+		}
+		max, hasMax, err := number()
+		if err != nil {
+			return err
+		}
+		if hasMax {
+			r.MaxHops = max
+		}
+	}
+	switch {
+	case r.MinHops < 1:
+		return p.errorf("paths need at least 1 hop")
+	case r.MaxHops < r.MinHops:
+		return p.errorf("hop range %d..%d is empty", r.MinHops, r.MaxHops)
+	case r.MaxHops > MaxHops:
+		return p.errorf("paths are limited to %d hops", MaxHops)
+	}
+	return nil
+}
+
+func (p *parser) returnItem() (ReturnItem, error) {
+	var item ReturnItem
+	v, err := p.ident()
+	if err != nil {
+		return item, err
+	}
+	item.Var = v
+	if p.acceptPunct(".") {
+		prop, err := p.ident()
+		if err != nil {
+			return item, err
+		}
+		item.Prop = strings.ToLower(prop)
+	}
+	if p.acceptKeyword("AS") {
+		alias, err := p.ident()
+		if err != nil {
+			return item, err
+		}
+		item.Alias = alias
+	}
+	return item, nil
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	if p.acceptPunct("(") {
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectPunct(")")
+	}
+	return p.comparison()
+}
+
+var comparisonOps = map[string]string{
+	"=": "=", "<>": "<>", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+func (p *parser) comparison() (Expr, error) {
+	c := &Comparison{}
+	v, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("."); err != nil {
+		return nil, err
+	}
+	prop, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	c.Var, c.Prop = v, strings.ToLower(prop)
+
+	t := p.peek()
+	switch {
+	case t.kind == tokPunct && comparisonOps[t.text] != "":
+		c.Op = comparisonOps[p.next().text]
+	case p.acceptKeyword("CONTAINS"):
+		c.Op = "CONTAINS"
+	case p.isKeyword("STARTS") || p.isKeyword("ENDS"):
+		c.Op = strings.ToUpper(p.next().text) + " WITH"
+		if !p.acceptKeyword("WITH") {
+			return nil, p.errorf("expected WITH")
+		}
+	default:
+		return nil, p.errorf("expected a comparison operator")
+	}
+
+	if p.peek().kind == tokIdent {
+		rv := p.next().text
+		if err := p.expectPunct("."); err != nil {
+			return nil, err
+		}
+		rp, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		c.Value = PropRef{Var: rv, Prop: strings.ToLower(rp)}
+		return c, nil
+	}
+	lit, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	c.Value = lit
+	return c, nil
+}
+
+func (p *parser) literal() (Literal, error) {
+	neg := p.acceptPunct("-")
+	t := p.next()
+	switch {
+	case t.kind == tokString && !neg:
+		return Literal{t.text}, nil
+	case t.kind == tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			break
+		}
+		if neg {
+			f = -f
+		}
+		return Literal{f}, nil
+	}
+	p.pos--
+	return Literal{}, p.errorf("expected a string or number")
+}
+
+// ============================================================
+// Compilation
+// ============================================================
+
+// Node and relationship properties and the columns they read.
+var (
+	nodeProps = map[string]string{
+		"id":          "%s.id",
+		"name":        "%s.name",
+		"type":        "%s.entity_type",
+		"description": "COALESCE(%s.description, '')",
+		"importance":  "COALESCE(%s.importance, 0)",
+		"created_at":  "%s.created_at",
+		"updated_at":  "%s.updated_at",
+	}
+	relProps = map[string]string{
+		"id":         "%s.id",
+		"type":       "%s.relation_type",
+		"confidence": "COALESCE(%s.confidence, 1)",
+		"created_at": "%s.created_at",
+		"updated_at": "%s.updated_at",
+	}
+	textProps = map[string]bool{"id": true, "name": true, "type": true, "description": true}
+)
+
+type compiler struct {
+	tenantID string
+	ctes     []string
+	cteArgs  []any
+	from     []string
+	fromArgs []any
+	conds    []string
+	args     []any
+	nodes    map[string]string
+	rels     map[string]*relBinding
+	nextNode int
+	nextRel  int
+}
+
+// relBinding is a fixed-length relationship and the node aliases it joins.
+type relBinding struct {
+	alias, left, right string
+}
+
+// column is a returned value read from one or more SQL columns.
+type column struct {
+	exprs []string
+	kind  string // node, rel or scalar
+}
+
+func (c column) width() int { return len(c.exprs) }
+
+func (c column) value(v []any) any {
+	switch c.kind {
+	case "node":
+		m := map[string]any{"id": v[0], "name": v[1], "type": v[2]}
+		if s, ok := v[3].(string); ok && s != "" {
+			m["description"] = s
+		}
+		return m
+	case "rel":
+		return map[string]any{"type": v[0], "confidence": v[1], "source": v[2], "target": v[3]}
+	default:
+		return v[0]
+	}
+}
+
+// Compile translates the query into SQL scoped to a tenant. Variable-length
+// relationships become recursive CTEs.
+func (q *Query) Compile(tenantID string) (string, []any, error) {
+	query, args, _, err := q.compile(tenantID)
+	return query, args, err
+}
+
+func (q *Query) compile(tenantID string) (string, []any, []column, error) {
+	c := &compiler{tenantID: tenantID, nodes: map[string]string{}, rels: map[string]*relBinding{}}
+	for _, pat := range q.Patterns {
+		if err := c.pattern(pat); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	var cols []column
+	var selects []string
+	for _, item := range q.Return {
+		col, err := c.returnColumn(item)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		cols = append(cols, col)
+		selects = append(selects, col.exprs...)
+	}
+
+	if q.Where != nil {
+		cond, err := q.Where.compile(c)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		c.conds = append(c.conds, cond)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	var b strings.Builder
+	if len(c.ctes) > 0 {
+		b.WriteString("WITH RECURSIVE\n")
+		b.WriteString(strings.Join(c.ctes, ",\n"))
+		b.WriteString("\n")
+	}
+	b.WriteString("SELECT ")
+	if q.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+	b.WriteString(strings.Join(selects, ", "))
+	b.WriteString("\nFROM ")
+	b.WriteString(strings.Join(c.from, ", "))
+	b.WriteString("\nWHERE ")
+	b.WriteString(strings.Join(c.conds, "\n  AND "))
+	b.WriteString("\nLIMIT ?")
+
+	args := append(append(append(c.cteArgs, c.fromArgs...), c.args...), limit)
+	return b.String(), args, cols, nil
+}
+
+func (c *compiler) pattern(pat Pattern) error {
+	aliases := make([]string, len(pat.Nodes))
+	for i, n := range pat.Nodes {
+		alias, err := c.node(n)
+		if err != nil {
+			return err
+		}
+		aliases[i] = alias
+	}
+	for i, r := range pat.Rels {
+		left, right := aliases[i], aliases[i+1]
+		var err error
+		if r.VarLength {
+			err = c.path(r, left, right)
+		} else {
+			err = c.rel(r, left, right)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) node(n NodePattern) (string, error) {
+	if n.Var != "" {
+		if _, ok := c.rels[n.Var]; ok {
+			return "", fmt.Errorf("query: %s is already a relationship", n.Var)
+		}
+	}
+	alias, seen := c.nodes[n.Var]
+	if !seen || n.Var == "" {
+		alias = fmt.Sprintf("n%d", c.nextNode)
+		c.nextNode++
+		if n.Var != "" {
+			c.nodes[n.Var] = alias
+		}
+		c.from = append(c.from, "team_entities "+alias)
+		c.conds = append(c.conds, alias+".tenant_id = ?")
+		c.args = append(c.args, c.tenantID)
+	}
+	if n.Label != "" {
+		c.conds = append(c.conds, alias+".entity_type = ? COLLATE NOCASE")
+		c.args = append(c.args, n.Label)
+	}
+	for key, lit := range n.Props {
+		expr, ok := nodeProps[key]
+		if !ok {
+			return "", fmt.Errorf("query: unknown node property %q", key)
+		}
+		cond, args := compare(fmt.Sprintf(expr, alias), "=", lit.Value, textProps[key])
+		c.conds = append(c.conds, cond)
+		c.args = append(c.args, args...)
+	}
+	return alias, nil
+}
+
+func (c *compiler) relTypes(col string, r RelPattern) (string, []any) {
+	if len(r.Types) == 0 {
+		return "", nil
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(r.Types)), ", ")
+	args := make([]any, len(r.Types))
+	for i, t := range r.Types {
+		args[i] = t
+	}
+	return fmt.Sprintf(" AND %s COLLATE NOCASE IN (%s)", col, marks), args
+}
+
+func (c *compiler) rel(r RelPattern, left, right string) error {
+	if r.Var != "" {
+		if _, ok := c.nodes[r.Var]; ok {
+			return fmt.Errorf("query: %s is already a node", r.Var)
+		}
+		if _, ok := c.rels[r.Var]; ok {
+			return fmt.Errorf("query: relationship %s is used twice", r.Var)
+		}
+	}
+	alias := fmt.Sprintf("r%d", c.nextRel)
+	c.nextRel++
+	if r.Var != "" {
+		c.rels[r.Var] = &relBinding{alias: alias, left: left, right: right}
+	}
+	c.from = append(c.from, "team_relations "+alias)
+
+	types, typeArgs := c.relTypes(alias+".relation_type", r)
+	cond := alias + ".tenant_id = ?" + types
+	c.args = append(c.args, c.tenantID)
+	c.args = append(c.args, typeArgs...)
+
+	src, dst := left, right
+	if r.Dir == DirLeft {
+		src, dst = right, left
+	}
+	join := fmt.Sprintf("%[1]s.source_id = %[2]s.id AND %[1]s.target_id = %[3]s.id", alias, src, dst)
+	if r.Dir == DirBoth {
+		join = fmt.Sprintf("((%[1]s.source_id = %[2]s.id AND %[1]s.target_id = %[3]s.id) OR (%[1]s.source_id = %[3]s.id AND %[1]s.target_id = %[2]s.id))", alias, left, right)
+	}
+	c.conds = append(c.conds, cond, join)
+	return nil
+}
+
+// path joins two nodes through a recursive CTE over the relations, visiting
+// no entity twice on a path.
+func (c *compiler) path(r RelPattern, left, right string) error {
+	if r.Var != "" {
+		return fmt.Errorf("query: variable-length relationship %s cannot be named", r.Var)
+	}
+	n := c.nextRel
+	c.nextRel++
+	edges, paths := fmt.Sprintf("e%d", n), fmt.Sprintf("p%d", n)
+
+	types, typeArgs := c.relTypes("relation_type", r)
+	edgeSQL := fmt.Sprintf("SELECT source_id, target_id FROM team_relations WHERE tenant_id = ?%s", types)
+	c.cteArgs = append(c.cteArgs, c.tenantID)
+	c.cteArgs = append(c.cteArgs, typeArgs...)
+	if r.Dir == DirBoth {
+		edgeSQL += fmt.Sprintf("\n    UNION SELECT target_id, source_id FROM team_relations WHERE tenant_id = ?%s", types)
+		c.cteArgs = append(c.cteArgs, c.tenantID)
+		c.cteArgs = append(c.cteArgs, typeArgs...)
+	}
+	c.ctes = append(c.ctes,
+		fmt.Sprintf("  %s(src, dst) AS (\n    %s\n  )", edges, edgeSQL),
+		fmt.Sprintf(`  %[1]s(start_id, end_id, depth, visited) AS (
+    SELECT src, dst, 1, ',' || src || ',' || dst || ',' FROM %[2]s
+    UNION ALL
+    SELECT %[1]s.start_id, %[2]s.dst, %[1]s.depth + 1, %[1]s.visited || %[2]s.dst || ','
+    FROM %[1]s JOIN %[2]s ON %[2]s.src = %[1]s.end_id
+    WHERE %[1]s.depth < ? AND instr(%[1]s.visited, ',' || %[2]s.dst || ',') = 0
+  )`, paths, edges))
+	c.cteArgs = append(c.cteArgs, r.MaxHops)
+
+	hop := fmt.Sprintf("h%d", n)
+	c.from = append(c.from, fmt.Sprintf("(SELECT DISTINCT start_id, end_id FROM %s WHERE depth >= ?) %s", paths, hop))
+	c.fromArgs = append(c.fromArgs, r.MinHops)
+
+	src, dst := left, right
+	if r.Dir == DirLeft {
+		src, dst = right, left
+	}
+	c.conds = append(c.conds, fmt.Sprintf("%[1]s.start_id = %[2]s.id AND %[1]s.end_id = %[3]s.id", hop, src, dst))
+	return nil
+}
+
+func (c *compiler) returnColumn(item ReturnItem) (column, error) {
+	if alias, ok := c.nodes[item.Var]; ok {
+		if item.Prop == "" {
+			return column{kind: "node", exprs: []string{
+				alias + ".id", alias + ".name", alias + ".entity_type", fmt.Sprintf(nodeProps["description"], alias),
+			}}, nil
+		}
+	}
+	if rel, ok := c.rels[item.Var]; ok && item.Prop == "" {
+		a := rel.alias
+		return column{kind: "rel", exprs: []string{
+			a + ".relation_type",
+			fmt.Sprintf(relProps["confidence"], a),
+			fmt.Sprintf("CASE %s.source_id WHEN %s.id THEN %s.name ELSE %s.name END", a, rel.left, rel.left, rel.right),
+			fmt.Sprintf("CASE %s.target_id WHEN %s.id THEN %s.name ELSE %s.name END", a, rel.right, rel.right, rel.left),
+		}}, nil
+	}
+	expr, _, err := c.prop(item.Var, item.Prop)
+	if err != nil {
+		return column{}, err
+	}
+	return column{kind: "scalar", exprs: []string{expr}}, nil
+}
+
+// prop returns the SQL for a property and whether it holds text.
+func (c *compiler) prop(v, prop string) (string, bool, error) {
+	if alias, ok := c.nodes[v]; ok {
+		expr, ok := nodeProps[prop]
+		if !ok {
+			return "", false, fmt.Errorf("query: unknown node property %s.%s", v, prop)
+		}
+		return fmt.Sprintf(expr, alias), textProps[prop], nil
+	}
+	if rel, ok := c.rels[v]; ok {
+		expr, ok := relProps[prop]
+		if !ok {
+			return "", false, fmt.Errorf("query: unknown relationship property %s.%s", v, prop)
+		}
+		return fmt.Sprintf(expr, rel.alias), prop == "id" || prop == "type", nil
+	}
+	return "", false, fmt.Errorf("query: %s is not defined in MATCH", v)
+}
+
+func (e *Comparison) compile(c *compiler) (string, error) {
+	left, text, err := c.prop(e.Var, e.Prop)
+	if err != nil {
+		return "", err
+	}
+	if ref, ok := e.Value.(PropRef); ok {
+		right, _, err := c.prop(ref.Var, ref.Prop)
+		if err != nil {
+			return "", err
+		}
+		switch e.Op {
+		case "CONTAINS":
+			return fmt.Sprintf("instr(lower(%s), lower(%s)) > 0", left, right), nil
+		case "STARTS WITH", "ENDS WITH":
+			return "", fmt.Errorf("query: %s needs a string", e.Op)
+		}
+		if text {
+			return fmt.Sprintf("%s %s %s COLLATE NOCASE", left, e.Op, right), nil
+		}
+		return fmt.Sprintf("%s %s %s", left, e.Op, right), nil
+	}
+
+	value := e.Value.(Literal).Value
+	if _, ok := value.(string); !ok && (e.Op == "CONTAINS" || strings.HasSuffix(e.Op, " WITH")) {
+		return "", fmt.Errorf("query: %s needs a string", e.Op)
+	}
+	cond, args := compare(left, e.Op, value, text)
+	c.args = append(c.args, args...)
+	return cond, nil
+}
+
+func (e *Logical) compile(c *compiler) (string, error) {
+	left, err := e.Left.compile(c)
+	if err != nil {
+		return "", err
+	}
+	right, err := e.Right.compile(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", left, e.Op, right), nil
+}
+
+func (e *Not) compile(c *compiler) (string, error) {
+	inner, err := e.Expr.compile(c)
+	if err != nil {
+		return "", err
+	}
+	return "NOT " + inner, nil
+}
+
+// compare builds a comparison with a literal. Text comparisons ignore case.
+func compare(expr, op string, value any, text bool) (string, []any) {
+	switch op {
+	case "CONTAINS", "STARTS WITH", "ENDS WITH":
+		s, _ := value.(string)
+		s = escapeLike(s)
+		switch op {
+		case "CONTAINS":
+			s = "%" + s + "%"
+		case "STARTS WITH":
+			s += "%"
+		default:
+			s = "%" + s
+		}
+		return fmt.Sprintf(`%s LIKE ? ESCAPE '\'`, expr), []any{s}
+	}
+	if text {
+		return fmt.Sprintf("%s %s ? COLLATE NOCASE", expr, op), []any{value}
+	}
+	return fmt.Sprintf("%s %s ?", expr, op), []any{value}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
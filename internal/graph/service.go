@@ -0,0 +1,561 @@
+// Package graph provides the knowledge graph service behind the graph tools.
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/flynn-ai/flynn/internal/memory"
+)
+
+// Service runs graph operations for one tenant. It implements the
+// executor.GraphService interface used by the model-facing graph tools.
+type Service struct {
+	Store    *memory.GraphStore
+	Ingestor *Ingestor
+	Code     *CodeIngestor
+	Indexer  *Indexer
+	Docs     *DocsQA
+	TenantID string
+}
+
+// NewService creates a graph service for a tenant. The extractor is used by
+// Ingest; nil stores documents without extracting entities.
+func NewService(store *memory.GraphStore, extractor Extractor, tenantID string) *Service {
+	ingestor := NewIngestor(store, extractor)
+	code := NewCodeIngestor(store)
+	return &Service{
+		Store:    store,
+		Ingestor: ingestor,
+		Code:     code,
+		Indexer:  &Indexer{Ingestor: ingestor, Code: code},
+		Docs:     NewDocsQA(store, nil),
+		TenantID: tenantID,
+	}
+}
+
+// Stats returns entity, relation, document and chunk counts.
+func (s *Service) Stats(ctx context.Context) (map[string]any, error) {
+	stats, err := s.Store.Stats(ctx, s.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"tenant_id": s.TenantID,
+		"entities":  stats.Entities,
+		"relations": stats.Relations,
+		"documents": stats.Documents,
+		"chunks":    stats.Chunks,
+	}, nil
+}
+
+// Search returns entities whose name contains the query.
+func (s *Service) Search(ctx context.Context, query string, limit int) ([]map[string]any, error) {
+	entities, err := s.Store.SearchEntities(ctx, s.TenantID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]map[string]any, 0, len(entities))
+	for _, e := range entities {
+		results = append(results, entityMap(e))
+	}
+	return results, nil
+}
+
+// Dump returns up to limit of the most recently updated entities and
+// relations. Only the json format is supported.
+func (s *Service) Dump(ctx context.Context, format string, limit int) (any, error) {
+	if format != "json" {
+		return nil, fmt.Errorf("unsupported dump format %q", format)
+	}
+	entities, err := s.Store.ListEntities(ctx, s.TenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	relations, err := s.Store.ListRelations(ctx, s.TenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	names := newNameCache(s)
+	entityRows := make([]map[string]any, 0, len(entities))
+	for _, e := range entities {
+		names.add(e)
+		entityRows = append(entityRows, entityMap(e))
+	}
+	relationRows := make([]map[string]any, 0, len(relations))
+	for _, r := range relations {
+		relationRows = append(relationRows, names.relationMap(ctx, r))
+	}
+	return map[string]any{
+		"entities":  entityRows,
+		"relations": relationRows,
+	}, nil
+}
+
+// QueryRelations returns the relations of every entity known by the name.
+func (s *Service) QueryRelations(ctx context.Context, entity string) ([]map[string]any, error) {
+	entities, err := s.Store.LookupEntities(ctx, s.TenantID, entity)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("entity %q not found", entity)
+	}
+
+	names := newNameCache(s)
+	seen := map[string]bool{}
+	results := []map[string]any{}
+	for _, e := range entities {
+		names.add(e)
+		relations, err := s.Store.GetRelations(ctx, s.TenantID, e.ID, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range relations {
+			if seen[r.ID] {
+				continue
+			}
+			seen[r.ID] = true
+			results = append(results, names.relationMap(ctx, r))
+		}
+	}
+	return results, nil
+}
+
+// AddEntity upserts an entity; properties are stored as its metadata.
+func (s *Service) AddEntity(ctx context.Context, entity, entityType string, properties any) error {
+	e := &memory.Entity{Name: strings.TrimSpace(entity), EntityType: entityType}
+	if props, ok := properties.(map[string]any); ok {
+		if desc, ok := props["description"].(string); ok {
+			e.Description = desc
+		}
+	}
+	if properties != nil {
+		data, err := json.Marshal(properties)
+		if err != nil {
+			return fmt.Errorf("encode properties: %w", err)
+		}
+		e.MetadataJSON = string(data)
+	}
+	_, err := s.Store.UpsertEntity(ctx, s.TenantID, e)
+	return err
+}
+
+// AddRelation links two entities by name, creating either as an "unknown"
+// entity when it does not exist yet.
+func (s *Service) AddRelation(ctx context.Context, from, to, relation string) error {
+	source, err := s.resolve(ctx, from)
+	if err != nil {
+		return err
+	}
+	target, err := s.resolve(ctx, to)
+	if err != nil {
+		return err
+	}
+	_, err = s.Store.CreateRelation(ctx, s.TenantID, &memory.Relation{
+		SourceID:     source.ID,
+		TargetID:     target.ID,
+		RelationType: relation,
+	})
+	return err
+}
+
+// Ingest stores content as a document and extracts entities and relations
+// from it. Ingesting the same source again replaces its chunks.
+func (s *Service) Ingest(ctx context.Context, content, source string) (map[string]any, error) {
+	title := source
+	if title == "" {
+		title = "graph_ingest"
+	}
+	result, err := s.Ingestor.IngestText(ctx, s.TenantID, Source{Type: "tool", Ref: source}, title, content)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"document_id": result.DocumentID,
+		"chunks":      result.Chunks,
+		"entities":    result.Entities,
+		"relations":   result.Relations,
+	}, nil
+}
+
+// IngestGo records the structure of the Go packages at path, which is a
+// directory or a .go file; see CodeIngestor.IngestGo.
+func (s *Service) IngestGo(ctx context.Context, path string) (*CodeResult, error) {
+	return s.Code.IngestGo(ctx, s.TenantID, path)
+}
+
+// Index brings the documents of the directory tree at path up to date; see
+// Indexer.Index. Files left pending by the indexer's limit are picked up by
+// the next call.
+func (s *Service) Index(ctx context.Context, path string) (map[string]any, error) {
+	result, err := s.Indexer.Index(ctx, s.TenantID, path)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"root":      result.Root,
+		"files":     result.Files,
+		"added":     result.Added,
+		"updated":   result.Updated,
+		"unchanged": result.Unchanged,
+		"removed":   result.Removed,
+		"skipped":   result.Skipped,
+		"failed":    result.Failed,
+		"pending":   result.Pending,
+		"resumed":   result.Resumed,
+	}
+	if len(result.Code) > 0 {
+		packages := 0
+		for _, c := range result.Code {
+			packages += c.Updated
+		}
+		out["code_packages_updated"] = packages
+	}
+	if len(result.Errors) > 0 {
+		out["errors"] = result.Errors
+	}
+	return out, nil
+}
+
+// Ask answers a question from the tenant's documents with at most k chunks
+// (0 uses the default); see DocsQA.Ask.
+func (s *Service) Ask(ctx context.Context, question string, k int) (*DocAnswer, error) {
+	return s.Docs.Ask(ctx, s.TenantID, question, k)
+}
+
+// AskDocs is Ask for the docs_ask tool: the answer with the sources it
+// cites, or the most relevant sources when there is no model to answer.
+func (s *Service) AskDocs(ctx context.Context, question string, k int) (map[string]any, error) {
+	answer, err := s.Ask(ctx, question, k)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{"question": question, "answer": answer.Answer}
+	sources := answer.Cited()
+	switch {
+	case len(answer.Sources) == 0:
+		out["note"] = "no ingested document matches the question"
+	case answer.Answer == "":
+		out["note"] = "no model is configured to answer; these are the most relevant passages"
+		sources = answer.Sources
+	case len(sources) == 0:
+		out["note"] = "the answer cites no source; these are the passages it was given"
+		sources = answer.Sources
+	}
+	list := make([]map[string]any, 0, len(sources))
+	for _, src := range sources {
+		item := map[string]any{
+			"ref":      src.Ref,
+			"document": src.Document,
+			"location": src.Location(),
+			"excerpt":  src.Excerpt,
+		}
+		if src.File != "" {
+			item["file"] = src.File
+		}
+		if src.StartLine > 0 {
+			item["start_line"] = src.StartLine
+			item["end_line"] = src.EndLine
+		}
+		list = append(list, item)
+	}
+	out["sources"] = list
+	return out, nil
+}
+
+// Clear deletes the tenant's whole graph, including ingested documents.
+func (s *Service) Clear(ctx context.Context) error {
+	return s.Store.Clear(ctx, s.TenantID)
+}
+
+// resolve returns the entity a name refers to, creating an "unknown" entity
+// when there is none.
+func (s *Service) resolve(ctx context.Context, name string) (*memory.Entity, error) {
+	return s.Store.ResolveOrCreateEntity(ctx, s.TenantID, &memory.Entity{Name: strings.TrimSpace(name), EntityType: "unknown"})
+}
+
+// ============================================================
+// Snapshots
+// ============================================================
+
+// Snapshot is a portable copy of a tenant's graph. Relations refer to
+// entities by name and type so snapshots can move between databases.
+type Snapshot struct {
+	Entities  []SnapshotEntity   `json:"entities"`
+	Relations []SnapshotRelation `json:"relations"`
+}
+
+// SnapshotEntity is an entity in a snapshot.
+type SnapshotEntity struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Metadata    string   `json:"metadata,omitempty"`
+	Importance  float64  `json:"importance,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// SnapshotRelation is a relation in a snapshot.
+type SnapshotRelation struct {
+	Source     string  `json:"source"`
+	SourceType string  `json:"source_type"`
+	Target     string  `json:"target"`
+	TargetType string  `json:"target_type"`
+	Relation   string  `json:"relation"`
+	Confidence float64 `json:"confidence,omitempty"`
+	Metadata   string  `json:"metadata,omitempty"`
+}
+
+// Snapshot returns every entity and relation of the tenant.
+func (s *Service) Snapshot(ctx context.Context) (*Snapshot, error) {
+	return s.Select(ctx, SelectOptions{})
+}
+
+// SelectOptions chooses part of a graph. Both filters may be combined.
+type SelectOptions struct {
+	Types  []string // Only entities of these types; empty keeps all
+	Around string   // Only the neighborhood of this entity, by ID or name
+	Hops   int      // Size of the neighborhood; 0 uses 2
+}
+
+// Select returns the entities opts choose and the relations among them.
+func (s *Service) Select(ctx context.Context, opts SelectOptions) (*Snapshot, error) {
+	stats, err := s.Store.Stats(ctx, s.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Entities: []SnapshotEntity{}, Relations: []SnapshotRelation{}}
+	if stats.Entities == 0 {
+		return snap, nil
+	}
+
+	var entities []*memory.Entity
+	if opts.Around != "" {
+		center, err := s.Entity(ctx, opts.Around)
+		if err != nil {
+			return nil, err
+		}
+		hops := opts.Hops
+		if hops <= 0 {
+			hops = 2
+		}
+		sub, err := s.Store.Neighborhood(ctx, s.TenantID, center.ID, hops, memory.TraversalOptions{Limit: stats.Entities})
+		if err != nil {
+			return nil, err
+		}
+		entities = sub.Entities
+	} else if entities, err = s.Store.ListEntities(ctx, s.TenantID, stats.Entities); err != nil {
+		return nil, err
+	}
+	types := map[string]bool{}
+	for _, t := range opts.Types {
+		types[strings.ToLower(t)] = true
+	}
+	aliases, err := s.Store.AliasMap(ctx, s.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*memory.Entity, len(entities))
+	for _, e := range entities {
+		if len(types) > 0 && !types[strings.ToLower(e.EntityType)] {
+			continue
+		}
+		byID[e.ID] = e
+		snap.Entities = append(snap.Entities, SnapshotEntity{
+			Name:        e.Name,
+			Type:        e.EntityType,
+			Description: e.Description,
+			Metadata:    e.MetadataJSON,
+			Importance:  e.Importance,
+			Aliases:     aliases[e.ID],
+		})
+	}
+	if stats.Relations == 0 || len(byID) == 0 {
+		return snap, nil
+	}
+
+	relations, err := s.Store.ListRelations(ctx, s.TenantID, stats.Relations)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range relations {
+		source, target := byID[r.SourceID], byID[r.TargetID]
+		if source == nil || target == nil {
+			continue
+		}
+		snap.Relations = append(snap.Relations, SnapshotRelation{
+			Source:     source.Name,
+			SourceType: source.EntityType,
+			Target:     target.Name,
+			TargetType: target.EntityType,
+			Relation:   r.RelationType,
+			Confidence: r.Confidence,
+			Metadata:   r.MetadataJSON,
+		})
+	}
+	return snap, nil
+}
+
+// ImportResult counts what Restore did.
+type ImportResult struct {
+	Entities  int `json:"entities"`  // Entities created
+	Merged    int `json:"merged"`    // Entities merged into one the graph had
+	Relations int `json:"relations"` // Relations created or confirmed
+	Skipped   int `json:"skipped"`   // Entities without a name, relations without endpoints or a type
+}
+
+// Restore merges a snapshot into the tenant's graph. Entities are resolved
+// by name and alias as ingestion resolves them, so one the graph knows under
+// another spelling is merged instead of duplicated. Relations whose entities
+// are not in the snapshot are resolved by name the same way.
+func (s *Service) Restore(ctx context.Context, snap *Snapshot) (*ImportResult, error) {
+	result := &ImportResult{}
+	ids := map[string]string{}
+	for _, e := range snap.Entities {
+		if strings.TrimSpace(e.Name) == "" {
+			result.Skipped++
+			continue
+		}
+		if e.Type == "" {
+			e.Type = "unknown"
+		}
+		existing, err := s.Store.ResolveEntity(ctx, s.TenantID, e.Name, e.Type)
+		if err != nil {
+			return result, fmt.Errorf("import entity %q: %w", e.Name, err)
+		}
+		entity := &memory.Entity{
+			Name:         e.Name,
+			EntityType:   e.Type,
+			Description:  e.Description,
+			MetadataJSON: e.Metadata,
+			Importance:   e.Importance,
+		}
+		var saved *memory.Entity
+		if existing == nil {
+			saved, err = s.Store.UpsertEntity(ctx, s.TenantID, entity)
+			result.Entities++
+		} else {
+			saved, err = s.Store.ResolveOrCreateEntity(ctx, s.TenantID, entity)
+			result.Merged++
+		}
+		if err != nil {
+			return result, fmt.Errorf("import entity %q: %w", e.Name, err)
+		}
+		for _, alias := range e.Aliases {
+			if memory.NormalizeName(alias) == "" {
+				continue
+			}
+			if err := s.Store.AddAlias(ctx, s.TenantID, saved.ID, alias); err != nil {
+				return result, fmt.Errorf("import alias %q of %q: %w", alias, e.Name, err)
+			}
+		}
+		ids[e.Name+"|"+e.Type] = saved.ID
+	}
+
+	endpoint := func(name, entityType string) (string, error) {
+		if entityType == "" {
+			entityType = "unknown"
+		}
+		key := name + "|" + entityType
+		if id := ids[key]; id != "" {
+			return id, nil
+		}
+		e, err := s.Store.ResolveEntity(ctx, s.TenantID, name, entityType)
+		if err != nil {
+			return "", err
+		}
+		if e == nil {
+			if e, err = s.Store.UpsertEntity(ctx, s.TenantID, &memory.Entity{Name: name, EntityType: entityType}); err != nil {
+				return "", err
+			}
+			result.Entities++
+		}
+		ids[key] = e.ID
+		return e.ID, nil
+	}
+	for _, r := range snap.Relations {
+		if strings.TrimSpace(r.Source) == "" || strings.TrimSpace(r.Target) == "" || r.Relation == "" {
+			result.Skipped++
+			continue
+		}
+		source, err := endpoint(r.Source, r.SourceType)
+		if err != nil {
+			return result, fmt.Errorf("import entity %q: %w", r.Source, err)
+		}
+		target, err := endpoint(r.Target, r.TargetType)
+		if err != nil {
+			return result, fmt.Errorf("import entity %q: %w", r.Target, err)
+		}
+		if _, err := s.Store.CreateRelation(ctx, s.TenantID, &memory.Relation{
+			SourceID:     source,
+			TargetID:     target,
+			RelationType: r.Relation,
+			Confidence:   r.Confidence,
+			MetadataJSON: r.Metadata,
+		}); err != nil {
+			return result, fmt.Errorf("import relation %s -%s-> %s: %w", r.Source, r.Relation, r.Target, err)
+		}
+		result.Relations++
+	}
+	return result, nil
+}
+
+// ============================================================
+// Result Maps
+// ============================================================
+
+func entityMap(e *memory.Entity) map[string]any {
+	m := map[string]any{
+		"id":         e.ID,
+		"name":       e.Name,
+		"type":       e.EntityType,
+		"importance": e.Importance,
+	}
+	if e.Description != "" {
+		m["description"] = e.Description
+	}
+	return m
+}
+
+// nameCache resolves relation endpoints to entity names.
+type nameCache struct {
+	svc      *Service
+	entities map[string]*memory.Entity
+}
+
+func newNameCache(s *Service) *nameCache {
+	return &nameCache{svc: s, entities: map[string]*memory.Entity{}}
+}
+
+func (c *nameCache) add(e *memory.Entity) {
+	c.entities[e.ID] = e
+}
+
+func (c *nameCache) get(ctx context.Context, id string) *memory.Entity {
+	if e, ok := c.entities[id]; ok {
+		return e
+	}
+	e, err := c.svc.Store.GetEntityByID(ctx, c.svc.TenantID, id)
+	if err != nil || e == nil {
+		e = &memory.Entity{ID: id, Name: id, EntityType: "unknown"}
+	}
+	c.entities[id] = e
+	return e
+}
+
+func (c *nameCache) relationMap(ctx context.Context, r *memory.Relation) map[string]any {
+	source, target := c.get(ctx, r.SourceID), c.get(ctx, r.TargetID)
+	return map[string]any{
+		"source":      source.Name,
+		"source_type": source.EntityType,
+		"relation":    r.RelationType,
+		"target":      target.Name,
+		"target_type": target.EntityType,
+		"confidence":  r.Confidence,
+	}
+}
@@ -0,0 +1,60 @@
+// Package memory provides full-text search over document chunks.
+package memory
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChunkHit is a document chunk found by SearchChunks.
+type ChunkHit struct {
+	DocumentID   string
+	Path         string // Path of the document
+	Title        string
+	Index        int // Position of the chunk in the document
+	Content      string
+	MetadataJSON string
+	Rank         float64 // bm25 relevance; higher is better
+}
+
+// SearchChunks returns the tenant's document chunks that match keywords of
+// query, best first. Keywords match as prefixes, or as whole words in
+// encrypted chunks.
+func (g *GraphStore) SearchChunks(ctx context.Context, tenantID, query string, limit int) ([]*ChunkHit, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	keywords := extractKeywords(query)
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT d.id, d.path, COALESCE(d.title, ''), c.chunk_index, c.content, COALESCE(c.metadata_json, ''),
+		       bm25(team_doc_chunks_fts)
+		FROM team_doc_chunks_fts f
+		JOIN team_doc_chunks c ON c.rowid = f.rowid
+		JOIN team_documents d ON d.id = c.document_id
+		WHERE team_doc_chunks_fts MATCH ? AND c.tenant_id = ?
+		ORDER BY bm25(team_doc_chunks_fts)
+		LIMIT ?
+	`, ftsMatchExpr(keywords), tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*ChunkHit
+	for rows.Next() {
+		var h ChunkHit
+		if err := rows.Scan(&h.DocumentID, &h.Path, &h.Title, &h.Index, &h.Content, &h.MetadataJSON, &h.Rank); err != nil {
+			return nil, err
+		}
+		h.Rank = -h.Rank // bm25 returns lower-is-better
+		out = append(out, &h)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,580 @@
+// Package memory provides memory consolidation: merging, archiving and summarizing.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/model"
+	"github.com/google/uuid"
+)
+
+// Archive reasons recorded in memory_archive.
+const (
+	ArchiveMerged     = "merged"
+	ArchiveSuperseded = "superseded"
+	ArchiveSummarized = "summarized"
+	ArchiveDecayed    = "decayed"
+)
+
+// ConsolidationOptions controls a consolidation run.
+type ConsolidationOptions struct {
+	OlderThanDays int         // Facts older than this may be summarized (default 30)
+	DryRun        bool        // Report changes without writing
+	Model         model.Model // Summarizes clusters; nil uses the rule-based fallback
+}
+
+// ConsolidationReport lists what a consolidation run changed.
+type ConsolidationReport struct {
+	DryRun     bool                  `json:"dry_run"`
+	Merged     []ConsolidationChange `json:"merged,omitempty"`
+	Superseded []ConsolidationChange `json:"superseded,omitempty"`
+	Summarized []ConsolidationChange `json:"summarized,omitempty"`
+	Decayed    []ArchivedMemory      `json:"decayed,omitempty"`
+	Archived   int                   `json:"archived"`
+	Remaining  int                   `json:"remaining"`
+}
+
+// ConsolidationChange is one surviving memory and the ones folded into it.
+type ConsolidationChange struct {
+	Kind     string           `json:"kind"`  // profile or action
+	Key      string           `json:"key"`   // Surviving field or trigger
+	Value    string           `json:"value"` // Surviving value or action
+	Archived []ArchivedMemory `json:"archived"`
+}
+
+// ArchivedMemory is a memory row moved out of the live tables.
+type ArchivedMemory struct {
+	ID         string  `json:"id"`
+	Kind       string  `json:"kind"`
+	OriginalID string  `json:"original_id"`
+	Key        string  `json:"key"`
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+	UpdatedAt  int64   `json:"updated_at"`
+	ArchivedAt int64   `json:"archived_at"`
+	Reason     string  `json:"reason"`
+	ReplacedBy string  `json:"replaced_by,omitempty"`
+}
+
+// String renders the report for humans.
+func (r *ConsolidationReport) String() string {
+	var b strings.Builder
+	if r.DryRun {
+		b.WriteString("Dry run - no changes written.\n")
+	}
+	sections := []struct {
+		title   string
+		changes []ConsolidationChange
+	}{
+		{"Merged duplicates", r.Merged},
+		{"Archived superseded", r.Superseded},
+		{"Summarized", r.Summarized},
+	}
+	for _, sec := range sections {
+		if len(sec.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", sec.title)
+		for _, c := range sec.changes {
+			fmt.Fprintf(&b, "  %s %s = %s\n", c.Kind, c.Key, c.Value)
+			for _, a := range c.Archived {
+				fmt.Fprintf(&b, "    - %s = %s\n", a.Key, a.Value)
+			}
+		}
+	}
+	if len(r.Decayed) > 0 {
+		b.WriteString("\nArchived low-confidence:\n")
+		for _, a := range r.Decayed {
+			fmt.Fprintf(&b, "  %s %s = %s (%.2f)\n", a.Kind, a.Key, a.Value, a.Confidence)
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d memories archived, %d remaining.\n", r.Archived, r.Remaining)
+	return b.String()
+}
+
+// Consolidate archives memories whose confidence has decayed below the
+// policy minimum, merges near-duplicates, archives superseded ones and
+// summarizes clusters of old related facts.
+func (e *EnhancedMemoryStore) Consolidate(ctx context.Context, opts ConsolidationOptions) (*ConsolidationReport, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	if opts.OlderThanDays <= 0 {
+		opts.OlderThanDays = 30
+	}
+
+	policy := e.store.ConfidencePolicy()
+	profile, err := loadMemoryRows(ctx, e.db, "profile", policy)
+	if err != nil {
+		return nil, fmt.Errorf("load profile: %w", err)
+	}
+	actions, err := loadMemoryRows(ctx, e.db, "action", policy)
+	if err != nil {
+		return nil, fmt.Errorf("load actions: %w", err)
+	}
+
+	report := &ConsolidationReport{DryRun: opts.DryRun}
+	plan := &consolidationPlan{}
+
+	profile = plan.decay(report, "profile", profile, policy.Min)
+	actions = plan.decay(report, "action", actions, policy.Min)
+
+	profile = plan.dedupe(report, "profile", profile, profileFieldKey, profileSuperseded)
+	actions = plan.dedupe(report, "action", actions, actionTriggerKey, func(_, _ *memoryRow) bool { return true })
+
+	cutoff := time.Now().AddDate(0, 0, -opts.OlderThanDays).Unix()
+	profile = plan.summarize(ctx, report, profile, cutoff, opts.Model)
+
+	report.Remaining = len(profile) + len(actions)
+	report.Archived = len(plan.archive)
+
+	if opts.DryRun || report.Archived == 0 {
+		return report, nil
+	}
+	if err := plan.apply(ctx, e.db); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ConsolidateOldMemories merges, archives and summarizes memories and
+// returns how many rows were archived.
+func (e *EnhancedMemoryStore) ConsolidateOldMemories(ctx context.Context, daysThreshold int) (int, error) {
+	report, err := e.Consolidate(ctx, ConsolidationOptions{OlderThanDays: daysThreshold})
+	if err != nil {
+		return 0, err
+	}
+	return report.Archived, nil
+}
+
+// ListArchived returns archived memories, newest first.
+func (e *EnhancedMemoryStore) ListArchived(ctx context.Context, limit int) ([]ArchivedMemory, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT id, kind, original_id, subject, content, confidence, updated_at, archived_at, reason, COALESCE(replaced_by, '')
+		FROM memory_archive
+		ORDER BY archived_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ArchivedMemory
+	for rows.Next() {
+		var a ArchivedMemory
+		if err := rows.Scan(&a.ID, &a.Kind, &a.OriginalID, &a.Key, &a.Value, &a.Confidence,
+			&a.UpdatedAt, &a.ArchivedAt, &a.Reason, &a.ReplacedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ============================================================
+// Planning
+// ============================================================
+
+// memoryRow is a live profile or action row.
+type memoryRow struct {
+	ID         string
+	Key        string // field or trigger
+	Value      string // value or action
+	Confidence float64
+	UpdatedAt  int64
+}
+
+// consolidationPlan collects the writes for a run so dry runs share the
+// same logic.
+type consolidationPlan struct {
+	archive     []ArchivedMemory
+	confidences []memoryUpdate
+	summaries   []memoryRow
+}
+
+type memoryUpdate struct {
+	kind       string
+	row        *memoryRow
+	confidence float64
+}
+
+// dedupe groups rows by normalized key. Within a group the newest row
+// survives; near-duplicates are merged into it and older conflicting rows
+// are archived as superseded.
+func (p *consolidationPlan) dedupe(report *ConsolidationReport, kind string, rows []*memoryRow, keyFn func(string) string, superseded func(newer, older *memoryRow) bool) []*memoryRow {
+	groups := map[string][]*memoryRow{}
+	var order []string
+	for _, r := range rows {
+		k := keyFn(r.Key)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], r)
+	}
+
+	var kept []*memoryRow
+	for _, k := range order {
+		group := groups[k]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].UpdatedAt > group[j].UpdatedAt })
+
+		var survivors []*memoryRow
+		merged := map[*memoryRow]*ConsolidationChange{}
+		replaced := map[*memoryRow]*ConsolidationChange{}
+
+	rowLoop:
+		for _, r := range group {
+			for _, s := range survivors {
+				switch {
+				case memorySimilarity(s.Value, r.Value) >= 0.8:
+					c := merged[s]
+					if c == nil {
+						c = &ConsolidationChange{Kind: kind, Key: s.Key, Value: s.Value}
+						merged[s] = c
+					}
+					c.Archived = append(c.Archived, p.archiveRow(kind, r, ArchiveMerged, s.ID))
+					if r.Confidence > s.Confidence {
+						s.Confidence = r.Confidence
+						p.confidences = append(p.confidences, memoryUpdate{kind: kind, row: s, confidence: s.Confidence})
+					}
+					continue rowLoop
+				case superseded(s, r):
+					c := replaced[s]
+					if c == nil {
+						c = &ConsolidationChange{Kind: kind, Key: s.Key, Value: s.Value}
+						replaced[s] = c
+					}
+					c.Archived = append(c.Archived, p.archiveRow(kind, r, ArchiveSuperseded, s.ID))
+					continue rowLoop
+				}
+			}
+			survivors = append(survivors, r)
+		}
+
+		for _, s := range survivors {
+			if c := merged[s]; c != nil {
+				report.Merged = append(report.Merged, *c)
+			}
+			if c := replaced[s]; c != nil {
+				report.Superseded = append(report.Superseded, *c)
+			}
+		}
+		kept = append(kept, survivors...)
+	}
+	return kept
+}
+
+// decay archives rows whose effective confidence is below min.
+func (p *consolidationPlan) decay(report *ConsolidationReport, kind string, rows []*memoryRow, min float64) []*memoryRow {
+	var kept []*memoryRow
+	for _, r := range rows {
+		if r.Confidence < min {
+			report.Decayed = append(report.Decayed, p.archiveRow(kind, r, ArchiveDecayed, ""))
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// summarize folds clusters of old, lower-confidence profile facts that
+// share a topic into a single "<topic>_summary" fact.
+func (p *consolidationPlan) summarize(ctx context.Context, report *ConsolidationReport, rows []*memoryRow, cutoff int64, m model.Model) []*memoryRow {
+	clusters := map[string][]*memoryRow{}
+	var order []string
+	for _, r := range rows {
+		if r.UpdatedAt >= cutoff || r.Confidence >= 0.9 || strings.HasSuffix(r.Key, "_summary") {
+			continue
+		}
+		topic := profileTopic(r.Key)
+		if _, ok := clusters[topic]; !ok {
+			order = append(order, topic)
+		}
+		clusters[topic] = append(clusters[topic], r)
+	}
+
+	folded := map[*memoryRow]bool{}
+	var summaries []*memoryRow
+	for _, topic := range order {
+		cluster := clusters[topic]
+		if len(cluster) < 3 {
+			continue
+		}
+
+		field := topic + "_summary"
+		var existing *memoryRow
+		for _, r := range rows {
+			if r.Key == field {
+				existing = r
+			}
+		}
+		facts := cluster
+		if existing != nil {
+			facts = append([]*memoryRow{existing}, cluster...)
+		}
+
+		summary := summarizeFacts(ctx, m, topic, facts)
+		conf := 0.0
+		for _, r := range cluster {
+			conf += r.Confidence
+		}
+		row := &memoryRow{
+			ID:         uuid.New().String(),
+			Key:        field,
+			Value:      summary,
+			Confidence: math.Round(conf/float64(len(cluster))*100) / 100,
+			UpdatedAt:  time.Now().Unix(),
+		}
+		if existing != nil {
+			row.ID = existing.ID
+			row.Confidence = max(row.Confidence, existing.Confidence)
+			folded[existing] = true
+		}
+
+		change := ConsolidationChange{Kind: "profile", Key: row.Key, Value: row.Value}
+		for _, r := range cluster {
+			change.Archived = append(change.Archived, p.archiveRow("profile", r, ArchiveSummarized, row.ID))
+			folded[r] = true
+		}
+		report.Summarized = append(report.Summarized, change)
+		p.summaries = append(p.summaries, *row)
+		summaries = append(summaries, row)
+	}
+
+	kept := summaries
+	for _, r := range rows {
+		if !folded[r] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func (p *consolidationPlan) archiveRow(kind string, r *memoryRow, reason, replacedBy string) ArchivedMemory {
+	a := ArchivedMemory{
+		ID:         uuid.New().String(),
+		Kind:       kind,
+		OriginalID: r.ID,
+		Key:        r.Key,
+		Value:      r.Value,
+		Confidence: r.Confidence,
+		UpdatedAt:  r.UpdatedAt,
+		ArchivedAt: time.Now().Unix(),
+		Reason:     reason,
+		ReplacedBy: replacedBy,
+	}
+	p.archive = append(p.archive, a)
+	return a
+}
+
+// apply writes the plan in a single transaction.
+func (p *consolidationPlan) apply(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range p.archive {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO memory_archive (id, kind, original_id, subject, content, confidence, updated_at, archived_at, reason, replaced_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.ID, a.Kind, a.OriginalID, a.Key, a.Value, a.Confidence, a.UpdatedAt, a.ArchivedAt, a.Reason, a.ReplacedBy); err != nil {
+			return fmt.Errorf("archive %s %s: %w", a.Kind, a.Key, err)
+		}
+	}
+	for _, a := range p.archive {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+memoryTable(a.Kind)+` WHERE id = ?`, a.OriginalID); err != nil {
+			return err
+		}
+	}
+	prov := Provenance{Source: SourceConsolidation}
+	for _, u := range p.confidences {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+memoryTable(u.kind)+` SET confidence = ?, confidence_at = ? WHERE id = ?`, u.confidence, time.Now().Unix(), u.row.ID); err != nil {
+			return err
+		}
+		if err := recordVersion(ctx, tx, u.kind, u.row.ID, u.row.Key, u.row.Value, u.confidence, prov); err != nil {
+			return err
+		}
+	}
+	for _, s := range p.summaries {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO memory_profile (id, field, value, confidence, updated_at, confidence_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(field) DO UPDATE SET
+				value = excluded.value,
+				confidence = excluded.confidence,
+				updated_at = excluded.updated_at,
+				confidence_at = excluded.confidence_at
+		`, s.ID, s.Key, s.Value, s.Confidence, s.UpdatedAt, s.UpdatedAt); err != nil {
+			return err
+		}
+		if err := recordVersion(ctx, tx, "profile", s.ID, s.Key, s.Value, s.Confidence, prov); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ============================================================
+// Helpers
+// ============================================================
+
+// loadMemoryRows loads profile or action rows with their decayed confidence.
+func loadMemoryRows(ctx context.Context, db *sql.DB, kind string, policy ConfidencePolicy) ([]*memoryRow, error) {
+	confidence := policy.sqlEffective("t", time.Now().Unix())
+	query := `SELECT id, field, value, ` + confidence + `, updated_at FROM memory_profile t ORDER BY updated_at DESC`
+	if kind == "action" {
+		query = `SELECT id, trigger, action, ` + confidence + `, updated_at FROM memory_actions t ORDER BY updated_at DESC`
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*memoryRow
+	for rows.Next() {
+		var r memoryRow
+		if err := rows.Scan(&r.ID, &r.Key, &r.Value, &r.Confidence, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, &r)
+	}
+	return out, rows.Err()
+}
+
+func memoryTable(kind string) string {
+	if kind == "action" {
+		return "memory_actions"
+	}
+	return "memory_profile"
+}
+
+var (
+	keySeparatorRegex = regexp.MustCompile(`[\s\-.]+`)
+	keyPunctRegex     = regexp.MustCompile(`[^\w\s]+`)
+)
+
+// multiValueFields hold one of many possible facts, so differing values are
+// only superseded when they are about the same thing.
+var multiValueFields = map[string]bool{
+	"preference": true, "dislike": true, "like": true, "interest": true,
+	"note": true, "habit": true, "goal": true, "skill": true,
+}
+
+// profileFieldKey normalizes a profile field so variants group together:
+// "Preferred Editor", "favorite_editor" and "editors" all become "editor".
+func profileFieldKey(field string) string {
+	k := strings.Trim(keySeparatorRegex.ReplaceAllString(strings.ToLower(field), "_"), "_")
+	for _, prefix := range []string{"preferred_", "favorite_", "favourite_", "my_", "user_"} {
+		k = strings.TrimPrefix(k, prefix)
+	}
+	if len(k) > 3 && strings.HasSuffix(k, "s") && !strings.HasSuffix(k, "ss") {
+		k = k[:len(k)-1]
+	}
+	return k
+}
+
+// profileTopic returns the leading segment of a normalized field.
+func profileTopic(field string) string {
+	topic, _, _ := strings.Cut(profileFieldKey(field), "_")
+	return topic
+}
+
+// profileSuperseded reports whether the newer fact replaces the older one.
+func profileSuperseded(newer, older *memoryRow) bool {
+	if multiValueFields[profileFieldKey(older.Key)] {
+		return memorySimilarity(newer.Value, older.Value) >= 0.4
+	}
+	return true
+}
+
+// actionTriggerKey normalizes a trigger phrase for grouping.
+func actionTriggerKey(trigger string) string {
+	return strings.Join(strings.Fields(keyPunctRegex.ReplaceAllString(strings.ToLower(trigger), " ")), " ")
+}
+
+// memorySimilarity returns the Jaccard similarity of two texts' keywords.
+func memorySimilarity(a, b string) float64 {
+	if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+		return 1
+	}
+	ka, kb := extractKeywords(a), extractKeywords(b)
+	if len(ka) == 0 || len(kb) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(ka))
+	for _, k := range ka {
+		set[k] = true
+	}
+	shared := 0
+	for _, k := range kb {
+		if set[k] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ka)+len(kb)-shared)
+}
+
+// summarizeFacts condenses a cluster with the model, falling back to a
+// de-duplicated list when no model is available or it fails.
+func summarizeFacts(ctx context.Context, m model.Model, topic string, facts []*memoryRow) string {
+	if m != nil && m.IsAvailable() {
+		var lines []string
+		for _, f := range facts {
+			lines = append(lines, fmt.Sprintf("- %s: %s", f.Key, f.Value))
+		}
+		prompt := fmt.Sprintf(`Summarize these remembered facts about a user's %s into one concise sentence.
+Keep every distinct detail; drop repetition. Return JSON: {"summary": "..."}
+
+Facts:
+%s`, topic, strings.Join(lines, "\n"))
+
+		resp, err := m.Generate(ctx, &model.Request{Prompt: prompt, JSON: true})
+		if err == nil {
+			var parsed struct {
+				Summary string `json:"summary"`
+			}
+			if json.Unmarshal([]byte(resp.Text), &parsed) == nil && strings.TrimSpace(parsed.Summary) != "" {
+				return strings.TrimSpace(parsed.Summary)
+			}
+		}
+	}
+
+	var parts []string
+	for _, f := range facts {
+		part := f.Value
+		if !strings.HasSuffix(f.Key, "_summary") {
+			part = strings.ReplaceAll(f.Key, "_", " ") + ": " + f.Value
+		}
+		duplicate := false
+		for _, existing := range parts {
+			if memorySimilarity(existing, part) >= 0.8 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			parts = append(parts, part)
+		}
+	}
+	return truncateText(strings.Join(parts, "; "), 500)
+}
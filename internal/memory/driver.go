@@ -0,0 +1,198 @@
+// Package memory provides the SQLite driver that opens sealed fields.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// driverName is the database/sql driver every store is opened with.
+const driverName = "flynn-sqlite"
+
+func init() {
+	// sql.Open only looks the driver up; it does not connect
+	db, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(driverName, sealedDriver{db.Driver()})
+	db.Close()
+}
+
+// sealedDriver wraps the SQLite driver so sealed values are opened as rows
+// are read. Values whose key is not unlocked are returned as stored.
+// Plaintext arguments that look sealed are escaped on the way in and
+// unescaped on the way out, so user text can never be mistaken for a seal.
+type sealedDriver struct {
+	driver.Driver
+}
+
+// sqliteConn is the subset of the SQLite connection that database/sql uses.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type sqliteStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+func (d sealedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return sealedConn{c.(sqliteConn)}, nil
+}
+
+type sealedConn struct {
+	sqliteConn
+}
+
+func (c sealedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c sealedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.sqliteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return sealedStmt{s.(sqliteStmt)}, nil
+}
+
+func (c sealedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteConn.ExecContext(ctx, query, escapeNamed(args))
+}
+
+func (c sealedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.sqliteConn.QueryContext(ctx, query, escapeNamed(args))
+	if err != nil {
+		return nil, err
+	}
+	return newSealedRows(rows), nil
+}
+
+type sealedStmt struct {
+	sqliteStmt
+}
+
+func (s sealedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.sqliteStmt.Exec(escapeValues(args))
+}
+
+func (s sealedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.sqliteStmt.ExecContext(ctx, escapeNamed(args))
+}
+
+func (s sealedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.sqliteStmt.Query(escapeValues(args))
+	if err != nil {
+		return nil, err
+	}
+	return newSealedRows(rows), nil
+}
+
+func (s sealedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.sqliteStmt.QueryContext(ctx, escapeNamed(args))
+	if err != nil {
+		return nil, err
+	}
+	return newSealedRows(rows), nil
+}
+
+// escapeValues escapes the string arguments that would read as sealed.
+func escapeValues(args []driver.Value) []driver.Value {
+	var out []driver.Value
+	for i, v := range args {
+		if s, ok := v.(string); ok && needsEscape(s) {
+			if out == nil {
+				out = slices.Clone(args)
+			}
+			out[i] = escapePrefix + s
+		}
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
+
+func escapeNamed(args []driver.NamedValue) []driver.NamedValue {
+	var out []driver.NamedValue
+	for i, v := range args {
+		if s, ok := v.Value.(string); ok && needsEscape(s) {
+			if out == nil {
+				out = slices.Clone(args)
+			}
+			out[i].Value = escapePrefix + s
+		}
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
+
+// sealedColumn matches result columns that read an encrypted field, by
+// name or inside an expression such as COALESCE(e.summary, x).
+var sealedColumn = func() *regexp.Regexp {
+	names := make([]string, len(sealedFields))
+	for i, f := range sealedFields {
+		names[i] = f.column
+	}
+	return regexp.MustCompile(`\b(` + strings.Join(names, "|") + `)\b`)
+}()
+
+type sealedRows struct {
+	driver.Rows
+	sealed []bool // Columns to open; nil when no data key is unlocked
+}
+
+func newSealedRows(rows driver.Rows) sealedRows {
+	r := sealedRows{Rows: rows}
+	if !keysUnlocked() {
+		return r
+	}
+	r.sealed = make([]bool, len(rows.Columns()))
+	for i, name := range rows.Columns() {
+		r.sealed[i] = sealedColumn.MatchString(name)
+	}
+	return r
+}
+
+// Next opens sealed values in encrypted columns and unescapes plaintext.
+// A value that does not open, because it is malformed or its key is not
+// unlocked, is returned as stored.
+func (r sealedRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		s, ok := v.(string)
+		if !ok || !needsEscape(s) {
+			continue
+		}
+		if i < len(r.sealed) && r.sealed[i] && isSealed(s) {
+			plain, err := openSealed(s)
+			if err != nil {
+				continue
+			}
+			s = plain
+		}
+		dest[i] = unescapePlain(s)
+	}
+	return nil
+}
@@ -0,0 +1,965 @@
+// Package memory provides opt-in field-level encryption at rest.
+package memory
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/argon2"
+	"modernc.org/sqlite"
+)
+
+// Sensitive fields are sealed with AES-256-GCM under a random data key,
+// stored wrapped by a key-encryption key derived from a passphrase
+// (argon2id) or a key file, so changing the passphrase only rewraps it.
+// Triggers installed by EnableEncryption seal values as they are written,
+// covering every write path, and the sealed driver opens them as rows are
+// read. Full-text search sees blind tokens, keyed hashes of whole words,
+// instead of the words themselves, unless the blind index is turned off.
+
+// Sealed values are stored as sealPrefix, the data key ID, a colon and
+// the base64 nonce and ciphertext. Plaintext that starts with sealPrefix
+// or escapePrefix is stored behind escapePrefix so it never reads as sealed.
+const (
+	sealPrefix   = "enc:v1:"
+	escapePrefix = "enc:plain:"
+)
+
+// Key derivation. Changing these parameters needs a new KDF name so
+// existing databases keep unlocking.
+const (
+	KDFArgon2id = "argon2id"
+	KDFKeyFile  = "keyfile"
+
+	argonTime    = 3
+	argonMemory  = 64 << 10 // KiB
+	argonThreads = 4
+
+	kekSaltSize    = 16
+	minKeyFileSize = 32
+)
+
+var (
+	// ErrLocked is returned when sealed data is written or searched before
+	// its key is unlocked.
+	ErrLocked = errors.New("encrypted data is locked")
+	// ErrWrongKey is returned when a passphrase or key file does not unlock
+	// the data keys.
+	ErrWrongKey = errors.New("wrong passphrase or key file")
+	// ErrNotEncrypted is returned by operations that need encryption enabled.
+	ErrNotEncrypted = errors.New("encryption is not enabled")
+)
+
+// ============================================================
+// Keyring
+// ============================================================
+
+// dataKey seals field values. index keys the blind FTS tokens.
+type dataKey struct {
+	id    string
+	raw   []byte
+	aead  cipher.AEAD
+	index []byte
+}
+
+func newDataKey(id string, raw []byte) (*dataKey, error) {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, raw)
+	mac.Write([]byte("flynn blind index"))
+	return &dataKey{id: id, raw: raw, aead: aead, index: mac.Sum(nil)}, nil
+}
+
+// keyring holds unlocked data keys by ID. It is process-wide because the
+// SQL functions that seal and index values are registered with the driver
+// rather than a connection; key IDs are random, so stores never collide.
+var keyring sync.Map // string -> *dataKey
+
+func unlockedKey(id string) (*dataKey, bool) {
+	k, ok := keyring.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return k.(*dataKey), true
+}
+
+// keysUnlocked reports whether any data key is unlocked. It is false
+// whenever encryption is disabled.
+func keysUnlocked() bool {
+	unlocked := false
+	keyring.Range(func(_, _ any) bool {
+		unlocked = true
+		return false
+	})
+	return unlocked
+}
+
+// seal encrypts a field value with k.
+func (k *dataKey) seal(plain string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(plain), []byte(k.id))
+	return sealPrefix + k.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// isSealed reports whether a stored value is sealed.
+func isSealed(s string) bool {
+	return strings.HasPrefix(s, sealPrefix)
+}
+
+// needsEscape reports whether plaintext would be mistaken for a sealed or
+// escaped value if stored as is.
+func needsEscape(s string) bool {
+	return isSealed(s) || strings.HasPrefix(s, escapePrefix)
+}
+
+// unescapePlain reverses the escaping of a stored plaintext value.
+func unescapePlain(s string) string {
+	return strings.TrimPrefix(s, escapePrefix)
+}
+
+// openSealed decrypts a sealed value. It returns ErrLocked when the value's
+// key is not unlocked.
+func openSealed(s string) (string, error) {
+	id, payload, ok := strings.Cut(strings.TrimPrefix(s, sealPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	k, ok := unlockedKey(id)
+	if !ok {
+		return "", ErrLocked
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	n := k.aead.NonceSize()
+	plain, err := k.aead.Open(nil, sealed[:n], sealed[n:], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("open sealed value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// blindWordRegex splits text into words the way extractKeywords does, so
+// query keywords produce the same blind tokens as indexed text.
+var blindWordRegex = regexp.MustCompile(`\w+`)
+
+// blindTokens returns the distinct blind index tokens for text.
+func (k *dataKey) blindTokens(text string) []string {
+	var tokens []string
+	seen := map[string]bool{}
+	for _, word := range blindWordRegex.FindAllString(strings.ToLower(text), -1) {
+		if len(word) < 3 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, k.blindToken(word))
+	}
+	return tokens
+}
+
+func (k *dataKey) blindToken(word string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(word))
+	return "x" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// blindTerms returns FTS terms matching keywords in encrypted fields under
+// every unlocked key. Blind tokens match whole words only.
+func blindTerms(keywords []string) []string {
+	var terms []string
+	keyring.Range(func(_, v any) bool {
+		k := v.(*dataKey)
+		for _, kw := range keywords {
+			terms = append(terms, `"`+k.blindToken(kw)+`"`)
+		}
+		return true
+	})
+	return terms
+}
+
+// ============================================================
+// SQL functions
+// ============================================================
+
+// The triggers installed by EnableEncryption call these functions, so any
+// connection writing encrypted tables must be opened through this package.
+//
+//	flynn_seal(value, key_id)   seals a plaintext value
+//	flynn_open(value)           opens a sealed value; anything else passes through
+//	flynn_index(text, key_id)   blind index tokens for text
+func init() {
+	sqlite.MustRegisterScalarFunction("flynn_seal", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return args[0], nil
+		}
+		k, err := functionKey(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if isSealed(s) {
+			// Every key is unlocked along with the active one, so a seal
+			// that does not open is plaintext stored before escaping
+			if _, err := openSealed(s); err == nil {
+				return s, nil
+			}
+			s = escapePrefix + s
+		}
+		return k.seal(s)
+	})
+	sqlite.MustRegisterScalarFunction("flynn_open", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok || !isSealed(s) {
+			return args[0], nil
+		}
+		if plain, err := openSealed(s); err == nil {
+			return plain, nil
+		}
+		return s, nil
+	})
+	sqlite.MustRegisterScalarFunction("flynn_index", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return "", nil
+		}
+		k, err := functionKey(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Join(k.blindTokens(s), " "), nil
+	})
+}
+
+func functionKey(id driver.Value) (*dataKey, error) {
+	s, _ := id.(string)
+	k, ok := unlockedKey(s)
+	if !ok {
+		return nil, fmt.Errorf("%w; run \"flynn unlock\"", ErrLocked)
+	}
+	return k, nil
+}
+
+// ============================================================
+// Sealed fields and triggers
+// ============================================================
+
+// sealedField is a column encrypted at rest.
+type sealedField struct {
+	team   bool
+	table  string
+	column string
+}
+
+var sealedFields = []sealedField{
+	{table: "messages", column: "content"},
+	{table: "memory_profile", column: "value"},
+	{table: "memory_actions", column: "action"},
+	{table: "memory_episodes", column: "summary"},
+	{table: "memory_episodes", column: "decisions_json"},
+	{table: "memory_episodes", column: "open_questions_json"},
+	{table: "memory_versions", column: "content"},
+	{table: "memory_versions", column: "snippet"},
+	{table: "memory_archive", column: "content"},
+	{team: true, table: "team_documents", column: "content_preview"},
+	{team: true, table: "team_doc_chunks", column: "content"},
+}
+
+// triggers seals the column on every insert and update. Values that are
+// already sealed, such as rows copied between tables, are left alone.
+func (f sealedField) triggers(keyID string) string {
+	name := f.table + "_" + f.column + "_seal"
+	update := fmt.Sprintf(`UPDATE %s SET %s = flynn_seal(new.%[2]s, %s) WHERE rowid = new.rowid;`, f.table, f.column, sqlQuote(keyID))
+	when := fmt.Sprintf(`substr(new.%s, 1, %d) <> '%s'`, f.column, len(sealPrefix), sealPrefix)
+	return fmt.Sprintf(`
+		DROP TRIGGER IF EXISTS %[1]s_insert;
+		CREATE TRIGGER %[1]s_insert AFTER INSERT ON %[2]s WHEN %[4]s BEGIN
+			%[5]s
+		END;
+		DROP TRIGGER IF EXISTS %[1]s_update;
+		CREATE TRIGGER %[1]s_update AFTER UPDATE OF %[3]s ON %[2]s WHEN %[4]s BEGIN
+			%[5]s
+		END;`, name, f.table, f.column, when, update)
+}
+
+// reseal seals every value of the column not already sealed with keyID.
+func (f sealedField) reseal(keyID string) string {
+	prefix := sealPrefix + keyID + ":"
+	return fmt.Sprintf(`UPDATE %[1]s SET %[2]s = flynn_seal(flynn_open(%[2]s), %[3]s)
+		WHERE substr(%[2]s, 1, %[4]d) <> %[5]s`, f.table, f.column, sqlQuote(keyID), len(prefix), sqlQuote(prefix))
+}
+
+// ftsIndex is a full-text index over a table with encrypted columns. Its
+// insert and update triggers are replaced to index blind tokens.
+type ftsIndex struct {
+	team    bool
+	table   string
+	fts     string
+	update  string // UPDATE event the update trigger fires on
+	columns []ftsColumn
+}
+
+// ftsColumn is one indexed column; expr reads it from the new row.
+type ftsColumn struct {
+	name   string
+	expr   string
+	sealed bool
+}
+
+var ftsIndexes = []ftsIndex{
+	{table: "messages", fts: "messages_fts", update: "UPDATE", columns: []ftsColumn{
+		{name: "content", expr: "flynn_open(new.content)", sealed: true},
+	}},
+	{table: "memory_profile", fts: "memory_profile_fts", update: "UPDATE", columns: []ftsColumn{
+		{name: "field", expr: "new.field"},
+		{name: "value", expr: "flynn_open(new.value)", sealed: true},
+	}},
+	{table: "memory_actions", fts: "memory_actions_fts", update: "UPDATE", columns: []ftsColumn{
+		{name: "trigger", expr: "new.trigger"},
+		{name: "action", expr: "flynn_open(new.action)", sealed: true},
+	}},
+	{table: "memory_episodes", fts: "memory_episodes_fts", update: "UPDATE", columns: []ftsColumn{
+		{name: "topic", expr: "new.topic"},
+		{name: "summary", expr: "flynn_open(new.summary)", sealed: true},
+		{name: "details", sealed: true, expr: "COALESCE(flynn_open(new.decisions_json), '') || ' ' || " +
+			"COALESCE(flynn_open(new.open_questions_json), '') || ' ' || COALESCE(new.files_json, '')"},
+	}},
+	{team: true, table: "team_doc_chunks", fts: "team_doc_chunks_fts", update: "UPDATE OF content", columns: []ftsColumn{
+		{name: "content", expr: "flynn_open(new.content)", sealed: true},
+	}},
+}
+
+// triggers indexes encrypted columns as blind tokens under keyID, or not at
+// all when index is false.
+func (f ftsIndex) triggers(keyID string, index bool) string {
+	names := make([]string, len(f.columns))
+	values := make([]string, len(f.columns))
+	sets := make([]string, len(f.columns))
+	for i, c := range f.columns {
+		value := c.expr
+		if c.sealed {
+			value = "''"
+			if index {
+				value = fmt.Sprintf("flynn_index(%s, %s)", c.expr, sqlQuote(keyID))
+			}
+		}
+		names[i], values[i] = c.name, value
+		sets[i] = c.name + " = " + value
+	}
+	return fmt.Sprintf(`
+		DROP TRIGGER IF EXISTS %[1]s_insert;
+		CREATE TRIGGER %[1]s_insert AFTER INSERT ON %[2]s BEGIN
+			INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.rowid, %[4]s);
+		END;
+		DROP TRIGGER IF EXISTS %[1]s_update;
+		CREATE TRIGGER %[1]s_update AFTER %[5]s ON %[2]s BEGIN
+			UPDATE %[1]s SET %[6]s WHERE rowid = new.rowid;
+		END;`, f.fts, f.table, strings.Join(names, ", "), strings.Join(values, ", "), f.update, strings.Join(sets, ", "))
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// applyEncryption installs the sealing and index triggers for key on one
+// database and seals every encrypted field with it. Rewriting the fields
+// also rebuilds their FTS rows through the update triggers. It runs in one
+// transaction, so the triggers are only present once every field is sealed.
+func applyEncryption(ctx context.Context, db *sql.DB, team bool, key *dataKey, index bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range ftsIndexes {
+		if f.team != team {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, f.triggers(key.id, index)); err != nil {
+			return fmt.Errorf("index %s: %w", f.table, err)
+		}
+	}
+	for _, f := range sealedFields {
+		if f.team != team {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, f.triggers(key.id)); err != nil {
+			return fmt.Errorf("seal %s.%s: %w", f.table, f.column, err)
+		}
+		if _, err := tx.ExecContext(ctx, f.reseal(key.id)); err != nil {
+			return fmt.Errorf("seal %s.%s: %w", f.table, f.column, err)
+		}
+	}
+	// FTS5 keeps replaced terms in old segments until they are merged
+	for _, f := range ftsIndexes {
+		if f.team != team {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %[1]s(%[1]s) VALUES ('optimize')`, f.fts)); err != nil {
+			return fmt.Errorf("optimize %s: %w", f.fts, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// sealedDatabase reports whether applyEncryption has completed on a
+// database, by the presence of its sealing triggers.
+func sealedDatabase(ctx context.Context, db *sql.DB, team bool) (bool, error) {
+	for _, f := range sealedFields {
+		if f.team != team {
+			continue
+		}
+		var n int
+		if err := db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?
+		`, f.table+"_"+f.column+"_seal_insert").Scan(&n); err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compact rewrites a database so plaintext left in free pages and the
+// write-ahead log does not outlive sealing.
+func compact(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `VACUUM`); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// ============================================================
+// Key-encryption keys
+// ============================================================
+
+// EncryptionSecret unlocks encrypted data: a passphrase or the contents
+// of a key file.
+type EncryptionSecret struct {
+	Passphrase string
+	KeyFile    []byte
+}
+
+// KDF names how the secret is turned into a key-encryption key.
+func (sec EncryptionSecret) KDF() string {
+	if sec.KeyFile != nil {
+		return KDFKeyFile
+	}
+	return KDFArgon2id
+}
+
+func (sec EncryptionSecret) validate() error {
+	switch {
+	case sec.KeyFile != nil && len(sec.KeyFile) < minKeyFileSize:
+		return fmt.Errorf("key file must hold at least %d bytes", minKeyFileSize)
+	case sec.KeyFile == nil && sec.Passphrase == "":
+		return fmt.Errorf("empty passphrase")
+	}
+	return nil
+}
+
+// deriveKEK stretches the secret into a key-encryption key.
+func deriveKEK(sec EncryptionSecret, kdf string, salt []byte) ([]byte, error) {
+	if sec.KDF() != kdf {
+		return nil, fmt.Errorf("data is encrypted with a %s; %w", map[string]string{
+			KDFArgon2id: "passphrase", KDFKeyFile: "key file",
+		}[kdf], ErrWrongKey)
+	}
+	if kdf == KDFKeyFile {
+		return hkdf.Key(sha256.New, sec.KeyFile, salt, "flynn key file", 32)
+	}
+	return argon2.IDKey([]byte(sec.Passphrase), salt, argonTime, argonMemory, argonThreads, 32), nil
+}
+
+// wrapKey seals a data key with the key-encryption key.
+func wrapKey(kek []byte, k *dataKey) ([]byte, error) {
+	aead, err := kekAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, k.raw, []byte(k.id)), nil
+}
+
+func unwrapKey(kek []byte, id string, wrapped []byte) (*dataKey, error) {
+	aead, err := kekAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, ErrWrongKey
+	}
+	raw, err := aead.Open(nil, wrapped[:n], wrapped[n:], []byte(id))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return newDataKey(id, raw)
+}
+
+func kekAEAD(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func generateDataKey() (*dataKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	return newDataKey(uuid.New().String(), raw)
+}
+
+// ============================================================
+// Store API
+// ============================================================
+
+// EncryptionStatus describes field encryption for a store.
+type EncryptionStatus struct {
+	Enabled    bool            `json:"enabled"`
+	KDF        string          `json:"kdf,omitempty"`
+	BlindIndex bool            `json:"blind_index"`
+	Unlocked   bool            `json:"unlocked"`
+	ActiveKey  string          `json:"active_key,omitempty"`
+	Keys       []EncryptionKey `json:"keys,omitempty"`
+	Plaintext  int64           `json:"plaintext"` // Encrypted fields still holding plaintext
+	UpdatedAt  int64           `json:"updated_at,omitempty"`
+}
+
+// EncryptionKey is one wrapped data key.
+type EncryptionKey struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// encryptionSettings reads the settings row; ok is false when encryption
+// has never been enabled.
+func (s *Store) encryptionSettings(ctx context.Context) (kdf string, salt []byte, index bool, ok bool, err error) {
+	err = s.personal.QueryRowContext(ctx, `SELECT kdf, salt, blind_index FROM encryption_settings WHERE id = 1`).Scan(&kdf, &salt, &index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, false, false, nil
+	}
+	return kdf, salt, index, err == nil, err
+}
+
+// activeKey returns the unlocked active data key.
+func (s *Store) activeKey(ctx context.Context) (*dataKey, error) {
+	var id string
+	err := s.personal.QueryRowContext(ctx, `SELECT id FROM encryption_keys WHERE status = 'active'`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotEncrypted
+	}
+	if err != nil {
+		return nil, err
+	}
+	k, ok := unlockedKey(id)
+	if !ok {
+		return nil, ErrLocked
+	}
+	return k, nil
+}
+
+// EncryptionStatus reports whether encryption is enabled and unlocked.
+func (s *Store) EncryptionStatus(ctx context.Context) (*EncryptionStatus, error) {
+	status := &EncryptionStatus{}
+	kdf, _, index, ok, err := s.encryptionSettings(ctx)
+	if err != nil || !ok {
+		return status, err
+	}
+	status.Enabled, status.KDF, status.BlindIndex = true, kdf, index
+	if err := s.personal.QueryRowContext(ctx, `SELECT updated_at FROM encryption_settings WHERE id = 1`).Scan(&status.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.personal.QueryContext(ctx, `SELECT id, status, created_at FROM encryption_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k EncryptionKey
+		if err := rows.Scan(&k.ID, &k.Status, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		if k.Status == "active" {
+			status.ActiveKey = k.ID
+			_, status.Unlocked = unlockedKey(k.ID)
+		}
+		status.Keys = append(status.Keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range sealedFields {
+		db := s.personal
+		if f.team {
+			db = s.team
+		}
+		var n int64
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE substr(%s, 1, %d) <> '%s'`, f.table, f.column, len(sealPrefix), sealPrefix)
+		if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s.%s: %w", f.table, f.column, err)
+		}
+		status.Plaintext += n
+	}
+	return status, nil
+}
+
+// Locked reports whether encryption is enabled but not yet unlocked.
+func (s *Store) Locked(ctx context.Context) (bool, error) {
+	_, err := s.activeKey(ctx)
+	switch {
+	case errors.Is(err, ErrLocked):
+		return true, nil
+	case errors.Is(err, ErrNotEncrypted):
+		return false, nil
+	}
+	return false, err
+}
+
+// DeriveKey turns a secret into the key-encryption key for this store, to
+// pass to UnlockKey. It does not check that the key is correct.
+func (s *Store) DeriveKey(ctx context.Context, sec EncryptionSecret) ([]byte, error) {
+	kdf, salt, _, ok, err := s.encryptionSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotEncrypted
+	}
+	return deriveKEK(sec, kdf, salt)
+}
+
+// UnlockKey unwraps the data keys with a key-encryption key from DeriveKey
+// so encrypted fields can be read, written and searched.
+func (s *Store) UnlockKey(ctx context.Context, kek []byte) error {
+	rows, err := s.personal.QueryContext(ctx, `SELECT id, wrapped FROM encryption_keys`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var keys []*dataKey
+	for rows.Next() {
+		var id string
+		var wrapped []byte
+		if err := rows.Scan(&id, &wrapped); err != nil {
+			return err
+		}
+		k, err := unwrapKey(kek, id, wrapped)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrNotEncrypted
+	}
+
+	for _, k := range keys {
+		keyring.Store(k.id, k)
+	}
+	s.encMu.Lock()
+	s.kek = kek
+	s.encMu.Unlock()
+	return nil
+}
+
+// Unlock derives the key-encryption key from a secret and unlocks with it.
+func (s *Store) Unlock(ctx context.Context, sec EncryptionSecret) error {
+	kek, err := s.DeriveKey(ctx, sec)
+	if err != nil {
+		return err
+	}
+	return s.UnlockKey(ctx, kek)
+}
+
+// EnableEncryption encrypts the sensitive fields of both databases with a
+// new data key protected by sec. With blindIndex false, encrypted fields
+// are dropped from full-text search instead of indexed as blind tokens.
+// An enable that was interrupted is finished by calling it again with the
+// same secret.
+func (s *Store) EnableEncryption(ctx context.Context, sec EncryptionSecret, blindIndex bool) error {
+	if err := sec.validate(); err != nil {
+		return err
+	}
+	_, _, index, ok, err := s.encryptionSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return s.resumeEncryption(ctx, sec, index)
+	}
+
+	salt := make([]byte, kekSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	kek, err := deriveKEK(sec, sec.KDF(), salt)
+	if err != nil {
+		return err
+	}
+	key, err := generateDataKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapKey(kek, key)
+	if err != nil {
+		return err
+	}
+
+	// The wrapped key is committed before anything is sealed with it, so
+	// an interruption leaves data the secret can still open.
+	tx, err := s.personal.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO encryption_keys (id, wrapped, status) VALUES (?, ?, 'active')
+	`, key.id, wrapped); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO encryption_settings (id, kdf, salt, blind_index) VALUES (1, ?, ?, ?)
+	`, sec.KDF(), salt, blindIndex); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	keyring.Store(key.id, key)
+	s.encMu.Lock()
+	s.kek = kek
+	s.encMu.Unlock()
+
+	return s.sealDatabases(ctx, key, blindIndex)
+}
+
+// resumeEncryption finishes an enable whose key was recorded but whose
+// databases were not both sealed.
+func (s *Store) resumeEncryption(ctx context.Context, sec EncryptionSecret, index bool) error {
+	team, err := sealedDatabase(ctx, s.team, true)
+	if err != nil {
+		return err
+	}
+	personal, err := sealedDatabase(ctx, s.personal, false)
+	if err != nil {
+		return err
+	}
+	if team && personal {
+		return fmt.Errorf("encryption is already enabled")
+	}
+	if err := s.Unlock(ctx, sec); err != nil {
+		return err
+	}
+	key, err := s.activeKey(ctx)
+	if err != nil {
+		return err
+	}
+	return s.sealDatabases(ctx, key, index)
+}
+
+// sealDatabases seals both databases with key and compacts them.
+func (s *Store) sealDatabases(ctx context.Context, key *dataKey, index bool) error {
+	if err := applyEncryption(ctx, s.team, true, key, index); err != nil {
+		return fmt.Errorf("encrypt team database: %w", err)
+	}
+	if err := applyEncryption(ctx, s.personal, false, key, index); err != nil {
+		return fmt.Errorf("encrypt personal database: %w", err)
+	}
+	for _, db := range []*sql.DB{s.personal, s.team} {
+		if err := compact(ctx, db); err != nil {
+			return fmt.Errorf("compact after encrypting: %w", err)
+		}
+	}
+	return nil
+}
+
+// RotateOptions selects what RotateEncryption replaces.
+type RotateOptions struct {
+	// Secret, when set, replaces the passphrase or key file. The data keys
+	// are rewrapped; encrypted fields are not touched.
+	Secret *EncryptionSecret
+	// DataKey generates a new data key, re-encrypts every field with it and
+	// deletes the old keys.
+	DataKey bool
+}
+
+// RotateEncryption replaces the key-encryption key, the data key, or both.
+// The store must be unlocked.
+func (s *Store) RotateEncryption(ctx context.Context, opts RotateOptions) error {
+	_, _, index, ok, err := s.encryptionSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotEncrypted
+	}
+	current, err := s.activeKey(ctx)
+	if err != nil {
+		return err
+	}
+	s.encMu.Lock()
+	kek := s.kek
+	s.encMu.Unlock()
+	if kek == nil {
+		return ErrLocked
+	}
+
+	if opts.Secret != nil {
+		if err := opts.Secret.validate(); err != nil {
+			return err
+		}
+		salt := make([]byte, kekSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		if kek, err = deriveKEK(*opts.Secret, opts.Secret.KDF(), salt); err != nil {
+			return err
+		}
+		if err := s.rewrapKeys(ctx, kek, opts.Secret.KDF(), salt); err != nil {
+			return fmt.Errorf("rewrap data keys: %w", err)
+		}
+		s.encMu.Lock()
+		s.kek = kek
+		s.encMu.Unlock()
+	}
+	if !opts.DataKey {
+		return nil
+	}
+
+	key, err := generateDataKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapKey(kek, key)
+	if err != nil {
+		return err
+	}
+	keyring.Store(key.id, key)
+	tx, err := s.personal.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE encryption_keys SET status = 'retired' WHERE status = 'active'`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO encryption_keys (id, wrapped, status) VALUES (?, ?, 'active')`, key.id, wrapped); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE encryption_settings SET updated_at = ? WHERE id = 1`, time.Now().Unix()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Retired keys stay until every field is resealed, so an interrupted
+	// rotation can still be read and is finished by rotating again.
+	if err := applyEncryption(ctx, s.team, true, key, index); err != nil {
+		return fmt.Errorf("re-encrypt team database: %w", err)
+	}
+	if err := applyEncryption(ctx, s.personal, false, key, index); err != nil {
+		return fmt.Errorf("re-encrypt personal database: %w", err)
+	}
+	if _, err := s.personal.ExecContext(ctx, `DELETE FROM encryption_keys WHERE status = 'retired'`); err != nil {
+		return err
+	}
+	keyring.Delete(current.id)
+
+	for _, db := range []*sql.DB{s.personal, s.team} {
+		if err := compact(ctx, db); err != nil {
+			return fmt.Errorf("compact after rotating: %w", err)
+		}
+	}
+	return nil
+}
+
+// rewrapKeys wraps every unlocked data key with a new key-encryption key.
+func (s *Store) rewrapKeys(ctx context.Context, kek []byte, kdf string, salt []byte) error {
+	tx, err := s.personal.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM encryption_keys`)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		k, ok := unlockedKey(id)
+		if !ok {
+			return ErrLocked
+		}
+		wrapped, err := wrapKey(kek, k)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE encryption_keys SET wrapped = ? WHERE id = ?`, wrapped, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE encryption_settings SET kdf = ?, salt = ?, updated_at = ? WHERE id = 1
+	`, kdf, salt, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,425 @@
+// Package memory provides episodic memory: one summary per finished
+// conversation, recalled in later sessions.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/model"
+	"github.com/google/uuid"
+)
+
+// Limits for stored episodes.
+const (
+	maxEpisodeItems     = 5   // Decisions or open questions kept per episode
+	maxEpisodeFiles     = 20  // Files kept per episode
+	maxEpisodeTurnLen   = 600 // Characters of each message sent to the summarizer
+	maxEpisodeTurns     = 20  // Most recent turns sent to the summarizer
+	minEpisodeUserChars = 20  // Shorter conversations (greetings) are not remembered
+)
+
+// Episode summarizes one finished conversation.
+type Episode struct {
+	ID             string   `json:"id"`
+	ConversationID string   `json:"conversation_id"`
+	Topic          string   `json:"topic"`
+	Summary        string   `json:"summary"`
+	Decisions      []string `json:"decisions,omitempty"`
+	OpenQuestions  []string `json:"open_questions,omitempty"`
+	Files          []string `json:"files,omitempty"`
+	MessageCount   int      `json:"message_count"`
+	StartedAt      int64    `json:"started_at"`
+	EndedAt        int64    `json:"ended_at"`
+}
+
+// EpisodeTurn is one user message and the reply to it.
+type EpisodeTurn struct {
+	User      string
+	Assistant string
+}
+
+// Transcript is a finished conversation waiting to be summarized.
+type Transcript struct {
+	ConversationID string
+	Turns          []EpisodeTurn
+	Files          []string // Paths touched by tools during the conversation
+	StartedAt      time.Time
+	EndedAt        time.Time
+}
+
+// EpisodeStore summarizes conversations and stores them in personal.db.
+type EpisodeStore struct {
+	db    *sql.DB
+	model model.Model // Optional; a rule-based summary is used without it
+}
+
+// NewEpisodeStore creates an episode store.
+func NewEpisodeStore(db *sql.DB, m model.Model) *EpisodeStore {
+	return &EpisodeStore{db: db, model: m}
+}
+
+// Record summarizes a transcript and saves it as an episode. It returns
+// nil without error when the conversation is too short to be worth
+// remembering.
+func (s *EpisodeStore) Record(ctx context.Context, t *Transcript) (*Episode, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("episode store not initialized")
+	}
+	if !t.worthRemembering() {
+		return nil, nil
+	}
+	ep := SummarizeTranscript(ctx, s.model, t)
+	if err := s.Save(ctx, ep); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+// Save stores an episode, replacing any earlier episode for the same
+// conversation.
+func (s *EpisodeStore) Save(ctx context.Context, ep *Episode) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("episode store not initialized")
+	}
+	if ep.ID == "" {
+		ep.ID = uuid.New().String()
+	}
+	if ep.EndedAt == 0 {
+		ep.EndedAt = time.Now().Unix()
+	}
+	if ep.StartedAt == 0 {
+		ep.StartedAt = ep.EndedAt
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if ep.ConversationID != "" {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM memory_episodes WHERE conversation_id = ?`, ep.ConversationID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO memory_episodes (id, conversation_id, topic, summary, decisions_json, open_questions_json,
+			files_json, message_count, started_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, ep.ID, ep.ConversationID, ep.Topic, ep.Summary, encodeList(ep.Decisions), encodeList(ep.OpenQuestions),
+		encodeList(ep.Files), ep.MessageCount, ep.StartedAt, ep.EndedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recent returns the most recently finished episodes.
+func (s *EpisodeStore) Recent(ctx context.Context, limit int) ([]Episode, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("episode store not initialized")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+episodeColumns+`
+		FROM memory_episodes
+		ORDER BY updated_at DESC, rowid DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Episode
+	for rows.Next() {
+		ep, err := scanEpisode(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *ep)
+	}
+	return out, rows.Err()
+}
+
+const episodeColumns = `id, conversation_id, topic, summary, COALESCE(decisions_json, ''),
+	COALESCE(open_questions_json, ''), COALESCE(files_json, ''), message_count, started_at, updated_at`
+
+func scanEpisode(row rowScanner) (*Episode, error) {
+	var ep Episode
+	var decisions, open, files string
+	if err := row.Scan(&ep.ID, &ep.ConversationID, &ep.Topic, &ep.Summary, &decisions, &open, &files,
+		&ep.MessageCount, &ep.StartedAt, &ep.EndedAt); err != nil {
+		return nil, err
+	}
+	ep.Decisions = decodeList(decisions)
+	ep.OpenQuestions = decodeList(open)
+	ep.Files = decodeList(files)
+	return &ep, nil
+}
+
+// ============================================================
+// Summarization
+// ============================================================
+
+// SummarizeTranscript condenses a conversation into an episode, using the
+// model when available and a rule-based summary otherwise.
+func SummarizeTranscript(ctx context.Context, m model.Model, t *Transcript) *Episode {
+	ep := &Episode{
+		ConversationID: t.ConversationID,
+		MessageCount:   len(t.Turns) * 2,
+		StartedAt:      t.StartedAt.Unix(),
+		EndedAt:        t.EndedAt.Unix(),
+	}
+	if t.StartedAt.IsZero() {
+		ep.StartedAt = 0
+	}
+	if t.EndedAt.IsZero() {
+		ep.EndedAt = 0
+	}
+
+	if !summarizeWithModel(ctx, m, t, ep) {
+		summarizeWithRules(t, ep)
+	}
+	ep.Files = mergeLists(maxEpisodeFiles, t.Files, ep.Files)
+	return ep
+}
+
+func summarizeWithModel(ctx context.Context, m model.Model, t *Transcript, ep *Episode) bool {
+	if m == nil || !m.IsAvailable() {
+		return false
+	}
+
+	turns := t.Turns
+	if len(turns) > maxEpisodeTurns {
+		turns = turns[len(turns)-maxEpisodeTurns:]
+	}
+	var transcript strings.Builder
+	for _, turn := range turns {
+		fmt.Fprintf(&transcript, "User: %s\n", truncateText(turn.User, maxEpisodeTurnLen))
+		if turn.Assistant != "" {
+			fmt.Fprintf(&transcript, "Assistant: %s\n", truncateText(turn.Assistant, maxEpisodeTurnLen))
+		}
+	}
+	files := "none"
+	if len(t.Files) > 0 {
+		files = strings.Join(t.Files, ", ")
+	}
+
+	prompt := fmt.Sprintf(`Summarize this finished conversation so it can be recalled in a later session.
+
+Return JSON:
+{
+  "topic": "short title, under 10 words",
+  "summary": "one or two sentences on what was discussed and done",
+  "decisions": ["decision that was made"],
+  "open_questions": ["question or task left unresolved"],
+  "files": ["file paths that were discussed or changed"]
+}
+
+Rules:
+- Only list decisions that were actually agreed, not suggestions
+- Leave lists empty when there is nothing to report
+- Write from the user's point of view ("we decided ...")
+
+Files touched by tools: %s
+
+Conversation:
+%s`, files, transcript.String())
+
+	resp, err := m.Generate(ctx, &model.Request{Prompt: prompt, JSON: true})
+	if err != nil {
+		return false
+	}
+	var parsed struct {
+		Topic         string   `json:"topic"`
+		Summary       string   `json:"summary"`
+		Decisions     []string `json:"decisions"`
+		OpenQuestions []string `json:"open_questions"`
+		Files         []string `json:"files"`
+	}
+	if json.Unmarshal([]byte(resp.Text), &parsed) != nil || strings.TrimSpace(parsed.Summary) == "" {
+		return false
+	}
+
+	ep.Topic = truncateText(parsed.Topic, 80)
+	ep.Summary = truncateText(parsed.Summary, 500)
+	ep.Decisions = mergeLists(maxEpisodeItems, parsed.Decisions)
+	ep.OpenQuestions = mergeLists(maxEpisodeItems, parsed.OpenQuestions)
+	ep.Files = parsed.Files
+	if ep.Topic == "" {
+		ep.Topic = transcriptTopic(t)
+	}
+	return true
+}
+
+var (
+	sentencePattern = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+	decisionPattern = regexp.MustCompile(`(?i)\b(decided|decide to|we'll|we will|let's|going with|go with|switch(ed|ing)? to|agreed|settled on|chose|choose to)\b`)
+	openPattern     = regexp.MustCompile(`(?i)\b(todo|follow[- ]up|open question|not sure|tbd|still need|later)\b`)
+)
+
+// summarizeWithRules builds an episode from the transcript text alone:
+// the first request is the topic, statements of intent are decisions and
+// unanswered questions or deferred work are open questions.
+func summarizeWithRules(t *Transcript, ep *Episode) {
+	ep.Topic = transcriptTopic(t)
+
+	var asked, decisions, open []string
+	for i, turn := range t.Turns {
+		userSentences := splitSentences(turn.User)
+		if len(userSentences) > 0 {
+			asked = append(asked, strings.TrimRight(userSentences[0], ".!"))
+		}
+		for _, s := range append(userSentences, splitSentences(turn.Assistant)...) {
+			switch {
+			case strings.HasSuffix(s, "?"):
+				// The assistant's closing questions were never answered
+				if i == len(t.Turns)-1 && !containsString(userSentences, s) {
+					open = append(open, s)
+				}
+			case decisionPattern.MatchString(s):
+				decisions = append(decisions, s)
+			case openPattern.MatchString(s):
+				open = append(open, s)
+			}
+		}
+	}
+
+	ep.Summary = truncateText("Discussed: "+strings.Join(mergeLists(maxEpisodeItems, asked), "; "), 500)
+	ep.Decisions = mergeLists(maxEpisodeItems, decisions)
+	ep.OpenQuestions = mergeLists(maxEpisodeItems, open)
+}
+
+// transcriptTopic returns the first sentence of the first substantial request.
+func transcriptTopic(t *Transcript) string {
+	for _, turn := range t.Turns {
+		if sentences := splitSentences(turn.User); len(sentences) > 0 && len(turn.User) >= minEpisodeUserChars {
+			return truncateText(strings.TrimRight(sentences[0], ".!?"), 80)
+		}
+	}
+	if len(t.Turns) > 0 {
+		return truncateText(t.Turns[0].User, 80)
+	}
+	return "Conversation"
+}
+
+func (t *Transcript) worthRemembering() bool {
+	if t == nil || len(t.Turns) == 0 {
+		return false
+	}
+	if len(t.Files) > 0 {
+		return true
+	}
+	chars := 0
+	for _, turn := range t.Turns {
+		chars += len(strings.TrimSpace(turn.User))
+	}
+	return chars >= minEpisodeUserChars
+}
+
+func splitSentences(text string) []string {
+	var out []string
+	for _, s := range sentencePattern.FindAllString(text, -1) {
+		if s = strings.TrimSpace(s); len(s) > 3 {
+			out = append(out, truncateText(s, 160))
+		}
+	}
+	return out
+}
+
+// mergeLists concatenates lists, dropping blanks and duplicates, and keeps
+// at most limit items.
+func mergeLists(limit int, lists ...[]string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, item := range list {
+			item = strings.TrimSpace(item)
+			key := strings.ToLower(item)
+			if item == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, item)
+			if len(out) == limit {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeList(items []string) any {
+	if len(items) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(items)
+	return string(data)
+}
+
+func decodeList(data string) []string {
+	if data == "" {
+		return nil
+	}
+	var items []string
+	_ = json.Unmarshal([]byte(data), &items)
+	return items
+}
+
+// ============================================================
+// Recall
+// ============================================================
+
+// episodeContent renders an episode's summary, decisions and open
+// questions as one line of prompt context.
+func episodeContent(summary, decisionsJSON, openJSON string) string {
+	parts := []string{strings.TrimRight(summary, ". ") + "."}
+	if decisions := decodeList(decisionsJSON); len(decisions) > 0 {
+		parts = append(parts, "Decided: "+strings.Join(decisions, "; "))
+	}
+	if open := decodeList(openJSON); len(open) > 0 {
+		parts = append(parts, "Open: "+strings.Join(open, "; "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// relativeDay describes when an episode happened the way a person would:
+// "today", "yesterday", "last Tuesday", or a date for older episodes.
+func relativeDay(ts int64, now time.Time) string {
+	t := time.Unix(ts, 0).In(now.Location())
+	startOfDay := func(t time.Time) time.Time {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+	days := int(startOfDay(now).Sub(startOfDay(t)).Hours() / 24)
+	switch {
+	case days <= 0:
+		return "today"
+	case days == 1:
+		return "yesterday"
+	case days < 7:
+		return "last " + t.Weekday().String()
+	case t.Year() == now.Year():
+		return "on " + t.Format("Jan 2")
+	default:
+		return "on " + t.Format("Jan 2, 2006")
+	}
+}
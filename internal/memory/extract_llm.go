@@ -92,6 +92,7 @@ Message to analyze:
 			Value:      strings.TrimSpace(p.Value),
 			Confidence: p.Confidence,
 			Overwrite:  p.Overwrite,
+			Source:     SourceLLM,
 		})
 	}
 	for _, a := range parsed.Actions {
@@ -107,6 +108,7 @@ Message to analyze:
 			Action:     strings.TrimSpace(a.Action),
 			Confidence: a.Confidence,
 			Overwrite:  a.Overwrite,
+			Source:     SourceLLM,
 		})
 	}
 
@@ -98,20 +98,29 @@ func (g *GraphStore) UpsertEntity(ctx context.Context, tenantID string, entity *
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(tenant_id, name, entity_type)
 		DO UPDATE SET
-			description = excluded.description,
-			metadata_json = excluded.metadata_json,
-			embedding_id = excluded.embedding_id,
-			importance = excluded.importance,
+			description = COALESCE(NULLIF(excluded.description, ''), description),
+			metadata_json = COALESCE(NULLIF(excluded.metadata_json, ''), metadata_json),
+			embedding_id = COALESCE(NULLIF(excluded.embedding_id, ''), embedding_id),
+			importance = MAX(importance, excluded.importance),
 			updated_at = excluded.updated_at
 	`, entity.ID, tenantID, entity.Name, entity.EntityType, entity.Description, entity.MetadataJSON, entity.EmbeddingID, entity.Importance, entity.CreatedAt, entity.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	return entity, nil
+	// On conflict the existing row keeps its ID, which relations must use
+	saved, err := g.FindEntityByName(ctx, tenantID, entity.Name, entity.EntityType)
+	if err != nil {
+		return nil, err
+	}
+	if err := addAlias(ctx, g.db, tenantID, saved.ID, saved.Name); err != nil {
+		return nil, err
+	}
+	return saved, nil
 }
 
-// CreateRelation inserts a relation edge between two entities.
+// CreateRelation inserts a relation edge between two entities. Recording an
+// existing edge again refreshes it and keeps the higher confidence.
 func (g *GraphStore) CreateRelation(ctx context.Context, tenantID string, relation *Relation) (*Relation, error) {
 	if g == nil || g.db == nil {
 		return nil, fmt.Errorf("graph store not initialized")
@@ -138,11 +147,22 @@ func (g *GraphStore) CreateRelation(ctx context.Context, tenantID string, relati
 	_, err := g.db.ExecContext(ctx, `
 		INSERT INTO team_relations (id, tenant_id, source_id, target_id, relation_type, metadata_json, confidence, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tenant_id, source_id, target_id, relation_type)
+		DO UPDATE SET
+			confidence = MAX(confidence, excluded.confidence),
+			updated_at = excluded.updated_at
 	`, relation.ID, tenantID, relation.SourceID, relation.TargetID, relation.RelationType, relation.MetadataJSON, relation.Confidence, relation.CreatedAt, relation.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	err = g.db.QueryRowContext(ctx, `
+		SELECT id, created_at FROM team_relations
+		WHERE tenant_id = ? AND source_id = ? AND target_id = ? AND relation_type = ?
+	`, tenantID, relation.SourceID, relation.TargetID, relation.RelationType).Scan(&relation.ID, &relation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
 	return relation, nil
 }
 
@@ -167,6 +187,37 @@ func (g *GraphStore) FindEntityByName(ctx context.Context, tenantID, name, entit
 	return &e, nil
 }
 
+// FindEntitiesByName returns the entities with a name, of any type, matched
+// case-insensitively. The most important come first.
+func (g *GraphStore) FindEntitiesByName(ctx context.Context, tenantID, name string) ([]*Entity, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT id, tenant_id, name, entity_type, description, metadata_json, embedding_id, importance, created_at, updated_at
+		FROM team_entities
+		WHERE tenant_id = ? AND name = ? COLLATE NOCASE
+		ORDER BY importance DESC, updated_at DESC
+	`, tenantID, strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Entity
+	for rows.Next() {
+		var e Entity
+		if err := rows.Scan(
+			&e.ID, &e.TenantID, &e.Name, &e.EntityType, &e.Description, &e.MetadataJSON,
+			&e.EmbeddingID, &e.Importance, &e.CreatedAt, &e.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
+
 // GetEntityByID returns a single entity by ID.
 func (g *GraphStore) GetEntityByID(ctx context.Context, tenantID, id string) (*Entity, error) {
 	var e Entity
@@ -303,6 +354,49 @@ func (g *GraphStore) UpsertDocument(ctx context.Context, tenantID string, doc *D
 	return doc, nil
 }
 
+// GetDocumentByPath returns a tenant's document by path, or nil.
+func (g *GraphStore) GetDocumentByPath(ctx context.Context, tenantID, path string) (*Document, error) {
+	docs, err := g.listDocuments(ctx, `WHERE tenant_id = ? AND path = ?`, tenantID, path)
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+	return docs[0], nil
+}
+
+// ListDocuments returns a tenant's documents whose path starts with prefix,
+// ordered by path.
+func (g *GraphStore) ListDocuments(ctx context.Context, tenantID, prefix string) ([]*Document, error) {
+	return g.listDocuments(ctx, `WHERE tenant_id = ? AND substr(path, 1, ?) = ? ORDER BY path`, tenantID, len(prefix), prefix)
+}
+
+func (g *GraphStore) listDocuments(ctx context.Context, where string, args ...any) ([]*Document, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT id, tenant_id, path, COALESCE(title, ''), COALESCE(content_preview, ''), COALESCE(file_type, ''),
+			COALESCE(size_bytes, 0), COALESCE(language, ''), indexed_at, updated_at, COALESCE(chunk_count, 0), COALESCE(metadata_json, '')
+		FROM team_documents
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Document
+	for rows.Next() {
+		var d Document
+		if err := rows.Scan(
+			&d.ID, &d.TenantID, &d.Path, &d.Title, &d.ContentPreview, &d.FileType,
+			&d.SizeBytes, &d.Language, &d.IndexedAt, &d.UpdatedAt, &d.ChunkCount, &d.MetadataJSON,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &d)
+	}
+	return out, rows.Err()
+}
+
 // ReplaceDocumentChunks removes existing chunks and inserts new ones.
 func (g *GraphStore) ReplaceDocumentChunks(ctx context.Context, tenantID, documentID string, chunks []DocumentChunk) error {
 	if g == nil || g.db == nil {
@@ -449,6 +543,35 @@ func (g *GraphStore) ListRelations(ctx context.Context, tenantID string, limit i
 	return out, rows.Err()
 }
 
+// Query runs a read-only query against the graph tables. The caller scopes
+// it to a tenant; compiled graph queries filter every table they read.
+func (g *GraphStore) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	return g.db.QueryContext(ctx, query, args...)
+}
+
+// Clear deletes a tenant's entities, relations, documents and chunks.
+func (g *GraphStore) Clear(ctx context.Context, tenantID string) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"team_relations", "team_entities", "team_doc_chunks", "team_documents", "team_index_roots"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE tenant_id = ?`, tenantID); err != nil {
+			return fmt.Errorf("clear %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
 func (g *GraphStore) getDocumentID(ctx context.Context, tenantID, path string) (string, error) {
 	var id string
 	err := g.db.QueryRowContext(ctx, `
@@ -0,0 +1,83 @@
+// Package memory provides the state of directory indexing.
+package memory
+
+import (
+	"context"
+	"fmt"
+)
+
+// IndexRoot is the state of an indexed directory. A run that started after
+// the last one finished was interrupted, and Pending files were left for the
+// next run.
+type IndexRoot struct {
+	TenantID   string
+	Root       string
+	StartedAt  int64
+	FinishedAt int64
+	Files      int    // Files indexed under the root after the last run
+	Pending    int    // Changed files the last run did not get to
+	CodeStamp  string // Summary of the Go files at the last code ingestion
+	LastError  string
+}
+
+// Interrupted reports whether the last run stopped before finishing.
+func (r *IndexRoot) Interrupted() bool {
+	return r.StartedAt > r.FinishedAt
+}
+
+// GetIndexRoot returns the state of an indexed directory, or nil.
+func (g *GraphStore) GetIndexRoot(ctx context.Context, tenantID, root string) (*IndexRoot, error) {
+	roots, err := g.listIndexRoots(ctx, `WHERE tenant_id = ? AND root = ?`, tenantID, root)
+	if err != nil || len(roots) == 0 {
+		return nil, err
+	}
+	return roots[0], nil
+}
+
+// ListIndexRoots returns a tenant's indexed directories.
+func (g *GraphStore) ListIndexRoots(ctx context.Context, tenantID string) ([]*IndexRoot, error) {
+	return g.listIndexRoots(ctx, `WHERE tenant_id = ? ORDER BY root`, tenantID)
+}
+
+func (g *GraphStore) listIndexRoots(ctx context.Context, where string, args ...any) ([]*IndexRoot, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT tenant_id, root, started_at, finished_at, files, pending, code_stamp, last_error
+		FROM team_index_roots
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*IndexRoot
+	for rows.Next() {
+		var r IndexRoot
+		if err := rows.Scan(&r.TenantID, &r.Root, &r.StartedAt, &r.FinishedAt, &r.Files, &r.Pending, &r.CodeStamp, &r.LastError); err != nil {
+			return nil, err
+		}
+		out = append(out, &r)
+	}
+	return out, rows.Err()
+}
+
+// SaveIndexRoot creates or replaces the state of an indexed directory.
+func (g *GraphStore) SaveIndexRoot(ctx context.Context, r *IndexRoot) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+	_, err := g.db.ExecContext(ctx, `
+		INSERT INTO team_index_roots (tenant_id, root, started_at, finished_at, files, pending, code_stamp, last_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tenant_id, root) DO UPDATE SET
+			started_at = excluded.started_at,
+			finished_at = excluded.finished_at,
+			files = excluded.files,
+			pending = excluded.pending,
+			code_stamp = excluded.code_stamp,
+			last_error = excluded.last_error
+	`, r.TenantID, r.Root, r.StartedAt, r.FinishedAt, r.Files, r.Pending, r.CodeStamp, r.LastError)
+	return err
+}
@@ -0,0 +1,221 @@
+// Package memory provides the confidence lifecycle of profile facts and
+// learned actions: reinforcement, decay and contradiction.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ConfidencePolicy controls how a memory's confidence changes after it is
+// stored. Zero fields take their DefaultConfidencePolicy value.
+type ConfidencePolicy struct {
+	Restate      float64 // Share of the gap to 1.0 gained when the user re-states a fact
+	Use          float64 // Share of the gap to 1.0 gained when a recalled fact goes uncorrected
+	Contradict   float64 // Multiplier applied when the user contradicts a fact
+	HalfLifeDays float64 // Days without confirmation for confidence to halve; negative disables decay
+	Min          float64 // Below this a fact is not recalled and is archived on consolidation
+}
+
+// DefaultConfidencePolicy returns the default lifecycle parameters.
+func DefaultConfidencePolicy() ConfidencePolicy {
+	return ConfidencePolicy{
+		Restate:      0.3,
+		Use:          0.05,
+		Contradict:   0.4,
+		HalfLifeDays: 90,
+		Min:          0.3,
+	}
+}
+
+// Outcomes of observing a fact.
+const (
+	FactAdded        = "added"        // New fact stored
+	FactReinforced   = "reinforced"   // Same fact re-stated; confidence raised
+	FactReplaced     = "replaced"     // Old value replaced by the new one
+	FactContradicted = "contradicted" // Old value kept with lowered confidence
+	FactIgnored      = "ignored"      // Unrelated value for a field that is already set
+)
+
+// withDefaults fills zero fields from DefaultConfidencePolicy.
+func (p ConfidencePolicy) withDefaults() ConfidencePolicy {
+	d := DefaultConfidencePolicy()
+	if p.Restate <= 0 {
+		p.Restate = d.Restate
+	}
+	if p.Use <= 0 {
+		p.Use = d.Use
+	}
+	if p.Contradict <= 0 || p.Contradict >= 1 {
+		p.Contradict = d.Contradict
+	}
+	if p.HalfLifeDays == 0 {
+		p.HalfLifeDays = d.HalfLifeDays
+	}
+	if p.Min <= 0 {
+		p.Min = d.Min
+	}
+	return p
+}
+
+// Effective returns confidence decayed from when it was last set.
+func (p ConfidencePolicy) Effective(confidence float64, setAt int64, now time.Time) float64 {
+	p = p.withDefaults()
+	if p.HalfLifeDays < 0 || setAt <= 0 {
+		return confidence
+	}
+	days := float64(now.Unix()-setAt) / 86400
+	if days <= 0 {
+		return confidence
+	}
+	return confidence * math.Pow(0.5, days/p.HalfLifeDays)
+}
+
+// sqlEffective is Effective as an SQL expression over a profile or action
+// table aliased as alias.
+func (p ConfidencePolicy) sqlEffective(alias string, now int64) string {
+	p = p.withDefaults()
+	if p.HalfLifeDays < 0 {
+		return alias + ".confidence"
+	}
+	return fmt.Sprintf("(%[1]s.confidence * pow(0.5, MAX(0, %[2]d - COALESCE(%[1]s.confidence_at, %[1]s.updated_at)) / (86400.0 * %[3]g)))",
+		alias, now, p.HalfLifeDays)
+}
+
+// raise moves confidence a share of the way towards 1.
+func raise(confidence, share float64) float64 {
+	return math.Min(1, confidence+share*(1-confidence))
+}
+
+// SetConfidencePolicy sets the lifecycle parameters used by this store.
+func (m *MemoryStore) SetConfidencePolicy(p ConfidencePolicy) {
+	m.policy = p.withDefaults()
+}
+
+// ConfidencePolicy returns the lifecycle parameters in effect.
+func (m *MemoryStore) ConfidencePolicy() ConfidencePolicy {
+	if m == nil {
+		return DefaultConfidencePolicy()
+	}
+	return m.policy.withDefaults()
+}
+
+// Observe records a fact stated by the user. Re-stating a stored fact
+// reinforces it; a conflicting value lowers the stored one's confidence
+// and replaces it once the new fact is more credible. Facts marked
+// Overwrite are explicit corrections and always replace.
+func (m *MemoryStore) Observe(ctx context.Context, fact MemoryFact, prov Provenance) (string, error) {
+	if m == nil || m.db == nil {
+		return "", fmt.Errorf("memory store not initialized")
+	}
+	kind, key, value := fact.Type, fact.Field, fact.Value
+	if kind == "action" {
+		key, value = fact.Trigger, fact.Action
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if key == "" || value == "" {
+		return "", fmt.Errorf("%s fact needs a key and value", kind)
+	}
+	upsert := func(confidence float64) error {
+		if kind == "action" {
+			return m.UpsertActionFrom(ctx, key, value, confidence, prov)
+		}
+		return m.UpsertProfileFieldFrom(ctx, key, value, confidence, prov)
+	}
+
+	current, err := m.lookupConfidence(ctx, kind, key)
+	if err != nil {
+		return "", err
+	}
+	if current == nil {
+		return FactAdded, upsert(fact.Confidence)
+	}
+
+	p := m.ConfidencePolicy()
+	effective := p.Effective(current.confidence, current.setAt, time.Now())
+	switch {
+	case memorySimilarity(current.value, value) >= 0.8:
+		return FactReinforced, m.setConfidence(ctx, kind, current.id, raise(math.Max(effective, fact.Confidence), p.Restate), "reinforced")
+	case fact.Overwrite:
+		return FactReplaced, upsert(fact.Confidence)
+	case kind == "profile" && multiValueFields[profileFieldKey(key)] && memorySimilarity(current.value, value) < 0.4:
+		// Another preference, not a different answer to the same one
+		return FactIgnored, nil
+	}
+
+	lowered := effective * p.Contradict
+	if lowered < fact.Confidence {
+		return FactReplaced, upsert(fact.Confidence)
+	}
+	return FactContradicted, m.setConfidence(ctx, kind, current.id, lowered, "contradicted")
+}
+
+// Reinforce raises the confidence of a recalled fact that the user went
+// along with. kind is "profile" or "action"; key is the field or trigger.
+func (m *MemoryStore) Reinforce(ctx context.Context, kind, key string) error {
+	if m == nil || m.db == nil {
+		return fmt.Errorf("memory store not initialized")
+	}
+	current, err := m.lookupConfidence(ctx, kind, key)
+	if err != nil || current == nil {
+		return err
+	}
+	p := m.ConfidencePolicy()
+	effective := p.Effective(current.confidence, current.setAt, time.Now())
+	return m.setConfidence(ctx, kind, current.id, raise(effective, p.Use), "reinforced")
+}
+
+// Contradict lowers the confidence of a fact the user said is wrong.
+func (m *MemoryStore) Contradict(ctx context.Context, kind, key string) error {
+	if m == nil || m.db == nil {
+		return fmt.Errorf("memory store not initialized")
+	}
+	current, err := m.lookupConfidence(ctx, kind, key)
+	if err != nil || current == nil {
+		return err
+	}
+	p := m.ConfidencePolicy()
+	effective := p.Effective(current.confidence, current.setAt, time.Now())
+	return m.setConfidence(ctx, kind, current.id, effective*p.Contradict, "contradicted")
+}
+
+type storedConfidence struct {
+	id         string
+	value      string
+	confidence float64
+	setAt      int64
+}
+
+func (m *MemoryStore) lookupConfidence(ctx context.Context, kind, key string) (*storedConfidence, error) {
+	keyCol, valueCol := "field", "value"
+	if kind == "action" {
+		keyCol, valueCol = "trigger", "action"
+	}
+	var c storedConfidence
+	err := m.db.QueryRowContext(ctx, `
+		SELECT id, `+valueCol+`, confidence, COALESCE(confidence_at, updated_at)
+		FROM `+memoryTable(kind)+` WHERE `+keyCol+` = ?
+	`, key).Scan(&c.id, &c.value, &c.confidence, &c.setAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// setConfidence stores an already-decayed confidence, restarting decay
+// from now, and bumps the named counter.
+func (m *MemoryStore) setConfidence(ctx context.Context, kind, id string, confidence float64, counter string) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE `+memoryTable(kind)+`
+		SET confidence = ?, confidence_at = ?, `+counter+` = `+counter+` + 1
+		WHERE id = ?
+	`, math.Max(0, math.Min(1, confidence)), time.Now().Unix(), id)
+	return err
+}
@@ -0,0 +1,564 @@
+// Package memory provides a uniform view for listing, editing and forgetting memories.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Memory kinds managed by MemoryManager.
+const (
+	KindProfile = "profile"
+	KindAction  = "action"
+	KindEpisode = "episode"
+	KindEntity  = "entity"
+	KindTeam    = "team"
+)
+
+// SourceImport marks memories loaded from an export file.
+const SourceImport = "import"
+
+// memoryExportVersion is bumped when the export layout changes.
+const memoryExportVersion = 1
+
+// MemoryItem is a profile fact, action, episode or graph entity in a
+// common shape.
+type MemoryItem struct {
+	Kind       string  `json:"kind"`
+	ID         string  `json:"id,omitempty"`
+	Key        string  `json:"key"`            // Field, trigger, episode topic or entity name
+	Value      string  `json:"value"`          // Value, action, episode summary or entity description
+	Type       string  `json:"type,omitempty"` // Entity type, or fact/action for team memories
+	Confidence float64 `json:"confidence"`
+	UpdatedAt  int64   `json:"updated_at,omitempty"`
+
+	rank float64
+}
+
+// MemoryFilter selects memories. Zero values match everything.
+type MemoryFilter struct {
+	Kinds         []string
+	MinConfidence float64
+	MaxConfidence float64
+	OlderThan     time.Duration // Last updated before now-OlderThan
+	NewerThan     time.Duration // Last updated after now-NewerThan
+	Pattern       string        // Glob (* and ?) matched against key or value, case-insensitive
+	Query         string        // Full-text query
+	Limit         int
+}
+
+// MemoryExport is the portable memory file format.
+type MemoryExport struct {
+	Version    int          `json:"version"`
+	ExportedAt int64        `json:"exported_at"`
+	Items      []MemoryItem `json:"items"`
+}
+
+// MemoryManager lists, edits and forgets memories across the personal
+// database and, when configured, the tenant's knowledge graph.
+type MemoryManager struct {
+	store    *MemoryStore
+	personal *sql.DB
+	team     *sql.DB
+	tenantID string
+	actor    TeamActor // Member whose role governs team memory changes
+}
+
+// NewMemoryManager creates a manager. team may be nil to manage personal
+// memories only.
+func NewMemoryManager(personal, team *sql.DB, tenantID string) *MemoryManager {
+	return &MemoryManager{
+		store:    NewMemoryStore(personal),
+		personal: personal,
+		team:     team,
+		tenantID: tenantID,
+	}
+}
+
+// SetConfidencePolicy sets how listed confidences decay.
+func (m *MemoryManager) SetConfidencePolicy(p ConfidencePolicy) {
+	m.store.SetConfidencePolicy(p)
+}
+
+// memoryKindSpec maps a kind onto its table.
+type memoryKindSpec struct {
+	kind       string
+	team       bool
+	table      string
+	fts        string
+	key        string
+	value      string
+	typ        string
+	confidence string
+	decays     bool // confidence decays per the store's ConfidencePolicy
+}
+
+var memoryKinds = []memoryKindSpec{
+	{kind: KindProfile, table: "memory_profile", fts: "memory_profile_fts", key: "t.field", value: "t.value", typ: "''", confidence: "t.confidence", decays: true},
+	{kind: KindAction, table: "memory_actions", fts: "memory_actions_fts", key: "t.trigger", value: "t.action", typ: "''", confidence: "t.confidence", decays: true},
+	{kind: KindEpisode, table: "memory_episodes", fts: "memory_episodes_fts", key: "t.topic", value: "t.summary", typ: "''", confidence: "0.7"},
+	{kind: KindEntity, team: true, table: "team_entities", fts: "team_entities_fts", key: "t.name", value: "COALESCE(t.description, '')", typ: "t.entity_type",
+		// Entities carry importance rather than confidence
+		confidence: "(0.5 + 0.5 * MIN(MAX(COALESCE(t.importance, 0), 0), 1))"},
+	{kind: KindTeam, team: true, table: "team_memory", fts: "team_memory_fts", key: "t.key", value: "t.value", typ: "t.kind", confidence: "t.confidence"},
+}
+
+// List returns memories matching the filter, newest first, or by relevance
+// when a full-text query is set.
+func (m *MemoryManager) List(ctx context.Context, filter MemoryFilter) ([]MemoryItem, error) {
+	if m == nil || m.personal == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	var match string
+	if filter.Query != "" {
+		keywords := extractKeywords(filter.Query)
+		if len(keywords) == 0 {
+			return nil, nil
+		}
+		match = ftsMatchExpr(keywords)
+	}
+
+	var items []MemoryItem
+	for _, spec := range memoryKinds {
+		if !filter.includes(spec.kind) {
+			continue
+		}
+		db := m.personal
+		if spec.team {
+			if m.team == nil {
+				continue
+			}
+			db = m.team
+		}
+		found, err := m.listKind(ctx, db, spec, filter, match)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", spec.kind, err)
+		}
+		items = append(items, found...)
+	}
+
+	if match != "" {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].rank < items[j].rank })
+	} else {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].UpdatedAt > items[j].UpdatedAt })
+	}
+	if filter.Limit > 0 && len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	return items, nil
+}
+
+func (m *MemoryManager) listKind(ctx context.Context, db *sql.DB, spec memoryKindSpec, filter MemoryFilter, match string) ([]MemoryItem, error) {
+	rank := "0"
+	from := spec.table + " t"
+	var where []string
+	var args []any
+	now := time.Now()
+	confidence := spec.confidence
+	if spec.decays {
+		confidence = m.store.ConfidencePolicy().sqlEffective("t", now.Unix())
+	}
+
+	if match != "" {
+		rank = "bm25(" + spec.fts + ")"
+		from += " JOIN " + spec.fts + " ON " + spec.fts + ".rowid = t.rowid"
+		where = append(where, spec.fts+" MATCH ?")
+		args = append(args, match)
+	}
+	if spec.team {
+		where = append(where, "t.tenant_id = ?")
+		args = append(args, m.tenantID)
+	}
+	if filter.MinConfidence > 0 {
+		where = append(where, confidence+" >= ?")
+		args = append(args, filter.MinConfidence)
+	}
+	if filter.MaxConfidence > 0 {
+		where = append(where, confidence+" <= ?")
+		args = append(args, filter.MaxConfidence)
+	}
+	if filter.OlderThan > 0 {
+		where = append(where, "t.updated_at < ?")
+		args = append(args, now.Add(-filter.OlderThan).Unix())
+	}
+	if filter.NewerThan > 0 {
+		where = append(where, "t.updated_at >= ?")
+		args = append(args, now.Add(-filter.NewerThan).Unix())
+	}
+	if filter.Pattern != "" {
+		like := globToLike(filter.Pattern)
+		where = append(where, "("+spec.key+` LIKE ? ESCAPE '\' OR flynn_open(`+spec.value+`) LIKE ? ESCAPE '\')`)
+		args = append(args, like, like)
+	}
+
+	query := fmt.Sprintf(`SELECT t.id, %s, %s, %s, %s, t.updated_at, %s FROM %s`,
+		spec.key, spec.value, spec.typ, confidence, rank, from)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if filter.Limit > 0 {
+		order := "t.updated_at DESC"
+		if match != "" {
+			order = rank
+		}
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", order, filter.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []MemoryItem
+	for rows.Next() {
+		item := MemoryItem{Kind: spec.kind}
+		if err := rows.Scan(&item.ID, &item.Key, &item.Value, &item.Type, &item.Confidence, &item.UpdatedAt, &item.rank); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Edit sets the value of a profile field, action, episode summary, entity
+// description or team fact. New profile fields, actions and team facts are
+// created; episodes and entities must exist.
+func (m *MemoryManager) Edit(ctx context.Context, kind, key, value string, confidence float64) error {
+	if m == nil || m.personal == nil {
+		return fmt.Errorf("memory store not initialized")
+	}
+	prov := Provenance{Source: SourceManual}
+	switch kind {
+	case KindProfile:
+		return m.store.UpsertProfileFieldFrom(ctx, key, value, editConfidence(confidence), prov)
+	case KindAction:
+		return m.store.UpsertActionFrom(ctx, key, value, editConfidence(confidence), prov)
+	case KindEpisode:
+		res, err := m.personal.ExecContext(ctx, `UPDATE memory_episodes SET summary = ? WHERE topic = ?`, value, key)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("episode %q not found", key)
+		}
+		return nil
+	case KindEntity:
+		if m.team == nil {
+			return fmt.Errorf("team database not configured")
+		}
+		res, err := m.team.ExecContext(ctx, `
+			UPDATE team_entities SET description = ?, updated_at = ?
+			WHERE tenant_id = ? AND name = ?
+		`, value, time.Now().Unix(), m.tenantID, key)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("entity %q not found", key)
+		}
+		return nil
+	case KindTeam:
+		_, err := m.teamMemory().Put(ctx, m.actor, TeamFact{Kind: TeamFactKind, Key: key, Value: value, Confidence: editConfidence(confidence)}, true)
+		return err
+	default:
+		return fmt.Errorf("unknown memory kind %q", kind)
+	}
+}
+
+// Forget deletes the given memories. Personal facts lose their version
+// history and archived copies too, so forgotten facts cannot be restored.
+// Entities lose their relations. Team memories are only forgotten when the
+// team actor may change them.
+func (m *MemoryManager) Forget(ctx context.Context, items []MemoryItem) (int, error) {
+	if m == nil || m.personal == nil {
+		return 0, fmt.Errorf("memory store not initialized")
+	}
+
+	ptx, err := m.personal.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer ptx.Rollback()
+
+	var ttx *sql.Tx
+	if m.team != nil {
+		if ttx, err = m.team.BeginTx(ctx, nil); err != nil {
+			return 0, err
+		}
+		defer ttx.Rollback()
+	}
+
+	forgotten := 0
+	for _, item := range items {
+		switch item.Kind {
+		case KindProfile, KindAction:
+			table := memoryTable(item.Kind)
+			if _, err := ptx.ExecContext(ctx, `DELETE FROM `+table+` WHERE id = ?`, item.ID); err != nil {
+				return 0, err
+			}
+			if _, err := ptx.ExecContext(ctx, `DELETE FROM memory_versions WHERE kind = ? AND subject = ?`, item.Kind, item.Key); err != nil {
+				return 0, err
+			}
+			if _, err := ptx.ExecContext(ctx, `DELETE FROM memory_archive WHERE kind = ? AND subject = ?`, item.Kind, item.Key); err != nil {
+				return 0, err
+			}
+		case KindEpisode:
+			if _, err := ptx.ExecContext(ctx, `DELETE FROM memory_episodes WHERE id = ?`, item.ID); err != nil {
+				return 0, err
+			}
+		case KindEntity:
+			if ttx == nil {
+				continue
+			}
+			if _, err := ttx.ExecContext(ctx, `
+				DELETE FROM team_relations WHERE tenant_id = ? AND (source_id = ? OR target_id = ?)
+			`, m.tenantID, item.ID, item.ID); err != nil {
+				return 0, err
+			}
+			if _, err := ttx.ExecContext(ctx, `DELETE FROM team_entities WHERE tenant_id = ? AND id = ?`, m.tenantID, item.ID); err != nil {
+				return 0, err
+			}
+		case KindTeam:
+			if ttx == nil {
+				continue
+			}
+			var owner string
+			err := ttx.QueryRowContext(ctx, `SELECT created_by FROM team_memory WHERE tenant_id = ? AND id = ?`, m.tenantID, item.ID).Scan(&owner)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			if err := m.actor.authorize(owner); err != nil {
+				return 0, fmt.Errorf("forget team %s: %w", item.Key, err)
+			}
+			if _, err := ttx.ExecContext(ctx, `DELETE FROM team_memory WHERE id = ?`, item.ID); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("unknown memory kind %q", item.Kind)
+		}
+		forgotten++
+	}
+
+	if err := ptx.Commit(); err != nil {
+		return 0, err
+	}
+	if ttx != nil {
+		if err := ttx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return forgotten, nil
+}
+
+// ForgetKey deletes a profile field or action trigger by exact key.
+func (m *MemoryManager) ForgetKey(ctx context.Context, kind, key string) (int, error) {
+	items, err := m.Lookup(ctx, kind, key)
+	if err != nil {
+		return 0, err
+	}
+	return m.Forget(ctx, items)
+}
+
+// Lookup returns memories whose key exactly matches. An empty kind
+// searches every kind.
+func (m *MemoryManager) Lookup(ctx context.Context, kind, key string) ([]MemoryItem, error) {
+	filter := MemoryFilter{Pattern: escapeGlob(key)}
+	if kind != "" {
+		filter.Kinds = []string{kind}
+	}
+	items, err := m.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var exact []MemoryItem
+	for _, item := range items {
+		if strings.EqualFold(item.Key, key) {
+			exact = append(exact, item)
+		}
+	}
+	return exact, nil
+}
+
+// Export returns the selected memories as a portable document.
+func (m *MemoryManager) Export(ctx context.Context, filter MemoryFilter) (*MemoryExport, error) {
+	items, err := m.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []MemoryItem{}
+	}
+	return &MemoryExport{Version: memoryExportVersion, ExportedAt: time.Now().Unix(), Items: items}, nil
+}
+
+// Import stores exported memories. Profile fields and actions are upserted;
+// episodes are added; entities are upserted by name and type.
+func (m *MemoryManager) Import(ctx context.Context, doc *MemoryExport) (int, error) {
+	if doc == nil {
+		return 0, fmt.Errorf("no memories to import")
+	}
+	if doc.Version > memoryExportVersion {
+		return 0, fmt.Errorf("unsupported memory export version %d", doc.Version)
+	}
+
+	prov := Provenance{Source: SourceImport}
+	imported := 0
+	for i, item := range doc.Items {
+		if strings.TrimSpace(item.Key) == "" {
+			return imported, fmt.Errorf("item %d: key is required", i+1)
+		}
+		var err error
+		switch item.Kind {
+		case KindProfile:
+			err = m.store.UpsertProfileFieldFrom(ctx, item.Key, item.Value, item.Confidence, prov)
+		case KindAction:
+			err = m.store.UpsertActionFrom(ctx, item.Key, item.Value, item.Confidence, prov)
+		case KindEpisode:
+			err = NewEpisodeStore(m.personal, nil).Save(ctx, &Episode{
+				Topic:   item.Key,
+				Summary: item.Value,
+				EndedAt: item.UpdatedAt,
+			})
+		case KindEntity:
+			if m.team == nil {
+				continue
+			}
+			_, err = NewGraphStore(m.team).UpsertEntity(ctx, m.tenantID, &Entity{
+				Name:        item.Key,
+				EntityType:  item.Type,
+				Description: item.Value,
+			})
+		case KindTeam:
+			if m.team == nil {
+				continue
+			}
+			_, err = m.teamMemory().Put(ctx, m.actor, TeamFact{Kind: item.Type, Key: item.Key, Value: item.Value, Confidence: item.Confidence}, true)
+		default:
+			err = fmt.Errorf("unknown memory kind %q", item.Kind)
+		}
+		if err != nil {
+			return imported, fmt.Errorf("item %d (%s %s): %w", i+1, item.Kind, item.Key, err)
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// DecodeMemoryExport parses an exported memory file.
+func DecodeMemoryExport(data []byte) (*MemoryExport, error) {
+	var doc MemoryExport
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse memory export: %w", err)
+	}
+	if doc.Version == 0 {
+		doc.Version = memoryExportVersion
+	}
+	return &doc, nil
+}
+
+// FormatMarkdown renders memories as a readable Markdown document.
+func FormatMarkdown(items []MemoryItem) string {
+	var b strings.Builder
+	b.WriteString("# Flynn Memory\n")
+
+	sections := []struct{ kind, title string }{
+		{KindProfile, "Profile"},
+		{KindAction, "Actions"},
+		{KindEpisode, "Past Conversations"},
+		{KindEntity, "Knowledge Graph"},
+		{KindTeam, "Team Memory"},
+	}
+	for _, sec := range sections {
+		var rows []MemoryItem
+		for _, item := range items {
+			if item.Kind == sec.kind {
+				rows = append(rows, item)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", sec.title)
+		for _, item := range rows {
+			updated := time.Unix(item.UpdatedAt, 0).Format("2006-01-02")
+			switch {
+			case item.Kind == KindAction, item.Kind == KindTeam && item.Type == TeamActionKind:
+				fmt.Fprintf(&b, "- When \"%s\": %s _(confidence %.2f, %s)_\n", item.Key, item.Value, item.Confidence, updated)
+			case item.Kind == KindEpisode:
+				fmt.Fprintf(&b, "- **%s** (%s): %s\n", item.Key, updated, item.Value)
+			case item.Kind == KindEntity:
+				fmt.Fprintf(&b, "- **%s** (%s): %s _(%s)_\n", item.Key, item.Type, item.Value, updated)
+			default:
+				fmt.Fprintf(&b, "- **%s**: %s _(confidence %.2f, %s)_\n", item.Key, item.Value, item.Confidence, updated)
+			}
+		}
+	}
+	return b.String()
+}
+
+// ============================================================
+// Helpers
+// ============================================================
+
+func (f MemoryFilter) includes(kind string) bool {
+	if len(f.Kinds) == 0 {
+		return true
+	}
+	for _, k := range f.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func editConfidence(confidence float64) float64 {
+	if confidence <= 0 {
+		// Stated directly by the user
+		return 1.0
+	}
+	return confidence
+}
+
+// globToLike converts a * and ? glob into a LIKE pattern escaped with '\'.
+func globToLike(glob string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range glob {
+		switch {
+		case escaped:
+			escaped = false
+			if r == '%' || r == '_' || r == '\\' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			b.WriteRune('%')
+		case r == '?':
+			b.WriteRune('_')
+		case r == '%' || r == '_':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// escapeGlob quotes glob metacharacters so a key matches literally.
+func escapeGlob(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+	return r.Replace(s)
+}
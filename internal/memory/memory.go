@@ -13,7 +13,8 @@ import (
 
 // MemoryStore manages profile and action memories.
 type MemoryStore struct {
-	db *sql.DB
+	db     *sql.DB
+	policy ConfidencePolicy
 }
 
 // NewMemoryStore creates a new memory store using the personal DB.
@@ -23,6 +24,12 @@ func NewMemoryStore(db *sql.DB) *MemoryStore {
 
 // UpsertProfileField stores or updates a profile field.
 func (m *MemoryStore) UpsertProfileField(ctx context.Context, field, value string, confidence float64) error {
+	return m.UpsertProfileFieldFrom(ctx, field, value, confidence, Provenance{})
+}
+
+// UpsertProfileFieldFrom stores or updates a profile field and records the
+// write, with its provenance, in the version history.
+func (m *MemoryStore) UpsertProfileFieldFrom(ctx context.Context, field, value string, confidence float64, prov Provenance) error {
 	if m == nil || m.db == nil {
 		return fmt.Errorf("memory store not initialized")
 	}
@@ -33,17 +40,35 @@ func (m *MemoryStore) UpsertProfileField(ctx context.Context, field, value strin
 		confidence = 0.7
 	}
 
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	now := time.Now().Unix()
 	id := uuid.New().String()
-	_, err := m.db.ExecContext(ctx, `
-		INSERT INTO memory_profile (id, field, value, confidence, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO memory_profile (id, field, value, confidence, updated_at, confidence_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(field) DO UPDATE SET
+			reinforced = CASE WHEN flynn_open(value) = excluded.value THEN reinforced ELSE 0 END,
+			contradicted = CASE WHEN flynn_open(value) = excluded.value THEN contradicted ELSE 0 END,
 			value = excluded.value,
 			confidence = excluded.confidence,
-			updated_at = excluded.updated_at
-	`, id, field, value, confidence, now)
-	return err
+			updated_at = excluded.updated_at,
+			confidence_at = excluded.confidence_at
+	`, id, field, value, confidence, now, now)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM memory_profile WHERE field = ?`, field).Scan(&id); err != nil {
+		return err
+	}
+	if err := recordVersion(ctx, tx, "profile", id, field, value, confidence, prov); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetProfileField returns the current value for a profile field.
@@ -69,6 +94,12 @@ func (m *MemoryStore) GetProfileField(ctx context.Context, field string) (string
 
 // UpsertAction stores or updates a personal action.
 func (m *MemoryStore) UpsertAction(ctx context.Context, trigger, action string, confidence float64) error {
+	return m.UpsertActionFrom(ctx, trigger, action, confidence, Provenance{})
+}
+
+// UpsertActionFrom stores or updates a personal action and records the
+// write, with its provenance, in the version history.
+func (m *MemoryStore) UpsertActionFrom(ctx context.Context, trigger, action string, confidence float64, prov Provenance) error {
 	if m == nil || m.db == nil {
 		return fmt.Errorf("memory store not initialized")
 	}
@@ -79,17 +110,35 @@ func (m *MemoryStore) UpsertAction(ctx context.Context, trigger, action string,
 		confidence = 0.7
 	}
 
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	now := time.Now().Unix()
 	id := uuid.New().String()
-	_, err := m.db.ExecContext(ctx, `
-		INSERT INTO memory_actions (id, trigger, action, confidence, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO memory_actions (id, trigger, action, confidence, updated_at, confidence_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(trigger) DO UPDATE SET
+			reinforced = CASE WHEN flynn_open(action) = excluded.action THEN reinforced ELSE 0 END,
+			contradicted = CASE WHEN flynn_open(action) = excluded.action THEN contradicted ELSE 0 END,
 			action = excluded.action,
 			confidence = excluded.confidence,
-			updated_at = excluded.updated_at
-	`, id, trigger, action, confidence, now)
-	return err
+			updated_at = excluded.updated_at,
+			confidence_at = excluded.confidence_at
+	`, id, trigger, action, confidence, now, now)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM memory_actions WHERE trigger = ?`, trigger).Scan(&id); err != nil {
+		return err
+	}
+	if err := recordVersion(ctx, tx, "action", id, trigger, action, confidence, prov); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetAction returns the current action for a trigger.
@@ -113,7 +162,8 @@ func (m *MemoryStore) GetAction(ctx context.Context, trigger string) (string, er
 	return action, nil
 }
 
-// ProfileSummary returns a compact profile summary.
+// ProfileSummary returns a compact summary of the profile facts that are
+// still confident enough to recall.
 func (m *MemoryStore) ProfileSummary(ctx context.Context, maxLines int) (string, error) {
 	if m == nil || m.db == nil {
 		return "", fmt.Errorf("memory store not initialized")
@@ -121,12 +171,14 @@ func (m *MemoryStore) ProfileSummary(ctx context.Context, maxLines int) (string,
 	if maxLines <= 0 {
 		maxLines = 5
 	}
+	policy := m.ConfidencePolicy()
 
 	rows, err := m.db.QueryContext(ctx, `
-		SELECT field, value FROM memory_profile
+		SELECT field, value FROM memory_profile t
+		WHERE `+policy.sqlEffective("t", time.Now().Unix())+` >= ?
 		ORDER BY updated_at DESC
 		LIMIT ?
-	`, maxLines)
+	`, policy.Min, maxLines)
 	if err != nil {
 		return "", err
 	}
@@ -143,7 +195,8 @@ func (m *MemoryStore) ProfileSummary(ctx context.Context, maxLines int) (string,
 	return strings.Join(lines, "\n"), nil
 }
 
-// ActionsSummary returns a compact personal actions summary.
+// ActionsSummary returns a compact summary of the learned actions that are
+// still confident enough to recall.
 func (m *MemoryStore) ActionsSummary(ctx context.Context, maxLines int) (string, error) {
 	if m == nil || m.db == nil {
 		return "", fmt.Errorf("memory store not initialized")
@@ -151,12 +204,14 @@ func (m *MemoryStore) ActionsSummary(ctx context.Context, maxLines int) (string,
 	if maxLines <= 0 {
 		maxLines = 5
 	}
+	policy := m.ConfidencePolicy()
 
 	rows, err := m.db.QueryContext(ctx, `
-		SELECT trigger, action FROM memory_actions
+		SELECT trigger, action FROM memory_actions t
+		WHERE `+policy.sqlEffective("t", time.Now().Unix())+` >= ?
 		ORDER BY updated_at DESC
 		LIMIT ?
-	`, maxLines)
+	`, policy.Min, maxLines)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,229 @@
+// Package memory provides the versioned schema migration runner for
+// personal.db and team.db.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration is one forward-only schema change. Each runs in its own
+// transaction and is recorded in schema_migrations.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// MigrationState is a migration and when it was applied.
+type MigrationState struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	AppliedAt   int64  `json:"applied_at,omitempty"` // 0 while pending
+}
+
+// SchemaStatus describes one database's schema version.
+type SchemaStatus struct {
+	Database   string           `json:"database"` // personal or team
+	Path       string           `json:"path"`
+	Current    int              `json:"current"`
+	Latest     int              `json:"latest"`
+	Migrations []MigrationState `json:"migrations"`
+}
+
+// Pending returns the migrations not yet applied.
+func (s SchemaStatus) Pending() []MigrationState {
+	var pending []MigrationState
+	for _, m := range s.Migrations {
+		if m.AppliedAt == 0 && m.Version > s.Current {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// MigrateOptions controls a migration run.
+type MigrateOptions struct {
+	DryRun   bool // Report pending migrations without applying them
+	NoBackup bool // Skip the copy taken before upgrading an existing database
+}
+
+// MigrationResult is what a run did to one database.
+type MigrationResult struct {
+	Database string           `json:"database"`
+	From     int              `json:"from"`
+	To       int              `json:"to"`
+	Applied  []MigrationState `json:"applied,omitempty"`
+	Backup   string           `json:"backup,omitempty"` // Copy taken before migrating
+}
+
+// schemaDB pairs a database with its migrations.
+type schemaDB struct {
+	name       string
+	path       string
+	db         *sql.DB
+	migrations []Migration
+}
+
+func (s *Store) schemaDBs() []schemaDB {
+	return []schemaDB{
+		{name: "personal", path: s.personalPath, db: s.personal, migrations: personalMigrations},
+		{name: "team", path: s.teamPath, db: s.team, migrations: teamMigrations},
+	}
+}
+
+// SchemaStatus reports the applied and pending migrations of both databases.
+func (s *Store) SchemaStatus(ctx context.Context) ([]SchemaStatus, error) {
+	var out []SchemaStatus
+	for _, d := range s.schemaDBs() {
+		status, err := schemaStatus(ctx, d)
+		if err != nil {
+			return nil, fmt.Errorf("%s schema: %w", d.name, err)
+		}
+		out = append(out, *status)
+	}
+	return out, nil
+}
+
+// Migrate applies pending migrations to both databases. An existing
+// database is copied aside before its first pending migration runs.
+func (s *Store) Migrate(ctx context.Context, opts MigrateOptions) ([]MigrationResult, error) {
+	var results []MigrationResult
+	for _, d := range s.schemaDBs() {
+		result, err := migrate(ctx, d, opts)
+		if err != nil {
+			return results, fmt.Errorf("migrate %s: %w", d.name, err)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func migrate(ctx context.Context, d schemaDB, opts MigrateOptions) (*MigrationResult, error) {
+	status, err := schemaStatus(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{Database: d.name, From: status.Current, To: status.Current}
+	if status.Current > status.Latest {
+		return nil, fmt.Errorf("schema version %d is newer than this build supports (%d)", status.Current, status.Latest)
+	}
+
+	pending := status.Pending()
+	if len(pending) == 0 {
+		return result, nil
+	}
+	if opts.DryRun {
+		result.Applied = pending
+		result.To = pending[len(pending)-1].Version
+		return result, nil
+	}
+
+	if status.Current > 0 && !opts.NoBackup {
+		if result.Backup, err = backupBeforeMigrate(ctx, d.db, d.path, status.Current); err != nil {
+			return nil, fmt.Errorf("backup before migrating: %w", err)
+		}
+	}
+
+	for _, m := range d.migrations {
+		if m.Version <= status.Current {
+			continue
+		}
+		state, err := applyMigration(ctx, d.db, m)
+		if err != nil {
+			return result, fmt.Errorf("version %d (%s): %w", m.Version, m.Description, err)
+		}
+		result.Applied = append(result.Applied, *state)
+		result.To = m.Version
+	}
+	return result, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) (*MigrationState, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (version, applied_at, description) VALUES (?, ?, ?)
+	`, m.Version, now, m.Description); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &MigrationState{Version: m.Version, Description: m.Description, AppliedAt: now}, nil
+}
+
+func schemaStatus(ctx context.Context, d schemaDB) (*SchemaStatus, error) {
+	if _, err := d.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			description TEXT
+		)
+	`); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]int64{}
+	current := 0
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+		current = max(current, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := &SchemaStatus{Database: d.name, Path: d.path, Current: current}
+	for _, m := range d.migrations {
+		status.Latest = max(status.Latest, m.Version)
+		status.Migrations = append(status.Migrations, MigrationState{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   applied[m.Version],
+		})
+	}
+	return status, nil
+}
+
+// backupBeforeMigrate copies a database next to itself, named after the
+// version it is being upgraded from. In-memory databases are not copied.
+func backupBeforeMigrate(ctx context.Context, db *sql.DB, path string, version int) (string, error) {
+	if path == "" || path == ":memory:" || strings.HasPrefix(path, "file::memory:") {
+		return "", nil
+	}
+	dest := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// execSchema returns a migration step that runs a block of SQL.
+func execSchema(schema string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(schema)
+		return err
+	}
+}
@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seedDB creates a database from a schema fixture and runs statements
+// against it, standing in for one written by an older build.
+func seedDB(t *testing.T, path, fixture string, statements ...string) {
+	t.Helper()
+	schema, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range append([]string{string(schema)}, statements...) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed %s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+// schemaOf returns every schema object of a database by type and name,
+// with whitespace in its SQL collapsed.
+func schemaOf(t *testing.T, s *Store, team bool) map[string]string {
+	t.Helper()
+	db := s.personal
+	if team {
+		db = s.team
+	}
+	rows, err := db.Query(`SELECT type, name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var typ, name, sql string
+		if err := rows.Scan(&typ, &name, &sql); err != nil {
+			t.Fatal(err)
+		}
+		out[typ+" "+name] = strings.Join(strings.Fields(sql), " ")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// checkUpgraded fails unless both databases are at the latest version and
+// have the same schema as databases created by this build.
+func checkUpgraded(t *testing.T, s *Store) {
+	t.Helper()
+	statuses, err := s.SchemaStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.Current != status.Latest {
+			t.Errorf("%s schema at version %d, want %d", status.Database, status.Current, status.Latest)
+		}
+		if pending := status.Pending(); len(pending) > 0 {
+			t.Errorf("%s schema has %d pending migrations", status.Database, len(pending))
+		}
+	}
+
+	dir := t.TempDir()
+	fresh, err := Open(filepath.Join(dir, "personal.db"), filepath.Join(dir, "team.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	for _, team := range []bool{false, true} {
+		got, want := schemaOf(t, s, team), schemaOf(t, fresh, team)
+		for key, sql := range want {
+			if got[key] != sql {
+				t.Errorf("upgraded %s: got %q, want %q", key, got[key], sql)
+			}
+		}
+		for key := range got {
+			if _, ok := want[key]; !ok {
+				t.Errorf("upgraded database has %s, which a new one lacks", key)
+			}
+		}
+	}
+}
+
+func count(t *testing.T, s *Store, team bool, query string, args ...any) int {
+	t.Helper()
+	db := s.personal
+	if team {
+		db = s.team
+	}
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestMigrateFromVersion1(t *testing.T) {
+	dir := t.TempDir()
+	personal, team := filepath.Join(dir, "personal.db"), filepath.Join(dir, "team.db")
+	seedDB(t, personal, "testdata/v1_personal.sql",
+		`INSERT INTO conversations (id, user_id) VALUES ('c1', 'user-local')`,
+		`INSERT INTO messages (id, conversation_id, role, content) VALUES ('m1', 'c1', 'user', 'I use neovim')`,
+		`INSERT INTO memory_profile (id, field, value) VALUES ('p1', 'editor', 'neovim')`,
+		`INSERT INTO memory_actions (id, trigger, action) VALUES ('a1', 'deploy', 'make deploy')`,
+	)
+	seedDB(t, team, "testdata/v1_team.sql",
+		`INSERT INTO tenants (id, name) VALUES ('default', 'Default Tenant')`,
+		`INSERT INTO team_entities (id, tenant_id, name, entity_type) VALUES ('e1', 'default', 'Postgres', 'technology')`,
+		`INSERT INTO team_doc_chunks (id, tenant_id, document_id, chunk_index, content) VALUES ('k1', 'default', 'd1', 0, 'replication lag alerts')`,
+	)
+
+	s, err := Open(personal, team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkUpgraded(t, s)
+
+	// Rows written by the old build are kept and reach the new indexes
+	if n := count(t, s, false, `SELECT COUNT(*) FROM messages`); n != 1 {
+		t.Errorf("messages: got %d rows, want 1", n)
+	}
+	if n := count(t, s, false, `SELECT COUNT(*) FROM memory_profile_fts WHERE memory_profile_fts MATCH 'neovim'`); n != 1 {
+		t.Errorf("memory_profile_fts: got %d matches, want 1", n)
+	}
+	if n := count(t, s, false, `SELECT COUNT(*) FROM memory_actions_fts WHERE memory_actions_fts MATCH 'deploy'`); n != 1 {
+		t.Errorf("memory_actions_fts: got %d matches, want 1", n)
+	}
+	if n := count(t, s, true, `SELECT COUNT(*) FROM team_entities_fts WHERE team_entities_fts MATCH 'postgres'`); n != 1 {
+		t.Errorf("team_entities_fts: got %d matches, want 1", n)
+	}
+	if n := count(t, s, true, `SELECT COUNT(*) FROM team_doc_chunks_fts WHERE team_doc_chunks_fts MATCH 'replication'`); n != 1 {
+		t.Errorf("team_doc_chunks_fts: got %d matches, want 1", n)
+	}
+	if n := count(t, s, true, `SELECT COUNT(*) FROM team_entity_aliases WHERE entity_id = 'e1'`); n != 1 {
+		t.Errorf("team_entity_aliases: got %d aliases for e1, want 1", n)
+	}
+}
+
+func TestMigrateFromIntermediateVersion(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := OpenUnmigrated(filepath.Join(dir, "personal.db"), filepath.Join(dir, "team.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Stop both databases partway, as a build from between releases would
+	const stopAt = 4
+	for _, d := range s.schemaDBs() {
+		if _, err := schemaStatus(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range d.migrations[:stopAt] {
+			if _, err := applyMigration(ctx, d.db, m); err != nil {
+				t.Fatalf("%s version %d: %v", d.name, m.Version, err)
+			}
+		}
+	}
+	for _, stmt := range []string{
+		`INSERT INTO memory_profile (id, field, value) VALUES ('p1', 'editor', 'neovim')`,
+		`INSERT INTO memory_archive (id, kind, original_id, subject, content, updated_at, reason) VALUES ('r1', 'profile', 'p0', 'editor', 'vim', 1, 'superseded')`,
+	} {
+		if _, err := s.personal.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, stmt := range []string{
+		`INSERT INTO tenants (id, name) VALUES ('default', 'Default Tenant')`,
+		`INSERT INTO team_entities (id, tenant_id, name, entity_type) VALUES ('e1', 'default', 'Postgres', 'technology')`,
+		`INSERT INTO team_relations (id, tenant_id, source_id, target_id, relation_type, metadata_json)
+			VALUES ('r1', 'default', 'e1', 'e1', 'depends_on', '{"document": "d1"}')`,
+	} {
+		if _, err := s.team.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := s.Migrate(ctx, MigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.From != stopAt {
+			t.Errorf("%s migrated from version %d, want %d", r.Database, r.From, stopAt)
+		}
+		if r.Backup == "" {
+			t.Errorf("%s was not backed up before migrating", r.Database)
+		} else if _, err := os.Stat(r.Backup); err != nil {
+			t.Errorf("%s backup: %v", r.Database, err)
+		}
+	}
+	checkUpgraded(t, s)
+
+	if n := count(t, s, false, `SELECT COUNT(*) FROM memory_archive WHERE pinned = 0`); n != 1 {
+		t.Errorf("memory_archive: got %d unpinned rows, want 1", n)
+	}
+	if n := count(t, s, false, `SELECT COUNT(*) FROM memory_profile WHERE reinforced = 0 AND contradicted = 0`); n != 1 {
+		t.Errorf("memory_profile: got %d rows with lifecycle counters, want 1", n)
+	}
+	if n := count(t, s, true, `SELECT COUNT(*) FROM team_relation_sources WHERE relation_id = 'r1' AND document_id = 'd1'`); n != 1 {
+		t.Errorf("team_relation_sources: got %d sources for r1, want 1", n)
+	}
+}
@@ -0,0 +1,184 @@
+// Package memory provides provenance tracking and version history for memories.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Memory sources recorded with each write.
+const (
+	SourceLLM           = "llm"           // LLMExtractor
+	SourceRouter        = "router"        // MemoryRouter regex rules
+	SourceManual        = "manual"        // Edited by the user
+	SourceConsolidation = "consolidation" // Merged or summarized by Consolidate
+	SourceRestore       = "restore"       // Restored from an earlier version
+	SourceUnknown       = "unknown"
+)
+
+// maxSnippetLen bounds the conversation snippet kept with each version.
+const maxSnippetLen = 280
+
+// ErrVersionNotFound is returned when a memory version does not exist.
+var ErrVersionNotFound = fmt.Errorf("memory version not found")
+
+// Provenance describes where a memory write came from.
+type Provenance struct {
+	Source    string // SourceLLM, SourceRouter, ...
+	MessageID string // Message the fact was extracted from
+	Snippet   string // Text of that message
+}
+
+// MemoryVersion is one recorded write to a profile field or action.
+type MemoryVersion struct {
+	ID              string  `json:"id"`
+	Kind            string  `json:"kind"` // profile or action
+	MemoryID        string  `json:"memory_id"`
+	Subject         string  `json:"subject"` // field or trigger
+	Content         string  `json:"content"` // value or action
+	Confidence      float64 `json:"confidence"`
+	Source          string  `json:"source"`
+	SourceMessageID string  `json:"source_message_id,omitempty"`
+	Snippet         string  `json:"snippet,omitempty"`
+	CreatedAt       int64   `json:"created_at"`
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// recordVersion appends a write to memory_versions.
+func recordVersion(ctx context.Context, db execer, kind, memoryID, subject, content string, confidence float64, prov Provenance) error {
+	source := prov.Source
+	if source == "" {
+		source = SourceUnknown
+	}
+	var messageID, snippet any
+	if prov.MessageID != "" {
+		messageID = prov.MessageID
+	}
+	if s := strings.TrimSpace(prov.Snippet); s != "" {
+		snippet = truncateText(s, maxSnippetLen)
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO memory_versions (id, kind, memory_id, subject, content, confidence, source, source_message_id, snippet, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, uuid.New().String(), kind, memoryID, subject, content, confidence, source, messageID, snippet, time.Now().Unix())
+	return err
+}
+
+// History returns every recorded version of a profile field or action
+// trigger, newest first. kind is "profile" or "action".
+func (m *MemoryStore) History(ctx context.Context, kind, subject string) ([]MemoryVersion, error) {
+	if m == nil || m.db == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+versionColumns+`
+		FROM memory_versions
+		WHERE kind = ? AND subject = ?
+		ORDER BY created_at DESC, rowid DESC
+	`, kind, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MemoryVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+// GetVersion returns a version by ID or unique ID prefix.
+func (m *MemoryStore) GetVersion(ctx context.Context, id string) (*MemoryVersion, error) {
+	if m == nil || m.db == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	if id == "" {
+		return nil, ErrVersionNotFound
+	}
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+versionColumns+`
+		FROM memory_versions
+		WHERE id = ? OR id LIKE ?
+		LIMIT 2
+	`, id, id+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found []*MemoryVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		if v.ID == id {
+			return v, nil
+		}
+		found = append(found, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, ErrVersionNotFound
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("version ID prefix %q is ambiguous", id)
+	}
+}
+
+// Restore makes an earlier version the current value. The original
+// provenance is carried over so "why" still points at the source message.
+func (m *MemoryStore) Restore(ctx context.Context, versionID string) (*MemoryVersion, error) {
+	v, err := m.GetVersion(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+	prov := Provenance{Source: SourceRestore, MessageID: v.SourceMessageID, Snippet: v.Snippet}
+	switch v.Kind {
+	case "profile":
+		err = m.UpsertProfileFieldFrom(ctx, v.Subject, v.Content, v.Confidence, prov)
+	case "action":
+		err = m.UpsertActionFrom(ctx, v.Subject, v.Content, v.Confidence, prov)
+	default:
+		err = fmt.Errorf("unknown memory kind %q", v.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+const versionColumns = `id, kind, memory_id, subject, content, confidence, source,
+	COALESCE(source_message_id, ''), COALESCE(snippet, ''), created_at`
+
+func scanVersion(row rowScanner) (*MemoryVersion, error) {
+	var v MemoryVersion
+	if err := row.Scan(&v.ID, &v.Kind, &v.MemoryID, &v.Subject, &v.Content, &v.Confidence,
+		&v.Source, &v.SourceMessageID, &v.Snippet, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
@@ -0,0 +1,797 @@
+// Package memory provides entity resolution for the knowledge graph: aliases,
+// duplicate detection and merging.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// genericEntityTypes are types that say little about what an entity is. An
+// entity of a generic type resolves to an existing one of any type.
+var genericEntityTypes = map[string]bool{
+	"":            true,
+	"unknown":     true,
+	"concept":     true,
+	"entity":      true,
+	"thing":       true,
+	"proper_noun": true,
+}
+
+// IsGenericType reports whether an entity type says little about what the
+// entity is.
+func IsGenericType(entityType string) bool {
+	return genericEntityTypes[strings.ToLower(entityType)]
+}
+
+// identifierEntityTypes are the types of entities recorded from code, whose
+// names are identifiers: "Query.compile" and "Query.Compile" are different
+// things, as are the packages "tool" and "tools". They are matched only by
+// exact name and type, and never offered as duplicates.
+var identifierEntityTypes = map[string]bool{
+	"package":   true,
+	"file":      true,
+	"type":      true,
+	"interface": true,
+	"function":  true,
+	"method":    true,
+}
+
+// NormalizeName returns the key names are matched by: lowercase letters and
+// digits only, so "PostgreSQL", "postgresql" and "Postgre-SQL" are equal.
+func NormalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// AddAlias records another name for an entity.
+func (g *GraphStore) AddAlias(ctx context.Context, tenantID, entityID, alias string) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+	if NormalizeName(alias) == "" {
+		return fmt.Errorf("alias %q has no letters or digits", alias)
+	}
+	return addAlias(ctx, g.db, tenantID, entityID, alias)
+}
+
+func addAlias(ctx context.Context, db execer, tenantID, entityID, alias string) error {
+	key := NormalizeName(alias)
+	if key == "" {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO team_entity_aliases (tenant_id, normalized, entity_id, alias, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, tenantID, key, entityID, strings.TrimSpace(alias), time.Now().Unix())
+	return err
+}
+
+// Aliases returns the names an entity is known by, other than its own.
+func (g *GraphStore) Aliases(ctx context.Context, tenantID, entityID string) ([]string, error) {
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT a.alias FROM team_entity_aliases a
+		JOIN team_entities e ON e.id = a.entity_id
+		WHERE a.tenant_id = ? AND a.entity_id = ? AND a.alias <> e.name
+		ORDER BY a.created_at
+	`, tenantID, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		out = append(out, alias)
+	}
+	return out, rows.Err()
+}
+
+// AliasMap returns the aliases of every entity of a tenant that has any,
+// by entity ID; see Aliases.
+func (g *GraphStore) AliasMap(ctx context.Context, tenantID string) (map[string][]string, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT a.entity_id, a.alias FROM team_entity_aliases a
+		JOIN team_entities e ON e.id = a.entity_id
+		WHERE a.tenant_id = ? AND a.alias <> e.name
+		ORDER BY a.created_at
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string][]string{}
+	for rows.Next() {
+		var id, alias string
+		if err := rows.Scan(&id, &alias); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], alias)
+	}
+	return out, rows.Err()
+}
+
+// LookupEntities returns the entities whose name or an alias normalizes to
+// the same key as name, most important first.
+func (g *GraphStore) LookupEntities(ctx context.Context, tenantID, name string) ([]*Entity, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	key := NormalizeName(name)
+	if key == "" {
+		return nil, nil
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT DISTINCT e.id, e.tenant_id, e.name, e.entity_type, e.description, e.metadata_json, e.embedding_id, e.importance, e.created_at, e.updated_at
+		FROM team_entity_aliases a
+		JOIN team_entities e ON e.id = a.entity_id
+		WHERE a.tenant_id = ? AND a.normalized = ?
+		ORDER BY e.importance DESC, e.updated_at DESC
+	`, tenantID, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Entity
+	for rows.Next() {
+		var e Entity
+		if err := rows.Scan(
+			&e.ID, &e.TenantID, &e.Name, &e.EntityType, &e.Description, &e.MetadataJSON,
+			&e.EmbeddingID, &e.Importance, &e.CreatedAt, &e.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
+
+// ResolveEntity returns the existing entity a name and type refer to, or nil.
+// A name matches through its aliases; an entity of the same type wins, and
+// when either type is generic an entity of any type does. Code entities
+// match only their exact name and type.
+func (g *GraphStore) ResolveEntity(ctx context.Context, tenantID, name, entityType string) (*Entity, error) {
+	name = strings.TrimSpace(name)
+	if identifierEntityTypes[entityType] {
+		return g.FindEntityByName(ctx, tenantID, name, entityType)
+	}
+	found, err := g.LookupEntities(ctx, tenantID, name)
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	found = slices.DeleteFunc(found, func(e *Entity) bool {
+		return identifierEntityTypes[e.EntityType] && e.Name != name
+	})
+	for _, e := range found {
+		if strings.EqualFold(e.EntityType, entityType) {
+			return e, nil
+		}
+	}
+	if genericEntityTypes[strings.ToLower(entityType)] {
+		return found[0], nil
+	}
+	for _, e := range found {
+		if genericEntityTypes[strings.ToLower(e.EntityType)] {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// ResolveOrCreateEntity returns the existing entity the given one refers to,
+// filling in its description when it has none, or creates it.
+func (g *GraphStore) ResolveOrCreateEntity(ctx context.Context, tenantID string, entity *Entity) (*Entity, error) {
+	existing, err := g.ResolveEntity(ctx, tenantID, entity.Name, entity.EntityType)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return g.UpsertEntity(ctx, tenantID, entity)
+	}
+
+	if existing.Description == "" && entity.Description != "" {
+		existing.Description = entity.Description
+	}
+	existing.UpdatedAt = time.Now().Unix()
+	if _, err := g.db.ExecContext(ctx, `
+		UPDATE team_entities SET description = ?, updated_at = ? WHERE tenant_id = ? AND id = ?
+	`, existing.Description, existing.UpdatedAt, tenantID, existing.ID); err != nil {
+		return nil, err
+	}
+	if err := addAlias(ctx, g.db, tenantID, existing.ID, entity.Name); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// AddMentions records that entities were extracted from a document.
+func (g *GraphStore) AddMentions(ctx context.Context, tenantID, documentID string, entityIDs []string) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+	return addMentions(ctx, g.db, tenantID, documentID, entityIDs)
+}
+
+func addMentions(ctx context.Context, db execer, tenantID, documentID string, entityIDs []string) error {
+	now := time.Now().Unix()
+	for _, id := range entityIDs {
+		if _, err := db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO team_entity_mentions (tenant_id, entity_id, document_id, created_at)
+			VALUES (?, ?, ?, ?)
+		`, tenantID, id, documentID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================
+// Document Facts
+// ============================================================
+
+// ReplaceDocumentFacts makes entityIDs the entities a document mentions and
+// relationIDs the relations it asserts. Relations and entities the document
+// no longer refers to are deleted once no document refers to them, entities
+// with their relations. It returns how many entities and relations were
+// removed.
+func (g *GraphStore) ReplaceDocumentFacts(ctx context.Context, tenantID, documentID string, entityIDs, relationIDs []string) (int, int, error) {
+	if g == nil || g.db == nil {
+		return 0, 0, fmt.Errorf("graph store not initialized")
+	}
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	entities, relations, err := replaceDocumentFacts(ctx, tx, tenantID, documentID, entityIDs, relationIDs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return entities, relations, tx.Commit()
+}
+
+// DeleteDocument deletes a document with its chunks and retracts its facts
+// as ReplaceDocumentFacts does.
+func (g *GraphStore) DeleteDocument(ctx context.Context, tenantID, documentID string) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, _, err := replaceDocumentFacts(ctx, tx, tenantID, documentID, nil, nil); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM team_doc_chunks WHERE tenant_id = ? AND document_id = ?`, tenantID, documentID); err != nil {
+		return fmt.Errorf("delete document chunks: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM team_documents WHERE tenant_id = ? AND id = ?`, tenantID, documentID); err != nil {
+		return fmt.Errorf("delete document: %w", err)
+	}
+	return tx.Commit()
+}
+
+func replaceDocumentFacts(ctx context.Context, tx *sql.Tx, tenantID, documentID string, entityIDs, relationIDs []string) (int, int, error) {
+	keepEntities, err := json.Marshal(nonNil(entityIDs))
+	if err != nil {
+		return 0, 0, err
+	}
+	keepRelations, err := json.Marshal(nonNil(relationIDs))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Facts the document stops asserting may now have no source at all
+	droppedRelations, err := queryIDs(ctx, tx, `
+		SELECT relation_id FROM team_relation_sources
+		WHERE tenant_id = ? AND document_id = ? AND relation_id NOT IN (SELECT value FROM json_each(?))
+	`, tenantID, documentID, string(keepRelations))
+	if err != nil {
+		return 0, 0, err
+	}
+	droppedEntities, err := queryIDs(ctx, tx, `
+		SELECT entity_id FROM team_entity_mentions
+		WHERE tenant_id = ? AND document_id = ? AND entity_id NOT IN (SELECT value FROM json_each(?))
+	`, tenantID, documentID, string(keepEntities))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM team_relation_sources
+		  WHERE tenant_id = ? AND document_id = ? AND relation_id NOT IN (SELECT value FROM json_each(?))`,
+			[]any{tenantID, documentID, string(keepRelations)}},
+		{`INSERT OR IGNORE INTO team_relation_sources (tenant_id, relation_id, document_id)
+		  SELECT ?, value, ? FROM json_each(?)`,
+			[]any{tenantID, documentID, string(keepRelations)}},
+		{`DELETE FROM team_entity_mentions
+		  WHERE tenant_id = ? AND document_id = ? AND entity_id NOT IN (SELECT value FROM json_each(?))`,
+			[]any{tenantID, documentID, string(keepEntities)}},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := addMentions(ctx, tx, tenantID, documentID, entityIDs); err != nil {
+		return 0, 0, err
+	}
+
+	removedRelations := 0
+	if len(droppedRelations) > 0 {
+		dropped, err := json.Marshal(droppedRelations)
+		if err != nil {
+			return 0, 0, err
+		}
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM team_relations
+			WHERE tenant_id = ? AND id IN (SELECT value FROM json_each(?))
+			  AND id NOT IN (SELECT relation_id FROM team_relation_sources WHERE tenant_id = ?)
+		`, tenantID, string(dropped), tenantID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("retract relations: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		removedRelations += int(n)
+	}
+	if len(droppedEntities) == 0 {
+		return 0, removedRelations, nil
+	}
+
+	orphans, err := json.Marshal(droppedEntities)
+	if err != nil {
+		return 0, 0, err
+	}
+	const orphaned = `
+		SELECT value FROM json_each(?)
+		WHERE value NOT IN (SELECT entity_id FROM team_entity_mentions WHERE tenant_id = ?)`
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM team_relations
+		WHERE tenant_id = ? AND (source_id IN (`+orphaned+`) OR target_id IN (`+orphaned+`))
+	`, tenantID, string(orphans), tenantID, string(orphans), tenantID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete orphaned relations: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	removedRelations += int(n)
+
+	res, err = tx.ExecContext(ctx, `
+		DELETE FROM team_entities WHERE tenant_id = ? AND id IN (`+orphaned+`)
+	`, tenantID, string(orphans), tenantID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete orphaned entities: %w", err)
+	}
+	removedEntities, _ := res.RowsAffected()
+	return int(removedEntities), removedRelations, nil
+}
+
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func nonNil(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+	return ids
+}
+
+// ============================================================
+// Duplicate Detection
+// ============================================================
+
+// DuplicateCandidate is a pair of entities that may be the same thing.
+type DuplicateCandidate struct {
+	A      *Entity
+	B      *Entity
+	Score  float64 // 0-1; 1 when their names normalize the same
+	Reason string
+}
+
+// maxDedupeEntities bounds how many entities a duplicate scan compares.
+const maxDedupeEntities = 5000
+
+// DuplicateCandidates returns pairs of entities whose names match after
+// normalization, one name extends the other ("Postgres", "PostgreSQL"), or
+// are spelled alike, best first. Pairs marked distinct and code entities are
+// left out.
+func (g *GraphStore) DuplicateCandidates(ctx context.Context, tenantID string, minScore float64, limit int) ([]DuplicateCandidate, error) {
+	entities, err := g.dedupeEntities(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	distinct, err := g.distinctPairs(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]string, len(entities))
+	for _, e := range entities {
+		keys[e.ID] = []string{NormalizeName(e.Name)}
+	}
+	rows, err := g.db.QueryContext(ctx, `SELECT entity_id, normalized FROM team_entity_aliases WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := keys[id]; ok && key != keys[id][0] {
+			keys[id] = append(keys[id], key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Only names sharing their first two characters are compared
+	blocks := map[string][]*Entity{}
+	for _, e := range entities {
+		seen := map[string]bool{}
+		for _, key := range keys[e.ID] {
+			block := string([]rune(key)[:min(2, len([]rune(key)))])
+			if !seen[block] {
+				seen[block] = true
+				blocks[block] = append(blocks[block], e)
+			}
+		}
+	}
+
+	best := map[[2]string]DuplicateCandidate{}
+	for _, block := range blocks {
+		for i, a := range block {
+			for _, b := range block[i+1:] {
+				pair := orderedPair(a.ID, b.ID)
+				if distinct[pair] {
+					continue
+				}
+				score, reason := nameSimilarity(keys[a.ID], keys[b.ID])
+				if score < minScore || score <= best[pair].Score {
+					continue
+				}
+				best[pair] = DuplicateCandidate{A: a, B: b, Score: score, Reason: reason}
+			}
+		}
+	}
+
+	out := make([]DuplicateCandidate, 0, len(best))
+	for _, c := range best {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].A.Name < out[j].A.Name
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// dedupeEntities returns the most recently updated entities a duplicate scan
+// compares: all but code entities.
+func (g *GraphStore) dedupeEntities(ctx context.Context, tenantID string) ([]*Entity, error) {
+	types := make([]string, 0, len(identifierEntityTypes))
+	for t := range identifierEntityTypes {
+		types = append(types, t)
+	}
+	excluded, err := json.Marshal(types)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT id, tenant_id, name, entity_type, description, metadata_json, embedding_id, importance, created_at, updated_at
+		FROM team_entities
+		WHERE tenant_id = ? AND entity_type NOT IN (SELECT value FROM json_each(?))
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`, tenantID, string(excluded), maxDedupeEntities)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Entity
+	for rows.Next() {
+		var e Entity
+		if err := rows.Scan(
+			&e.ID, &e.TenantID, &e.Name, &e.EntityType, &e.Description, &e.MetadataJSON,
+			&e.EmbeddingID, &e.Importance, &e.CreatedAt, &e.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
+
+// nameSimilarity scores the closest pair of keys from two entities.
+func nameSimilarity(a, b []string) (float64, string) {
+	var score float64
+	var reason string
+	for _, x := range a {
+		for _, y := range b {
+			s, r := keySimilarity(x, y)
+			if s > score {
+				score, reason = s, r
+			}
+		}
+	}
+	return score, reason
+}
+
+func keySimilarity(a, b string) (float64, string) {
+	if a == "" || b == "" {
+		return 0, ""
+	}
+	if a == b {
+		return 1, "same name"
+	}
+	ra, rb := []rune(a), []rune(b)
+	short, long := ra, rb
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	if len(short) >= 4 && strings.HasPrefix(string(long), string(short)) {
+		return 0.7 + 0.25*float64(len(short))/float64(len(long)), "one name extends the other"
+	}
+	dist := levenshtein(ra, rb)
+	return 1 - float64(dist)/float64(len(long)), "similar spelling"
+}
+
+func orderedPair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+func (g *GraphStore) distinctPairs(ctx context.Context, tenantID string) (map[[2]string]bool, error) {
+	rows, err := g.db.QueryContext(ctx, `SELECT entity_a, entity_b FROM team_entity_distinct WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[[2]string]bool{}
+	for rows.Next() {
+		var a, b string
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, err
+		}
+		out[[2]string{a, b}] = true
+	}
+	return out, rows.Err()
+}
+
+// MarkDistinct records that two entities are different things, so they are
+// no longer offered as duplicates.
+func (g *GraphStore) MarkDistinct(ctx context.Context, tenantID, a, b string) error {
+	if g == nil || g.db == nil {
+		return fmt.Errorf("graph store not initialized")
+	}
+	if a == b {
+		return fmt.Errorf("an entity cannot be distinct from itself")
+	}
+	pair := orderedPair(a, b)
+	_, err := g.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO team_entity_distinct (tenant_id, entity_a, entity_b, created_at)
+		VALUES (?, ?, ?, ?)
+	`, tenantID, pair[0], pair[1], time.Now().Unix())
+	return err
+}
+
+// ============================================================
+// Merging
+// ============================================================
+
+// MergeEntities folds drop into keep: drop's relations, document mentions
+// and aliases move to keep, its name becomes an alias, keep gains its
+// description if it has none, and drop is deleted.
+func (g *GraphStore) MergeEntities(ctx context.Context, tenantID, keepID, dropID string) (*Entity, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	if keepID == dropID {
+		return nil, fmt.Errorf("cannot merge an entity into itself")
+	}
+	keep, err := g.GetEntityByID(ctx, tenantID, keepID)
+	if err != nil {
+		return nil, err
+	}
+	drop, err := g.GetEntityByID(ctx, tenantID, dropID)
+	if err != nil {
+		return nil, err
+	}
+	if keep == nil || drop == nil {
+		return nil, fmt.Errorf("entity not found")
+	}
+
+	tx, err := g.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := mergeRelations(ctx, tx, tenantID, keepID, dropID); err != nil {
+		return nil, fmt.Errorf("merge %s into %s: %w", drop.Name, keep.Name, err)
+	}
+
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE OR IGNORE team_entity_mentions SET entity_id = ? WHERE tenant_id = ? AND entity_id = ?`, []any{keepID, tenantID, dropID}},
+		{`UPDATE OR IGNORE team_entity_aliases SET entity_id = ? WHERE tenant_id = ? AND entity_id = ?`, []any{keepID, tenantID, dropID}},
+		{`UPDATE team_entities SET
+			description = COALESCE(NULLIF(description, ''), ?),
+			importance = MAX(COALESCE(importance, 0), ?),
+			updated_at = ?
+		  WHERE tenant_id = ? AND id = ?`, []any{drop.Description, drop.Importance, time.Now().Unix(), tenantID, keepID}},
+		// Deleting drop also clears its leftover aliases, mentions and reviews
+		{`DELETE FROM team_entities WHERE tenant_id = ? AND id = ?`, []any{tenantID, dropID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return nil, fmt.Errorf("merge %s into %s: %w", drop.Name, keep.Name, err)
+		}
+	}
+	if err := addAlias(ctx, tx, tenantID, keepID, drop.Name); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return g.GetEntityByID(ctx, tenantID, keepID)
+}
+
+// mergeRelations moves drop's relations to keep. A relation keep already has
+// takes the higher confidence of the two; one between keep and drop is
+// deleted rather than becoming a loop.
+func mergeRelations(ctx context.Context, tx *sql.Tx, tenantID, keepID, dropID string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, source_id, target_id, relation_type, COALESCE(confidence, 1)
+		FROM team_relations
+		WHERE tenant_id = ? AND (source_id = ? OR target_id = ?)
+	`, tenantID, dropID, dropID)
+	if err != nil {
+		return err
+	}
+	var relations []Relation
+	for rows.Next() {
+		var r Relation
+		if err := rows.Scan(&r.ID, &r.SourceID, &r.TargetID, &r.RelationType, &r.Confidence); err != nil {
+			rows.Close()
+			return err
+		}
+		relations = append(relations, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, r := range relations {
+		if r.SourceID == dropID {
+			r.SourceID = keepID
+		}
+		if r.TargetID == dropID {
+			r.TargetID = keepID
+		}
+		if r.SourceID == r.TargetID {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM team_relations WHERE id = ?`, r.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE team_relations SET confidence = MAX(COALESCE(confidence, 1), ?), updated_at = ?
+			WHERE tenant_id = ? AND source_id = ? AND target_id = ? AND relation_type = ? AND id <> ?
+		`, r.Confidence, now, tenantID, r.SourceID, r.TargetID, r.RelationType, r.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE OR IGNORE team_relation_sources SET relation_id = (
+					SELECT id FROM team_relations
+					WHERE tenant_id = ? AND source_id = ? AND target_id = ? AND relation_type = ? AND id <> ?
+				) WHERE tenant_id = ? AND relation_id = ?
+			`, tenantID, r.SourceID, r.TargetID, r.RelationType, r.ID, tenantID, r.ID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM team_relations WHERE id = ?`, r.ID)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE team_relations SET source_id = ?, target_id = ?, updated_at = ? WHERE id = ?`, r.SourceID, r.TargetID, now, r.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillAliases gives every existing entity its own name as an alias.
+func backfillAliases(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, tenant_id, name FROM team_entities`)
+	if err != nil {
+		return err
+	}
+	type named struct{ id, tenant, name string }
+	var all []named
+	for rows.Next() {
+		var n named
+		if err := rows.Scan(&n.id, &n.tenant, &n.name); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, n := range all {
+		if err := addAlias(context.Background(), tx, n.tenant, n.id, n.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountRelations returns how many relations an entity takes part in.
+func (g *GraphStore) CountRelations(ctx context.Context, tenantID, entityID string) (int, error) {
+	var n int
+	err := g.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM team_relations WHERE tenant_id = ? AND (source_id = ? OR target_id = ?)
+	`, tenantID, entityID, entityID).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,393 @@
+// Package memory provides retention policies that purge old conversations,
+// conversation documents, plan execution records and archived memories.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Retention data classes.
+const (
+	RetainMessages  = "messages"  // messages and team_messages
+	RetainDocuments = "documents" // Chat turns ingested into the graph as documents
+	RetainAudit     = "audit"     // Plan execution records, one per plan run
+	RetainArchive   = "archive"   // Memories archived by consolidation
+)
+
+// RetentionClasses lists the data classes in purge order.
+var RetentionClasses = []string{RetainMessages, RetainDocuments, RetainAudit, RetainArchive}
+
+// RetentionPolicy limits how much of a data class is kept. Pinned items
+// are never purged and do not count towards MaxBytes.
+type RetentionPolicy struct {
+	MaxAgeDays int   // Older items are purged; 0 keeps them regardless of age
+	MaxBytes   int64 // Oldest items beyond this size are purged; 0 means no cap
+}
+
+// RetentionOptions controls a purge.
+type RetentionOptions struct {
+	Policies    map[string]RetentionPolicy            // By data class; missing classes are kept
+	Tenants     map[string]map[string]RetentionPolicy // Tenant ID -> class -> policy for team data
+	VacuumPages int                                   // Free pages reclaimed per run; 0 reclaims all
+	Compact     bool                                  // Fully VACUUM databases not yet in incremental mode
+	DryRun      bool                                  // Report what would be purged
+}
+
+// PurgeReport lists what a purge removed.
+type PurgeReport struct {
+	DryRun      bool          `json:"dry_run"`
+	Purged      []PurgedItems `json:"purged,omitempty"`
+	Reclaimed   int64         `json:"reclaimed_bytes"`       // File space released by VACUUM
+	Uncompacted []string      `json:"uncompacted,omitempty"` // Databases whose free pages need a full VACUUM to release
+}
+
+// PurgedItems counts the rows purged from one class in one database.
+type PurgedItems struct {
+	Class    string `json:"class"`
+	Database string `json:"database"` // personal or team
+	Tenant   string `json:"tenant,omitempty"`
+	Rows     int    `json:"rows"`
+	Bytes    int64  `json:"bytes"` // Approximate content size
+}
+
+// Rows returns the total rows purged.
+func (r *PurgeReport) Rows() int {
+	n := 0
+	for _, p := range r.Purged {
+		n += p.Rows
+	}
+	return n
+}
+
+// retentionTable describes where a data class lives.
+type retentionTable struct {
+	class    string
+	database string // personal or team
+	table    string
+	time     string // Age column
+	size     string // Approximate row size in bytes
+	keep     string // Rows matching this are never purged
+	scope    string // Restricts the table to the class; empty for all rows
+	children string // Deletes dependent rows; %s is replaced by the purged ids
+	cleanup  string // Runs after a purge, e.g. to drop emptied conversations
+}
+
+var retentionTables = []retentionTable{
+	{
+		class: RetainMessages, database: "personal", table: "messages", time: "created_at",
+		size:    "length(content) + COALESCE(length(metadata_json), 0)",
+		keep:    "pinned = 1 OR conversation_id IN (SELECT id FROM conversations WHERE pinned = 1)",
+		cleanup: "DELETE FROM conversations WHERE pinned = 0 AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.conversation_id = conversations.id)",
+	},
+	{
+		class: RetainMessages, database: "team", table: "team_messages", time: "created_at",
+		size:    "length(content) + COALESCE(length(metadata_json), 0)",
+		keep:    "pinned = 1 OR conversation_id IN (SELECT id FROM team_conversations WHERE pinned = 1)",
+		cleanup: "DELETE FROM team_conversations WHERE pinned = 0 AND NOT EXISTS (SELECT 1 FROM team_messages m WHERE m.conversation_id = team_conversations.id)",
+	},
+	{
+		class: RetainDocuments, database: "team", table: "team_documents", time: "updated_at",
+		size:     "COALESCE(size_bytes, 0) + COALESCE(length(content_preview), 0)",
+		keep:     "pinned = 1",
+		scope:    "path LIKE 'message://%'",
+		children: "DELETE FROM team_doc_chunks WHERE document_id IN (%s)",
+	},
+	{
+		class: RetainAudit, database: "team", table: "team_plan_executions", time: "started_at",
+		size: "COALESCE(length(steps_json), 0) + COALESCE(length(variables_json), 0) + COALESCE(length(error_message), 0)",
+		keep: "pinned = 1",
+	},
+	{
+		class: RetainArchive, database: "personal", table: "memory_archive", time: "archived_at",
+		size: "length(subject) + length(content)",
+		keep: "pinned = 1",
+	},
+}
+
+// Purge deletes data older or larger than its retention policy, then
+// reclaims free pages with an incremental VACUUM. Team data is purged per
+// tenant, using the tenant's overrides where set. A database created before
+// incremental auto-vacuum was enabled keeps its free pages for reuse, and is
+// listed in Uncompacted, unless Compact is set.
+func (s *Store) Purge(ctx context.Context, opts RetentionOptions) (*PurgeReport, error) {
+	report := &PurgeReport{DryRun: opts.DryRun}
+	now := time.Now()
+	dbs := map[string]*sql.DB{"personal": s.personal, "team": s.team}
+
+	for _, class := range RetentionClasses {
+		for _, t := range retentionTables {
+			if t.class != class {
+				continue
+			}
+			db := dbs[t.database]
+			if t.database == "personal" {
+				p, ok := opts.Policies[class]
+				if !ok {
+					continue
+				}
+				items, err := purgeTable(ctx, db, t, p, "", now, opts.DryRun)
+				if err != nil {
+					return report, fmt.Errorf("purge %s: %w", t.table, err)
+				}
+				report.add(items)
+				continue
+			}
+
+			tenants, err := tenantIDs(ctx, db, t.table)
+			if err != nil {
+				return report, err
+			}
+			for _, tenant := range tenants {
+				p, ok := opts.Policies[class]
+				if override, found := opts.Tenants[tenant][class]; found {
+					p, ok = override, true
+				}
+				if !ok {
+					continue
+				}
+				items, err := purgeTable(ctx, db, t, p, tenant, now, opts.DryRun)
+				if err != nil {
+					return report, fmt.Errorf("purge %s for %s: %w", t.table, tenant, err)
+				}
+				report.add(items)
+			}
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	for _, name := range []string{"personal", "team"} {
+		reclaimed, ok, err := incrementalVacuum(ctx, dbs[name], opts.VacuumPages, opts.Compact)
+		if err != nil {
+			return report, fmt.Errorf("vacuum %s: %w", name, err)
+		}
+		if !ok {
+			report.Uncompacted = append(report.Uncompacted, name)
+		}
+		report.Reclaimed += reclaimed
+	}
+	return report, nil
+}
+
+func (r *PurgeReport) add(items *PurgedItems) {
+	if items != nil && items.Rows > 0 {
+		r.Purged = append(r.Purged, *items)
+	}
+}
+
+// purgeTable removes the rows of one table, or one tenant's rows, that
+// fall outside policy: first everything older than MaxAgeDays, then the
+// oldest rows until the rest fit in MaxBytes.
+func purgeTable(ctx context.Context, db *sql.DB, t retentionTable, p RetentionPolicy, tenant string, now time.Time, dryRun bool) (*PurgedItems, error) {
+	if p.MaxAgeDays <= 0 && p.MaxBytes <= 0 {
+		return nil, nil
+	}
+	cutoff := int64(0)
+	if p.MaxAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -p.MaxAgeDays).Unix()
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = math.MaxInt64
+	}
+
+	where := []string{"NOT (" + t.keep + ")"}
+	args := []any{}
+	if t.scope != "" {
+		where = append(where, t.scope)
+	}
+	if tenant != "" {
+		where = append(where, "tenant_id = ?")
+		args = append(args, tenant)
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, size FROM (
+			SELECT id, `+t.time+` AS at, `+t.size+` AS size,
+				SUM(`+t.size+`) OVER (ORDER BY `+t.time+` DESC, id DESC) AS running
+			FROM `+t.table+`
+			WHERE `+strings.Join(where, " AND ")+`
+		)
+		WHERE at < ? OR running > ?
+	`, append(args, cutoff, maxBytes)...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []any
+	items := &PurgedItems{Class: t.class, Database: t.database, Tenant: tenant}
+	for rows.Next() {
+		var id string
+		var size int64
+		if err := rows.Scan(&id, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		items.Rows++
+		items.Bytes += size
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 || dryRun {
+		return items, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	const batch = 500
+	for start := 0; start < len(ids); start += batch {
+		chunk := ids[start:min(start+batch, len(ids))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+		if t.children != "" {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(t.children, placeholders), chunk...); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+t.table+` WHERE id IN (`+placeholders+`)`, chunk...); err != nil {
+			return nil, err
+		}
+	}
+	if t.cleanup != "" {
+		if _, err := tx.ExecContext(ctx, t.cleanup); err != nil {
+			return nil, err
+		}
+	}
+	return items, tx.Commit()
+}
+
+// tenantIDs returns the tenants with rows in a team table.
+func tenantIDs(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT tenant_id FROM `+table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// incrementalVacuum releases up to pages free pages (all when pages <= 0)
+// and returns the bytes given back to the file system. A database created
+// before incremental auto-vacuum was enabled can only be converted by a full
+// VACUUM, which rewrites the whole file and blocks writers while it runs;
+// that happens once, and only when convert is set. ok is false when the
+// database was left unconverted.
+func incrementalVacuum(ctx context.Context, db *sql.DB, pages int, convert bool) (reclaimed int64, ok bool, err error) {
+	// auto_vacuum and VACUUM must run on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	pageCount := func() (int64, error) {
+		var n int64
+		err := conn.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&n)
+		return n, err
+	}
+	var pageSize, mode int64
+	if err := conn.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, false, err
+	}
+	if err := conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		return 0, false, err
+	}
+	before, err := pageCount()
+	if err != nil {
+		return 0, false, err
+	}
+
+	const incremental = 2
+	if mode != incremental && !convert {
+		return 0, false, nil
+	}
+	if mode != incremental {
+		if _, err := conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+			return 0, false, err
+		}
+		if _, err := conn.ExecContext(ctx, `VACUUM`); err != nil {
+			return 0, false, err
+		}
+	} else {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf(`PRAGMA incremental_vacuum(%d)`, max(pages, 0)))
+		if err != nil {
+			return 0, false, err
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, false, err
+		}
+	}
+
+	after, err := pageCount()
+	if err != nil {
+		return 0, false, err
+	}
+	return max(before-after, 0) * pageSize, true, nil
+}
+
+// ============================================================
+// Pins
+// ============================================================
+
+// pinTables lists where each class can be pinned. Pinning a conversation
+// keeps all of its messages.
+var pinTables = map[string][]struct{ database, table, match string }{
+	RetainMessages: {
+		{"personal", "messages", "id = ?"},
+		{"personal", "conversations", "id = ?"},
+		{"team", "team_messages", "id = ?"},
+		{"team", "team_conversations", "id = ?"},
+	},
+	RetainDocuments: {{"team", "team_documents", "id = ? OR path = ?"}},
+	RetainAudit:     {{"team", "team_plan_executions", "id = ?"}},
+	RetainArchive:   {{"personal", "memory_archive", "id = ?"}},
+}
+
+// Pin marks an item of a data class to be kept forever, or releases it
+// when pinned is false. id is a row ID; messages also accept conversation
+// IDs and documents their path.
+func (s *Store) Pin(ctx context.Context, class, id string, pinned bool) error {
+	tables, ok := pinTables[class]
+	if !ok {
+		return fmt.Errorf("unknown data class %q (want %s)", class, strings.Join(RetentionClasses, ", "))
+	}
+	dbs := map[string]*sql.DB{"personal": s.personal, "team": s.team}
+	value := 0
+	if pinned {
+		value = 1
+	}
+	for _, t := range tables {
+		args := []any{value}
+		for range strings.Count(t.match, "?") {
+			args = append(args, id)
+		}
+		res, err := dbs[t.database].ExecContext(ctx, `UPDATE `+t.table+` SET pinned = ? WHERE `+t.match, args...)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s item %q", class, id)
+}
@@ -7,14 +7,17 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
 // EnhancedMemoryStore provides advanced memory retrieval with scoring.
 type EnhancedMemoryStore struct {
-	store *MemoryStore
-	db    *sql.DB
+	store    *MemoryStore
+	db       *sql.DB
+	teamDB   *sql.DB
+	tenantID string
 }
 
 // NewEnhancedMemoryStore creates an enhanced memory store.
@@ -25,21 +28,169 @@ func NewEnhancedMemoryStore(store *MemoryStore, db *sql.DB) *EnhancedMemoryStore
 	}
 }
 
+// SetTeamDB enables retrieval from the tenant's knowledge graph and
+// indexed documents.
+func (e *EnhancedMemoryStore) SetTeamDB(db *sql.DB, tenantID string) {
+	e.teamDB = db
+	e.tenantID = tenantID
+}
+
 // MemoryEntry represents a memory with its relevance score.
 type MemoryEntry struct {
-	Type       string  // profile, action, conversation
-	Field      string  // For profile memories
+	Type       string  // profile, action, episode, entity, document, team
+	Field      string  // Profile field, or entity type
 	Value      string  // For profile memories
 	Trigger    string  // For action memories
 	Action     string  // For action memories
-	Content    string  // For conversation memories
+	Name       string  // Entity name, document path or episode topic
+	Content    string  // Entity description, document chunk or episode summary
 	Score      float64 // Relevance score (0-1)
 	UpdatedAt  int64
 	Confidence float64
+
+	rank         float64 // bm25 rank, higher is better; normalized into Score
+	confidenceAt int64   // When a profile or action confidence was last set; 0 if it does not decay
+}
+
+// ftsSource describes one full-text indexed table searched by RetrieveRelevant.
+type ftsSource struct {
+	kind       string
+	team       bool
+	teamThread bool // Only searched for team threads
+	query      string
+	scan       func(rows *sql.Rows) (MemoryEntry, error)
+}
+
+// ftsSources lists the indexed tables. Each query takes the MATCH expression
+// (and tenant for team tables) plus a limit, and returns the bm25 rank last.
+var ftsSources = []ftsSource{
+	{
+		kind: "profile",
+		query: `
+			SELECT p.field, p.value, p.confidence, p.updated_at, COALESCE(p.confidence_at, p.updated_at),
+			       bm25(memory_profile_fts)
+			FROM memory_profile_fts f
+			JOIN memory_profile p ON p.rowid = f.rowid
+			WHERE memory_profile_fts MATCH ?
+			ORDER BY bm25(memory_profile_fts)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "profile"}
+			err := rows.Scan(&m.Field, &m.Value, &m.Confidence, &m.UpdatedAt, &m.confidenceAt, &m.rank)
+			return m, err
+		},
+	},
+	{
+		kind: "action",
+		query: `
+			SELECT a.trigger, a.action, a.confidence, a.updated_at, COALESCE(a.confidence_at, a.updated_at),
+			       bm25(memory_actions_fts)
+			FROM memory_actions_fts f
+			JOIN memory_actions a ON a.rowid = f.rowid
+			WHERE memory_actions_fts MATCH ?
+			ORDER BY bm25(memory_actions_fts)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "action"}
+			err := rows.Scan(&m.Trigger, &m.Action, &m.Confidence, &m.UpdatedAt, &m.confidenceAt, &m.rank)
+			return m, err
+		},
+	},
+	{
+		kind: "episode",
+		query: `
+			SELECT e.topic, e.summary, COALESCE(e.decisions_json, ''), COALESCE(e.open_questions_json, ''),
+			       e.updated_at, bm25(memory_episodes_fts, 2.0, 1.0, 1.0)
+			FROM memory_episodes_fts f
+			JOIN memory_episodes e ON e.rowid = f.rowid
+			WHERE memory_episodes_fts MATCH ?
+			ORDER BY bm25(memory_episodes_fts, 2.0, 1.0, 1.0)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "episode", Confidence: 0.7}
+			var summary, decisions, open string
+			err := rows.Scan(&m.Name, &summary, &decisions, &open, &m.UpdatedAt, &m.rank)
+			m.Content = episodeContent(summary, decisions, open)
+			return m, err
+		},
+	},
+	{
+		kind: "entity",
+		team: true,
+		query: `
+			SELECT e.name, e.entity_type, COALESCE(e.description, ''), COALESCE(e.importance, 0), e.updated_at,
+			       bm25(team_entities_fts, 2.0, 1.0)
+			FROM team_entities_fts f
+			JOIN team_entities e ON e.rowid = f.rowid
+			WHERE team_entities_fts MATCH ? AND e.tenant_id = ?
+			ORDER BY bm25(team_entities_fts, 2.0, 1.0)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "entity"}
+			var importance float64
+			err := rows.Scan(&m.Name, &m.Field, &m.Content, &importance, &m.UpdatedAt, &m.rank)
+			// Entities carry importance rather than confidence
+			m.Confidence = 0.5 + 0.5*math.Min(math.Max(importance, 0), 1)
+			return m, err
+		},
+	},
+	{
+		kind:       "team",
+		team:       true,
+		teamThread: true,
+		query: `
+			SELECT m.kind, m.key, m.value, m.confidence, m.updated_at, bm25(team_memory_fts, 2.0, 1.0)
+			FROM team_memory_fts f
+			JOIN team_memory m ON m.rowid = f.rowid
+			WHERE team_memory_fts MATCH ? AND m.tenant_id = ?
+			ORDER BY bm25(team_memory_fts, 2.0, 1.0)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "team"}
+			var kind, key, value string
+			err := rows.Scan(&kind, &key, &value, &m.Confidence, &m.UpdatedAt, &m.rank)
+			if kind == TeamActionKind {
+				m.Trigger, m.Action = key, value
+			} else {
+				m.Field, m.Value = key, value
+			}
+			return m, err
+		},
+	},
+	{
+		kind: "document",
+		team: true,
+		query: `
+			SELECT d.path, c.content, d.updated_at, bm25(team_doc_chunks_fts)
+			FROM team_doc_chunks_fts f
+			JOIN team_doc_chunks c ON c.rowid = f.rowid
+			JOIN team_documents d ON d.id = c.document_id
+			WHERE team_doc_chunks_fts MATCH ? AND c.tenant_id = ?
+			ORDER BY bm25(team_doc_chunks_fts)
+			LIMIT ?`,
+		scan: func(rows *sql.Rows) (MemoryEntry, error) {
+			m := MemoryEntry{Type: "document", Confidence: 0.5}
+			err := rows.Scan(&m.Name, &m.Content, &m.UpdatedAt, &m.rank)
+			return m, err
+		},
+	},
 }
 
 // RetrieveRelevant retrieves memories relevant to the current query.
+// Candidates come from the FTS indexes ranked by bm25; the final score
+// blends text relevance with confidence and recency. Profile facts and
+// actions whose decayed confidence is below the policy minimum are skipped.
 func (e *EnhancedMemoryStore) RetrieveRelevant(ctx context.Context, query string, maxResults int) ([]MemoryEntry, error) {
+	return e.retrieve(ctx, query, maxResults, false)
+}
+
+// RetrieveTeamRelevant is RetrieveRelevant for a team thread: the tenant's
+// team memory is searched alongside personal memory.
+func (e *EnhancedMemoryStore) RetrieveTeamRelevant(ctx context.Context, query string, maxResults int) ([]MemoryEntry, error) {
+	return e.retrieve(ctx, query, maxResults, true)
+}
+
+func (e *EnhancedMemoryStore) retrieve(ctx context.Context, query string, maxResults int, teamThread bool) ([]MemoryEntry, error) {
 	if e == nil || e.db == nil {
 		return nil, fmt.Errorf("memory store not initialized")
 	}
@@ -52,39 +203,72 @@ func (e *EnhancedMemoryStore) RetrieveRelevant(ctx context.Context, query string
 	if len(keywords) == 0 {
 		return nil, nil
 	}
+	match := ftsMatchExpr(keywords)
 
-	// Search profile memories
-	profileMemories, err := e.searchProfileMemories(ctx, keywords)
-	if err != nil {
-		return nil, fmt.Errorf("search profile: %w", err)
+	var allMemories []MemoryEntry
+	for _, src := range ftsSources {
+		if src.teamThread && !teamThread {
+			continue
+		}
+		var memories []MemoryEntry
+		var err error
+		if src.team {
+			if e.teamDB == nil {
+				continue
+			}
+			memories, err = searchFTS(ctx, e.teamDB, src, match, e.tenantID, maxResults*2)
+		} else {
+			memories, err = searchFTS(ctx, e.db, src, match, nil, maxResults*2)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("search %s: %w", src.kind, err)
+		}
+		allMemories = append(allMemories, memories...)
 	}
 
-	// Search action memories
-	actionMemories, err := e.searchActionMemories(ctx, keywords)
-	if err != nil {
-		return nil, fmt.Errorf("search actions: %w", err)
+	// bm25 is unbounded; normalize against the best hit for this query
+	bestRank := 0.0
+	for _, m := range allMemories {
+		bestRank = math.Max(bestRank, m.rank)
 	}
 
-	// Combine and score
-	allMemories := append(profileMemories, actionMemories...)
+	// Decayed or contradicted facts are left out until re-confirmed
+	policy := e.store.ConfidencePolicy()
+	now := time.Now()
+	scored := allMemories[:0]
+	for _, m := range allMemories {
+		if m.confidenceAt != 0 {
+			m.Confidence = policy.Effective(m.Confidence, m.confidenceAt, now)
+			if m.Confidence < policy.Min {
+				continue
+			}
+		}
+		m.Score = calculateRelevance(m.text(), keywords, m.rank, bestRank, m.UpdatedAt, m.Confidence)
+		if m.Score > 0.1 { // Minimum relevance threshold
+			scored = append(scored, m)
+		}
+	}
 
 	// Sort by relevance score
-	sortByScore(allMemories)
+	sortByScore(scored)
 
 	// Return top results
-	if len(allMemories) > maxResults {
-		allMemories = allMemories[:maxResults]
+	if len(scored) > maxResults {
+		scored = scored[:maxResults]
 	}
 
-	return allMemories, nil
+	return scored, nil
 }
 
-// searchProfileMemories searches profile memories for keyword matches.
-func (e *EnhancedMemoryStore) searchProfileMemories(ctx context.Context, keywords []string) ([]MemoryEntry, error) {
-	rows, err := e.db.QueryContext(ctx, `
-		SELECT field, value, confidence, updated_at
-		FROM memory_profile
-	`)
+// searchFTS runs one source query. tenantID is nil for personal tables.
+func searchFTS(ctx context.Context, db *sql.DB, src ftsSource, match string, tenantID any, limit int) ([]MemoryEntry, error) {
+	args := []any{match}
+	if tenantID != nil {
+		args = append(args, tenantID)
+	}
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, src.query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -92,131 +276,147 @@ func (e *EnhancedMemoryStore) searchProfileMemories(ctx context.Context, keyword
 
 	var memories []MemoryEntry
 	for rows.Next() {
-		var field, value string
-		var confidence float64
-		var updatedAt int64
-		if err := rows.Scan(&field, &value, &confidence, &updatedAt); err != nil {
-			continue
-		}
-
-		// Calculate relevance score
-		score := calculateRelevance(field+" "+value, keywords, updatedAt, confidence)
-		if score > 0.1 { // Minimum relevance threshold
-			memories = append(memories, MemoryEntry{
-				Type:       "profile",
-				Field:      field,
-				Value:      value,
-				Score:      score,
-				UpdatedAt:  updatedAt,
-				Confidence: confidence,
-			})
+		m, err := src.scan(rows)
+		if err != nil {
+			return nil, err
 		}
+		m.rank = -m.rank // bm25 returns lower-is-better
+		memories = append(memories, m)
 	}
-
-	return memories, nil
+	return memories, rows.Err()
 }
 
-// searchActionMemories searches action memories for keyword matches.
-func (e *EnhancedMemoryStore) searchActionMemories(ctx context.Context, keywords []string) ([]MemoryEntry, error) {
-	rows, err := e.db.QueryContext(ctx, `
-		SELECT trigger, action, confidence, updated_at
-		FROM memory_actions
-	`)
-	if err != nil {
-		return nil, err
+// text returns the searchable text of a memory for keyword coverage.
+func (m MemoryEntry) text() string {
+	switch m.Type {
+	case "profile":
+		return m.Field + " " + m.Value
+	case "action":
+		return m.Trigger + " " + m.Action
+	case "team":
+		return m.Field + m.Trigger + " " + m.Value + m.Action
+	default:
+		return m.Name + " " + m.Content
 	}
-	defer rows.Close()
+}
 
-	var memories []MemoryEntry
-	for rows.Next() {
-		var trigger, action string
-		var confidence float64
-		var updatedAt int64
-		if err := rows.Scan(&trigger, &action, &confidence, &updatedAt); err != nil {
-			continue
-		}
+// DefaultContextTokens is the prompt budget RetrieveSemantic fills.
+const DefaultContextTokens = 600
 
-		// Calculate relevance score
-		fullText := trigger + " " + action
-		score := calculateRelevance(fullText, keywords, updatedAt, confidence)
-		if score > 0.1 { // Minimum relevance threshold
-			memories = append(memories, MemoryEntry{
-				Type:       "action",
-				Trigger:    trigger,
-				Action:     action,
-				Score:      score,
-				UpdatedAt:  updatedAt,
-				Confidence: confidence,
-			})
-		}
-	}
+// RetrieveSemantic retrieves memories using semantic search (keyword-based for now, can add embeddings).
+func (e *EnhancedMemoryStore) RetrieveSemantic(ctx context.Context, query string, maxResults int) (string, error) {
+	return e.RetrieveContext(ctx, query, maxResults, DefaultContextTokens)
+}
 
-	return memories, nil
+// memorySections lists the prompt sections in display order. Personal
+// sections are marked as such when team memory is shown alongside them.
+var memorySections = []struct {
+	kind     string
+	heading  string
+	personal bool
+}{
+	{"team", "### Team Memory", false},
+	{"profile", "### Profile", true},
+	{"action", "### Learned Actions", true},
+	{"episode", "### Past Conversations", true},
+	{"entity", "### Knowledge Graph", false},
+	{"document", "### Documents", false},
 }
 
-// RetrieveSemantic retrieves memories using semantic search (keyword-based for now, can add embeddings).
-func (e *EnhancedMemoryStore) RetrieveSemantic(ctx context.Context, query string, maxResults int) (string, error) {
+// RetrieveContext renders relevant memories as prompt context. Memories
+// are added best-first until maxTokens (estimated at 4 chars per token)
+// is spent; maxTokens <= 0 means no limit.
+func (e *EnhancedMemoryStore) RetrieveContext(ctx context.Context, query string, maxResults, maxTokens int) (string, error) {
 	memories, err := e.RetrieveRelevant(ctx, query, maxResults)
 	if err != nil {
 		return "", err
 	}
-	if len(memories) == 0 {
-		return "", nil
-	}
+	return renderContext(memories, maxTokens, false), nil
+}
 
-	var output strings.Builder
-	output.WriteString("## Relevant Memories\n\n")
+// RetrieveTeamContext renders team and personal memories for a team
+// thread, with each section marked as team or personal.
+func (e *EnhancedMemoryStore) RetrieveTeamContext(ctx context.Context, query string, maxResults, maxTokens int) (string, error) {
+	memories, err := e.RetrieveTeamRelevant(ctx, query, maxResults)
+	if err != nil {
+		return "", err
+	}
+	return renderContext(memories, maxTokens, true), nil
+}
 
-	// Group by type
-	profileMemories := filterByType(memories, "profile")
-	actionMemories := filterByType(memories, "action")
+func renderContext(memories []MemoryEntry, maxTokens int, teamThread bool) string {
+	if len(memories) == 0 {
+		return ""
+	}
 
-	if len(profileMemories) > 0 {
-		output.WriteString("### Profile\n")
-		for _, m := range profileMemories {
-			output.WriteString(fmt.Sprintf("- %s: %s (relevance: %.2f)\n", m.Field, m.Value, m.Score))
+	const title = "## Relevant Memories\n\n"
+	used := estimateTokens(title)
+	now := time.Now()
+	lines := make(map[string][]string)
+	for _, m := range memories {
+		line := m.contextLine(now)
+		cost := estimateTokens(line)
+		if len(lines[m.Type]) == 0 {
+			cost += 6 // Section heading and spacing
 		}
-		output.WriteString("\n")
+		if maxTokens > 0 && used+cost > maxTokens {
+			continue // A shorter, lower-ranked memory may still fit
+		}
+		used += cost
+		lines[m.Type] = append(lines[m.Type], line)
+	}
+	if len(lines) == 0 {
+		return ""
 	}
 
-	if len(actionMemories) > 0 {
-		output.WriteString("### Learned Actions\n")
-		for _, m := range actionMemories {
-			output.WriteString(fmt.Sprintf("- When \"%s\": %s (relevance: %.2f)\n", m.Trigger, m.Action, m.Score))
+	var output strings.Builder
+	output.WriteString(title)
+	for _, section := range memorySections {
+		if len(lines[section.kind]) == 0 {
+			continue
+		}
+		heading := section.heading
+		if teamThread && section.personal {
+			heading += " (personal)"
+		}
+		output.WriteString(heading + "\n")
+		for _, line := range lines[section.kind] {
+			output.WriteString(line + "\n")
 		}
+		output.WriteString("\n")
 	}
 
-	return output.String(), nil
+	return strings.TrimRight(output.String(), "\n") + "\n"
 }
 
-// ConsolidateOldMemories compresses memories older than the threshold.
-func (e *EnhancedMemoryStore) ConsolidateOldMemories(ctx context.Context, daysThreshold int) (int, error) {
-	if e == nil || e.db == nil {
-		return 0, fmt.Errorf("memory store not initialized")
-	}
-
-	cutoff := time.Now().AddDate(0, 0, -daysThreshold).Unix()
-
-	// Count old memories
-	var oldCount int
-	err := e.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM (
-			SELECT updated_at FROM memory_profile WHERE updated_at < ?
-			UNION ALL
-			SELECT updated_at FROM memory_actions WHERE updated_at < ?
-		)
-	`, cutoff, cutoff).Scan(&oldCount)
-	if err != nil {
-		return 0, err
+// contextLine renders one memory as a prompt line.
+func (m MemoryEntry) contextLine(now time.Time) string {
+	switch m.Type {
+	case "profile":
+		return fmt.Sprintf("- %s: %s (relevance: %.2f)", m.Field, m.Value, m.Score)
+	case "action":
+		return fmt.Sprintf("- When \"%s\": %s (relevance: %.2f)", m.Trigger, m.Action, m.Score)
+	case "team":
+		if m.Trigger != "" {
+			return fmt.Sprintf("- When \"%s\": %s (relevance: %.2f)", m.Trigger, m.Action, m.Score)
+		}
+		return fmt.Sprintf("- %s: %s (relevance: %.2f)", m.Field, m.Value, m.Score)
+	case "episode":
+		return fmt.Sprintf("- %s, %s: %s (relevance: %.2f)", relativeDay(m.UpdatedAt, now), m.Name, truncateText(m.Content, 320), m.Score)
+	case "entity":
+		line := fmt.Sprintf("- %s (%s)", m.Name, m.Field)
+		if m.Content != "" {
+			line += ": " + truncateText(m.Content, 160)
+		}
+		return fmt.Sprintf("%s (relevance: %.2f)", line, m.Score)
+	default:
+		return fmt.Sprintf("- %s: %s (relevance: %.2f)", m.Name, truncateText(m.Content, 240), m.Score)
 	}
+}
 
-	// For now, just return count. Actual consolidation would involve:
-	// - Summarizing related memories
-	// - Merging similar entries
-	// - Archiving old memories to a separate table
-	// - Keeping only high-confidence/high-relevance memories
-
-	return oldCount, nil
+// estimateTokens approximates the token count of prompt text.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
 }
 
 // ============================================================
@@ -267,12 +467,24 @@ func extractKeywords(query string) []string {
 	return keywords
 }
 
+// ftsMatchExpr builds an FTS5 query that matches any keyword as a prefix,
+// or as a whole word in encrypted fields.
+func ftsMatchExpr(keywords []string) string {
+	terms := make([]string, len(keywords))
+	for i, kw := range keywords {
+		terms[i] = `"` + strings.ReplaceAll(kw, `"`, `""`) + `"*`
+	}
+	terms = append(terms, blindTerms(keywords)...)
+	return strings.Join(terms, " OR ")
+}
+
 // calculateRelevance calculates a relevance score for a memory.
-func calculateRelevance(memoryText string, keywords []string, updatedAt int64, confidence float64) float64 {
+// rank is the memory's bm25 rank and bestRank the best rank for the query.
+func calculateRelevance(memoryText string, keywords []string, rank, bestRank float64, updatedAt int64, confidence float64) float64 {
 	memoryText = strings.ToLower(memoryText)
 
-	// Keyword match score (60% weight)
-	keywordScore := 0.0
+	// Keyword coverage - how much of the query this memory answers
+	coverage := 0.0
 	matchedKeywords := 0
 	for _, kw := range keywords {
 		if strings.Contains(memoryText, kw) {
@@ -280,9 +492,18 @@ func calculateRelevance(memoryText string, keywords []string, updatedAt int64, c
 		}
 	}
 	if len(keywords) > 0 {
-		keywordScore = float64(matchedKeywords) / float64(len(keywords))
+		coverage = float64(matchedKeywords) / float64(len(keywords))
 	}
 
+	// bm25 relative to the best hit - term rarity and density
+	bm25Score := 0.0
+	if bestRank > 0 {
+		bm25Score = rank / bestRank
+	}
+
+	// Text score (60% weight)
+	textScore := 0.5*coverage + 0.5*bm25Score
+
 	// Recency score (20% weight) - more recent = higher score
 	ageHours := float64(time.Now().Unix()-updatedAt) / 3600.0
 	recencyScore := math.Exp(-ageHours / (24.0 * 30.0)) // Decay over 30 days
@@ -291,29 +512,24 @@ func calculateRelevance(memoryText string, keywords []string, updatedAt int64, c
 	confidenceScore := confidence
 
 	// Combined score
-	score := (keywordScore * 0.6) + (recencyScore * 0.2) + (confidenceScore * 0.2)
+	score := (textScore * 0.6) + (recencyScore * 0.2) + (confidenceScore * 0.2)
 
 	return math.Min(score, 1.0)
 }
 
 // sortByScore sorts memories by relevance score in descending order.
 func sortByScore(memories []MemoryEntry) {
-	for i := 0; i < len(memories)-1; i++ {
-		for j := i + 1; j < len(memories); j++ {
-			if memories[j].Score > memories[i].Score {
-				memories[i], memories[j] = memories[j], memories[i]
-			}
-		}
-	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i].Score > memories[j].Score
+	})
 }
 
-// filterByType filters memories by type.
-func filterByType(memories []MemoryEntry, memType string) []MemoryEntry {
-	var filtered []MemoryEntry
-	for _, m := range memories {
-		if m.Type == memType {
-			filtered = append(filtered, m)
-		}
+// truncateText collapses whitespace and shortens text to maxLen runes.
+func truncateText(text string, maxLen int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
 	}
-	return filtered
+	return string(runes[:maxLen]) + "..."
 }
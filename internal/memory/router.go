@@ -18,6 +18,7 @@ type MemoryFact struct {
 	Action     string
 	Confidence float64
 	Overwrite  bool
+	Source     string // Extractor that produced the fact (SourceLLM, SourceRouter)
 }
 
 // ShouldIngest returns extracted memory facts.
@@ -33,16 +34,16 @@ func (r *MemoryRouter) ShouldIngest(message string) []MemoryFact {
 	var facts []MemoryFact
 
 	if name := extractName(msg); name != "" {
-		facts = append(facts, MemoryFact{Type: "profile", Field: "name", Value: name, Confidence: 0.9, Overwrite: overwrite})
+		facts = append(facts, MemoryFact{Type: "profile", Field: "name", Value: name, Confidence: 0.9, Overwrite: overwrite, Source: SourceRouter})
 	}
 	if pref := extractPreference(msg); pref != "" {
-		facts = append(facts, MemoryFact{Type: "profile", Field: "preference", Value: pref, Confidence: 0.7, Overwrite: overwrite})
+		facts = append(facts, MemoryFact{Type: "profile", Field: "preference", Value: pref, Confidence: 0.7, Overwrite: overwrite, Source: SourceRouter})
 	}
 	if dislike := extractDislike(msg); dislike != "" {
-		facts = append(facts, MemoryFact{Type: "profile", Field: "dislike", Value: dislike, Confidence: 0.7, Overwrite: overwrite})
+		facts = append(facts, MemoryFact{Type: "profile", Field: "dislike", Value: dislike, Confidence: 0.7, Overwrite: overwrite, Source: SourceRouter})
 	}
 	if trigger, action := extractAction(msg); trigger != "" && action != "" {
-		facts = append(facts, MemoryFact{Type: "action", Trigger: trigger, Action: action, Confidence: 0.7, Overwrite: overwrite})
+		facts = append(facts, MemoryFact{Type: "action", Trigger: trigger, Action: action, Confidence: 0.7, Overwrite: overwrite, Source: SourceRouter})
 	}
 
 	return facts
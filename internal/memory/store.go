@@ -6,8 +6,11 @@
 package memory
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
 
 	// SQLite driver (pure Go, no CGO required).
 	_ "modernc.org/sqlite"
@@ -15,45 +18,51 @@ import (
 
 // Store manages both personal and team databases.
 type Store struct {
-	personal *sql.DB
-	team     *sql.DB
+	personal     *sql.DB
+	team         *sql.DB
+	personalPath string
+	teamPath     string
+
+	encMu sync.Mutex
+	kek   []byte // Key-encryption key once unlocked
 }
 
 // Open opens both SQLite databases at the given paths.
-// Creates the databases and tables if they don't exist.
+// Creates the databases and applies any pending schema migrations.
 func Open(personalPath, teamPath string) (*Store, error) {
-	// Open personal database
-	personal, err := openDB(personalPath)
+	store, err := OpenUnmigrated(personalPath, teamPath)
 	if err != nil {
 		return nil, err
 	}
-
-	// Open team database
-	team, err := openDB(teamPath)
-	if err != nil {
-		personal.Close()
+	if _, err := store.Migrate(context.Background(), MigrateOptions{}); err != nil {
+		store.Close()
 		return nil, err
 	}
+	return store, nil
+}
 
-	store := &Store{
-		personal: personal,
-		team:     team,
-	}
-
-	// Initialize schemas
-	if err := store.initPersonal(); err != nil {
-		personal.Close()
-		team.Close()
+// OpenUnmigrated opens both databases without changing their schemas, for
+// inspecting or migrating them explicitly.
+func OpenUnmigrated(personalPath, teamPath string) (*Store, error) {
+	// Open personal database
+	personal, err := openDB(personalPath)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := store.initTeam(); err != nil {
+	// Open team database
+	team, err := openDB(teamPath)
+	if err != nil {
 		personal.Close()
-		team.Close()
 		return nil, err
 	}
 
-	return store, nil
+	return &Store{
+		personal:     personal,
+		team:         team,
+		personalPath: personalPath,
+		teamPath:     teamPath,
+	}, nil
 }
 
 // NewStore is an alias for Open for convenience.
@@ -65,43 +74,12 @@ func NewStore(personalPath, teamPath string) (*Store, error) {
 // Creates the databases and tables if they don't exist.
 // Deprecated: Use Open or NewStore instead.
 func openDBs(personalPath, teamPath string) (*Store, error) {
-	// Open personal database
-	personal, err := openDB(personalPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Open team database
-	team, err := openDB(teamPath)
-	if err != nil {
-		personal.Close()
-		return nil, err
-	}
-
-	store := &Store{
-		personal: personal,
-		team:     team,
-	}
-
-	// Initialize schemas
-	if err := store.initPersonal(); err != nil {
-		personal.Close()
-		team.Close()
-		return nil, err
-	}
-
-	if err := store.initTeam(); err != nil {
-		personal.Close()
-		team.Close()
-		return nil, err
-	}
-
-	return store, nil
+	return Open(personalPath, teamPath)
 }
 
 // openDB opens a single SQLite database with optimal settings.
 func openDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_foreign_keys=on&_journal_mode=WAL")
+	db, err := sql.Open(driverName, dbPath+"?_foreign_keys=on&_journal_mode=WAL")
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +90,8 @@ func openDB(dbPath string) (*sql.DB, error) {
 		"PRAGMA cache_size = -64000",
 		"PRAGMA temp_store = MEMORY",
 		"PRAGMA mmap_size = 30000000000",
+		// Takes effect on new databases; retention purges convert old ones
+		"PRAGMA auto_vacuum = INCREMENTAL",
 	}
 
 	for _, pragma := range pragmas {
@@ -178,8 +158,9 @@ func (s *Store) EnsureTenant(id, name string) error {
 // PERSONAL DB SCHEMA
 // ============================================================
 
-func (s *Store) initPersonal() error {
-	schema := `
+// personalSchema is the version 1 personal schema. It is frozen: later
+// changes go in their own migrations.
+const personalSchema = `
 	-- Schema version tracking
 	CREATE TABLE IF NOT EXISTS schema_migrations (
 		version INTEGER PRIMARY KEY,
@@ -341,26 +322,214 @@ func (s *Store) initPersonal() error {
 			SET message_count = message_count - 1, updated_at = strftime('%s', 'now')
 			WHERE id = OLD.conversation_id;
 		END;
-	`
+`
 
-	_, err := s.personal.Exec(schema)
-	if err != nil {
-		return err
-	}
+// memorySearchSchema indexes profile facts and actions for full-text search.
+const memorySearchSchema = `
+	-- ============================================================
+	-- MEMORY: FULL-TEXT SEARCH
+	-- ============================================================
 
-	if err := ensureSchemaVersion(s.personal, 1, "Initial personal schema"); err != nil {
-		return err
-	}
+	CREATE VIRTUAL TABLE IF NOT EXISTS memory_profile_fts USING fts5(
+		field,
+		value,
+		content_rowid=rowid
+	);
 
-	return nil
+	CREATE TRIGGER IF NOT EXISTS memory_profile_fts_insert AFTER INSERT ON memory_profile BEGIN
+		INSERT INTO memory_profile_fts(rowid, field, value) VALUES (new.rowid, new.field, new.value);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_profile_fts_delete AFTER DELETE ON memory_profile BEGIN
+		DELETE FROM memory_profile_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_profile_fts_update AFTER UPDATE ON memory_profile BEGIN
+		UPDATE memory_profile_fts SET field = NEW.field, value = NEW.value WHERE rowid = NEW.rowid;
+	END;
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS memory_actions_fts USING fts5(
+		trigger,
+		action,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS memory_actions_fts_insert AFTER INSERT ON memory_actions BEGIN
+		INSERT INTO memory_actions_fts(rowid, trigger, action) VALUES (new.rowid, new.trigger, new.action);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_actions_fts_delete AFTER DELETE ON memory_actions BEGIN
+		DELETE FROM memory_actions_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_actions_fts_update AFTER UPDATE ON memory_actions BEGIN
+		UPDATE memory_actions_fts SET trigger = NEW.trigger, action = NEW.action WHERE rowid = NEW.rowid;
+	END;
+
+	-- Index rows written before the FTS tables existed
+	INSERT INTO memory_profile_fts(rowid, field, value)
+		SELECT rowid, field, value FROM memory_profile
+		WHERE rowid NOT IN (SELECT rowid FROM memory_profile_fts);
+
+	INSERT INTO memory_actions_fts(rowid, trigger, action)
+		SELECT rowid, trigger, action FROM memory_actions
+		WHERE rowid NOT IN (SELECT rowid FROM memory_actions_fts);
+`
+
+// memoryArchiveSchema keeps the memories consolidation removes.
+const memoryArchiveSchema = `
+	-- ============================================================
+	-- MEMORY: ARCHIVE
+	-- ============================================================
+
+	-- Memories removed by consolidation (merged, superseded, summarized)
+	CREATE TABLE IF NOT EXISTS memory_archive (
+		id          TEXT PRIMARY KEY,
+		kind        TEXT NOT NULL, -- profile, action
+		original_id TEXT NOT NULL,
+		subject     TEXT NOT NULL, -- field or trigger
+		content     TEXT NOT NULL, -- value or action
+		confidence  REAL NOT NULL DEFAULT 0,
+		updated_at  INTEGER NOT NULL,
+		archived_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		reason      TEXT NOT NULL,
+		replaced_by TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_memory_archive_subject ON memory_archive(kind, subject);
+	CREATE INDEX IF NOT EXISTS idx_memory_archive_archived ON memory_archive(archived_at DESC);
+`
+
+// memoryVersionsSchema records every memory write and where it came from.
+const memoryVersionsSchema = `
+	-- ============================================================
+	-- MEMORY: VERSION HISTORY
+	-- ============================================================
+
+	-- Every write to memory_profile/memory_actions, with where it came from
+	CREATE TABLE IF NOT EXISTS memory_versions (
+		id                TEXT PRIMARY KEY,
+		kind              TEXT NOT NULL, -- profile, action
+		memory_id         TEXT NOT NULL,
+		subject           TEXT NOT NULL, -- field or trigger
+		content           TEXT NOT NULL, -- value or action
+		confidence        REAL NOT NULL DEFAULT 0,
+		source            TEXT NOT NULL, -- llm, router, manual, consolidation, restore
+		source_message_id TEXT,
+		snippet           TEXT,
+		created_at        INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_memory_versions_subject ON memory_versions(kind, subject, created_at DESC);
+`
+
+// episodesSchema adds conversation summaries and their full-text index.
+const episodesSchema = `
+	-- ============================================================
+	-- MEMORY: EPISODES
+	-- ============================================================
+
+	-- One summary per finished conversation, recalled across sessions
+	CREATE TABLE IF NOT EXISTS memory_episodes (
+		id                  TEXT PRIMARY KEY,
+		conversation_id     TEXT NOT NULL,
+		topic               TEXT NOT NULL,
+		summary             TEXT NOT NULL,
+		decisions_json      TEXT,
+		open_questions_json TEXT,
+		files_json          TEXT,
+		message_count       INTEGER NOT NULL DEFAULT 0,
+		started_at          INTEGER NOT NULL,
+		updated_at          INTEGER NOT NULL, -- end of the conversation
+		created_at          INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_memory_episodes_conversation ON memory_episodes(conversation_id);
+	CREATE INDEX IF NOT EXISTS idx_memory_episodes_updated ON memory_episodes(updated_at DESC);
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS memory_episodes_fts USING fts5(
+		topic,
+		summary,
+		details,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS memory_episodes_fts_insert AFTER INSERT ON memory_episodes BEGIN
+		INSERT INTO memory_episodes_fts(rowid, topic, summary, details)
+		VALUES (new.rowid, new.topic, new.summary,
+			COALESCE(new.decisions_json, '') || ' ' || COALESCE(new.open_questions_json, '') || ' ' || COALESCE(new.files_json, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_episodes_fts_delete AFTER DELETE ON memory_episodes BEGIN
+		DELETE FROM memory_episodes_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS memory_episodes_fts_update AFTER UPDATE ON memory_episodes BEGIN
+		UPDATE memory_episodes_fts SET topic = NEW.topic, summary = NEW.summary,
+			details = COALESCE(NEW.decisions_json, '') || ' ' || COALESCE(NEW.open_questions_json, '') || ' ' || COALESCE(NEW.files_json, '')
+		WHERE rowid = NEW.rowid;
+	END;
+`
+
+// encryptionSchema records field encryption settings and the wrapped data
+// keys. Team.db fields are sealed with the same keys.
+const encryptionSchema = `
+	CREATE TABLE IF NOT EXISTS encryption_settings (
+		id          INTEGER PRIMARY KEY CHECK (id = 1),
+		kdf         TEXT NOT NULL,              -- argon2id or keyfile
+		salt        BLOB NOT NULL,
+		blind_index INTEGER NOT NULL DEFAULT 1, -- 0 leaves encrypted fields out of FTS
+		created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		updated_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+	);
+
+	CREATE TABLE IF NOT EXISTS encryption_keys (
+		id         TEXT PRIMARY KEY,
+		wrapped    BLOB NOT NULL,                  -- data key sealed with the key-encryption key
+		status     TEXT NOT NULL DEFAULT 'active', -- active, retired
+		created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+	);
+`
+
+// personalMigrations evolve personal.db in order. Append new steps; never
+// edit or reorder ones that have shipped. Version 1 is the schema databases
+// were created with before migrations were versioned.
+var personalMigrations = []Migration{
+	{Version: 1, Description: "Initial personal schema", Up: execSchema(personalSchema)},
+	{Version: 2, Description: "Memory full-text search", Up: execSchema(memorySearchSchema)},
+	{Version: 3, Description: "Memory archive", Up: execSchema(memoryArchiveSchema)},
+	{Version: 4, Description: "Memory version history", Up: execSchema(memoryVersionsSchema)},
+	{Version: 5, Description: "Episodic memory", Up: execSchema(episodesSchema)},
+	{Version: 6, Description: "Memory confidence lifecycle", Up: func(tx *sql.Tx) error {
+		for _, table := range []string{"memory_profile", "memory_actions"} {
+			if err := ensureColumns(tx, table, []string{
+				"confidence_at INTEGER", // When confidence was last set; decay runs from here
+				"reinforced INTEGER NOT NULL DEFAULT 0",
+				"contradicted INTEGER NOT NULL DEFAULT 0",
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{Version: 7, Description: "Retention pins", Up: func(tx *sql.Tx) error {
+		for _, table := range []string{"conversations", "messages", "memory_archive"} {
+			if err := ensureColumns(tx, table, []string{"pinned INTEGER NOT NULL DEFAULT 0"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{Version: 8, Description: "Field encryption", Up: execSchema(encryptionSchema)},
 }
 
 // ============================================================
 // TEAM DB SCHEMA
 // ============================================================
 
-func (s *Store) initTeam() error {
-	schema := `
+// teamSchema is the version 1 team schema. It is frozen: later changes go
+// in their own migrations.
+const teamSchema = `
 	-- Schema version tracking
 	CREATE TABLE IF NOT EXISTS schema_migrations (
 		version INTEGER PRIMARY KEY,
@@ -634,34 +803,322 @@ func (s *Store) initTeam() error {
 				updated_at = strftime('%s', 'now')
 			WHERE id = NEW.pattern_id;
 		END;
-	`
+`
 
-	_, err := s.team.Exec(schema)
-	if err != nil {
-		return err
-	}
+// planCandidatesSchema holds plans learned from tool-call sessions until
+// they are promoted.
+const planCandidatesSchema = `
+	CREATE TABLE IF NOT EXISTS team_plan_candidates (
+		id              TEXT PRIMARY KEY,
+		tenant_id       TEXT NOT NULL,
+		intent_category TEXT NOT NULL,
+		signature       TEXT NOT NULL,
+		plan_json       TEXT NOT NULL,
+		example         TEXT,
+		success_count   INTEGER NOT NULL DEFAULT 1,
+		status          TEXT NOT NULL DEFAULT 'pending', -- pending, promoted, rejected
+		plan_id         TEXT,
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+		UNIQUE(tenant_id, intent_category, signature)
+	);
 
-	if err := ensureSchemaVersion(s.team, 1, "Initial team schema"); err != nil {
-		return err
-	}
+	CREATE INDEX IF NOT EXISTS idx_team_candidates_status ON team_plan_candidates(tenant_id, status);
+`
 
-	return nil
+// planExamplesSchema records requests each plan served, for ranking plans
+// by phrasing.
+const planExamplesSchema = `
+	CREATE TABLE IF NOT EXISTS team_plan_examples (
+		id              TEXT PRIMARY KEY,
+		tenant_id       TEXT NOT NULL,
+		plan_id         TEXT NOT NULL,
+		intent_category TEXT NOT NULL,
+		request         TEXT NOT NULL,
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+		UNIQUE(tenant_id, plan_id, request)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_team_plan_examples_plan ON team_plan_examples(tenant_id, plan_id, created_at DESC);
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS team_plan_examples_fts USING fts5(
+		request,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_plan_examples_fts_insert AFTER INSERT ON team_plan_examples BEGIN
+		INSERT INTO team_plan_examples_fts(rowid, request) VALUES (new.rowid, new.request);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_plan_examples_fts_delete AFTER DELETE ON team_plan_examples BEGIN
+		DELETE FROM team_plan_examples_fts WHERE rowid = OLD.rowid;
+	END;
+`
+
+// graphSearchSchema indexes entities and document chunks for full-text
+// search.
+const graphSearchSchema = `
+	-- ============================================================
+	-- FULL-TEXT SEARCH
+	-- ============================================================
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS team_entities_fts USING fts5(
+		name,
+		description,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_entities_fts_insert AFTER INSERT ON team_entities BEGIN
+		INSERT INTO team_entities_fts(rowid, name, description) VALUES (new.rowid, new.name, COALESCE(new.description, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_entities_fts_delete AFTER DELETE ON team_entities BEGIN
+		DELETE FROM team_entities_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_entities_fts_update AFTER UPDATE OF name, description ON team_entities BEGIN
+		UPDATE team_entities_fts SET name = NEW.name, description = COALESCE(NEW.description, '') WHERE rowid = NEW.rowid;
+	END;
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS team_doc_chunks_fts USING fts5(
+		content,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_doc_chunks_fts_insert AFTER INSERT ON team_doc_chunks BEGIN
+		INSERT INTO team_doc_chunks_fts(rowid, content) VALUES (new.rowid, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_doc_chunks_fts_delete AFTER DELETE ON team_doc_chunks BEGIN
+		DELETE FROM team_doc_chunks_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_doc_chunks_fts_update AFTER UPDATE OF content ON team_doc_chunks BEGIN
+		UPDATE team_doc_chunks_fts SET content = NEW.content WHERE rowid = NEW.rowid;
+	END;
+
+	-- Index rows written before the FTS tables existed
+	INSERT INTO team_entities_fts(rowid, name, description)
+		SELECT rowid, name, COALESCE(description, '') FROM team_entities
+		WHERE rowid NOT IN (SELECT rowid FROM team_entities_fts);
+
+	INSERT INTO team_doc_chunks_fts(rowid, content)
+		SELECT rowid, content FROM team_doc_chunks
+		WHERE rowid NOT IN (SELECT rowid FROM team_doc_chunks_fts);
+`
+
+// indexSchema adds the documents each relation was extracted from and the
+// state of directory indexing.
+const indexSchema = `
+	-- ============================================================
+	-- INDEXING
+	-- ============================================================
+
+	-- Documents a relation was extracted from; a relation that loses its
+	-- last source is deleted
+	CREATE TABLE IF NOT EXISTS team_relation_sources (
+		tenant_id       TEXT NOT NULL,
+		relation_id     TEXT NOT NULL,
+		document_id     TEXT NOT NULL,
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		PRIMARY KEY (tenant_id, relation_id, document_id),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_team_relation_sources_doc ON team_relation_sources(document_id);
+
+	-- Directories indexed by "flynn index"; a run that started after the
+	-- last one finished was interrupted
+	CREATE TABLE IF NOT EXISTS team_index_roots (
+		tenant_id       TEXT NOT NULL,
+		root            TEXT NOT NULL,
+		started_at      INTEGER NOT NULL DEFAULT 0,
+		finished_at     INTEGER NOT NULL DEFAULT 0,
+		files           INTEGER NOT NULL DEFAULT 0,
+		pending         INTEGER NOT NULL DEFAULT 0,
+		code_stamp      TEXT NOT NULL DEFAULT '',
+		last_error      TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (tenant_id, root),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_relations_sources_delete AFTER DELETE ON team_relations BEGIN
+		DELETE FROM team_relation_sources WHERE relation_id = OLD.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_documents_sources_delete AFTER DELETE ON team_documents BEGIN
+		DELETE FROM team_relation_sources WHERE document_id = OLD.id;
+	END;
+`
+
+// entityAliasSchema adds entity aliases, document mentions and pairs of
+// entities reviewed as distinct.
+const entityAliasSchema = `
+	-- ============================================================
+	-- ENTITY RESOLUTION
+	-- ============================================================
+
+	-- Names an entity is known by, including its own. normalized is the
+	-- lookup key produced by NormalizeName.
+	CREATE TABLE IF NOT EXISTS team_entity_aliases (
+		tenant_id       TEXT NOT NULL,
+		normalized      TEXT NOT NULL,
+		entity_id       TEXT NOT NULL,
+		alias           TEXT NOT NULL, -- As first written
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		PRIMARY KEY (tenant_id, normalized, entity_id),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_team_entity_aliases_entity ON team_entity_aliases(entity_id);
+
+	-- Documents an entity was extracted from
+	CREATE TABLE IF NOT EXISTS team_entity_mentions (
+		tenant_id       TEXT NOT NULL,
+		entity_id       TEXT NOT NULL,
+		document_id     TEXT NOT NULL,
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		PRIMARY KEY (tenant_id, entity_id, document_id),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_team_entity_mentions_doc ON team_entity_mentions(document_id);
+
+	-- Duplicate candidates a reviewer marked as different things;
+	-- entity_a sorts before entity_b
+	CREATE TABLE IF NOT EXISTS team_entity_distinct (
+		tenant_id       TEXT NOT NULL,
+		entity_a        TEXT NOT NULL,
+		entity_b        TEXT NOT NULL,
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		PRIMARY KEY (tenant_id, entity_a, entity_b),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_entities_resolution_delete AFTER DELETE ON team_entities BEGIN
+		DELETE FROM team_entity_aliases WHERE entity_id = OLD.id;
+		DELETE FROM team_entity_mentions WHERE entity_id = OLD.id;
+		DELETE FROM team_entity_distinct WHERE entity_a = OLD.id OR entity_b = OLD.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_documents_mentions_delete AFTER DELETE ON team_documents BEGIN
+		DELETE FROM team_entity_mentions WHERE document_id = OLD.id;
+	END;
+`
+
+// teamMemorySchema adds tenant-scoped team memory.
+const teamMemorySchema = `
+	-- ============================================================
+	-- TEAM MEMORY
+	-- ============================================================
+
+	-- Facts and actions shared across the tenant, usually promoted from
+	-- a member's personal memory
+	CREATE TABLE IF NOT EXISTS team_memory (
+		id              TEXT PRIMARY KEY,
+		tenant_id       TEXT NOT NULL,
+		kind            TEXT NOT NULL, -- fact, action
+		key             TEXT NOT NULL, -- Fact name or action trigger
+		value           TEXT NOT NULL,
+		confidence      REAL NOT NULL DEFAULT 0.8,
+		created_by      TEXT NOT NULL,
+		updated_by      TEXT NOT NULL,
+		source_id       TEXT,          -- Personal memory it was promoted from
+		created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+		FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+		UNIQUE(tenant_id, kind, key)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_team_memory_tenant ON team_memory(tenant_id, updated_at);
+
+	CREATE VIRTUAL TABLE IF NOT EXISTS team_memory_fts USING fts5(
+		key,
+		value,
+		content_rowid=rowid
+	);
+
+	CREATE TRIGGER IF NOT EXISTS team_memory_fts_insert AFTER INSERT ON team_memory BEGIN
+		INSERT INTO team_memory_fts(rowid, key, value) VALUES (new.rowid, new.key, new.value);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_memory_fts_delete AFTER DELETE ON team_memory BEGIN
+		DELETE FROM team_memory_fts WHERE rowid = OLD.rowid;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS team_memory_fts_update AFTER UPDATE OF key, value ON team_memory BEGIN
+		UPDATE team_memory_fts SET key = NEW.key, value = NEW.value WHERE rowid = NEW.rowid;
+	END;
+`
+
+// teamMigrations evolve team.db in order. Append new steps; never edit or
+// reorder ones that have shipped. Version 1 is the schema databases were
+// created with before migrations were versioned.
+var teamMigrations = []Migration{
+	{Version: 1, Description: "Initial team schema", Up: execSchema(teamSchema)},
+	{Version: 2, Description: "Plan candidates", Up: execSchema(planCandidatesSchema)},
+	{Version: 3, Description: "Plan examples", Up: execSchema(planExamplesSchema)},
+	{Version: 4, Description: "Graph full-text search", Up: execSchema(graphSearchSchema)},
+	{Version: 5, Description: "Team memory", Up: execSchema(teamMemorySchema)},
+	{Version: 6, Description: "Retention pins", Up: func(tx *sql.Tx) error {
+		for _, table := range []string{"team_conversations", "team_messages", "team_documents", "team_plan_executions"} {
+			if err := ensureColumns(tx, table, []string{"pinned INTEGER NOT NULL DEFAULT 0"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{Version: 7, Description: "Entity aliases", Up: func(tx *sql.Tx) error {
+		if err := execSchema(entityAliasSchema)(tx); err != nil {
+			return err
+		}
+		return backfillAliases(tx)
+	}},
+	{Version: 8, Description: "Indexing", Up: func(tx *sql.Tx) error {
+		if err := execSchema(indexSchema)(tx); err != nil {
+			return err
+		}
+		// Code ingestion used to tag relations with their document
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO team_relation_sources (tenant_id, relation_id, document_id)
+			SELECT tenant_id, id, json_extract(metadata_json, '$.document') FROM team_relations
+			WHERE json_valid(metadata_json) AND json_extract(metadata_json, '$.document') IS NOT NULL
+		`)
+		return err
+	}},
 }
 
-func ensureSchemaVersion(db *sql.DB, version int, description string) error {
-	var current sql.NullInt64
-	if err := db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&current); err != nil {
+// ensureColumns adds any missing columns to an existing table. Each
+// definition starts with the column name.
+func ensureColumns(tx *sql.Tx, table string, definitions []string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
 		return err
 	}
-
-	if !current.Valid || int(current.Int64) < version {
-		_, err := db.Exec(
-			"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
-			version,
-			description,
-		)
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
 		return err
 	}
 
+	for _, def := range definitions {
+		name, _, _ := strings.Cut(def, " ")
+		if existing[name] {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + def); err != nil {
+			return fmt.Errorf("add %s.%s: %w", table, name, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,275 @@
+// Package memory provides tenant-scoped team memory shared by all members.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Team memory kinds.
+const (
+	TeamFactKind   = "fact"   // "our staging host is X", team conventions
+	TeamActionKind = "action" // Shared aliases: trigger -> action
+)
+
+// Team roles, matching config.TeamMember.Role.
+const (
+	RoleAdmin  = "admin"  // Manage every team memory
+	RoleMember = "member" // Add team memories and change their own
+	RoleViewer = "viewer" // Read only
+)
+
+// ErrPermission is returned when a member's role does not allow a change.
+var ErrPermission = errors.New("permission denied")
+
+// TeamActor is the member making a change to team memory.
+type TeamActor struct {
+	ID   string
+	Role string // Empty when the member is unknown; every change is refused
+}
+
+// TeamFact is one shared fact or action.
+type TeamFact struct {
+	ID         string  `json:"id"`
+	Kind       string  `json:"kind"`
+	Key        string  `json:"key"`
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+	CreatedBy  string  `json:"created_by"`
+	UpdatedBy  string  `json:"updated_by"`
+	SourceID   string  `json:"source_id,omitempty"`
+	CreatedAt  int64   `json:"created_at"`
+	UpdatedAt  int64   `json:"updated_at"`
+}
+
+// TeamMemoryStore reads and writes a tenant's shared memory.
+type TeamMemoryStore struct {
+	db       *sql.DB
+	tenantID string
+}
+
+// NewTeamMemoryStore creates a team memory store for a tenant.
+func NewTeamMemoryStore(db *sql.DB, tenantID string) *TeamMemoryStore {
+	return &TeamMemoryStore{db: db, tenantID: tenantID}
+}
+
+// authorize reports whether actor may change a memory created by owner.
+// owner is empty for a new memory.
+func (a TeamActor) authorize(owner string) error {
+	switch strings.ToLower(a.Role) {
+	case RoleAdmin:
+		return nil
+	case RoleMember:
+		if owner == "" || owner == a.ID {
+			return nil
+		}
+		return fmt.Errorf("%w: only admins can change team memories added by %s", ErrPermission, owner)
+	case "":
+		return fmt.Errorf("%w: the local user is not a team member with a role", ErrPermission)
+	default:
+		return fmt.Errorf("%w: role %q cannot change team memory", ErrPermission, a.Role)
+	}
+}
+
+// Get returns the team memory with the given kind and key, or nil.
+func (t *TeamMemoryStore) Get(ctx context.Context, kind, key string) (*TeamFact, error) {
+	if t == nil || t.db == nil {
+		return nil, fmt.Errorf("team database not configured")
+	}
+	row := t.db.QueryRowContext(ctx, `
+		SELECT id, kind, key, value, confidence, created_by, updated_by, COALESCE(source_id, ''), created_at, updated_at
+		FROM team_memory
+		WHERE tenant_id = ? AND kind = ? AND key = ?
+	`, t.tenantID, kind, key)
+	f, err := scanTeamFact(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return f, err
+}
+
+// List returns the tenant's team memories, newest first.
+func (t *TeamMemoryStore) List(ctx context.Context) ([]TeamFact, error) {
+	if t == nil || t.db == nil {
+		return nil, fmt.Errorf("team database not configured")
+	}
+	rows, err := t.db.QueryContext(ctx, `
+		SELECT id, kind, key, value, confidence, created_by, updated_by, COALESCE(source_id, ''), created_at, updated_at
+		FROM team_memory
+		WHERE tenant_id = ?
+		ORDER BY updated_at DESC
+	`, t.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []TeamFact
+	for rows.Next() {
+		f, err := scanTeamFact(rows)
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, *f)
+	}
+	return facts, rows.Err()
+}
+
+// Put adds or updates a team memory. An existing memory with a different
+// value is only replaced when overwrite is set, and only by its author or
+// an admin.
+func (t *TeamMemoryStore) Put(ctx context.Context, actor TeamActor, f TeamFact, overwrite bool) (*TeamFact, error) {
+	if t == nil || t.db == nil {
+		return nil, fmt.Errorf("team database not configured")
+	}
+	f.Key, f.Value = strings.TrimSpace(f.Key), strings.TrimSpace(f.Value)
+	if f.Kind == "" {
+		f.Kind = TeamFactKind
+	}
+	if f.Kind != TeamFactKind && f.Kind != TeamActionKind {
+		return nil, fmt.Errorf("unknown team memory kind %q", f.Kind)
+	}
+	if f.Key == "" || f.Value == "" {
+		return nil, fmt.Errorf("team memory needs a key and value")
+	}
+	if f.Confidence <= 0 {
+		f.Confidence = 0.8
+	}
+
+	existing, err := t.Get(ctx, f.Kind, f.Key)
+	if err != nil {
+		return nil, err
+	}
+	owner := ""
+	if existing != nil {
+		owner = existing.CreatedBy
+		if existing.Value != f.Value && !overwrite {
+			return nil, fmt.Errorf("team already has %s = %s", existing.Key, existing.Value)
+		}
+	}
+	if err := actor.authorize(owner); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if existing == nil {
+		f.ID, f.CreatedBy, f.CreatedAt = uuid.New().String(), actor.ID, now
+	} else {
+		f.ID, f.CreatedBy, f.CreatedAt = existing.ID, existing.CreatedBy, existing.CreatedAt
+	}
+	f.UpdatedBy, f.UpdatedAt = actor.ID, now
+
+	_, err = t.db.ExecContext(ctx, `
+		INSERT INTO team_memory (id, tenant_id, kind, key, value, confidence, created_by, updated_by, source_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT(tenant_id, kind, key) DO UPDATE SET
+			value = excluded.value,
+			confidence = excluded.confidence,
+			updated_by = excluded.updated_by,
+			source_id = COALESCE(excluded.source_id, source_id),
+			updated_at = excluded.updated_at
+	`, f.ID, t.tenantID, f.Kind, f.Key, f.Value, f.Confidence, f.CreatedBy, f.UpdatedBy, f.SourceID, f.CreatedAt, f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Delete removes a team memory if actor may change it.
+func (t *TeamMemoryStore) Delete(ctx context.Context, actor TeamActor, kind, key string) error {
+	f, err := t.Get(ctx, kind, key)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return fmt.Errorf("team %s %q not found", kind, key)
+	}
+	if err := actor.authorize(f.CreatedBy); err != nil {
+		return err
+	}
+	_, err = t.db.ExecContext(ctx, `DELETE FROM team_memory WHERE id = ?`, f.ID)
+	return err
+}
+
+// ============================================================
+// Promotion
+// ============================================================
+
+// PromoteOptions controls copying a personal memory into team memory.
+type PromoteOptions struct {
+	Kind      string // profile or action; empty tries profile, then action
+	As        string // Team key; defaults to the personal key
+	Overwrite bool   // Replace a different team value
+}
+
+// Promote copies a personal profile fact or action into the tenant's team
+// memory as the manager's team actor. The personal memory is kept.
+func (m *MemoryManager) Promote(ctx context.Context, key string, opts PromoteOptions) (*TeamFact, error) {
+	if m == nil || m.personal == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	if m.team == nil {
+		return nil, fmt.Errorf("team database not configured")
+	}
+
+	kinds := []string{KindProfile, KindAction}
+	if opts.Kind != "" {
+		kinds = []string{opts.Kind}
+	}
+	var current *storedConfidence
+	var kind string
+	for _, k := range kinds {
+		if k != KindProfile && k != KindAction {
+			return nil, fmt.Errorf("only profile facts and actions can be promoted, not %q", k)
+		}
+		c, err := m.store.lookupConfidence(ctx, k, key)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			current, kind = c, k
+			break
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no personal memory %q", key)
+	}
+
+	f := TeamFact{
+		Kind:       TeamFactKind,
+		Key:        key,
+		Value:      current.value,
+		Confidence: m.store.ConfidencePolicy().Effective(current.confidence, current.setAt, time.Now()),
+		SourceID:   current.id,
+	}
+	if kind == KindAction {
+		f.Kind = TeamActionKind
+	}
+	if opts.As != "" {
+		f.Key = opts.As
+	}
+	return m.teamMemory().Put(ctx, m.actor, f, opts.Overwrite)
+}
+
+// SetTeamActor sets the member whose role governs changes to team memory.
+func (m *MemoryManager) SetTeamActor(actor TeamActor) {
+	m.actor = actor
+}
+
+func (m *MemoryManager) teamMemory() *TeamMemoryStore {
+	return NewTeamMemoryStore(m.team, m.tenantID)
+}
+
+func scanTeamFact(row rowScanner) (*TeamFact, error) {
+	var f TeamFact
+	if err := row.Scan(&f.ID, &f.Kind, &f.Key, &f.Value, &f.Confidence, &f.CreatedBy, &f.UpdatedBy, &f.SourceID, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
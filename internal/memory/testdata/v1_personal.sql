@@ -0,0 +1,166 @@
+-- personal.db as created before schema migrations were versioned: the
+-- version 1 schema, recorded the way those builds recorded it.
+
+-- Schema version tracking
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	applied_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	description TEXT
+);
+
+-- ============================================================
+-- CONVERSATIONS & MESSAGES (Personal)
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS conversations (
+	id              TEXT PRIMARY KEY,
+	user_id         TEXT NOT NULL,
+	created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	title           TEXT,
+	summary         TEXT,
+	message_count   INTEGER NOT NULL DEFAULT 0,
+	is_archived     INTEGER NOT NULL DEFAULT 0,
+	metadata_json   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user ON conversations(user_id, updated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_conversations_created ON conversations(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_conversations_archived ON conversations(is_archived);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id              TEXT PRIMARY KEY,
+	conversation_id TEXT NOT NULL,
+	role            TEXT NOT NULL,
+	content         TEXT NOT NULL,
+	tokens_used     INTEGER NOT NULL DEFAULT 0,
+	cost            REAL NOT NULL DEFAULT 0,
+	tier            INTEGER NOT NULL DEFAULT 0,
+	model           TEXT,
+	plan_id         TEXT,
+	created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	metadata_json   TEXT,
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_tier ON messages(tier);
+
+-- ============================================================
+-- MEMORY: USER PROFILE FACTS
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS memory_profile (
+	id          TEXT PRIMARY KEY,
+	field       TEXT NOT NULL,
+	value       TEXT NOT NULL,
+	confidence  REAL NOT NULL DEFAULT 0.7,
+	updated_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	UNIQUE(field)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memory_profile_field ON memory_profile(field);
+
+-- ============================================================
+-- MEMORY: PERSONAL ACTIONS
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS memory_actions (
+	id            TEXT PRIMARY KEY,
+	trigger       TEXT NOT NULL,
+	action        TEXT NOT NULL,
+	metadata_json TEXT,
+	confidence    REAL NOT NULL DEFAULT 0.7,
+	updated_at    INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	UNIQUE(trigger)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memory_actions_trigger ON memory_actions(trigger);
+
+-- ============================================================
+-- USER PROFILE
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS user_profile (
+	id              TEXT PRIMARY KEY,
+	name            TEXT,
+	timezone        TEXT DEFAULT 'UTC',
+	language        TEXT DEFAULT 'en',
+	response_style  TEXT DEFAULT 'balanced',
+	cost_sensitivity TEXT DEFAULT 'balanced',
+	preferences_json TEXT,
+	created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+	updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+);
+
+-- ============================================================
+-- COST TRACKING (Personal)
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS cost_history (
+	id              TEXT PRIMARY KEY,
+	date            TEXT NOT NULL,
+	hour            INTEGER NOT NULL,
+	tier            INTEGER NOT NULL,
+	model           TEXT NOT NULL,
+	request_type    TEXT,
+	tokens_input    INTEGER NOT NULL DEFAULT 0,
+	tokens_output   INTEGER NOT NULL DEFAULT 0,
+	tokens_total    INTEGER NOT NULL DEFAULT 0,
+	cost            REAL NOT NULL DEFAULT 0,
+	created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_date ON cost_history(date);
+CREATE INDEX IF NOT EXISTS idx_cost_date_hour ON cost_history(date, hour);
+CREATE INDEX IF NOT EXISTS idx_cost_tier ON cost_history(tier);
+
+-- ============================================================
+-- FULL-TEXT SEARCH
+-- ============================================================
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	content,
+	content_rowid=rowid
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+	DELETE FROM messages_fts WHERE rowid = OLD.rowid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE ON messages BEGIN
+	UPDATE messages_fts SET content = NEW.content WHERE rowid = NEW.rowid;
+END;
+
+-- ============================================================
+-- TRIGGERS
+-- ============================================================
+
+CREATE TRIGGER IF NOT EXISTS conversations_updated
+	AFTER UPDATE ON conversations
+	BEGIN
+		UPDATE conversations SET updated_at = strftime('%s', 'now') WHERE id = NEW.id;
+	END;
+
+CREATE TRIGGER IF NOT EXISTS messages_count_insert
+	AFTER INSERT ON messages
+	BEGIN
+		UPDATE conversations
+		SET message_count = message_count + 1, updated_at = strftime('%s', 'now')
+		WHERE id = NEW.conversation_id;
+	END;
+
+CREATE TRIGGER IF NOT EXISTS messages_count_delete
+	AFTER DELETE ON messages
+	BEGIN
+		UPDATE conversations
+		SET message_count = message_count - 1, updated_at = strftime('%s', 'now')
+		WHERE id = OLD.conversation_id;
+	END;
+
+INSERT INTO schema_migrations (version, description) VALUES (1, 'Initial personal schema');
@@ -0,0 +1,313 @@
+// Package memory provides path finding and neighborhood traversal over the
+// knowledge graph.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Traversal defaults and limits.
+const (
+	DefaultTraversalDepth = 4
+	MaxTraversalDepth     = 8
+	defaultNeighborhood   = 100
+	traversalBatch        = 400
+)
+
+// TraversalOptions selects the relations a traversal may follow.
+type TraversalOptions struct {
+	RelationTypes []string // Relation types to follow; empty follows all
+	MinConfidence float64  // Skip relations below this confidence
+	Directed      bool     // Only follow relations from source to target
+	MaxDepth      int      // Most hops to take; 0 uses DefaultTraversalDepth
+	Limit         int      // Most entities a neighborhood returns
+}
+
+// GraphPath is a chain of entities; Relations[i] joins Entities[i] and
+// Entities[i+1], in either direction.
+type GraphPath struct {
+	Entities  []*Entity
+	Relations []*Relation
+}
+
+// Hops returns the number of relations on the path.
+func (p *GraphPath) Hops() int {
+	return len(p.Relations)
+}
+
+// Subgraph is the neighborhood of an entity.
+type Subgraph struct {
+	Entities  []*Entity
+	Relations []*Relation
+	Depth     map[string]int // Hops from the start, by entity ID
+}
+
+// ShortestPath returns a path with the fewest hops between two entities, or
+// nil when none exists within opts.MaxDepth.
+func (g *GraphStore) ShortestPath(ctx context.Context, tenantID, fromID, toID string, opts TraversalOptions) (*GraphPath, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	maxDepth, err := traversalDepth(opts.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	// via maps each reached entity to the relation that reached it
+	via := map[string]*Relation{fromID: nil}
+	frontier := []string{fromID}
+	for depth := 0; depth < maxDepth && len(frontier) > 0 && fromID != toID; depth++ {
+		relations, err := g.relationsAround(ctx, tenantID, frontier, opts)
+		if err != nil {
+			return nil, err
+		}
+		inFrontier := setOf(frontier)
+		var next []string
+		for _, r := range relations {
+			for _, step := range [][2]string{{r.SourceID, r.TargetID}, {r.TargetID, r.SourceID}} {
+				from, to := step[0], step[1]
+				if !inFrontier[from] || (opts.Directed && from != r.SourceID) {
+					continue
+				}
+				if _, seen := via[to]; seen {
+					continue
+				}
+				via[to] = r
+				next = append(next, to)
+			}
+		}
+		if _, found := via[toID]; found {
+			break
+		}
+		frontier = next
+	}
+	if _, found := via[toID]; !found {
+		return nil, nil
+	}
+
+	// Walk back from the target to the start
+	ids := []string{toID}
+	var relations []*Relation
+	for id := toID; id != fromID; {
+		r := via[id]
+		relations = append(relations, r)
+		if r.SourceID == id {
+			id = r.TargetID
+		} else {
+			id = r.SourceID
+		}
+		ids = append(ids, id)
+	}
+	reverse(ids)
+	reverse(relations)
+
+	entities, err := g.entitiesByID(ctx, tenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	path := &GraphPath{Relations: relations}
+	for _, id := range ids {
+		e := entities[id]
+		if e == nil {
+			e = &Entity{ID: id, TenantID: tenantID, Name: id, EntityType: "unknown"}
+		}
+		path.Entities = append(path.Entities, e)
+	}
+	return path, nil
+}
+
+// Neighborhood returns the entities within hops of an entity and the
+// relations followed to reach them, nearest first.
+func (g *GraphStore) Neighborhood(ctx context.Context, tenantID, entityID string, hops int, opts TraversalOptions) (*Subgraph, error) {
+	if g == nil || g.db == nil {
+		return nil, fmt.Errorf("graph store not initialized")
+	}
+	hops, err := traversalDepth(hops)
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultNeighborhood
+	}
+
+	depth := map[string]int{entityID: 0}
+	order := []string{entityID}
+	var followed []*Relation
+	seenRel := map[string]bool{}
+	frontier := []string{entityID}
+	for d := 1; d <= hops && len(frontier) > 0 && len(order) < limit; d++ {
+		relations, err := g.relationsAround(ctx, tenantID, frontier, opts)
+		if err != nil {
+			return nil, err
+		}
+		inFrontier := setOf(frontier)
+		var next []string
+		for _, r := range relations {
+			for _, step := range [][2]string{{r.SourceID, r.TargetID}, {r.TargetID, r.SourceID}} {
+				from, to := step[0], step[1]
+				if !inFrontier[from] || (opts.Directed && from != r.SourceID) {
+					continue
+				}
+				if _, seen := depth[to]; !seen && len(order) < limit {
+					depth[to] = d
+					order = append(order, to)
+					next = append(next, to)
+				}
+			}
+			if !seenRel[r.ID] {
+				seenRel[r.ID] = true
+				followed = append(followed, r)
+			}
+		}
+		frontier = next
+	}
+
+	entities, err := g.entitiesByID(ctx, tenantID, order)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subgraph{Depth: depth}
+	for _, id := range order {
+		if e := entities[id]; e != nil {
+			sub.Entities = append(sub.Entities, e)
+		}
+	}
+	for _, r := range followed {
+		_, src := depth[r.SourceID]
+		_, dst := depth[r.TargetID]
+		if src && dst {
+			sub.Relations = append(sub.Relations, r)
+		}
+	}
+	return sub, nil
+}
+
+// relationsAround returns the relations touching any of the entities that
+// pass the traversal filters.
+func (g *GraphStore) relationsAround(ctx context.Context, tenantID string, ids []string, opts TraversalOptions) ([]*Relation, error) {
+	var out []*Relation
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > traversalBatch {
+			batch = batch[:traversalBatch]
+		}
+		ids = ids[len(batch):]
+
+		marks := placeholders(len(batch))
+		query := `
+			SELECT id, tenant_id, source_id, target_id, relation_type, metadata_json, confidence, created_at, updated_at
+			FROM team_relations
+			WHERE tenant_id = ? AND COALESCE(confidence, 1) >= ?`
+		args := []any{tenantID, opts.MinConfidence}
+		if opts.Directed {
+			query += ` AND source_id IN (` + marks + `)`
+			args = appendStrings(args, batch)
+		} else {
+			query += ` AND (source_id IN (` + marks + `) OR target_id IN (` + marks + `))`
+			args = appendStrings(appendStrings(args, batch), batch)
+		}
+		if len(opts.RelationTypes) > 0 {
+			query += ` AND relation_type COLLATE NOCASE IN (` + placeholders(len(opts.RelationTypes)) + `)`
+			args = appendStrings(args, opts.RelationTypes)
+		}
+		query += ` ORDER BY confidence DESC, updated_at DESC`
+
+		rows, err := g.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var r Relation
+			if err := rows.Scan(
+				&r.ID, &r.TenantID, &r.SourceID, &r.TargetID, &r.RelationType, &r.MetadataJSON,
+				&r.Confidence, &r.CreatedAt, &r.UpdatedAt,
+			); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out = append(out, &r)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// entitiesByID loads entities by ID; missing IDs are left out of the map.
+func (g *GraphStore) entitiesByID(ctx context.Context, tenantID string, ids []string) (map[string]*Entity, error) {
+	out := make(map[string]*Entity, len(ids))
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > traversalBatch {
+			batch = batch[:traversalBatch]
+		}
+		ids = ids[len(batch):]
+
+		rows, err := g.db.QueryContext(ctx, `
+			SELECT id, tenant_id, name, entity_type, description, metadata_json, embedding_id, importance, created_at, updated_at
+			FROM team_entities
+			WHERE tenant_id = ? AND id IN (`+placeholders(len(batch))+`)
+		`, appendStrings([]any{tenantID}, batch)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var e Entity
+			if err := rows.Scan(
+				&e.ID, &e.TenantID, &e.Name, &e.EntityType, &e.Description, &e.MetadataJSON,
+				&e.EmbeddingID, &e.Importance, &e.CreatedAt, &e.UpdatedAt,
+			); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out[e.ID] = &e
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func traversalDepth(depth int) (int, error) {
+	if depth <= 0 {
+		return DefaultTraversalDepth, nil
+	}
+	if depth > MaxTraversalDepth {
+		return 0, fmt.Errorf("traversals are limited to %d hops", MaxTraversalDepth)
+	}
+	return depth, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func appendStrings(args []any, values []string) []any {
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+func setOf(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,183 @@
+// Package memory provides matching of messages against learned action triggers.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Trigger matching thresholds.
+const (
+	minTriggerSimilarity = 0.85 // Edit-distance similarity for typos and small rewordings
+	minTriggerConfidence = 0.5  // Actions whose decayed confidence is below this are too uncertain to run unasked
+	minFuzzyTriggerLen   = 5    // Shorter triggers must match exactly
+)
+
+// ActionMatch is a learned action whose trigger matches a message.
+type ActionMatch struct {
+	Trigger    string
+	Action     string
+	Confidence float64
+	Score      float64 // Trigger similarity (0-1)
+}
+
+// Exact reports whether the message has the trigger's words, ignoring
+// filler words and order. Anything less is a guess at a typo.
+func (a *ActionMatch) Exact() bool {
+	return a.Score >= 1
+}
+
+// triggerFillers are words that do not change what a trigger means.
+var triggerFillers = map[string]bool{
+	"please": true, "pls": true, "plz": true, "flynn": true, "hey": true,
+	"can": true, "could": true, "would": true, "you": true, "now": true,
+	"the": true, "a": true, "an": true, "for": true, "me": true,
+}
+
+var triggerWordRegex = regexp.MustCompile(`[\p{L}\p{N}_./-]+`)
+
+// identifierWord matches words that name one specific thing, such as db2,
+// api_v1 or src/cmd, where a one-letter difference is a different thing.
+var identifierWord = regexp.MustCompile(`[\p{N}_./-]`)
+
+// MatchAction returns the learned action whose trigger best matches the
+// message, tolerating filler words, word order and small typos. It returns
+// nil when nothing matches, or when the message is itself defining a new
+// trigger ("when I say X, do Y").
+func (m *MemoryStore) MatchAction(ctx context.Context, message string) (*ActionMatch, error) {
+	if m == nil || m.db == nil {
+		return nil, fmt.Errorf("memory store not initialized")
+	}
+	if trigger, _ := extractAction(message); trigger != "" {
+		return nil, nil
+	}
+	normalized := normalizeTrigger(message)
+	if normalized == "" {
+		return nil, nil
+	}
+
+	policy := m.ConfidencePolicy()
+	threshold := math.Max(minTriggerConfidence, policy.Min)
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT trigger, action, `+policy.sqlEffective("t", time.Now().Unix())+` AS effective
+		FROM memory_actions t
+		WHERE effective >= ?
+		ORDER BY effective DESC, updated_at DESC
+	`, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *ActionMatch
+	for rows.Next() {
+		var a ActionMatch
+		if err := rows.Scan(&a.Trigger, &a.Action, &a.Confidence); err != nil {
+			return nil, err
+		}
+		a.Score = triggerSimilarity(normalizeTrigger(a.Trigger), normalized)
+		if a.Score > 0 && (best == nil || a.Score > best.Score) {
+			best = &a
+		}
+	}
+	return best, rows.Err()
+}
+
+// triggerSimilarity scores normalized trigger and message text. Identical
+// word sets score 1; otherwise the edit-distance ratio must clear
+// minTriggerSimilarity, and words with digits or identifier punctuation
+// must appear in both.
+func triggerSimilarity(trigger, message string) float64 {
+	if trigger == "" || message == "" {
+		return 0
+	}
+	if trigger == message || sameWords(trigger, message) {
+		return 1
+	}
+	if len(trigger) < minFuzzyTriggerLen || differentIdentifiers(trigger, message) {
+		return 0
+	}
+	a, b := []rune(trigger), []rune(message)
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	ratio := 1 - float64(levenshtein(a, b))/float64(longest)
+	if ratio < minTriggerSimilarity {
+		return 0
+	}
+	return ratio
+}
+
+// normalizeTrigger lowercases text, strips punctuation and drops filler words.
+func normalizeTrigger(text string) string {
+	var words []string
+	for _, w := range triggerWordRegex.FindAllString(strings.ToLower(text), -1) {
+		w = strings.Trim(w, "./-")
+		if w != "" && !triggerFillers[w] {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func sameWords(a, b string) bool {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	if len(wa) != len(wb) {
+		return false
+	}
+	counts := make(map[string]int, len(wa))
+	for _, w := range wa {
+		counts[w]++
+	}
+	for _, w := range wb {
+		if counts[w] == 0 {
+			return false
+		}
+		counts[w]--
+	}
+	return true
+}
+
+// differentIdentifiers reports whether either text has an identifier word
+// the other lacks.
+func differentIdentifiers(a, b string) bool {
+	counts := make(map[string]int)
+	for _, w := range strings.Fields(a) {
+		counts[w]++
+	}
+	for _, w := range strings.Fields(b) {
+		counts[w]--
+	}
+	for w, n := range counts {
+		if n != 0 && identifierWord.MatchString(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -20,3 +20,11 @@ type Model interface {
 	// Status returns the current status of the model.
 	Status() *ModelStatus
 }
+
+// Embedder is implemented by models that can also embed text as vectors.
+// Callers check for it with a type assertion and fall back to text search
+// when a model does not implement it.
+type Embedder interface {
+	// Embed returns one vector per text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
@@ -222,6 +222,10 @@ func ListTemplates() []string {
 func Instantiate(template *Plan, vars map[string]string) (*Plan, error) {
 	plan := *template
 	plan.ID = "" // Will be set when stored
+
+	// Copy steps so filling variables doesn't mutate the template
+	plan.Steps = append([]PlanStep(nil), template.Steps...)
+
 	// Fill default variables from template if not provided.
 	for _, v := range plan.Variables {
 		if _, ok := vars[v.Name]; ok {
@@ -337,6 +341,12 @@ func Validate(plan *Plan) error {
 		}
 		stepIDs[step.ID] = true
 
+		switch step.OnFailure {
+		case "", FailureAbort, FailureContinue, FailureRetry:
+		default:
+			return fmt.Errorf("step %d: unknown failure policy %q", i+1, step.OnFailure)
+		}
+
 		// Validate dependencies
 		for _, dep := range step.Depends {
 			if !stepIDs[dep] {
@@ -0,0 +1,648 @@
+// Package planlib provides the plan executor that runs stored plans as a DAG.
+package planlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/subagent"
+)
+
+// FailurePolicy controls how the executor reacts to a failed step.
+type FailurePolicy string
+
+const (
+	// FailureAbort stops scheduling new steps and cancels running ones.
+	FailureAbort FailurePolicy = "abort"
+	// FailureContinue keeps running steps that do not depend on the failed one.
+	FailureContinue FailurePolicy = "continue"
+	// FailureRetry retries the step and aborts once retries are exhausted.
+	FailureRetry FailurePolicy = "retry"
+)
+
+// ExecutorConfig configures a plan executor.
+type ExecutorConfig struct {
+	Policy         FailurePolicy    // Default failure policy (abort)
+	MaxRetries     int              // Retries per step under FailureRetry (2)
+	RetryDelay     time.Duration    // Base delay between retries (500ms)
+	MaxParallel    int              // Max concurrently running steps (4)
+	DefaultTimeout int              // Step timeout in seconds when unset (60)
+	OnStep         func(StepResult) // Optional progress callback
+}
+
+// Executor runs plans against the subagent registry.
+type Executor struct {
+	library   *PlanLibrary
+	subagents *subagent.Registry
+	config    ExecutorConfig
+}
+
+// NewExecutor creates a plan executor. library may be nil to skip persistence.
+func NewExecutor(library *PlanLibrary, subagents *subagent.Registry, cfg *ExecutorConfig) *Executor {
+	c := ExecutorConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Policy == "" {
+		c.Policy = FailureAbort
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 2
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 500 * time.Millisecond
+	}
+	if c.MaxParallel <= 0 {
+		c.MaxParallel = 4
+	}
+	if c.DefaultTimeout <= 0 {
+		c.DefaultTimeout = 60
+	}
+	return &Executor{library: library, subagents: subagents, config: c}
+}
+
+// stepRefRegex matches {{steps.N...}} and {{previous_result}} references.
+var stepRefRegex = regexp.MustCompile(`\{\{\s*(steps\.\d+(?:\.[\w\-]+)*|previous_result)\s*\}\}`)
+
+// stopGrace is how long a step gets to return once its context is
+// cancelled, by a timeout or an aborted plan.
+const stopGrace = 5 * time.Second
+
+// stepOutcome carries a finished step back to the scheduler.
+type stepOutcome struct {
+	id     int
+	result StepResult
+}
+
+// Execute runs an instantiated plan and returns the full execution record.
+// Step failures are reported through the execution status, not the error.
+func (e *Executor) Execute(ctx context.Context, tenantID string, plan *Plan, vars map[string]string) (*PlanExecution, error) {
+	if e.subagents == nil {
+		return nil, fmt.Errorf("subagent registry not initialized")
+	}
+	if plan == nil || len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("plan has no steps")
+	}
+
+	steps, deps, err := e.prepare(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	exec := &PlanExecution{
+		TenantID:  tenantID,
+		PlanID:    plan.ID,
+		Variables: make(map[string]any, len(vars)),
+		Results:   []StepResult{},
+		Status:    "running",
+		StartedAt: time.Now().Unix(),
+		StepCount: len(plan.Steps),
+	}
+	for k, v := range vars {
+		exec.Variables[k] = v
+	}
+
+	if e.library != nil {
+		if err := e.library.CreateExecution(ctx, tenantID, exec); err != nil {
+			return nil, fmt.Errorf("create execution: %w", err)
+		}
+	}
+
+	start := time.Now()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(map[int]StepResult, len(steps))
+	started := make(map[int]bool, len(steps))
+	done := make(chan stepOutcome, len(steps))
+	running := 0
+	aborted := false
+	var firstErr string
+
+	order := make([]int, 0, len(steps))
+	for id := range steps {
+		order = append(order, id)
+	}
+	sort.Ints(order)
+
+	for {
+		// Skip blocked steps and launch ready ones until nothing changes.
+		for changed := true; changed; {
+			changed = false
+			for _, id := range order {
+				if started[id] {
+					continue
+				}
+				if aborted {
+					e.record(exec, results, skippedResult(id, "plan aborted"))
+					started[id] = true
+					changed = true
+					continue
+				}
+				ready := true
+				for _, dep := range deps[id] {
+					r, ok := results[dep]
+					if !ok {
+						ready = false
+						break
+					}
+					if !r.Success {
+						e.record(exec, results, skippedResult(id, fmt.Sprintf("dependency step %d did not succeed", dep)))
+						started[id] = true
+						changed = true
+						ready = false
+						break
+					}
+				}
+				if !ready || started[id] || running >= e.config.MaxParallel {
+					continue
+				}
+
+				input, err := resolveStepRefs(steps[id], results, deps[id])
+				started[id] = true
+				changed = true
+				if err != nil {
+					done <- stepOutcome{id: id, result: StepResult{StepID: id, Error: err.Error()}}
+					running++
+					continue
+				}
+				running++
+				go func(step PlanStep) {
+					done <- stepOutcome{id: step.ID, result: e.runStep(runCtx, step)}
+				}(withInput(steps[id], input))
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		out := <-done
+		running--
+		e.record(exec, results, out.result)
+		if e.config.OnStep != nil {
+			e.config.OnStep(out.result)
+		}
+
+		if !out.result.Success {
+			if firstErr == "" {
+				firstErr = fmt.Sprintf("step %d: %s", out.id, out.result.Error)
+			}
+			if e.policyFor(steps[out.id]) != FailureContinue && !aborted {
+				aborted = true
+				cancel()
+			}
+		}
+
+		if e.library != nil {
+			_ = e.library.UpdateExecution(ctx, tenantID, exec)
+		}
+	}
+
+	sort.Slice(exec.Results, func(i, j int) bool {
+		return exec.Results[i].StepID < exec.Results[j].StepID
+	})
+
+	exec.Status = "completed"
+	for _, r := range exec.Results {
+		if !r.Success {
+			exec.Status = "failed"
+			exec.Error = firstErr
+			break
+		}
+	}
+	exec.DurationMs = time.Since(start).Milliseconds()
+	if exec.DurationMs == 0 {
+		exec.DurationMs = 1
+	}
+
+	if e.library != nil {
+		if err := e.library.UpdateExecution(ctx, tenantID, exec); err != nil {
+			return exec, fmt.Errorf("update execution: %w", err)
+		}
+	} else {
+		exec.CompletedAt = time.Now().Unix()
+	}
+
+	return exec, nil
+}
+
+// prepare validates the plan graph and returns steps by ID with their
+// effective dependencies (declared plus those implied by references).
+func (e *Executor) prepare(plan *Plan) (map[int]PlanStep, map[int][]int, error) {
+	steps := make(map[int]PlanStep, len(plan.Steps))
+	for _, step := range plan.Steps {
+		if _, dup := steps[step.ID]; dup {
+			return nil, nil, fmt.Errorf("duplicate step id %d", step.ID)
+		}
+		sub, ok := e.subagents.Get(step.Subagent)
+		if !ok {
+			return nil, nil, fmt.Errorf("step %d: unknown subagent %q", step.ID, step.Subagent)
+		}
+		if !sub.ValidateAction(step.Action) {
+			return nil, nil, fmt.Errorf("step %d: subagent %q does not support action %q", step.ID, step.Subagent, step.Action)
+		}
+		switch step.OnFailure {
+		case "", FailureAbort, FailureContinue, FailureRetry:
+		default:
+			return nil, nil, fmt.Errorf("step %d: unknown failure policy %q", step.ID, step.OnFailure)
+		}
+		steps[step.ID] = step
+	}
+
+	deps := make(map[int][]int, len(steps))
+	for id, step := range steps {
+		seen := map[int]bool{}
+		add := func(dep int) error {
+			if dep == id {
+				return fmt.Errorf("step %d depends on itself", id)
+			}
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("step %d depends on unknown step %d", id, dep)
+			}
+			if !seen[dep] {
+				seen[dep] = true
+				deps[id] = append(deps[id], dep)
+			}
+			return nil
+		}
+		for _, dep := range step.Depends {
+			if err := add(dep); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, ref := range collectRefs(step.Input) {
+			if ref == "previous_result" {
+				if len(step.Depends) == 0 {
+					if _, ok := steps[id-1]; ok {
+						if err := add(id - 1); err != nil {
+							return nil, nil, err
+						}
+					}
+				}
+				continue
+			}
+			n, _ := strconv.Atoi(strings.SplitN(strings.TrimPrefix(ref, "steps."), ".", 2)[0])
+			if err := add(n); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if err := checkAcyclic(steps, deps); err != nil {
+		return nil, nil, err
+	}
+	return steps, deps, nil
+}
+
+// runStep executes a single step with its timeout and retry policy.
+func (e *Executor) runStep(ctx context.Context, step PlanStep) StepResult {
+	attempts := 1
+	if e.policyFor(step) == FailureRetry {
+		attempts += e.config.MaxRetries
+		if step.Retries > 0 {
+			attempts = 1 + step.Retries
+		}
+	}
+
+	var result StepResult
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var stopped bool
+		result, stopped = e.runOnce(ctx, step)
+		result.Attempts = attempt
+		// A step still running would overlap its retry
+		if result.Success || !stopped || ctx.Err() != nil || attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(e.config.RetryDelay * time.Duration(attempt)):
+		}
+	}
+	return result
+}
+
+// runOnce executes a single attempt of a step. The step's context is
+// cancelled when it times out, and stopped is false when the subagent had
+// not returned stopGrace later.
+func (e *Executor) runOnce(ctx context.Context, step PlanStep) (result StepResult, stopped bool) {
+	start := time.Now()
+	sub, ok := e.subagents.Get(step.Subagent)
+	if !ok {
+		return StepResult{StepID: step.ID, Error: fmt.Sprintf("unknown subagent: %s", step.Subagent)}, true
+	}
+
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = e.config.DefaultTimeout
+	}
+	stepCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	type reply struct {
+		res *subagent.Result
+		err error
+	}
+	ch := make(chan reply, 1)
+	go func() {
+		res, err := sub.Execute(stepCtx, &subagent.PlanStep{
+			ID:       step.ID,
+			Subagent: step.Subagent,
+			Action:   step.Action,
+			Input:    step.Input,
+			Depends:  step.Depends,
+			Timeout:  timeout,
+		})
+		ch <- reply{res: res, err: err}
+	}()
+
+	var r reply
+	select {
+	case r = <-ch:
+	case <-stepCtx.Done():
+		msg := stepCtx.Err().Error()
+		if stepCtx.Err() == context.DeadlineExceeded {
+			msg = fmt.Sprintf("step timed out after %ds", timeout)
+		}
+		cancel()
+		select {
+		case <-ch:
+			stopped = true
+		case <-time.After(stopGrace):
+			msg += "; the step did not stop when cancelled"
+		}
+		return StepResult{StepID: step.ID, Error: msg, DurationMs: time.Since(start).Milliseconds()}, stopped
+	}
+
+	if r.err != nil {
+		return StepResult{StepID: step.ID, Error: r.err.Error(), DurationMs: time.Since(start).Milliseconds()}, true
+	}
+	if r.res == nil {
+		return StepResult{StepID: step.ID, Error: "subagent returned no result", DurationMs: time.Since(start).Milliseconds()}, true
+	}
+
+	duration := r.res.DurationMs
+	if duration == 0 {
+		duration = time.Since(start).Milliseconds()
+	}
+	return StepResult{
+		StepID:     step.ID,
+		Success:    r.res.Success,
+		Data:       r.res.Data,
+		Error:      r.res.Error,
+		TokensUsed: r.res.TokensUsed,
+		Cost:       r.res.Cost,
+		DurationMs: duration,
+	}, true
+}
+
+// policyFor returns the effective failure policy for a step.
+func (e *Executor) policyFor(step PlanStep) FailurePolicy {
+	if step.OnFailure != "" {
+		return step.OnFailure
+	}
+	return e.config.Policy
+}
+
+// record stores a step result and updates execution totals.
+func (e *Executor) record(exec *PlanExecution, results map[int]StepResult, r StepResult) {
+	exec.Results = append(exec.Results, r)
+	results[r.StepID] = r
+	if r.Success {
+		exec.StepsCompleted++
+	}
+	exec.TotalTokens += r.TokensUsed
+	exec.TotalCost += r.Cost
+}
+
+// ============================================================
+// Step References
+// ============================================================
+
+// resolveStepRefs returns the step input with {{steps.N...}} references
+// replaced by the outputs of earlier steps.
+func resolveStepRefs(step PlanStep, results map[int]StepResult, deps []int) (map[string]any, error) {
+	prev := 0
+	for _, dep := range deps {
+		if dep > prev {
+			prev = dep
+		}
+	}
+	resolved, err := resolveValue(step.Input, results, prev)
+	if err != nil {
+		return nil, fmt.Errorf("step %d: %w", step.ID, err)
+	}
+	input, _ := resolved.(map[string]any)
+	return input, nil
+}
+
+func resolveValue(v any, results map[int]StepResult, prev int) (any, error) {
+	switch val := v.(type) {
+	case string:
+		return resolveString(val, results, prev)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			r, err := resolveValue(item, results, prev)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			r, err := resolveValue(item, results, prev)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+func resolveString(s string, results map[int]StepResult, prev int) (any, error) {
+	matches := stepRefRegex.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	// A string that is exactly one reference keeps the referenced type.
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		return lookupRef(s[matches[0][2]:matches[0][3]], results, prev)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		val, err := lookupRef(s[m[2]:m[3]], results, prev)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(refString(val))
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// lookupRef resolves "steps.N.data.a.b", "steps.N.error", "steps.N.success"
+// or "previous_result" against completed step results.
+func lookupRef(ref string, results map[int]StepResult, prev int) (any, error) {
+	if ref == "previous_result" {
+		r, ok := results[prev]
+		if !ok {
+			return nil, fmt.Errorf("{{previous_result}} has no previous step")
+		}
+		return normalizeData(r.Data), nil
+	}
+
+	parts := strings.Split(ref, ".")
+	id, _ := strconv.Atoi(parts[1])
+	r, ok := results[id]
+	if !ok {
+		return nil, fmt.Errorf("reference %q: step %d has not run", ref, id)
+	}
+
+	var cur any = map[string]any{
+		"success": r.Success,
+		"data":    normalizeData(r.Data),
+		"error":   r.Error,
+	}
+	if len(parts) == 2 {
+		return cur, nil
+	}
+	for _, key := range parts[2:] {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("reference %q: key %q not found", ref, key)
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("reference %q: index %q out of range", ref, key)
+			}
+			cur = node[i]
+		default:
+			return nil, fmt.Errorf("reference %q: cannot index into %T", ref, cur)
+		}
+	}
+	return cur, nil
+}
+
+// normalizeData converts subagent output into plain maps and slices so
+// references can navigate it regardless of the concrete Go type.
+func normalizeData(data any) any {
+	if data == nil {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return data
+	}
+	return out
+}
+
+func refString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(raw)
+	}
+}
+
+// collectRefs returns all step references found in a step input.
+func collectRefs(v any) []string {
+	var refs []string
+	switch val := v.(type) {
+	case string:
+		for _, m := range stepRefRegex.FindAllStringSubmatch(val, -1) {
+			refs = append(refs, m[1])
+		}
+	case map[string]any:
+		for _, item := range val {
+			refs = append(refs, collectRefs(item)...)
+		}
+	case []any:
+		for _, item := range val {
+			refs = append(refs, collectRefs(item)...)
+		}
+	}
+	return refs
+}
+
+// ============================================================
+// Helpers
+// ============================================================
+
+// checkAcyclic reports an error if the dependency graph contains a cycle.
+func checkAcyclic(steps map[int]PlanStep, deps map[int][]int) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int]int, len(steps))
+	var visit func(id int) error
+	visit = func(id int) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("dependency cycle at step %d", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, dep := range deps[id] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	for id := range steps {
+		if err := visit(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skippedResult(id int, reason string) StepResult {
+	return StepResult{StepID: id, Skipped: true, Error: "skipped: " + reason}
+}
+
+func withInput(step PlanStep, input map[string]any) PlanStep {
+	step.Input = input
+	return step
+}
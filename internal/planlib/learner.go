@@ -0,0 +1,414 @@
+// Package planlib provides plan learning from successful tool-call sessions.
+package planlib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flynn-ai/flynn/internal/subagent"
+	"github.com/google/uuid"
+)
+
+// TraceStep is a single tool call made by the model.
+type TraceStep struct {
+	Tool    string         `json:"tool"`  // Tool registry name, e.g. "file_read"
+	Input   map[string]any `json:"input"` // Arguments the model passed
+	Success bool           `json:"success"`
+}
+
+// Trace is a tool-call session that solved a user request.
+type Trace struct {
+	Intent    string            `json:"intent"`    // Classified intent, e.g. "code.fix_tests"
+	Message   string            `json:"message"`   // Original user message
+	Variables map[string]string `json:"variables"` // Variables extracted by the classifier
+	Steps     []TraceStep       `json:"steps"`
+}
+
+// PlanCandidate is a learned plan waiting for promotion.
+type PlanCandidate struct {
+	ID           string `json:"id"`
+	TenantID     string `json:"tenant_id"`
+	Intent       string `json:"intent"`
+	Signature    string `json:"signature"`
+	Plan         *Plan  `json:"plan"`
+	Example      string `json:"example,omitempty"`
+	SuccessCount int    `json:"success_count"`
+	Status       string `json:"status"` // pending, promoted, rejected
+	PlanID       string `json:"plan_id,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// LearnerConfig configures plan learning.
+type LearnerConfig struct {
+	PromoteAfter int // Similar successes needed before auto-promotion (3)
+}
+
+// Learner turns successful tool-call traces into reusable plans.
+type Learner struct {
+	library      *PlanLibrary
+	subagents    *subagent.Registry
+	promoteAfter int
+}
+
+// NewLearner creates a plan learner.
+func NewLearner(library *PlanLibrary, subagents *subagent.Registry, cfg *LearnerConfig) *Learner {
+	promoteAfter := 3
+	if cfg != nil && cfg.PromoteAfter > 0 {
+		promoteAfter = cfg.PromoteAfter
+	}
+	return &Learner{library: library, subagents: subagents, promoteAfter: promoteAfter}
+}
+
+// toolActionAliases maps tool names that don't follow "<subagent>_<action>".
+var toolActionAliases = map[string][2]string{
+	"code_search":  {"file", "search"},
+	"graph_ingest": {"graph", "ingest_file"},
+}
+
+// Observe records a successful trace as a plan candidate and promotes it
+// once enough similar successes have been seen.
+func (l *Learner) Observe(ctx context.Context, tenantID string, trace *Trace) (*PlanCandidate, error) {
+	if l == nil || l.library == nil {
+		return nil, fmt.Errorf("plan learner not initialized")
+	}
+
+	plan, err := l.Generalize(trace)
+	if err != nil {
+		return nil, err
+	}
+	signature := planSignature(plan)
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	_, err = l.library.db.ExecContext(ctx, `
+		INSERT INTO team_plan_candidates (id, tenant_id, intent_category, signature, plan_json, example, success_count, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 1, 'pending', ?, ?)
+		ON CONFLICT(tenant_id, intent_category, signature) DO UPDATE SET
+			success_count = success_count + 1,
+			plan_json = excluded.plan_json,
+			example = excluded.example,
+			updated_at = excluded.updated_at
+	`, uuid.New().String(), tenantID, plan.Intent, signature, planJSON, trace.Message, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate, err := l.getCandidate(ctx, tenantID, "intent_category = ? AND signature = ?", plan.Intent, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if candidate.Status == "promoted" {
+		_ = l.library.AddExample(ctx, tenantID, candidate.PlanID, candidate.Intent, trace.Message)
+	}
+
+	if candidate.Status == "pending" && candidate.SuccessCount >= l.promoteAfter {
+		// Don't silently replace a plan the intent already has; that needs approval
+		if _, err := l.library.GetPattern(ctx, tenantID, candidate.Intent); err == ErrPatternNotFound {
+			if err := l.promote(ctx, tenantID, candidate); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return candidate, nil
+}
+
+// Approve promotes a candidate immediately, replacing any existing plan for its intent.
+func (l *Learner) Approve(ctx context.Context, tenantID, candidateID string) (*Plan, error) {
+	candidate, err := l.getCandidate(ctx, tenantID, "id = ?", candidateID)
+	if err != nil {
+		return nil, err
+	}
+	if candidate.Status == "promoted" {
+		return l.library.GetByID(ctx, tenantID, candidate.PlanID)
+	}
+	if err := l.promote(ctx, tenantID, candidate); err != nil {
+		return nil, err
+	}
+	return candidate.Plan, nil
+}
+
+// Reject marks a candidate so it is never promoted.
+func (l *Learner) Reject(ctx context.Context, tenantID, candidateID string) error {
+	result, err := l.library.db.ExecContext(ctx, `
+		UPDATE team_plan_candidates SET status = 'rejected', updated_at = ?
+		WHERE id = ? AND tenant_id = ?
+	`, time.Now().Unix(), candidateID, tenantID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrCandidateNotFound
+	}
+	return nil
+}
+
+// ListCandidates returns learned candidates, optionally filtered by status.
+func (l *Learner) ListCandidates(ctx context.Context, tenantID, status string) ([]*PlanCandidate, error) {
+	query := `
+		SELECT id, tenant_id, intent_category, signature, plan_json, example, success_count, status, plan_id, created_at, updated_at
+		FROM team_plan_candidates
+		WHERE tenant_id = ?`
+	args := []any{tenantID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY success_count DESC, updated_at DESC`
+
+	rows, err := l.library.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*PlanCandidate
+	for rows.Next() {
+		c, err := scanCandidate(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// Generalize converts a trace into a plan template. Arguments holding a
+// variable the classifier extracted become {{variables}}.
+func (l *Learner) Generalize(trace *Trace) (*Plan, error) {
+	if trace == nil || trace.Intent == "" {
+		return nil, fmt.Errorf("trace has no intent")
+	}
+
+	// Build the lookup of message-derived values, longest first so
+	// "src/api" wins over "src" when both were extracted.
+	type binding struct{ name, value string }
+	var bindings []binding
+	for name, value := range trace.Variables {
+		if strings.TrimSpace(value) != "" {
+			bindings = append(bindings, binding{name, value})
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		if len(bindings[i].value) != len(bindings[j].value) {
+			return len(bindings[i].value) > len(bindings[j].value)
+		}
+		return bindings[i].name < bindings[j].name
+	})
+
+	variables := map[string]*Variable{}
+	var varOrder []string
+	useVar := func(name string) string {
+		if _, ok := variables[name]; !ok {
+			variables[name] = &Variable{
+				Name:        name,
+				Type:        "string",
+				Description: fmt.Sprintf("%s taken from the request", name),
+				Required:    true,
+			}
+			varOrder = append(varOrder, name)
+		}
+		return "{{" + name + "}}"
+	}
+
+	// Literals the classifier didn't name stay literal; Instantiate could
+	// never bind a variable named after them.
+	templatize := func(value string) string {
+		for _, b := range bindings {
+			if value == b.value {
+				return useVar(b.name)
+			}
+		}
+		for _, b := range bindings {
+			if len(b.value) >= 3 && strings.Contains(value, b.value) {
+				value = strings.ReplaceAll(value, b.value, useVar(b.name))
+			}
+		}
+		return value
+	}
+
+	plan := &Plan{
+		Intent:      trace.Intent,
+		Description: fmt.Sprintf("Learned plan for %s", trace.Intent),
+	}
+
+	// A session's tool calls run in parallel, so its steps depend on none
+	// of each other
+	for _, ts := range trace.Steps {
+		if !ts.Success {
+			continue // The model recovered from it; don't replay failures
+		}
+		sub, action, err := l.resolveTool(ts.Tool)
+		if err != nil {
+			return nil, err
+		}
+		input := make(map[string]any, len(ts.Input))
+		for k, v := range ts.Input {
+			if k == "action" {
+				continue
+			}
+			if s, ok := v.(string); ok {
+				input[k] = templatize(s)
+			} else {
+				input[k] = v
+			}
+		}
+
+		id := len(plan.Steps) + 1
+		plan.Steps = append(plan.Steps, PlanStep{
+			ID:       id,
+			Subagent: sub,
+			Action:   action,
+			Input:    input,
+			Timeout:  60,
+		})
+	}
+
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("%w: no successful steps", ErrTraceNotLearnable)
+	}
+	for _, name := range varOrder {
+		plan.Variables = append(plan.Variables, *variables[name])
+	}
+
+	if err := Validate(plan); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTraceNotLearnable, err)
+	}
+	return plan, nil
+}
+
+// resolveTool maps a tool registry name to a subagent and action.
+func (l *Learner) resolveTool(tool string) (string, string, error) {
+	sub, action := "", ""
+	if alias, ok := toolActionAliases[tool]; ok {
+		sub, action = alias[0], alias[1]
+	} else if i := strings.Index(tool, "_"); i > 0 {
+		sub, action = tool[:i], tool[i+1:]
+	}
+	if sub == "" {
+		return "", "", fmt.Errorf("%w: tool %q has no subagent", ErrTraceNotLearnable, tool)
+	}
+	if l.subagents != nil {
+		agent, ok := l.subagents.Get(sub)
+		if !ok || !agent.ValidateAction(action) {
+			return "", "", fmt.Errorf("%w: tool %q has no subagent action", ErrTraceNotLearnable, tool)
+		}
+	}
+	return sub, action, nil
+}
+
+// promote stores a candidate's plan in the library and marks it promoted.
+func (l *Learner) promote(ctx context.Context, tenantID string, candidate *PlanCandidate) error {
+	plan := candidate.Plan
+
+	if pattern, err := l.library.GetPattern(ctx, tenantID, candidate.Intent); err == nil {
+		// Replace the existing plan for this intent in place
+		plan.ID = pattern.PlanID
+		if err := l.library.Update(ctx, tenantID, plan); err != nil {
+			return err
+		}
+	} else if err == ErrPatternNotFound {
+		if err := l.library.Store(ctx, tenantID, plan); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	// Start the pattern from the observed successes so GetBestPattern picks it
+	now := time.Now().Unix()
+	if _, err := l.library.db.ExecContext(ctx, `
+		UPDATE team_plan_patterns
+		SET plan_id = ?,
+		    usage_count = ?,
+		    success_count = ?,
+		    failure_count = 0,
+		    success_rate = 1.0,
+		    last_succeeded = ?,
+		    updated_at = ?
+		WHERE tenant_id = ? AND intent_category = ?
+	`, plan.ID, candidate.SuccessCount, candidate.SuccessCount, now, now, tenantID, candidate.Intent); err != nil {
+		return err
+	}
+
+	if _, err := l.library.db.ExecContext(ctx, `
+		UPDATE team_plan_candidates SET status = 'promoted', plan_id = ?, updated_at = ?
+		WHERE id = ? AND tenant_id = ?
+	`, plan.ID, now, candidate.ID, tenantID); err != nil {
+		return err
+	}
+
+	candidate.Status = "promoted"
+	candidate.PlanID = plan.ID
+	return l.library.AddExample(ctx, tenantID, plan.ID, candidate.Intent, candidate.Example)
+}
+
+func (l *Learner) getCandidate(ctx context.Context, tenantID, where string, args ...any) (*PlanCandidate, error) {
+	row := l.library.db.QueryRowContext(ctx, `
+		SELECT id, tenant_id, intent_category, signature, plan_json, example, success_count, status, plan_id, created_at, updated_at
+		FROM team_plan_candidates
+		WHERE tenant_id = ? AND `+where, append([]any{tenantID}, args...)...)
+	c, err := scanCandidate(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrCandidateNotFound
+	}
+	return c, err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCandidate(row rowScanner) (*PlanCandidate, error) {
+	var c PlanCandidate
+	var planJSON string
+	var example, planID sql.NullString
+	if err := row.Scan(&c.ID, &c.TenantID, &c.Intent, &c.Signature, &planJSON, &example,
+		&c.SuccessCount, &c.Status, &planID, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.Example = example.String
+	c.PlanID = planID.String
+	if err := json.Unmarshal([]byte(planJSON), &c.Plan); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// planSignature identifies plans that replay the same way: the same actions
+// with the same arguments. Variables appear as their {{placeholders}}, so
+// requests differing only in variable values share a signature, while a
+// literal the classifier didn't name keeps sessions with other literals
+// apart; each must succeed on its own before it is promoted.
+func planSignature(plan *Plan) string {
+	parts := make([]string, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		keys := make([]string, 0, len(step.Input))
+		for k := range step.Input {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		args := make([]string, 0, len(keys))
+		for _, k := range keys {
+			value, err := json.Marshal(step.Input[k])
+			if err != nil {
+				value = []byte(fmt.Sprintf("%q", fmt.Sprint(step.Input[k])))
+			}
+			args = append(args, k+"="+string(value))
+		}
+		parts = append(parts, fmt.Sprintf("%s.%s(%s)", step.Subagent, step.Action, strings.Join(args, ",")))
+	}
+	return strings.Join(parts, ">")
+}
@@ -0,0 +1,316 @@
+// Package planlib provides similarity-based plan retrieval.
+package planlib
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMinConfidence is the match confidence below which callers should
+// fall back to the model.
+const DefaultMinConfidence = 0.6
+
+// maxExamplesPerPlan bounds how many example requests are kept per plan.
+const maxExamplesPerPlan = 20
+
+// PlanMatch is a ranked plan candidate for a request.
+type PlanMatch struct {
+	Plan         *Plan        `json:"plan"`
+	Pattern      *PlanPattern `json:"pattern"`
+	Confidence   float64      `json:"confidence"`    // Combined score, 0-1
+	IntentScore  float64      `json:"intent_score"`  // Intent label similarity
+	TextScore    float64      `json:"text_score"`    // Keyword overlap with stored examples
+	SuccessScore float64      `json:"success_score"` // Smoothed success rate
+	RecencyScore float64      `json:"recency_score"` // Decays with time since last use
+	Example      string       `json:"example,omitempty"`
+}
+
+// AddExample stores a request phrasing that a plan handled.
+func (p *PlanLibrary) AddExample(ctx context.Context, tenantID, planID, intent, request string) error {
+	request = strings.TrimSpace(request)
+	if request == "" {
+		return nil
+	}
+
+	_, err := p.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO team_plan_examples (id, tenant_id, plan_id, intent_category, request, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, uuid.New().String(), tenantID, planID, intent, request, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	// Keep only the most recent examples per plan
+	_, err = p.db.ExecContext(ctx, `
+		DELETE FROM team_plan_examples
+		WHERE tenant_id = ? AND plan_id = ? AND id NOT IN (
+			SELECT id FROM team_plan_examples
+			WHERE tenant_id = ? AND plan_id = ?
+			ORDER BY created_at DESC
+			LIMIT ?
+		)
+	`, tenantID, planID, tenantID, planID, maxExamplesPerPlan)
+	return err
+}
+
+// ListExamples returns stored example requests for a plan.
+func (p *PlanLibrary) ListExamples(ctx context.Context, tenantID, planID string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT request FROM team_plan_examples
+		WHERE tenant_id = ? AND plan_id = ?
+		ORDER BY created_at DESC
+	`, tenantID, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var examples []string
+	for rows.Next() {
+		var request string
+		if err := rows.Scan(&request); err != nil {
+			return nil, err
+		}
+		examples = append(examples, request)
+	}
+	return examples, rows.Err()
+}
+
+// FindSimilar ranks proven plans for a request by intent similarity,
+// keyword overlap with stored examples, success rate and recency.
+func (p *PlanLibrary) FindSimilar(ctx context.Context, tenantID, intent, message string, limit int) ([]*PlanMatch, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT pt.id, pt.tenant_id, pt.intent_category, pt.plan_id, pt.usage_count, pt.success_count, pt.failure_count,
+		       pt.success_rate, COALESCE(pt.last_used, 0), pt.created_at, pt.updated_at, pl.description
+		FROM team_plan_patterns pt
+		JOIN team_plans pl ON pl.id = pt.plan_id AND pl.tenant_id = pt.tenant_id
+		WHERE pt.tenant_id = ? AND pl.is_active = 1 AND pt.success_count > 0
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	byPlan := map[string]*PlanMatch{}
+	for rows.Next() {
+		var pattern PlanPattern
+		var description string
+		if err := rows.Scan(
+			&pattern.ID, &pattern.TenantID, &pattern.IntentCategory, &pattern.PlanID,
+			&pattern.UsageCount, &pattern.SuccessCount, &pattern.FailureCount,
+			&pattern.SuccessRate, &pattern.LastUsed, &pattern.CreatedAt, &pattern.UpdatedAt,
+			&description,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m := &PlanMatch{
+			Pattern:      &pattern,
+			IntentScore:  intentSimilarity(intent, pattern.IntentCategory),
+			SuccessScore: float64(pattern.SuccessCount+1) / float64(pattern.UsageCount+2),
+			RecencyScore: recencyScore(max(pattern.LastUsed, pattern.UpdatedAt)),
+		}
+		// The description counts as an example so hand-written plans can match too
+		m.TextScore = keywordSimilarity(message, description)
+		byPlan[pattern.PlanID] = m
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(byPlan) == 0 {
+		return nil, nil
+	}
+
+	if err := p.scoreExamples(ctx, tenantID, message, byPlan); err != nil {
+		return nil, err
+	}
+
+	matches := make([]*PlanMatch, 0, len(byPlan))
+	for _, m := range byPlan {
+		// Either a matching intent or matching phrasing is strong evidence
+		relevance := 1 - (1-m.IntentScore)*(1-m.TextScore)
+		m.Confidence = 0.75*relevance + 0.15*m.SuccessScore + 0.10*m.RecencyScore
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Confidence != matches[j].Confidence {
+			return matches[i].Confidence > matches[j].Confidence
+		}
+		return matches[i].Pattern.UsageCount > matches[j].Pattern.UsageCount
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	for _, m := range matches {
+		plan, err := p.GetByID(ctx, tenantID, m.Pattern.PlanID)
+		if err != nil {
+			return nil, err
+		}
+		m.Plan = plan
+	}
+	return matches, nil
+}
+
+// BestMatch returns the top plan for a request, or ErrNoConfidentMatch when
+// no plan reaches minConfidence.
+func (p *PlanLibrary) BestMatch(ctx context.Context, tenantID, intent, message string, minConfidence float64) (*PlanMatch, error) {
+	if minConfidence <= 0 {
+		minConfidence = DefaultMinConfidence
+	}
+	matches, err := p.FindSimilar(ctx, tenantID, intent, message, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 || matches[0].Confidence < minConfidence {
+		return nil, ErrNoConfidentMatch
+	}
+	return matches[0], nil
+}
+
+// scoreExamples uses FTS over stored examples to find phrasings that share
+// keywords with the request, keeping the best overlap per plan.
+func (p *PlanLibrary) scoreExamples(ctx context.Context, tenantID, message string, byPlan map[string]*PlanMatch) error {
+	keywords := requestKeywords(message)
+	if len(keywords) == 0 {
+		return nil
+	}
+	terms := make([]string, len(keywords))
+	for i, k := range keywords {
+		terms[i] = `"` + k + `"*`
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT e.plan_id, e.request
+		FROM team_plan_examples_fts f
+		JOIN team_plan_examples e ON e.rowid = f.rowid
+		WHERE team_plan_examples_fts MATCH ? AND e.tenant_id = ?
+		ORDER BY bm25(team_plan_examples_fts)
+		LIMIT 100
+	`, strings.Join(terms, " OR "), tenantID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var planID, request string
+		if err := rows.Scan(&planID, &request); err != nil {
+			return err
+		}
+		m, ok := byPlan[planID]
+		if !ok {
+			continue
+		}
+		if score := keywordSimilarity(message, request); score > m.TextScore {
+			m.TextScore = score
+			m.Example = request
+		}
+	}
+	return rows.Err()
+}
+
+// ============================================================
+// Scoring Helpers
+// ============================================================
+
+var wordRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+var requestStopWords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true,
+	"is": true, "are": true, "be": true, "do": true, "does": true,
+	"i": true, "me": true, "my": true, "you": true, "it": true, "we": true,
+	"please": true, "can": true, "could": true, "would": true, "will": true,
+	"this": true, "that": true, "these": true, "those": true,
+	"to": true, "for": true, "of": true, "with": true, "by": true,
+	"from": true, "in": true, "on": true, "at": true, "as": true, "into": true,
+	"now": true, "all": true, "some": true,
+}
+
+// requestKeywords returns normalized, de-duplicated keywords for a request.
+func requestKeywords(text string) []string {
+	var keywords []string
+	seen := map[string]bool{}
+	for _, word := range wordRegex.FindAllString(strings.ToLower(text), -1) {
+		if len(word) < 2 || requestStopWords[word] {
+			continue
+		}
+		word = stemWord(word)
+		if !seen[word] {
+			seen[word] = true
+			keywords = append(keywords, word)
+		}
+	}
+	return keywords
+}
+
+// stemWord strips common English suffixes so "tests" matches "test".
+func stemWord(word string) string {
+	switch {
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		return word[:len(word)-3]
+	case len(word) > 4 && strings.HasSuffix(word, "es") && !strings.HasSuffix(word, "ses"):
+		return word[:len(word)-1]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// keywordSimilarity returns the Dice coefficient of two texts' keywords.
+func keywordSimilarity(a, b string) float64 {
+	ka, kb := requestKeywords(a), requestKeywords(b)
+	if len(ka) == 0 || len(kb) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(ka))
+	for _, k := range ka {
+		set[k] = true
+	}
+	shared := 0
+	for _, k := range kb {
+		if set[k] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ka)+len(kb))
+}
+
+// intentSimilarity compares two "category.subcategory" intents.
+func intentSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	catA, subA, _ := strings.Cut(a, ".")
+	catB, subB, _ := strings.Cut(b, ".")
+	subScore := keywordSimilarity(strings.ReplaceAll(subA, "_", " "), strings.ReplaceAll(subB, "_", " "))
+	if catA == catB {
+		return 0.5 + 0.5*subScore
+	}
+	return 0.5 * subScore
+}
+
+// recencyScore decays with a 30-day half-life.
+func recencyScore(ts int64) float64 {
+	if ts <= 0 {
+		return 0
+	}
+	days := time.Since(time.Unix(ts, 0)).Hours() / 24
+	if days < 0 {
+		days = 0
+	}
+	return math.Pow(0.5, days/30)
+}
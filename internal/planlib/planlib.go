@@ -228,16 +228,18 @@ func (p *PlanLibrary) CreateExecution(ctx context.Context, tenantID string, exec
 		INSERT INTO team_plan_executions (id, tenant_id, plan_id, variables_json, status, started_at, total_tokens, total_cost, step_count, steps_completed, steps_json)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, exec.ID, tenantID, exec.PlanID, variablesJSON, exec.Status, exec.StartedAt,
-		exec.TotalTokens, exec.TotalCost, len(exec.Results), 0, stepsJSON)
+		exec.TotalTokens, exec.TotalCost, exec.StepCount, exec.StepsCompleted, stepsJSON)
 
 	return err
 }
 
 // UpdateExecution updates a plan execution record.
 func (p *PlanLibrary) UpdateExecution(ctx context.Context, tenantID string, exec *PlanExecution) error {
-	exec.CompletedAt = time.Now().Unix()
-	if exec.DurationMs == 0 {
-		exec.DurationMs = exec.CompletedAt - exec.StartedAt*1000
+	if exec.Status != "running" {
+		exec.CompletedAt = time.Now().Unix()
+		if exec.DurationMs == 0 {
+			exec.DurationMs = (exec.CompletedAt - exec.StartedAt) * 1000
+		}
 	}
 
 	stepsJSON, err := json.Marshal(exec.Results)
@@ -250,7 +252,7 @@ func (p *PlanLibrary) UpdateExecution(ctx context.Context, tenantID string, exec
 		SET status = ?, completed_at = ?, duration_ms = ?, total_tokens = ?, total_cost = ?, steps_completed = ?, steps_json = ?, error_message = ?
 		WHERE id = ? AND tenant_id = ?
 	`, exec.Status, exec.CompletedAt, exec.DurationMs, exec.TotalTokens, exec.TotalCost,
-		len(exec.Results), stepsJSON, exec.Error, exec.ID, tenantID)
+		exec.StepsCompleted, stepsJSON, exec.Error, exec.ID, tenantID)
 
 	return err
 }
@@ -260,7 +262,7 @@ func (p *PlanLibrary) GetPattern(ctx context.Context, tenantID, intent string) (
 	var pattern PlanPattern
 
 	err := p.db.QueryRowContext(ctx, `
-		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, last_used, created_at, updated_at
+		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, COALESCE(last_used, 0), created_at, updated_at
 		FROM team_plan_patterns
 		WHERE tenant_id = ? AND intent_category = ?
 	`, tenantID, intent).Scan(
@@ -284,7 +286,7 @@ func (p *PlanLibrary) GetBestPattern(ctx context.Context, tenantID, intent strin
 	var pattern PlanPattern
 
 	err := p.db.QueryRowContext(ctx, `
-		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, last_used, created_at, updated_at
+		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, COALESCE(last_used, 0), created_at, updated_at
 		FROM team_plan_patterns
 		WHERE tenant_id = ? AND intent_category = ? AND success_count > 0
 		ORDER BY success_rate DESC, usage_count DESC
@@ -308,7 +310,7 @@ func (p *PlanLibrary) GetBestPattern(ctx context.Context, tenantID, intent strin
 // ListPatterns returns all patterns for a tenant.
 func (p *PlanLibrary) ListPatterns(ctx context.Context, tenantID string) ([]*PlanPattern, error) {
 	rows, err := p.db.QueryContext(ctx, `
-		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, last_used, created_at, updated_at
+		SELECT id, tenant_id, intent_category, plan_id, usage_count, success_count, failure_count, success_rate, COALESCE(last_used, 0), created_at, updated_at
 		FROM team_plan_patterns
 		WHERE tenant_id = ?
 		ORDER BY usage_count DESC
@@ -408,32 +410,37 @@ func (p *PlanLibrary) GetExecutionHistory(ctx context.Context, tenantID, planID
 
 // Plan represents an execution plan.
 type Plan struct {
-	ID          string     `json:"id"`
-	Intent      string     `json:"intent"` // e.g., "code.fix_tests"
-	Description string     `json:"description"`
-	Steps       []PlanStep `json:"steps"`
-	Variables   []Variable `json:"variables"`
-	CreatedAt   int64      `json:"created_at"`
-	UpdatedAt   int64      `json:"updated_at"`
+	ID          string     `json:"id" yaml:"id,omitempty"`
+	Intent      string     `json:"intent" yaml:"intent"` // e.g., "code.fix_tests"
+	Description string     `json:"description" yaml:"description"`
+	Steps       []PlanStep `json:"steps" yaml:"steps"`
+	Variables   []Variable `json:"variables" yaml:"variables,omitempty"`
+	CreatedAt   int64      `json:"created_at" yaml:"created_at,omitempty"`
+	UpdatedAt   int64      `json:"updated_at" yaml:"updated_at,omitempty"`
 }
 
 // PlanStep represents a single step in an execution plan.
 type PlanStep struct {
-	ID       int            `json:"id"`
-	Subagent string         `json:"subagent"`
-	Action   string         `json:"action"`
-	Input    map[string]any `json:"input"`
-	Depends  []int          `json:"depends"`
-	Timeout  int            `json:"timeout"`
+	ID       int            `json:"id" yaml:"id"`
+	Subagent string         `json:"subagent" yaml:"subagent"`
+	Action   string         `json:"action" yaml:"action"`
+	Input    map[string]any `json:"input" yaml:"input,omitempty"`
+	Depends  []int          `json:"depends" yaml:"depends,omitempty,flow"`
+	Timeout  int            `json:"timeout" yaml:"timeout,omitempty"`
+
+	// OnFailure overrides the executor's failure policy for this step.
+	OnFailure FailurePolicy `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+	// Retries overrides the executor's retry count for this step.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
 }
 
 // Variable represents a template variable.
 type Variable struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
-	Required    bool   `json:"required"`
-	Default     any    `json:"default,omitempty"`
+	Name        string `json:"name" yaml:"name"`
+	Type        string `json:"type" yaml:"type"`
+	Description string `json:"description" yaml:"description,omitempty"`
+	Required    bool   `json:"required" yaml:"required"`
+	Default     any    `json:"default,omitempty" yaml:"default,omitempty"`
 }
 
 // PlanExecution represents an execution of a plan.
@@ -452,7 +459,7 @@ type PlanExecution struct {
 	TotalTokens    int            `json:"total_tokens"`
 	TotalCost      float64        `json:"total_cost"`
 	StepCount      int            `json:"step_count"`
-	StepsCompleted int            `json:"steps_completed"`
+	StepsCompleted int            `json:"steps_completed"` // Steps that succeeded
 }
 
 // StepResult represents the result of a step.
@@ -464,6 +471,8 @@ type StepResult struct {
 	TokensUsed int     `json:"tokens_used"`
 	Cost       float64 `json:"cost"`
 	DurationMs int64   `json:"duration_ms"`
+	Attempts   int     `json:"attempts,omitempty"`
+	Skipped    bool    `json:"skipped,omitempty"`
 }
 
 // PlanPattern represents a stored pattern with stats.
@@ -490,4 +499,8 @@ type PlanPattern struct {
 var (
 	ErrPlanNotFound    = fmt.Errorf("plan not found")
 	ErrPatternNotFound = fmt.Errorf("pattern not found")
+
+	ErrCandidateNotFound = fmt.Errorf("plan candidate not found")
+	ErrTraceNotLearnable = fmt.Errorf("trace cannot be learned as a plan")
+	ErrNoConfidentMatch  = fmt.Errorf("no plan matched with enough confidence")
 )
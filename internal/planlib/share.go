@@ -0,0 +1,253 @@
+// Package planlib provides plan import and export for sharing between teams.
+package planlib
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Serialization formats for plan documents.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// planDocumentVersion is bumped when the document layout changes.
+const planDocumentVersion = 1
+
+// PlanDocument is the portable file format for sharing plans.
+type PlanDocument struct {
+	Version    int           `json:"version" yaml:"version"`
+	ExportedAt int64         `json:"exported_at,omitempty" yaml:"exported_at,omitempty"`
+	Plans      []*SharedPlan `json:"plans" yaml:"plans"`
+}
+
+// SharedPlan is a plan with its usage stats and example requests.
+type SharedPlan struct {
+	Plan     `yaml:",inline"`
+	Stats    *PlanStats `json:"stats,omitempty" yaml:"stats,omitempty"`
+	Examples []string   `json:"examples,omitempty" yaml:"examples,omitempty"`
+}
+
+// PlanStats summarizes how a plan has performed.
+type PlanStats struct {
+	UsageCount   int     `json:"usage_count" yaml:"usage_count"`
+	SuccessCount int     `json:"success_count" yaml:"success_count"`
+	FailureCount int     `json:"failure_count" yaml:"failure_count"`
+	SuccessRate  float64 `json:"success_rate" yaml:"success_rate"`
+	LastUsed     int64   `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+}
+
+// Export builds a document for the given plans, or all active plans when
+// no IDs are given.
+func (p *PlanLibrary) Export(ctx context.Context, tenantID string, planIDs ...string) (*PlanDocument, error) {
+	var plans []*Plan
+	if len(planIDs) == 0 {
+		all, err := p.List(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		plans = all
+	} else {
+		for _, id := range planIDs {
+			plan, err := p.GetByID(ctx, tenantID, id)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			plans = append(plans, plan)
+		}
+	}
+
+	doc := &PlanDocument{
+		Version:    planDocumentVersion,
+		ExportedAt: time.Now().Unix(),
+		Plans:      make([]*SharedPlan, 0, len(plans)),
+	}
+	for _, plan := range plans {
+		shared := &SharedPlan{Plan: *plan}
+		stats, err := p.planStats(ctx, tenantID, plan.ID)
+		if err != nil {
+			return nil, err
+		}
+		shared.Stats = stats
+		if shared.Examples, err = p.ListExamples(ctx, tenantID, plan.ID); err != nil {
+			return nil, err
+		}
+		doc.Plans = append(doc.Plans, shared)
+	}
+	return doc, nil
+}
+
+// Import validates and stores every plan in a document. A plan whose intent
+// already has one is an error unless replace is set, in which case the
+// existing plan is updated in place. Nothing is written if any plan is invalid.
+func (p *PlanLibrary) Import(ctx context.Context, tenantID string, doc *PlanDocument, replace bool) ([]*Plan, error) {
+	if doc == nil || len(doc.Plans) == 0 {
+		return nil, fmt.Errorf("no plans to import")
+	}
+	if doc.Version > planDocumentVersion {
+		return nil, fmt.Errorf("unsupported plan document version %d", doc.Version)
+	}
+
+	existing := make(map[string]*PlanPattern, len(doc.Plans))
+	seen := make(map[string]bool, len(doc.Plans))
+	for i, shared := range doc.Plans {
+		if err := Validate(&shared.Plan); err != nil {
+			return nil, fmt.Errorf("plan %d (%s): %w", i+1, shared.Intent, err)
+		}
+		if seen[shared.Intent] {
+			return nil, fmt.Errorf("plan %d: duplicate intent %q in document", i+1, shared.Intent)
+		}
+		seen[shared.Intent] = true
+
+		pattern, err := p.GetPattern(ctx, tenantID, shared.Intent)
+		if err == nil {
+			if !replace {
+				return nil, fmt.Errorf("plan %d: intent %q already has a plan (use replace)", i+1, shared.Intent)
+			}
+			existing[shared.Intent] = pattern
+		} else if err != ErrPatternNotFound {
+			return nil, err
+		}
+	}
+
+	imported := make([]*Plan, 0, len(doc.Plans))
+	for _, shared := range doc.Plans {
+		plan := shared.Plan
+		if pattern, ok := existing[plan.Intent]; ok {
+			plan.ID = pattern.PlanID
+			if err := p.Update(ctx, tenantID, &plan); err != nil {
+				return imported, err
+			}
+		} else if err := p.Store(ctx, tenantID, &plan); err != nil {
+			return imported, err
+		}
+
+		for _, example := range shared.Examples {
+			if err := p.AddExample(ctx, tenantID, plan.ID, plan.Intent, example); err != nil {
+				return imported, err
+			}
+		}
+		imported = append(imported, &plan)
+	}
+	return imported, nil
+}
+
+// planStats returns the pattern stats for a plan, or nil if it has none.
+func (p *PlanLibrary) planStats(ctx context.Context, tenantID, planID string) (*PlanStats, error) {
+	var stats PlanStats
+	err := p.db.QueryRowContext(ctx, `
+		SELECT usage_count, success_count, failure_count, success_rate, COALESCE(last_used, 0)
+		FROM team_plan_patterns
+		WHERE tenant_id = ? AND plan_id = ?
+	`, tenantID, planID).Scan(&stats.UsageCount, &stats.SuccessCount, &stats.FailureCount, &stats.SuccessRate, &stats.LastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ============================================================
+// Encoding
+// ============================================================
+
+// FormatFromPath guesses the document format from a file extension.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return ""
+}
+
+// EncodePlans serializes a plan document as YAML or JSON.
+func EncodePlans(doc *PlanDocument, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatYAML, "":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown plan format %q", format)
+	}
+}
+
+// DecodePlans parses a plan document. An empty format is detected from the
+// content. A file holding a single plan is accepted as a one-plan document.
+func DecodePlans(data []byte, format string) (*PlanDocument, error) {
+	if format == "" {
+		format = FormatYAML
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			format = FormatJSON
+		}
+	}
+
+	unmarshal := yaml.Unmarshal
+	switch format {
+	case FormatJSON:
+		unmarshal = json.Unmarshal
+	case FormatYAML:
+	default:
+		return nil, fmt.Errorf("unknown plan format %q", format)
+	}
+
+	var doc PlanDocument
+	if err := unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse plans: %w", err)
+	}
+	if len(doc.Plans) == 0 {
+		var single SharedPlan
+		if err := unmarshal(data, &single); err == nil && single.Intent != "" {
+			doc.Plans = []*SharedPlan{&single}
+		}
+	}
+	if doc.Version == 0 {
+		doc.Version = planDocumentVersion
+	}
+
+	for _, shared := range doc.Plans {
+		shared.Plan.ID = ""
+		for i := range shared.Steps {
+			shared.Steps[i].Input = normalizeInput(shared.Steps[i].Input)
+		}
+	}
+	return &doc, nil
+}
+
+// normalizeInput converts YAML-decoded values into the JSON-compatible
+// shapes the rest of planlib expects (map[string]any, []any, float64).
+func normalizeInput(input map[string]any) map[string]any {
+	if input == nil {
+		return map[string]any{}
+	}
+	if out, ok := normalizeData(input).(map[string]any); ok {
+		return out
+	}
+	return input
+}
@@ -0,0 +1,116 @@
+// Package scheduler runs periodic background jobs in daemon mode.
+//
+// Jobs are plain functions with an interval. Each job runs on its own
+// goroutine; a job never overlaps with itself.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job is a periodic task.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// RunAtStart runs the job once immediately instead of waiting a full interval.
+	RunAtStart bool
+	Run        func(ctx context.Context) error
+}
+
+// Result describes one job run.
+type Result struct {
+	Job      string
+	Started  time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Scheduler runs registered jobs until its context is canceled.
+type Scheduler struct {
+	mu    sync.Mutex
+	jobs  []*Job
+	onRun func(Result)
+}
+
+// New creates a scheduler. onRun, if set, is called after every job run.
+func New(onRun func(Result)) *Scheduler {
+	return &Scheduler{onRun: onRun}
+}
+
+// Add registers a job. Jobs added after Run has started are ignored.
+func (s *Scheduler) Add(job *Job) error {
+	if job == nil || job.Run == nil {
+		return fmt.Errorf("job run function is required")
+	}
+	if job.Interval <= 0 {
+		return fmt.Errorf("job %q: interval must be positive", job.Name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.Name == job.Name {
+			return fmt.Errorf("job %q already registered", job.Name)
+		}
+	}
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+// Jobs returns the registered jobs.
+func (s *Scheduler) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Job(nil), s.jobs...)
+}
+
+// Run starts every job and blocks until ctx is canceled and all running
+// jobs have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.Jobs() {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	if job.RunAtStart {
+		s.runOnce(ctx, job)
+	}
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runOnce(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job *Job) {
+	if ctx.Err() != nil {
+		return
+	}
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.Run(ctx)
+	}()
+	if s.onRun != nil {
+		s.onRun(Result{Job: job.Name, Started: start, Duration: time.Since(start), Err: err})
+	}
+}
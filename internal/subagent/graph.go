@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/flynn-ai/flynn/internal/graph"
 	"github.com/flynn-ai/flynn/internal/memory"
 )
 
@@ -36,6 +37,7 @@ func (g *GraphAgent) Description() string {
 func (g *GraphAgent) Capabilities() []string {
 	return []string{
 		"ingest_file",   // Ingest a file into the document store
+		"ingest_code",   // Ingest the structure of Go packages
 		"ingest_text",   // Ingest raw text content
 		"entity_upsert", // Create or update an entity
 		"link",          // Link two entities
@@ -87,6 +89,12 @@ func (g *GraphAgent) Execute(ctx context.Context, step *PlanStep) (*Result, erro
 			return &Result{Success: false, Error: "path parameter required"}, nil
 		}
 		result, err = g.ingestFile(ctx, tenantID, path)
+	case "ingest_code":
+		path, ok := step.Input["path"].(string)
+		if !ok || path == "" {
+			return &Result{Success: false, Error: "path parameter required"}, nil
+		}
+		result, err = graph.NewCodeIngestor(g.store).IngestGo(ctx, tenantID, path)
 	case "ingest_text":
 		content, ok := step.Input["content"].(string)
 		if !ok || content == "" {
@@ -209,6 +217,10 @@ func (g *GraphAgent) ingestFile(ctx context.Context, tenantID, path string) (any
 	if info.IsDir() {
 		return nil, fmt.Errorf("path is a directory, not a file")
 	}
+	// Go files are ingested by structure, as part of their package
+	if filepath.Ext(absPath) == ".go" {
+		return graph.NewCodeIngestor(g.store).IngestGo(ctx, tenantID, absPath)
+	}
 
 	content, err := os.ReadFile(absPath)
 	if err != nil {
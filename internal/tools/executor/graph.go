@@ -4,12 +4,13 @@ package executor
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 )
 
 // GraphStats shows knowledge graph statistics.
 type GraphStats struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphStats) Name() string { return "graph_stats" }
@@ -19,11 +20,11 @@ func (t *GraphStats) Description() string { return "Show knowledge graph statist
 func (t *GraphStats) Execute(ctx context.Context, input map[string]any) (*Result, error) {
 	start := time.Now()
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	stats, err := t.graph.Stats(ctx)
+	stats, err := t.Graph.Stats(ctx)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -33,7 +34,7 @@ func (t *GraphStats) Execute(ctx context.Context, input map[string]any) (*Result
 
 // GraphSearch searches the knowledge graph.
 type GraphSearch struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphSearch) Name() string { return "graph_search" }
@@ -48,7 +49,7 @@ func (t *GraphSearch) Execute(ctx context.Context, input map[string]any) (*Resul
 		return TimedResult(NewErrorResult(fmt.Errorf("query is required")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
@@ -57,7 +58,7 @@ func (t *GraphSearch) Execute(ctx context.Context, input map[string]any) (*Resul
 		limit = int(l)
 	}
 
-	results, err := t.graph.Search(ctx, query, limit)
+	results, err := t.Graph.Search(ctx, query, limit)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -71,7 +72,7 @@ func (t *GraphSearch) Execute(ctx context.Context, input map[string]any) (*Resul
 
 // GraphDump exports graph data.
 type GraphDump struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphDump) Name() string { return "graph_dump" }
@@ -91,11 +92,11 @@ func (t *GraphDump) Execute(ctx context.Context, input map[string]any) (*Result,
 		limit = int(l)
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	data, err := t.graph.Dump(ctx, format, limit)
+	data, err := t.Graph.Dump(ctx, format, limit)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -108,7 +109,7 @@ func (t *GraphDump) Execute(ctx context.Context, input map[string]any) (*Result,
 
 // GraphQuery queries graph relationships.
 type GraphQuery struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphQuery) Name() string { return "graph_query" }
@@ -123,11 +124,11 @@ func (t *GraphQuery) Execute(ctx context.Context, input map[string]any) (*Result
 		return TimedResult(NewErrorResult(fmt.Errorf("entity is required")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	relations, err := t.graph.QueryRelations(ctx, entity)
+	relations, err := t.Graph.QueryRelations(ctx, entity)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -139,9 +140,102 @@ func (t *GraphQuery) Execute(ctx context.Context, input map[string]any) (*Result
 	}), start), nil
 }
 
+// GraphMatch runs a pattern query over the knowledge graph.
+type GraphMatch struct {
+	Graph GraphService
+}
+
+func (t *GraphMatch) Name() string { return "graph_match" }
+
+func (t *GraphMatch) Description() string { return "Find graph patterns with a MATCH query" }
+
+func (t *GraphMatch) Execute(ctx context.Context, input map[string]any) (*Result, error) {
+	start := time.Now()
+
+	query, ok := input["query"].(string)
+	if !ok || query == "" {
+		return TimedResult(NewErrorResult(fmt.Errorf("query is required")), start), nil
+	}
+
+	if t.Graph == nil {
+		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
+	}
+
+	limit := 0
+	if l, ok := input["limit"].(float64); ok {
+		limit = int(l)
+	}
+
+	result, err := t.Graph.Match(ctx, query, limit)
+	if err != nil {
+		return TimedResult(NewErrorResult(err), start), nil
+	}
+
+	result["query"] = query
+	return TimedResult(NewSuccessResult(result), start), nil
+}
+
+// GraphPath finds how two entities are connected.
+type GraphPath struct {
+	Graph GraphService
+}
+
+func (t *GraphPath) Name() string { return "graph_path" }
+
+func (t *GraphPath) Description() string { return "Find how two entities are connected" }
+
+func (t *GraphPath) Execute(ctx context.Context, input map[string]any) (*Result, error) {
+	start := time.Now()
+
+	from, ok := input["from"].(string)
+	if !ok || from == "" {
+		return TimedResult(NewErrorResult(fmt.Errorf("from is required")), start), nil
+	}
+
+	to, ok := input["to"].(string)
+	if !ok || to == "" {
+		return TimedResult(NewErrorResult(fmt.Errorf("to is required")), start), nil
+	}
+
+	var relations []string
+	switch v := input["relations"].(type) {
+	case string:
+		for _, r := range strings.Split(v, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				relations = append(relations, r)
+			}
+		}
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok && s != "" {
+				relations = append(relations, s)
+			}
+		}
+	}
+
+	minConfidence, _ := input["min_confidence"].(float64)
+	maxHops := 0
+	if h, ok := input["max_hops"].(float64); ok {
+		maxHops = int(h)
+	}
+
+	if t.Graph == nil {
+		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
+	}
+
+	result, err := t.Graph.Path(ctx, from, to, relations, minConfidence, maxHops)
+	if err != nil {
+		return TimedResult(NewErrorResult(err), start), nil
+	}
+
+	result["from"] = from
+	result["to"] = to
+	return TimedResult(NewSuccessResult(result), start), nil
+}
+
 // GraphAddEntity adds an entity to the graph.
 type GraphAddEntity struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphAddEntity) Name() string { return "graph_add_entity" }
@@ -161,11 +255,11 @@ func (t *GraphAddEntity) Execute(ctx context.Context, input map[string]any) (*Re
 		entityType = "unknown"
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	err := t.graph.AddEntity(ctx, entity, entityType, input["properties"])
+	err := t.Graph.AddEntity(ctx, entity, entityType, input["properties"])
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -179,7 +273,7 @@ func (t *GraphAddEntity) Execute(ctx context.Context, input map[string]any) (*Re
 
 // GraphAddRelation adds a relation to the graph.
 type GraphAddRelation struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphAddRelation) Name() string { return "graph_add_relation" }
@@ -204,11 +298,11 @@ func (t *GraphAddRelation) Execute(ctx context.Context, input map[string]any) (*
 		return TimedResult(NewErrorResult(fmt.Errorf("relation is required")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	err := t.graph.AddRelation(ctx, from, to, relation)
+	err := t.Graph.AddRelation(ctx, from, to, relation)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -223,7 +317,7 @@ func (t *GraphAddRelation) Execute(ctx context.Context, input map[string]any) (*
 
 // GraphExport exports graph to file.
 type GraphExport struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphExport) Name() string { return "graph_export" }
@@ -243,11 +337,11 @@ func (t *GraphExport) Execute(ctx context.Context, input map[string]any) (*Resul
 		format = "json"
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	err := t.graph.Export(ctx, path, format)
+	err := t.Graph.Export(ctx, path, format)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -261,7 +355,7 @@ func (t *GraphExport) Execute(ctx context.Context, input map[string]any) (*Resul
 
 // GraphImport imports graph from file.
 type GraphImport struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphImport) Name() string { return "graph_import" }
@@ -276,11 +370,11 @@ func (t *GraphImport) Execute(ctx context.Context, input map[string]any) (*Resul
 		return TimedResult(NewErrorResult(fmt.Errorf("path is required")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	count, err := t.graph.Import(ctx, path)
+	count, err := t.Graph.Import(ctx, path)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -294,7 +388,7 @@ func (t *GraphImport) Execute(ctx context.Context, input map[string]any) (*Resul
 
 // GraphIngest ingests content into the knowledge graph.
 type GraphIngest struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphIngest) Name() string { return "graph_ingest" }
@@ -310,27 +404,92 @@ func (t *GraphIngest) Execute(ctx context.Context, input map[string]any) (*Resul
 	}
 
 	source, _ := input["source"].(string)
-	if source == "" {
-		source = "unknown"
+
+	if t.Graph == nil {
+		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
+	}
+
+	result, err := t.Graph.Ingest(ctx, content, source)
+	if err != nil {
+		return TimedResult(NewErrorResult(err), start), nil
+	}
+
+	result["ingested"] = true
+	result["length"] = len(content)
+	if source != "" {
+		result["source"] = source
+	}
+	return TimedResult(NewSuccessResult(result), start), nil
+}
+
+// GraphIndex indexes a directory tree into the knowledge graph.
+type GraphIndex struct {
+	Graph GraphService
+}
+
+func (t *GraphIndex) Name() string { return "graph_index" }
+
+func (t *GraphIndex) Description() string {
+	return "Index a directory tree into knowledge graph, re-ingesting only changed files"
+}
+
+func (t *GraphIndex) Execute(ctx context.Context, input map[string]any) (*Result, error) {
+	start := time.Now()
+
+	path, ok := input["path"].(string)
+	if !ok || path == "" {
+		return TimedResult(NewErrorResult(fmt.Errorf("path is required")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	// In production, this would extract entities and relations
-	// For now, return a placeholder result
-	return TimedResult(NewSuccessResult(map[string]any{
-		"ingested": true,
-		"source":   source,
-		"length":   len(content),
-		"message":  "Content ingested into graph",
-	}), start), nil
+	result, err := t.Graph.Index(ctx, path)
+	if err != nil {
+		return TimedResult(NewErrorResult(err), start), nil
+	}
+	return TimedResult(NewSuccessResult(result), start), nil
+}
+
+// DocsAsk answers a question from ingested documents, citing its sources.
+type DocsAsk struct {
+	Graph GraphService
+}
+
+func (t *DocsAsk) Name() string { return "docs_ask" }
+
+func (t *DocsAsk) Description() string {
+	return "Answer a question from ingested documents with [doc:path#chunk] citations"
+}
+
+func (t *DocsAsk) Execute(ctx context.Context, input map[string]any) (*Result, error) {
+	start := time.Now()
+
+	question, ok := input["question"].(string)
+	if !ok || question == "" {
+		return TimedResult(NewErrorResult(fmt.Errorf("question is required")), start), nil
+	}
+
+	k := 0
+	if v, ok := input["top_k"].(float64); ok {
+		k = int(v)
+	}
+
+	if t.Graph == nil {
+		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
+	}
+
+	result, err := t.Graph.AskDocs(ctx, question, k)
+	if err != nil {
+		return TimedResult(NewErrorResult(err), start), nil
+	}
+	return TimedResult(NewSuccessResult(result), start), nil
 }
 
 // GraphClear clears all graph data.
 type GraphClear struct {
-	graph GraphService
+	Graph GraphService
 }
 
 func (t *GraphClear) Name() string { return "graph_clear" }
@@ -345,11 +504,11 @@ func (t *GraphClear) Execute(ctx context.Context, input map[string]any) (*Result
 		return TimedResult(NewErrorResult(fmt.Errorf("confirm must be true to clear graph")), start), nil
 	}
 
-	if t.graph == nil {
+	if t.Graph == nil {
 		return TimedResult(NewErrorResult(fmt.Errorf("graph service not available")), start), nil
 	}
 
-	err := t.graph.Clear(ctx)
+	err := t.Graph.Clear(ctx)
 	if err != nil {
 		return TimedResult(NewErrorResult(err), start), nil
 	}
@@ -360,15 +519,20 @@ func (t *GraphClear) Execute(ctx context.Context, input map[string]any) (*Result
 }
 
 // GraphService defines the interface for graph operations.
-// This will be implemented by the actual graph service.
+// It is implemented by graph.Service for a single tenant.
 type GraphService interface {
 	Stats(ctx context.Context) (map[string]any, error)
 	Search(ctx context.Context, query string, limit int) ([]map[string]any, error)
 	Dump(ctx context.Context, format string, limit int) (any, error)
 	QueryRelations(ctx context.Context, entity string) ([]map[string]any, error)
+	Match(ctx context.Context, query string, limit int) (map[string]any, error)
+	Path(ctx context.Context, from, to string, relations []string, minConfidence float64, maxHops int) (map[string]any, error)
 	AddEntity(ctx context.Context, entity, entityType string, properties any) error
 	AddRelation(ctx context.Context, from, to, relation string) error
 	Export(ctx context.Context, path, format string) error
 	Import(ctx context.Context, path string) (int, error)
+	Ingest(ctx context.Context, content, source string) (map[string]any, error)
+	Index(ctx context.Context, path string) (map[string]any, error)
+	AskDocs(ctx context.Context, question string, k int) (map[string]any, error)
 	Clear(ctx context.Context) error
 }
@@ -53,9 +53,15 @@ func (r *Registry) Execute(ctx context.Context, name string, input map[string]an
 	return r.executors.Execute(ctx, name, input)
 }
 
+// Dependencies are the services injected into tools that need them.
+// Tools whose service is nil report that it is not available.
+type Dependencies struct {
+	Graph executor.GraphService
+}
+
 // Initialize registers all tools with their schemas and executors.
-// Simplified set: 18 essential tools for lightweight agent.
-func (r *Registry) Initialize() {
+// Simplified set: 22 essential tools for lightweight agent.
+func (r *Registry) Initialize(deps Dependencies) {
 	// === FILE TOOLS (6) ===
 	r.Register(&executor.FileRead{}, schemas.NewSchema("file_read", "Read file contents with line numbers").
 		AddParam("path", "string", "Absolute path to the file", true).
@@ -122,24 +128,47 @@ func (r *Registry) Initialize() {
 		AddParam("status", "string", "Filter by status (pending, in_progress, completed)", false).
 		Build())
 
-	// === GRAPH TOOLS (4) ===
-	r.Register(&executor.GraphStats{}, schemas.NewSchema("graph_stats", "Show knowledge graph statistics").
+	// === GRAPH TOOLS (7) ===
+	r.Register(&executor.GraphStats{Graph: deps.Graph}, schemas.NewSchema("graph_stats", "Show knowledge graph statistics").
 		Build())
 
-	r.Register(&executor.GraphSearch{}, schemas.NewSchema("graph_search", "Search the knowledge graph").
+	r.Register(&executor.GraphSearch{Graph: deps.Graph}, schemas.NewSchema("graph_search", "Search the knowledge graph").
 		AddParam("query", "string", "Search query", true).
 		AddParam("limit", "integer", "Maximum number of results", false).
 		Build())
 
-	r.Register(&executor.GraphIngest{}, schemas.NewSchema("graph_ingest", "Ingest content into knowledge graph").
+	r.Register(&executor.GraphIngest{Graph: deps.Graph}, schemas.NewSchema("graph_ingest", "Ingest content into knowledge graph").
 		AddParam("content", "string", "Content to ingest", true).
-		AddParam("source", "string", "Source identifier", false).
+		AddParam("source", "string", "Source identifier; ingesting the same source again replaces it", false).
 		Build())
 
-	r.Register(&executor.GraphQuery{}, schemas.NewSchema("graph_query", "Query graph relationships for an entity").
+	r.Register(&executor.GraphIndex{Graph: deps.Graph}, schemas.NewSchema("graph_index", "Index a directory tree into knowledge graph; only changed files are re-ingested and deleted files are removed").
+		AddParam("path", "string", "Directory to index; .gitignore rules, size limits and binary files are respected", true).
+		Build())
+
+	r.Register(&executor.GraphQuery{Graph: deps.Graph}, schemas.NewSchema("graph_query", "Query graph relationships for an entity").
 		AddParam("entity", "string", "Entity name to query", true).
 		Build())
 
+	r.Register(&executor.GraphMatch{Graph: deps.Graph}, schemas.NewSchema("graph_match", "Find patterns in the knowledge graph, e.g. MATCH (p:Person)-[:works_on]->(x)-[:uses*1..3]->(t) WHERE t.name = \"Postgres\" RETURN p, x").
+		AddParam("query", "string", "MATCH ... [WHERE ...] RETURN ... [LIMIT n]; labels are entity types, -[*1..3]-> spans several hops", true).
+		AddParam("limit", "integer", "Maximum number of rows when the query has no LIMIT", false).
+		Build())
+
+	r.Register(&executor.GraphPath{Graph: deps.Graph}, schemas.NewSchema("graph_path", "Find how two entities are connected; returns the shortest path as triples").
+		AddParam("from", "string", "Entity name to start from", true).
+		AddParam("to", "string", "Entity name to reach", true).
+		AddParam("relations", "array", "Relation types to follow (default all)", false).
+		AddParam("min_confidence", "number", "Ignore relations below this confidence (0-1)", false).
+		AddParam("max_hops", "integer", "Longest path to look for (default 4, at most 8)", false).
+		Build())
+
+	// === DOCS TOOLS (1) ===
+	r.Register(&executor.DocsAsk{Graph: deps.Graph}, schemas.NewSchema("docs_ask", "Answer a question from ingested documents; returns the answer with [doc:path#chunk] citations and the file and lines of each source").
+		AddParam("question", "string", "Question to answer", true).
+		AddParam("top_k", "integer", "Most document chunks to answer from (default 6)", false).
+		Build())
+
 	// === RESEARCH TOOLS (2) ===
 	r.Register(&executor.ResearchSearch{}, schemas.NewSchema("research_web_search", "Search the web").
 		AddParam("query", "string", "Search query", true).